@@ -0,0 +1,81 @@
+package coincount
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry records one write to the store.
+type AuditEntry struct {
+	ID int
+	// Time is the wall clock time of the write, not the business date of
+	// what was written.
+	Time      time.Time
+	User      string
+	Operation string
+	Entity    string
+	EntityID  string
+	// Before and After are the record as JSON around the write, null when
+	// it did not exist or was not kept.
+	Before json.RawMessage
+	After  json.RawMessage
+}
+
+type userKey struct{}
+
+// WithUser returns a context whose writes are audited as made by user.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user set by WithUser, or "".
+func UserFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// newAuditEntry describes operation on the entity with id, marshaling the
+// record before and after it.
+func newAuditEntry(ctx context.Context, operation, entity string, id, before, after interface{}) (AuditEntry, error) {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		User:      UserFrom(ctx),
+		Operation: operation,
+		Entity:    entity,
+		EntityID:  fmt.Sprint(id),
+	}
+
+	var err error
+	if entry.Before, err = json.Marshal(before); err != nil {
+		return entry, fmt.Errorf("auditing %s %v: %w", entity, id, err)
+	}
+	if entry.After, err = json.Marshal(after); err != nil {
+		return entry, fmt.Errorf("auditing %s %v: %w", entity, id, err)
+	}
+	return entry, nil
+}
+
+// audit appends an entry for a write to the audit log through db, which
+// should be the transaction making the write.
+func (d Dialect) audit(ctx context.Context, db querier, operation, entity string, id, before, after interface{}) error {
+	entry, err := newAuditEntry(ctx, operation, entity, id, before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.bind(db).ExecContext(ctx, `
+		INSERT INTO audit_log
+			(recorded_at, username, operation, entity, entity_id, before_json, after_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.Time.Unix(),
+		entry.User,
+		entry.Operation,
+		entry.Entity,
+		entry.EntityID,
+		string(entry.Before),
+		string(entry.After),
+	)
+	return err
+}
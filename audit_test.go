@@ -0,0 +1,52 @@
+package coincount
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewAuditEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		before     interface{}
+		after      interface{}
+		wantUser   string
+		wantBefore string
+		wantAfter  string
+	}{
+		{
+			name:       "save",
+			ctx:        context.Background(),
+			after:      VisaCard,
+			wantBefore: "null",
+			wantAfter:  `{"ID":1020,"Name":"Visa Card","Archived":false}`,
+		},
+		{
+			name:       "update by user",
+			ctx:        WithUser(context.Background(), "alice"),
+			before:     VisaCard,
+			after:      Account{ID: 1020, Name: "Visa"},
+			wantUser:   "alice",
+			wantBefore: `{"ID":1020,"Name":"Visa Card","Archived":false}`,
+			wantAfter:  `{"ID":1020,"Name":"Visa","Archived":false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := newAuditEntry(tt.ctx, "save", "account", 1020, tt.before, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.User != tt.wantUser || entry.EntityID != "1020" || entry.Time.IsZero() {
+				t.Errorf("newAuditEntry() = %+v", entry)
+			}
+			if string(entry.Before) != tt.wantBefore {
+				t.Errorf("newAuditEntry() Before = %s, want %s", entry.Before, tt.wantBefore)
+			}
+			if string(entry.After) != tt.wantAfter {
+				t.Errorf("newAuditEntry() After = %s, want %s", entry.After, tt.wantAfter)
+			}
+		})
+	}
+}
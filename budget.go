@@ -0,0 +1,233 @@
+package coincount
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidBudget = errors.New("Invalid Budget")
+
+// Budget is the activity expected in an account over one calendar month,
+// signed like balances with debits positive, so expense budgets are
+// positive and revenue budgets negative.
+type Budget struct {
+	Account Account
+	// Period is the first day of the month budgeted, at midnight UTC.
+	Period time.Time
+	Amount Money
+}
+
+// MonthStart returns the first day of the month t falls in, at midnight UTC.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidBudget listing
+// every field of b that cannot be saved.
+func (b Budget) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidBudget}
+
+	if b.Account.ID <= 0 {
+		invalid.add("account", "is missing")
+	}
+	if b.Period.IsZero() {
+		invalid.add("period", "is missing")
+	} else if !b.Period.Equal(MonthStart(b.Period)) {
+		invalid.add("period", "%s is not the start of a month", b.Period.Format("2006-01-02"))
+	}
+
+	return invalid.err()
+}
+
+// ParseBudgetCSV reads budgets in currency from CSV with a header row naming
+// the account, period and amount columns, in any order. Periods are written
+// YYYY-MM and amounts as decimals such as 150.00.
+func ParseBudgetCSV(r io.Reader, currency string) ([]Budget, error) {
+	in := csv.NewReader(r)
+	in.TrimLeadingSpace = true
+
+	header, err := in.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrInvalidBudget, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"account", "period", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: header has no %s column", ErrInvalidBudget, name)
+		}
+	}
+
+	var budgets []Budget
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			return budgets, nil
+		}
+		line, _ := in.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBudget, err)
+		}
+
+		var budget Budget
+		if budget.Account.ID, err = strconv.Atoi(record[columns["account"]]); err != nil {
+			return nil, fmt.Errorf("%w: line %d: account %q", ErrInvalidBudget, line, record[columns["account"]])
+		}
+		if budget.Period, err = time.Parse("2006-01", record[columns["period"]]); err != nil {
+			return nil, fmt.Errorf("%w: line %d: period %q is not YYYY-MM", ErrInvalidBudget, line, record[columns["period"]])
+		}
+		if budget.Amount, err = ParseMoney(record[columns["amount"]], currency, CentPrecision); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidBudget, line, err)
+		}
+
+		budgets = append(budgets, budget)
+	}
+}
+
+// ImportBudgets saves the budgets read from CSV as ParseBudgetCSV does, in
+// the functional currency of the books, replacing any already saved for the
+// same account and month. The budgets are saved together or not at all. It
+// returns the budgets saved.
+func ImportBudgets(ctx context.Context, store Store, r io.Reader) ([]Budget, error) {
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := ParseBudgetCSV(r, books.FunctionalCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Atomic(ctx, func(tx Store) error {
+		for _, budget := range budgets {
+			if err := tx.Budgets().Save(ctx, budget); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+// BudgetLine compares the budget for an account and month with the net
+// activity posted to the account in that month.
+type BudgetLine struct {
+	Account Account
+	Period  time.Time
+	Budget  Money
+	Actual  Money
+}
+
+// Variance is how far the actual activity is above the budget.
+func (l BudgetLine) Variance() Money {
+	return l.Actual.Sub(l.Budget)
+}
+
+// VariancePercent is the variance as a percentage of the budget. It is not
+// ok when the budget is zero.
+func (l BudgetLine) VariancePercent() (percent float64, ok bool) {
+	if l.Budget.IsZero() {
+		return 0, false
+	}
+
+	variance, budget, _, _ := l.Variance().align(l.Budget)
+	ratio := new(big.Rat).SetFrac(variance, budget)
+	percent, _ = ratio.Mul(ratio, big.NewRat(100, 1)).Float64()
+	return percent, true
+}
+
+// BudgetVsActual compares every budget with the lines of gl posted to its
+// account in its month, leaving out period closing entries. Lines are
+// ordered by account, then month.
+func BudgetVsActual(budgets []Budget, gl []GLTransaction) []BudgetLine {
+	type key struct {
+		account int
+		period  int64
+	}
+
+	actual := make(map[key]Money)
+	for _, line := range gl {
+		if isClosing(line) {
+			continue
+		}
+		k := key{line.Account.ID, MonthStart(line.Date).Unix()}
+		actual[k] = actual[k].Add(line.Debit).Sub(line.Credit)
+	}
+
+	lines := make([]BudgetLine, 0, len(budgets))
+	for _, budget := range budgets {
+		lines = append(lines, BudgetLine{
+			Account: budget.Account,
+			Period:  budget.Period,
+			Budget:  budget.Amount,
+			Actual:  budget.Amount.zero().Add(actual[key{budget.Account.ID, budget.Period.Unix()}]),
+		})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].Account.ID != lines[j].Account.ID {
+			return lines[i].Account.ID < lines[j].Account.ID
+		}
+		return lines[i].Period.Before(lines[j].Period)
+	})
+	return lines
+}
+
+// BudgetReport compares the budgets for the months from from up to to,
+// either of which may be zero to leave that side open, with what was
+// posted in them, for one account or all when accountID is 0.
+func BudgetReport(ctx context.Context, store Store, accountID int, from, to time.Time) ([]BudgetLine, error) {
+	opts := ListOptions{AccountID: accountID, From: from, To: to}
+
+	budgets, _, err := store.Budgets().List(ctx, opts)
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, budget := range budgets {
+		if c := budget.Amount.Currency(); c != books.FunctionalCurrency {
+			return nil, fmt.Errorf("%w: budget for account %d in %s is in %s, not %s",
+				ErrCurrencyMismatch, budget.Account.ID, budget.Period.Format("2006-01"), c, books.FunctionalCurrency)
+		}
+	}
+
+	// The ledger is listed from the first month budgeted to the end of the
+	// last, so that to need not fall on a month boundary.
+	opts.From = budgets[0].Period
+	opts.To = budgets[0].Period
+	for _, budget := range budgets {
+		if budget.Period.Before(opts.From) {
+			opts.From = budget.Period
+		}
+		if end := budget.Period.AddDate(0, 1, 0); end.After(opts.To) {
+			opts.To = end
+		}
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return BudgetVsActual(budgets, gl), nil
+}
@@ -0,0 +1,108 @@
+package coincount
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBudgetCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Budget
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			csv:  "period,account,amount\n2017-08,5000,150.00\n2017-09, 5000, 175.5\n",
+			want: []Budget{
+				{Account: Account{ID: 5000}, Period: time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC), Amount: Cents(15000)},
+				{Account: Account{ID: 5000}, Period: time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC), Amount: Cents(17550)},
+			},
+		},
+		{name: "header only", csv: "account,period,amount\n"},
+		{name: "missing column", csv: "account,amount\n5000,150.00\n", wantErr: true},
+		{name: "bad period", csv: "account,period,amount\n5000,2017-08-01,150.00\n", wantErr: true},
+		{name: "bad account", csv: "account,period,amount\nelectric,2017-08,150.00\n", wantErr: true},
+		{name: "bad amount", csv: "account,period,amount\n5000,2017-08,lots\n", wantErr: true},
+		{name: "empty", csv: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBudgetCSV(strings.NewReader(tt.csv), DefaultCurrency)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidBudget) {
+					t.Errorf("ParseBudgetCSV() error = %v, want ErrInvalidBudget", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseBudgetCSV() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Account != tt.want[i].Account || !got[i].Period.Equal(tt.want[i].Period) ||
+					got[i].Amount.Cmp(tt.want[i].Amount) != 0 {
+					t.Errorf("budget %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetVsActual(t *testing.T) {
+	august := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	september := august.AddDate(0, 1, 0)
+
+	budgets := []Budget{
+		{Account: RevenueEth, Period: august, Amount: Cents(-1000)},
+		{Account: CoinbaseFee, Period: september, Amount: Cents(0)},
+		{Account: CoinbaseFee, Period: august, Amount: Cents(200)},
+	}
+	gl := []GLTransaction{
+		{Date: august.AddDate(0, 0, 3), Account: CoinbaseFee, Debit: Cents(150), Credit: Cents(0)},
+		{Date: august.AddDate(0, 0, 20), Account: CoinbaseFee, Debit: Cents(100), Credit: Cents(0)},
+		{Date: august.AddDate(0, 0, 9), Account: RevenueEth, Debit: Cents(0), Credit: Cents(800)},
+		{Date: september.Add(-time.Second), Account: RevenueEth, Debit: Cents(800), Credit: Cents(0), Memo: "CLOSE-2017-08-01"},
+		{Date: september.AddDate(0, 0, 1), Account: CoinbaseFee, Debit: Cents(50), Credit: Cents(0)},
+	}
+
+	lines := BudgetVsActual(budgets, gl)
+
+	tests := []struct {
+		name     string
+		account  Account
+		period   time.Time
+		actual   int64
+		variance int64
+		percent  float64
+		noPct    bool
+	}{
+		{name: "revenue short", account: RevenueEth, period: august, actual: -800, variance: 200, percent: -20},
+		{name: "over budget", account: CoinbaseFee, period: august, actual: 250, variance: 50, percent: 25},
+		{name: "no budget", account: CoinbaseFee, period: september, actual: 50, variance: 50, noPct: true},
+	}
+	if len(lines) != len(tests) {
+		t.Fatalf("BudgetVsActual() = %+v", lines)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := lines[i]
+			if line.Account != tt.account || !line.Period.Equal(tt.period) {
+				t.Fatalf("line %d = %+v, want %v in %v", i, line, tt.account.Name, tt.period)
+			}
+			if line.Actual.Cmp(Cents(tt.actual)) != 0 || line.Variance().Cmp(Cents(tt.variance)) != 0 {
+				t.Errorf("actual %v variance %v, want %v and %v", line.Actual, line.Variance(), Cents(tt.actual), Cents(tt.variance))
+			}
+			percent, ok := line.VariancePercent()
+			if ok == tt.noPct || percent != tt.percent {
+				t.Errorf("VariancePercent() = %v, %v, want %v", percent, ok, tt.percent)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package coincount
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var ErrBrokenChain = errors.New("Broken Chain")
+
+// ChainLink ties a journal entry to the one saved before it when the books
+// keep a hash chain. Hash covers the entry's lines and Previous, so changing
+// any saved line or link breaks every link after it.
+type ChainLink struct {
+	Entry    int
+	Previous string
+	Hash     string
+}
+
+// EntryHash returns the hex SHA-256 of previous followed by lines, which
+// must be one journal entry as it is stored.
+func EntryHash(previous string, lines []GLTransaction) string {
+	sorted := append([]GLTransaction(nil), lines...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Account.ID < sorted[j].Account.ID
+	})
+
+	h := sha256.New()
+	io.WriteString(h, previous+"\n")
+	for _, line := range sorted {
+		fmt.Fprintf(h, "%d|%d|%d|%s|%s|%s|%q|%s|%s|%d\n",
+			line.ID,
+			line.Date.Unix(),
+			line.Account.ID,
+			line.Debit.Minor(),
+			line.Credit.Minor(),
+			currencyValue(line.Debit.Add(line.Credit).Currency()),
+			line.Memo,
+			line.Foreign.Currency(),
+			line.Foreign.Minor(),
+			line.Reverses,
+		)
+		// Sources are hashed only when set so that links made before they
+		// were kept still verify.
+		if !line.Source.IsZero() {
+			fmt.Fprintf(h, "source|%s|%d\n", line.Source.Type, line.Source.ID)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// splitEntries groups lines by journal entry in the order the entries first
+// appear.
+func splitEntries(lines []GLTransaction) [][]GLTransaction {
+	var (
+		entries [][]GLTransaction
+		index   = make(map[int]int)
+	)
+	for _, line := range lines {
+		i, ok := index[line.ID]
+		if !ok {
+			i = len(entries)
+			index[line.ID] = i
+			entries = append(entries, nil)
+		}
+		entries[i] = append(entries[i], line)
+	}
+	return entries
+}
+
+// nextLink chains the entry made of lines after last, the latest link or
+// nil if the chain is empty.
+func nextLink(last *ChainLink, lines []GLTransaction) ChainLink {
+	link := ChainLink{Entry: lines[0].ID}
+	if last != nil {
+		link.Previous = last.Hash
+	}
+	link.Hash = EntryHash(link.Previous, lines)
+	return link
+}
+
+// VerifyChain checks links, in the order they were made, against gl, which
+// is in ID order. Entries from before the chain was started are skipped. It
+// returns ErrBrokenChain describing the first link that does not hold.
+func VerifyChain(links []ChainLink, gl []GLTransaction) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	entries := make(map[int][]GLTransaction)
+	var ids []int
+	for _, line := range gl {
+		if _, ok := entries[line.ID]; !ok {
+			ids = append(ids, line.ID)
+		}
+		entries[line.ID] = append(entries[line.ID], line)
+	}
+
+	chained := make(map[int]bool, len(links))
+	previous := ""
+	for _, link := range links {
+		if link.Previous != previous {
+			return fmt.Errorf("%w: entry %d does not follow the link before it", ErrBrokenChain, link.Entry)
+		}
+
+		lines, ok := entries[link.Entry]
+		if !ok {
+			return fmt.Errorf("%w: entry %d is missing", ErrBrokenChain, link.Entry)
+		}
+		if EntryHash(link.Previous, lines) != link.Hash {
+			return fmt.Errorf("%w: entry %d has been altered", ErrBrokenChain, link.Entry)
+		}
+
+		chained[link.Entry] = true
+		previous = link.Hash
+	}
+
+	for _, id := range ids {
+		if id > links[0].Entry && !chained[id] {
+			return fmt.Errorf("%w: entry %d is not in the chain", ErrBrokenChain, id)
+		}
+	}
+
+	return nil
+}
+
+// VerifyLedger checks the hash chain of the general ledger in store.
+func VerifyLedger(ctx context.Context, store Store) error {
+	links, err := store.GLTransactions().Chain(ctx)
+	if err != nil {
+		return err
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	return VerifyChain(links, gl)
+}
@@ -0,0 +1,57 @@
+package coincount
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyChain(t *testing.T) {
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(id int, cents int64) []GLTransaction {
+		return []GLTransaction{
+			{ID: id, Date: date, Account: EthMain, Debit: Cents(cents), Credit: Cents(0)},
+			{ID: id, Date: date, Account: ElectricBill, Debit: Cents(0), Credit: Cents(cents)},
+		}
+	}
+
+	var (
+		gl    = append(append(entry(1, 100), entry(2, 200)...), entry(3, 300)...)
+		links []ChainLink
+	)
+	for _, lines := range splitEntries(gl[2:]) {
+		var last *ChainLink
+		if len(links) > 0 {
+			last = &links[len(links)-1]
+		}
+		links = append(links, nextLink(last, lines))
+	}
+
+	altered := append([]GLTransaction(nil), gl...)
+	altered[4].Debit = Cents(301)
+
+	broken := append([]ChainLink(nil), links...)
+	broken[1].Previous = "beef"
+
+	tests := []struct {
+		name    string
+		links   []ChainLink
+		gl      []GLTransaction
+		wantErr bool
+	}{
+		{name: "intact", links: links, gl: gl},
+		{name: "no chain", gl: gl},
+		{name: "altered line", links: links, gl: altered, wantErr: true},
+		{name: "missing entry", links: links, gl: gl[:4], wantErr: true},
+		{name: "broken link", links: broken, gl: gl, wantErr: true},
+		{name: "unchained entry", links: links, gl: append(gl, entry(4, 400)...), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyChain(tt.links, tt.gl)
+			if tt.wantErr != errors.Is(err, ErrBrokenChain) {
+				t.Errorf("VerifyChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
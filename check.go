@@ -0,0 +1,165 @@
+package coincount
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Problem is an integrity issue found by Check or CheckReferences.
+type Problem struct {
+	Check  string
+	Detail string
+}
+
+func (p Problem) String() string {
+	return p.Check + ": " + p.Detail
+}
+
+// foreignKeys lists the references between the tables as child table,
+// column and parent table.
+var foreignKeys = [][3]string{
+	{"gl_transaction", "account_id", "account"},
+	{"inventory_transaction", "account_id", "account"},
+	{"inventory_transaction", "item_id", "item"},
+	{"purchase", "vendor_id", "vendor"},
+	{"purchase", "payable_acct_id", "account"},
+	{"purchase_item", "purchase_id", "purchase"},
+	{"purchase_item", "item_id", "item"},
+	{"purchase_item", "inventory_account_id", "account"},
+	{"posted_purchase", "purchase_id", "purchase"},
+	{"vendor_payment", "vendor_id", "vendor"},
+	{"vendor_payment", "payable_acct_id", "account"},
+	{"vendor_payment", "payment_acct_id", "account"},
+	{"payment_application", "payment_id", "vendor_payment"},
+	{"payment_application", "purchase_id", "purchase"},
+	{"invoice", "customer_id", "customer"},
+	{"invoice", "receivable_acct_id", "account"},
+	{"invoice_line", "invoice_id", "invoice"},
+	{"invoice_line", "item_id", "item"},
+	{"invoice_line", "account_id", "account"},
+	{"invoice_line", "inventory_account_id", "account"},
+	{"invoice_line", "cost_account_id", "account"},
+	{"customer_receipt", "customer_id", "customer"},
+	{"customer_receipt", "receivable_acct_id", "account"},
+	{"customer_receipt", "deposit_acct_id", "account"},
+	{"receipt_application", "receipt_id", "customer_receipt"},
+	{"receipt_application", "invoice_id", "invoice"},
+	{"recurring_instance", "template_id", "recurring_template"},
+	{"budget", "account_id", "account"},
+}
+
+// CheckReferences looks for rows that refer to missing records, which SQLite
+// accepted before foreign keys were enforced.
+func CheckReferences(ctx context.Context, db *sql.DB) ([]Problem, error) {
+	var problems []Problem
+	for _, fk := range foreignKeys {
+		child, column, parent := fk[0], fk[1], fk[2]
+
+		var orphans int
+		err := db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM `+child+`
+			WHERE `+child+`.`+column+` IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM `+parent+` WHERE `+parent+`.id = `+child+`.`+column+`
+			)`).Scan(&orphans)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s.%s: %w", child, column, err)
+		}
+
+		if orphans > 0 {
+			problems = append(problems, Problem{
+				Check:  "orphan",
+				Detail: fmt.Sprintf("%d %s rows refer to a missing %s by %s", orphans, child, parent, column),
+			})
+		}
+	}
+	return problems, nil
+}
+
+// Check looks through store for unbalanced journal entries, inventory
+// transactions whose value disagrees with the general ledger lines posted
+// with them and items whose quantity on hand goes negative.
+func Check(ctx context.Context, store Store) ([]Problem, error) {
+	gl, _, err := store.GLTransactions().List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	inv, _, err := store.InventoryTransactions().List(ctx, ListOptions{SortBy: "date"})
+	if err != nil {
+		return nil, err
+	}
+
+	problems := checkBalanced(gl)
+	problems = append(problems, checkPosted(inv, gl)...)
+	problems = append(problems, checkOnHand(inv)...)
+	return problems, nil
+}
+
+// checkBalanced reports every unbalanced entry in gl, which is in ID order.
+func checkBalanced(gl []GLTransaction) []Problem {
+	var problems []Problem
+	for start := 0; start < len(gl); {
+		end := start + 1
+		for end < len(gl) && gl[end].ID == gl[start].ID {
+			end++
+		}
+
+		if err := CheckBalanced(gl[start:end]); err != nil {
+			problems = append(problems, Problem{Check: "unbalanced", Detail: err.Error()})
+		}
+		start = end
+	}
+	return problems
+}
+
+// checkPosted reports the entries whose inventory transactions and general
+// ledger lines disagree.
+func checkPosted(inv []InventoryTransaction, gl []GLTransaction) []Problem {
+	reconciliations, err := Reconcile(inv, gl)
+	if err != nil {
+		return []Problem{{Check: "mismatch", Detail: err.Error()}}
+	}
+
+	var problems []Problem
+	for _, r := range reconciliations {
+		for _, d := range r.Discrepancies {
+			problems = append(problems, Problem{
+				Check:  "mismatch",
+				Detail: r.Account.Name + " " + d.String(),
+			})
+		}
+	}
+	return problems
+}
+
+// checkOnHand reports the first inventory transaction, in date order, that
+// takes an item in an account below zero.
+func checkOnHand(inv []InventoryTransaction) []Problem {
+	type key struct {
+		account, item int
+	}
+
+	var (
+		onHand   = make(map[key]Quantity)
+		reported = make(map[key]bool)
+		problems []Problem
+	)
+
+	for _, transaction := range inv {
+		k := key{transaction.Account.ID, transaction.Item.ID}
+		onHand[k] = onHand[k].Add(transaction.QtyIn).Sub(transaction.QtyOut)
+		if onHand[k].Sign() >= 0 || reported[k] {
+			continue
+		}
+
+		reported[k] = true
+		problems = append(problems, Problem{
+			Check: "negative",
+			Detail: fmt.Sprintf("%s in %s is %v after inventory transaction %d on %s",
+				transaction.Item.Name, transaction.Account.Name, onHand[k],
+				transaction.ID, transaction.Date.Format("2006-01-02")),
+		})
+	}
+	return problems
+}
@@ -0,0 +1,153 @@
+package coincount
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	store := seededMemoryStore(t)
+
+	for day := 1; day <= 2; day++ {
+		date := time.Date(2017, 8, day, 0, 0, 0, 0, time.UTC)
+		id, err := store.Purchases().Save(ctx, MiningPayout(date, ether("0.5"), Cents(30000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		purchase, err := store.Purchases().Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = RecordPurchase(ctx, store, purchase); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := Check(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Check() = %v, want no problems", problems)
+	}
+}
+
+func TestCheckBalanced(t *testing.T) {
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		gl   []GLTransaction
+		want []string
+	}{
+		{
+			name: "balanced",
+			gl: []GLTransaction{
+				{ID: 1, Date: date, Account: EthMain, Debit: Cents(100)},
+				{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(100)},
+			},
+		},
+		{
+			name: "unbalanced",
+			gl: []GLTransaction{
+				{ID: 1, Date: date, Account: EthMain, Debit: Cents(100)},
+				{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(100)},
+				{ID: 2, Date: date, Account: EthMain, Debit: Cents(100)},
+				{ID: 2, Date: date, Account: ElectricBill, Credit: Cents(90)},
+			},
+			want: []string{"unbalanced"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checks(checkBalanced(tt.gl)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkBalanced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPosted(t *testing.T) {
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	inv := []InventoryTransaction{
+		{ID: 1, Date: date, Account: EthMain, Item: Ether, QtyIn: ether("1"), Cost: NewUnitCost(Cents(100), ether("1")), Memo: "payout"},
+	}
+
+	tests := []struct {
+		name string
+		gl   []GLTransaction
+		want []string
+	}{
+		{
+			name: "posted",
+			gl: []GLTransaction{
+				{ID: 1, Date: date, Account: EthMain, Debit: Cents(100), Memo: "payout"},
+				{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(100), Memo: "payout"},
+			},
+		},
+		{
+			name: "not posted",
+			want: []string{"mismatch"},
+		},
+		{
+			name: "wrong amount",
+			gl: []GLTransaction{
+				{ID: 1, Date: date, Account: EthMain, Debit: Cents(90), Memo: "payout"},
+				{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(90), Memo: "payout"},
+			},
+			want: []string{"mismatch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checks(checkPosted(inv, tt.gl)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkPosted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOnHand(t *testing.T) {
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		inv  []InventoryTransaction
+		want []string
+	}{
+		{
+			name: "positive",
+			inv: []InventoryTransaction{
+				{ID: 1, Date: date, Account: EthMain, Item: Ether, QtyIn: ether("1")},
+				{ID: 2, Date: date.AddDate(0, 0, 1), Account: EthMain, Item: Ether, QtyOut: ether("1")},
+			},
+		},
+		{
+			name: "negative once",
+			inv: []InventoryTransaction{
+				{ID: 1, Date: date, Account: EthMain, Item: Ether, QtyOut: ether("1")},
+				{ID: 2, Date: date.AddDate(0, 0, 1), Account: EthMain, Item: Ether, QtyOut: ether("1")},
+			},
+			want: []string{"negative"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checks(checkOnHand(tt.inv)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkOnHand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// checks returns the name of the check behind each problem.
+func checks(problems []Problem) []string {
+	var names []string
+	for _, p := range problems {
+		names = append(names, p.Check)
+	}
+	return names
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runAudit(ctx context.Context, db *sql.DB, args []string) error {
+	var opts coincount.ListOptions
+
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	flags.StringVar(&opts.Search, "entity", "", "only entities containing this text, such as account")
+	from := flags.String("from", "", "first date recorded, YYYY-MM-DD")
+	to := flags.String("to", "", "date recorded to stop before, YYYY-MM-DD")
+	flags.BoolVar(&opts.Descending, "desc", false, "newest first")
+	flags.IntVar(&opts.Limit, "limit", 50, "page size, 0 for everything")
+	flags.StringVar(&opts.Cursor, "cursor", "", "cursor of the page to show")
+	verbose := flags.Bool("v", false, "show the records before and after each write")
+	flags.Parse(args)
+
+	var err error
+	if opts.From, err = parseDate(*from); err != nil {
+		return err
+	}
+	if opts.To, err = parseDate(*to); err != nil {
+		return err
+	}
+
+	entries, cursor, err := store(db).Audit().List(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tUSER\tOPERATION\tENTITY\tENTITY ID")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			entry.ID, entry.Time.Format("2006-01-02 15:04:05"), entry.User,
+			entry.Operation, entry.Entity, entry.EntityID)
+		if *verbose {
+			fmt.Fprintf(w, "\tbefore: %s\n\tafter:  %s\n", entry.Before, entry.After)
+		}
+	}
+	w.Flush()
+
+	if cursor != "" {
+		fmt.Println("next page: -cursor", cursor)
+	}
+	return nil
+}
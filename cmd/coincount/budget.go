@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runBudget(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount budget import|list|report [flags]")
+	}
+
+	flags := flag.NewFlagSet("budget "+args[0], flag.ExitOnError)
+	account := flags.Int("account", 0, "account ID, all accounts if 0")
+	from := flags.String("from", "", "first month, YYYY-MM")
+	to := flags.String("to", "", "last month, YYYY-MM")
+
+	// months parses -from and -to into the range they cover, -to inclusive.
+	months := func() (time.Time, time.Time, error) {
+		start, err := parseMonth(*from)
+		if err != nil {
+			return start, time.Time{}, err
+		}
+		end, err := parseMonth(*to)
+		if err != nil || end.IsZero() {
+			return start, end, err
+		}
+		return start, end.AddDate(0, 1, 0), nil
+	}
+
+	switch args[0] {
+	case "import":
+		file := flags.String("file", "", "CSV file with account, period and amount columns")
+		flags.Parse(args[1:])
+
+		if *file == "" {
+			return errors.New("import requires -file")
+		}
+
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		budgets, err := coincount.ImportBudgets(ctx, store(db), f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *file, err)
+		}
+		fmt.Printf("%d budgets imported\n", len(budgets))
+		return nil
+
+	case "list":
+		flags.Parse(args[1:])
+
+		start, end, err := months()
+		if err != nil {
+			return err
+		}
+
+		budgets, _, err := store(db).Budgets().List(ctx, coincount.ListOptions{
+			AccountID: *account,
+			From:      start,
+			To:        end,
+		})
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tNAME\tPERIOD\tBUDGET")
+		for _, budget := range budgets {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%v\n",
+				budget.Account.ID, budget.Account.Name, budget.Period.Format("2006-01"), budget.Amount)
+		}
+		return w.Flush()
+
+	case "report":
+		flags.Parse(args[1:])
+
+		start, end, err := months()
+		if err != nil {
+			return err
+		}
+
+		lines, err := coincount.BudgetReport(ctx, store(db), *account, start, end)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tNAME\tPERIOD\tBUDGET\tACTUAL\tVARIANCE\tVARIANCE %")
+		for _, line := range lines {
+			percent := "-"
+			if p, ok := line.VariancePercent(); ok {
+				percent = fmt.Sprintf("%.1f%%", p)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%v\t%s\n",
+				line.Account.ID, line.Account.Name, line.Period.Format("2006-01"),
+				line.Budget, line.Actual, line.Variance(), percent)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown budget command %q", args[0])
+}
+
+// parseMonth parses a YYYY-MM month into its first day, or returns the zero
+// time for "".
+func parseMonth(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01", value)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runChain(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount chain enable|verify")
+	}
+
+	switch args[0] {
+	case "enable":
+		books, err := store(db).Books().Get(ctx)
+		if err != nil {
+			return err
+		}
+		books.HashChain = true
+		return store(db).Books().Save(ctx, books)
+
+	case "verify":
+		if err := coincount.VerifyLedger(ctx, store(db)); err != nil {
+			return err
+		}
+		fmt.Println("ok")
+		return nil
+	}
+
+	return fmt.Errorf("unknown chain command %q", args[0])
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runDB(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 || args[0] != "check" {
+		return errors.New("usage: coincount db check")
+	}
+
+	problems, err := coincount.CheckReferences(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	more, err := coincount.Check(ctx, store(db))
+	if err != nil {
+		return err
+	}
+	problems = append(problems, more...)
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	fmt.Println("ok")
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runFX(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount fx books|rate|revalue [flags]")
+	}
+
+	flags := flag.NewFlagSet("fx "+args[0], flag.ExitOnError)
+	date := flags.String("date", "", "date, YYYY-MM-DD")
+
+	switch args[0] {
+	case "books":
+		functional := flags.String("functional", "", "currency the ledger is kept in")
+		reporting := flags.String("reporting", "", "currency reports are translated into")
+		flags.Parse(args[1:])
+
+		books, err := store(db).Books().Get(ctx)
+		if err != nil {
+			return err
+		}
+
+		if *functional != "" || *reporting != "" {
+			if *functional != "" {
+				books.FunctionalCurrency = *functional
+			}
+			if *reporting != "" {
+				books.ReportingCurrency = *reporting
+			}
+			if err = store(db).Books().Save(ctx, books); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("functional %s, reporting %s\n", books.FunctionalCurrency, books.ReportingCurrency)
+		return nil
+
+	case "rate":
+		base := flags.String("base", "", "currency the rate prices")
+		quote := flags.String("quote", "", "currency the rate is quoted in")
+		value := flags.String("rate", "", "units of -quote one unit of -base was worth, e.g. 1.1")
+		flags.Parse(args[1:])
+
+		if *base == "" || *quote == "" || *value == "" || *date == "" {
+			return errors.New("rate requires -base, -quote, -rate and -date")
+		}
+
+		rate := coincount.FXRate{Base: *base, Quote: *quote}
+		var ok bool
+		if rate.Rate, ok = new(big.Rat).SetString(*value); !ok || rate.Rate.Sign() <= 0 {
+			return fmt.Errorf("invalid rate %q", *value)
+		}
+
+		var err error
+		if rate.Date, err = parseDate(*date); err != nil {
+			return err
+		}
+
+		if err = store(db).FXRates().Save(ctx, rate); err != nil {
+			return err
+		}
+		fmt.Println(rate)
+		return nil
+
+	case "revalue":
+		account := flags.Int("account", 0, "account holding foreign currency balances")
+		gainLoss := flags.Int("gain-loss", coincount.UnrealizedFX.ID, "account the differences are posted to")
+		flags.Parse(args[1:])
+
+		if *account == 0 || *date == "" {
+			return errors.New("revalue requires -account and -date")
+		}
+
+		on, err := parseDate(*date)
+		if err != nil {
+			return err
+		}
+
+		acct, err := store(db).Accounts().Get(ctx, *account)
+		if err != nil {
+			return err
+		}
+		offset, err := store(db).Accounts().Get(ctx, *gainLoss)
+		if err != nil {
+			return err
+		}
+
+		gl, err := coincount.RevalueAccount(ctx, store(db), on, acct, offset)
+		if err != nil {
+			return err
+		}
+		if len(gl) == 0 {
+			fmt.Println("nothing to revalue")
+		}
+		for _, line := range gl {
+			fmt.Printf("entry %d %s: %s debit %v credit %v\n", line.ID, line.Memo, line.Account.Name, line.Debit, line.Credit)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown fx command %q", args[0])
+}
+
+// translateBalances converts balances into the reporting currency at the
+// rate before end, or the latest rate when end is zero.
+func translateBalances(ctx context.Context, db *sql.DB, balances []coincount.AccountBalance, end time.Time) ([]coincount.AccountBalance, error) {
+	books, err := store(db).Books().Get(ctx)
+	if err != nil || books.ReportingCurrency == books.FunctionalCurrency {
+		return balances, err
+	}
+
+	on := time.Now()
+	if !end.IsZero() {
+		on = end.Add(-time.Second)
+	}
+
+	rate, err := store(db).FXRates().Get(ctx, books.FunctionalCurrency, books.ReportingCurrency, on)
+	if err != nil {
+		return nil, err
+	}
+	return books.Translate(balances, rate)
+}
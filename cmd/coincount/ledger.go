@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runLedger(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("ledger", flag.ExitOnError)
+	account := flags.Int("account", 0, "account to list")
+	from := flags.String("from", "", "first date, YYYY-MM-DD")
+	to := flags.String("to", "", "date to stop before, YYYY-MM-DD")
+	format := flags.String("format", "table", "output format: table, csv or json")
+	flags.Parse(args)
+
+	if *account == 0 {
+		return errors.New("ledger requires -account")
+	}
+
+	start, err := parseDate(*from)
+	if err != nil {
+		return err
+	}
+	end, err := parseDate(*to)
+	if err != nil {
+		return err
+	}
+
+	ledger, err := coincount.AccountLedgerReport(ctx, store(db), *account, start, end)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "csv":
+		return ledger.WriteCSV(os.Stdout)
+	case "json":
+		return ledger.WriteJSON(os.Stdout)
+	case "table":
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%d %s\n", ledger.Account.ID, ledger.Account.Name)
+	fmt.Fprintln(w, "ENTRY\tDATE\tMEMO\tSOURCE\tDEBIT\tCREDIT\tBALANCE")
+	fmt.Fprintf(w, "\t\tOpening balance\t\t\t\t%v\n", ledger.Opening)
+	for _, line := range ledger.Lines {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%v\t%v\t%v\n",
+			line.Entry, line.Date.Format("2006-01-02"), line.Memo, line.Source,
+			line.Debit, line.Credit, line.Balance)
+	}
+	fmt.Fprintf(w, "\t\tClosing balance\t\t\t\t%v\n", ledger.Closing)
+	return w.Flush()
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
+	"sort"
 	"time"
 
 	"github.com/ebittleman/coincount"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -17,37 +22,202 @@ const (
 	ElectricityPerETH = float64(102.0)
 )
 
+// dialect is the database the commands run against: Postgres when
+// COINCOUNT_POSTGRES_DSN is set, otherwise SQLite in the home directory.
+var dialect = coincount.SQLite
+
+func store(db *sql.DB) coincount.SQLStore {
+	return coincount.SQLStore{DB: db, Dialect: dialect}
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, db *sql.DB, args []string) error
+}
+
+var commands = map[string]command{
+	"init": {
+		usage: "load the fixtures into a new database",
+		run: func(ctx context.Context, db *sql.DB, args []string) error {
+			initDB(ctx, db)
+			return nil
+		},
+	},
+	"import": {
+		usage: "register the mining payouts in data/mining.json as purchases",
+		run: func(ctx context.Context, db *sql.DB, args []string) error {
+			insertPurchases(ctx, db)
+			return nil
+		},
+	},
+	"post": {
+		usage: "[-from ID] [-to ID] post purchases to the ledger",
+		run:   runPost,
+	},
+	"account": {
+		usage: "list|update|archive manage accounts",
+		run:   runAccount,
+	},
+	"item": {
+		usage: "list|update|archive manage inventory items",
+		run:   runItem,
+	},
+	"vendor": {
+		usage: "list|update|archive manage vendors",
+		run:   runVendor,
+	},
+	"customer": {
+		usage: "list|update|archive manage customers",
+		run:   runCustomer,
+	},
+	"db": {
+		usage: "check verify the integrity of the database",
+		run:   runDB,
+	},
+	"reconcile": {
+		usage: "[-account ID] [-from DATE] [-to DATE] compare inventory with the ledger",
+		run:   runReconcile,
+	},
+	"period": {
+		usage: "list|add|close|reopen manage fiscal periods",
+		run:   runPeriod,
+	},
+	"reverse": {
+		usage: "-entry ID -date DATE [-reason TEXT] reverse a journal entry",
+		run:   runReverse,
+	},
+	"balance": {
+		usage: "[-from DATE] [-to DATE] [-net] [-translate] show the trial balance",
+		run:   runBalance,
+	},
+	"ledger": {
+		usage: "-account ID [-from DATE] [-to DATE] [-format table|csv|json] list an account's lines with a running balance",
+		run:   runLedger,
+	},
+	"source": {
+		usage: "[-type TYPE] -id ID list everything posted from a document",
+		run:   runSource,
+	},
+	"payable": {
+		usage: "pay|open|balances|aging [-vendor ID] pay vendors and report what is owed",
+		run:   runPayable,
+	},
+	"receivable": {
+		usage: "invoice|receive|open|balances|aging [-customer ID] invoice customers and report what they owe",
+		run:   runReceivable,
+	},
+	"recurring": {
+		usage: "list|add|run [-through DATE] [-post] manage recurring templates and generate what is due",
+		run:   runRecurring,
+	},
+	"budget": {
+		usage: "import|list|report [-account ID] [-from YYYY-MM] [-to YYYY-MM] import budgets and compare them with the ledger",
+		run:   runBudget,
+	},
+	"audit": {
+		usage: "[-entity NAME] [-from DATE] [-to DATE] [-v] browse the audit log",
+		run:   runAudit,
+	},
+	"fx": {
+		usage: "books|rate|revalue set the currencies, record exchange rates and revalue foreign balances",
+		run:   runFX,
+	},
+	"chain": {
+		usage: "enable|verify hash chain journal entries or check the chain",
+		run:   runChain,
+	},
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: coincount <command> [arguments]")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	homeDir, ok := os.LookupEnv("USERPROFILE")
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
 	if !ok {
-		log.Fatal("Could not locate home directory")
+		usage()
+		os.Exit(2)
+	}
+
+	dsn, ok := os.LookupEnv("COINCOUNT_POSTGRES_DSN")
+	if ok {
+		dialect = coincount.Postgres
+	} else {
+		homeDir, ok := os.LookupEnv("USERPROFILE")
+		if !ok {
+			log.Fatal("Could not locate home directory")
+		}
+		dsn = path.Join(homeDir, "db.sqlite")
 	}
 
-	db, err := sql.Open("sqlite3", path.Join(homeDir, "db.sqlite"))
+	db, err := coincount.Open(dialect, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
-	// initDB(ctx, db)
+	if err = coincount.Migrate(ctx, db, dialect); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, env := range []string{"USER", "USERNAME"} {
+		if user, ok := os.LookupEnv(env); ok {
+			ctx = coincount.WithUser(ctx, user)
+			break
+		}
+	}
 
-	// insertPurchases(ctx, db)
+	if err = cmd.run(ctx, db, os.Args[2:]); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs err and exits. Validation errors list one field per line.
+func fatal(err error) {
+	var invalid *coincount.ValidationError
+	if !errors.As(err, &invalid) {
+		log.Fatal(err)
+	}
+
+	log.Println(invalid.Err)
+	for _, field := range invalid.Fields {
+		fmt.Fprintf(os.Stderr, "  %s\n", field)
+	}
+	os.Exit(1)
+}
 
-	// readPurchase(ctx, db, 1)
+func runPost(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("post", flag.ExitOnError)
+	from := flags.Int("from", 1, "first purchase ID to post")
+	to := flags.Int("to", 10, "last purchase ID to post")
+	flags.Parse(args)
 
-	for i := 1; i <= 10; i++ {
+	for i := *from; i <= *to; i++ {
 		postPurchase(ctx, db, readPurchase(ctx, db, i))
 	}
+
+	return nil
 }
 
 func readPurchase(ctx context.Context, db *sql.DB, id int) coincount.Purchase {
-	table := coincount.PurchaseTable{
-		DB: db,
-	}
-	purchase, err := table.Get(ctx, id)
+	purchase, err := store(db).Purchases().Get(ctx, id)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -56,36 +226,17 @@ func readPurchase(ctx context.Context, db *sql.DB, id int) coincount.Purchase {
 }
 
 func postPurchase(ctx context.Context, db *sql.DB, purchase coincount.Purchase) {
-
-	inventoryTable := coincount.InventoryTransactionTable{
-		DB: db,
-	}
-
-	glTable := coincount.GLTransactionTable{
-		DB: db,
-	}
-
-	nextId, err := glTable.NextID(ctx)
+	inv, gl, err := coincount.RecordPurchase(ctx, store(db), purchase)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
-	log.Println("Next GL Transactions:", nextId)
-
-	inv, gl := coincount.PostPurchase(purchase.Date, purchase, nextId)
 
 	for _, transaction := range inv {
-		id, err := inventoryTable.Save(ctx, transaction)
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Println("Recorded Inventory Transaction:", id)
+		log.Println("Recorded Inventory Transaction:", transaction.ID)
 	}
 
 	log.Println("Inventory Transactions:", inv)
 	log.Println("GL Transactions:", gl)
-	if err = glTable.Save(ctx, gl); err != nil {
-		log.Fatal(err)
-	}
 }
 
 func insertPurchases(ctx context.Context, db *sql.DB) {
@@ -109,35 +260,27 @@ func insertPurchases(ctx context.Context, db *sql.DB) {
 	}
 
 	for _, call := range calls {
-		qty := coincount.ParseEtherFloatToWei(call.Qty)
-		purchase := coincount.MiningPayout(call.Date, qty, call.Cost)
-		table := coincount.PurchaseTable{
-			DB: db,
-		}
-
-		id, err := table.Save(ctx, purchase)
+		wei, err := coincount.ParseEther(call.Qty)
 		if err != nil {
 			log.Fatal(err)
 		}
+		purchase := coincount.MiningPayout(call.Date, coincount.Wei(wei), coincount.Cents(call.Cost))
+		id, err := store(db).Purchases().Save(ctx, purchase)
+		if err != nil {
+			fatal(err)
+		}
 		log.Println("Registered Purchase:", id)
 
 	}
 }
 
 func initDB(ctx context.Context, db *sql.DB) {
-	_, err := db.Exec(coincount.SQLDbCreate)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	insertFixtures(ctx, db)
 }
 
 func insertFixtures(ctx context.Context, db *sql.DB) {
 	var err error
-	accountTable := coincount.AccountTable{
-		DB: db,
-	}
+	accountTable := store(db).Accounts()
 	for _, acct := range coincount.GLAccounts {
 		err = accountTable.Save(ctx, acct)
 		if err != nil {
@@ -145,9 +288,7 @@ func insertFixtures(ctx context.Context, db *sql.DB) {
 		}
 	}
 
-	inventoryTable := coincount.ItemTable{
-		DB: db,
-	}
+	inventoryTable := store(db).Items()
 	for _, item := range coincount.InventoryItems {
 		err = inventoryTable.Save(ctx, item)
 		if err != nil {
@@ -155,13 +296,19 @@ func insertFixtures(ctx context.Context, db *sql.DB) {
 		}
 	}
 
-	vendorTable := coincount.VendorTable{
-		DB: db,
-	}
+	vendorTable := store(db).Vendors()
 	for _, vendor := range coincount.Vendors {
 		err = vendorTable.Save(ctx, vendor)
 		if err != nil {
 			log.Println(err)
 		}
 	}
+
+	customerTable := store(db).Customers()
+	for _, customer := range coincount.Customers {
+		err = customerTable.Save(ctx, customer)
+		if err != nil {
+			log.Println(err)
+		}
+	}
 }
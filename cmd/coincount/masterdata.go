@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebittleman/coincount"
+)
+
+// masterData wires the list, update and archive subcommands shared by
+// accounts, items, vendors and customers to one table.
+type masterData struct {
+	name    string
+	list    func(ctx context.Context, opts coincount.ListOptions, w *tabwriter.Writer) (string, error)
+	update  func(ctx context.Context, id int, name string) error
+	archive func(ctx context.Context, id int) error
+}
+
+func (m masterData) run(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: coincount %s list|update|archive [flags]", m.name)
+	}
+
+	flags := flag.NewFlagSet(m.name+" "+args[0], flag.ExitOnError)
+	id := flags.Int("id", 0, m.name+" ID")
+
+	switch args[0] {
+	case "list":
+		var opts coincount.ListOptions
+		flags.StringVar(&opts.Search, "search", "", "only names containing this text")
+		flags.BoolVar(&opts.IncludeArchived, "all", false, "include archived records")
+		flags.StringVar(&opts.SortBy, "sort", "id", "sort by id or name")
+		flags.BoolVar(&opts.Descending, "desc", false, "sort descending")
+		flags.IntVar(&opts.Limit, "limit", 0, "page size, 0 for everything")
+		flags.StringVar(&opts.Cursor, "cursor", "", "cursor of the page to show")
+		flags.Parse(args[1:])
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tARCHIVED")
+		cursor, err := m.list(ctx, opts, w)
+		if err != nil {
+			return err
+		}
+		w.Flush()
+
+		if cursor != "" {
+			fmt.Println("next page: -cursor", cursor)
+		}
+		return nil
+
+	case "update":
+		name := flags.String("name", "", "new name")
+		flags.Parse(args[1:])
+
+		if *id == 0 || *name == "" {
+			return errors.New("update requires -id and -name")
+		}
+		return m.update(ctx, *id, *name)
+
+	case "archive":
+		flags.Parse(args[1:])
+
+		if *id == 0 {
+			return errors.New("archive requires -id")
+		}
+		return m.archive(ctx, *id)
+	}
+
+	return fmt.Errorf("unknown %s command %q", m.name, args[0])
+}
+
+func runAccount(ctx context.Context, db *sql.DB, args []string) error {
+	table := store(db).Accounts()
+
+	return masterData{
+		name: "account",
+		list: func(ctx context.Context, opts coincount.ListOptions, w *tabwriter.Writer) (string, error) {
+			accts, cursor, err := table.List(ctx, opts)
+			for _, acct := range accts {
+				fmt.Fprintf(w, "%d\t%s\t%t\n", acct.ID, acct.Name, acct.Archived)
+			}
+			return cursor, err
+		},
+		update: func(ctx context.Context, id int, name string) error {
+			return table.Update(ctx, coincount.Account{ID: id, Name: name})
+		},
+		archive: table.Archive,
+	}.run(ctx, args)
+}
+
+func runItem(ctx context.Context, db *sql.DB, args []string) error {
+	table := store(db).Items()
+
+	return masterData{
+		name: "item",
+		list: func(ctx context.Context, opts coincount.ListOptions, w *tabwriter.Writer) (string, error) {
+			items, cursor, err := table.List(ctx, opts)
+			for _, item := range items {
+				fmt.Fprintf(w, "%d\t%s\t%t\n", item.ID, item.Name, item.Archived)
+			}
+			return cursor, err
+		},
+		update: func(ctx context.Context, id int, name string) error {
+			return table.Update(ctx, coincount.Item{ID: id, Name: name})
+		},
+		archive: table.Archive,
+	}.run(ctx, args)
+}
+
+func runVendor(ctx context.Context, db *sql.DB, args []string) error {
+	table := store(db).Vendors()
+
+	return masterData{
+		name: "vendor",
+		list: func(ctx context.Context, opts coincount.ListOptions, w *tabwriter.Writer) (string, error) {
+			vendors, cursor, err := table.List(ctx, opts)
+			for _, vendor := range vendors {
+				fmt.Fprintf(w, "%d\t%s\t%t\n", vendor.ID, vendor.Name, vendor.Archived)
+			}
+			return cursor, err
+		},
+		update: func(ctx context.Context, id int, name string) error {
+			return table.Update(ctx, coincount.Vendor{ID: id, Name: name})
+		},
+		archive: table.Archive,
+	}.run(ctx, args)
+}
+
+func runCustomer(ctx context.Context, db *sql.DB, args []string) error {
+	table := store(db).Customers()
+
+	return masterData{
+		name: "customer",
+		list: func(ctx context.Context, opts coincount.ListOptions, w *tabwriter.Writer) (string, error) {
+			customers, cursor, err := table.List(ctx, opts)
+			for _, customer := range customers {
+				fmt.Fprintf(w, "%d\t%s\t%t\n", customer.ID, customer.Name, customer.Archived)
+			}
+			return cursor, err
+		},
+		update: func(ctx context.Context, id int, name string) error {
+			return table.Update(ctx, coincount.Customer{ID: id, Name: name})
+		},
+		archive: table.Archive,
+	}.run(ctx, args)
+}
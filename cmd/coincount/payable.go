@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runPayable(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount payable pay|open|balances|aging [flags]")
+	}
+
+	flags := flag.NewFlagSet("payable "+args[0], flag.ExitOnError)
+	vendor := flags.Int("vendor", 0, "vendor ID, all vendors if 0")
+
+	switch args[0] {
+	case "pay":
+		payable := flags.Int("payable", 0, "payable account to debit")
+		from := flags.Int("from", 0, "account to pay from")
+		amount := flags.String("amount", "", "amount paid, e.g. 12.34")
+		date := flags.String("date", "", "date paid, YYYY-MM-DD")
+		apply := flags.String("apply", "", "purchases settled as PURCHASE:AMOUNT,...; oldest first if empty")
+		flags.Parse(args[1:])
+
+		if *vendor == 0 || *payable == 0 || *from == 0 || *amount == "" || *date == "" {
+			return errors.New("pay requires -vendor, -payable, -from, -amount and -date")
+		}
+
+		books, err := store(db).Books().Get(ctx)
+		if err != nil {
+			return err
+		}
+
+		payment := coincount.VendorPayment{
+			Vendor:         coincount.Vendor{ID: *vendor},
+			PayableAccount: coincount.Account{ID: *payable},
+			PaymentAccount: coincount.Account{ID: *from},
+		}
+		if payment.Date, err = parseDate(*date); err != nil {
+			return err
+		}
+		if payment.Amount, err = coincount.ParseMoney(*amount, books.FunctionalCurrency, coincount.CentPrecision); err != nil {
+			return err
+		}
+
+		if *apply == "" {
+			purchases, payments, err := coincount.VendorPayables(ctx, store(db), *vendor)
+			if err != nil {
+				return err
+			}
+			payment.Applications = coincount.ApplyOldestFirst(coincount.OpenPurchases(purchases, payments), payment.Amount)
+		} else if payment.Applications, err = parseApplications(*apply, books.FunctionalCurrency); err != nil {
+			return err
+		}
+
+		payment, gl, err := coincount.PayVendor(ctx, store(db), payment)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("payment %d posted as entry %d\n", payment.ID, gl[0].ID)
+		for _, application := range payment.Applications {
+			fmt.Printf("  purchase %d: %v\n", application.PurchaseID, application.Amount)
+		}
+		if unapplied := payment.Unapplied(); unapplied.Sign() > 0 {
+			fmt.Printf("  unapplied: %v\n", unapplied)
+		}
+		return nil
+
+	case "open":
+		flags.Parse(args[1:])
+
+		purchases, payments, err := coincount.VendorPayables(ctx, store(db), *vendor)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PURCHASE\tDATE\tVENDOR\tAMOUNT\tAPPLIED\tOPEN")
+		for _, open := range coincount.OpenPurchases(purchases, payments) {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%v\n",
+				open.Purchase.ID, open.Purchase.Date.Format("2006-01-02"), open.Purchase.Vendor.Name,
+				open.Purchase.Amount, open.Applied, open.Open())
+		}
+		return w.Flush()
+
+	case "balances":
+		flags.Parse(args[1:])
+
+		purchases, payments, err := coincount.VendorPayables(ctx, store(db), *vendor)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tVENDOR\tPURCHASED\tPAID\tBALANCE")
+		for _, balance := range coincount.VendorBalances(purchases, payments) {
+			fmt.Fprintf(w, "%d\t%s\t%v\t%v\t%v\n",
+				balance.Vendor.ID, balance.Vendor.Name, balance.Purchased, balance.Paid, balance.Balance())
+		}
+		return w.Flush()
+
+	case "aging":
+		asOf := flags.String("as-of", "", "date to age as of, YYYY-MM-DD; today if empty")
+		flags.Parse(args[1:])
+
+		date, err := parseDate(*asOf)
+		if err != nil {
+			return err
+		}
+		if date.IsZero() {
+			date = time.Now().UTC()
+		}
+
+		purchases, payments, err := coincount.VendorPayables(ctx, store(db), *vendor)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VENDOR\tCURRENT\t31-60\t61-90\tOVER 90\tUNAPPLIED\tBALANCE")
+		for _, aging := range coincount.AgePayables(purchases, payments, date) {
+			fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\t%v\n",
+				aging.Vendor.Name, aging.Current, aging.Days30, aging.Days60, aging.Days90,
+				aging.Unapplied, aging.Balance())
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown payable command %q", args[0])
+}
+
+// parseApplications parses PURCHASE:AMOUNT pairs separated by commas.
+func parseApplications(value, currency string) ([]coincount.PaymentApplication, error) {
+	var applications []coincount.PaymentApplication
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("application %q is not PURCHASE:AMOUNT", pair)
+		}
+
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("application %q: %w", pair, err)
+		}
+		amount, err := coincount.ParseMoney(parts[1], currency, coincount.CentPrecision)
+		if err != nil {
+			return nil, fmt.Errorf("application %q: %w", pair, err)
+		}
+
+		applications = append(applications, coincount.PaymentApplication{PurchaseID: id, Amount: amount})
+	}
+	return applications, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runPeriod(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount period list|add|close|reopen [flags]")
+	}
+
+	flags := flag.NewFlagSet("period "+args[0], flag.ExitOnError)
+	start := flags.String("start", "", "first date of the period, YYYY-MM-DD")
+
+	switch args[0] {
+	case "list":
+		flags.Parse(args[1:])
+
+		periods, err := store(db).Periods().List(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "START\tEND\tCLOSED\tCLOSING ENTRY")
+		for _, period := range periods {
+			closed := ""
+			if period.Closed() {
+				closed = period.ClosedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n",
+				period.Start.Format("2006-01-02"), period.End.Format("2006-01-02"),
+				closed, period.ClosingEntry)
+		}
+		return w.Flush()
+
+	case "add":
+		end := flags.String("end", "", "date the period ends before, YYYY-MM-DD")
+		flags.Parse(args[1:])
+
+		var (
+			period coincount.Period
+			err    error
+		)
+		if period.Start, err = parseDate(*start); err != nil {
+			return err
+		}
+		if period.End, err = parseDate(*end); err != nil {
+			return err
+		}
+		if *start == "" || *end == "" {
+			return errors.New("add requires -start and -end")
+		}
+		return store(db).Periods().Save(ctx, period)
+
+	case "close", "reopen":
+		flags.Parse(args[1:])
+
+		if *start == "" {
+			return fmt.Errorf("%s requires -start", args[0])
+		}
+		date, err := parseDate(*start)
+		if err != nil {
+			return err
+		}
+
+		var period coincount.Period
+		if args[0] == "close" {
+			period, err = coincount.ClosePeriod(ctx, store(db), date)
+		} else {
+			period, err = coincount.ReopenPeriod(ctx, store(db), date)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s %s\n", args[0], period)
+		if period.ClosingEntry != 0 && period.Closed() {
+			fmt.Println("closing entry:", period.ClosingEntry)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown period command %q", args[0])
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runReceivable(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount receivable invoice|receive|open|balances|aging [flags]")
+	}
+
+	flags := flag.NewFlagSet("receivable "+args[0], flag.ExitOnError)
+	customer := flags.Int("customer", 0, "customer ID, all customers if 0")
+
+	switch args[0] {
+	case "invoice":
+		receivable := flags.Int("receivable", coincount.AccountsReceivable.ID, "receivable account to debit")
+		date := flags.String("date", "", "date sold, YYYY-MM-DD")
+		due := flags.String("due", "", "date due, YYYY-MM-DD; -terms days after -date if empty")
+		terms := flags.Int("terms", 30, "days until due when -due is empty")
+		qty := flags.String("ether", "", "ether sold, e.g. 1.5")
+		price := flags.String("price", "", "amount the ether is sold for, e.g. 12.34")
+		revenue := flags.Int("revenue", coincount.RevenueEth.ID, "account to credit the ether's price to")
+		inventory := flags.Int("inventory", coincount.EthMain.ID, "inventory account the ether is taken from")
+		cost := flags.Int("cost", coincount.CostOfEthSold.ID, "account to expense the ether's cost to")
+		lines := flags.String("lines", "", "other lines as KIND:ACCOUNT:AMOUNT,... with KIND service, tax or discount")
+		flags.Parse(args[1:])
+
+		if *customer == 0 || *date == "" || (*qty == "") != (*price == "") || *qty == "" && *lines == "" {
+			return errors.New("invoice requires -customer, -date and -ether with -price, -lines or both")
+		}
+
+		books, err := store(db).Books().Get(ctx)
+		if err != nil {
+			return err
+		}
+
+		invoice := coincount.Invoice{
+			Customer:          coincount.Customer{ID: *customer},
+			ReceivableAccount: coincount.Account{ID: *receivable},
+			Amount:            coincount.NewMoney(nil, books.FunctionalCurrency, coincount.CentPrecision),
+		}
+		if invoice.Date, err = parseDate(*date); err != nil {
+			return err
+		}
+		if invoice.DueDate, err = parseDate(*due); err != nil {
+			return err
+		}
+		if invoice.DueDate.IsZero() {
+			invoice.DueDate = invoice.Date.AddDate(0, 0, *terms)
+		}
+
+		if *qty != "" {
+			line := coincount.InvoiceLine{
+				Kind:             coincount.LineInventory,
+				Item:             coincount.Ether,
+				Account:          coincount.Account{ID: *revenue},
+				InventoryAccount: coincount.Account{ID: *inventory},
+				CostAccount:      coincount.Account{ID: *cost},
+			}
+			if line.Qty, err = coincount.ParseQuantity(*qty, coincount.EtherDecimals); err != nil {
+				return err
+			}
+			if line.Amount, err = coincount.ParseMoney(*price, books.FunctionalCurrency, coincount.CentPrecision); err != nil {
+				return err
+			}
+			invoice.Lines = append(invoice.Lines, line)
+		}
+		if *lines != "" {
+			other, err := parseInvoiceLines(*lines, books.FunctionalCurrency)
+			if err != nil {
+				return err
+			}
+			invoice.Lines = append(invoice.Lines, other...)
+		}
+
+		for _, line := range invoice.Lines {
+			if line.Kind == coincount.LineDiscount {
+				invoice.Amount = invoice.Amount.Sub(line.Amount)
+			} else {
+				invoice.Amount = invoice.Amount.Add(line.Amount)
+			}
+		}
+
+		invoice, _, gl, err := coincount.RecordInvoice(ctx, store(db), invoice)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("invoice %d for %v due %s posted as entry %d\n",
+			invoice.ID, invoice.Amount, invoice.DueDate.Format("2006-01-02"), gl[0].ID)
+		return nil
+
+	case "receive":
+		receivable := flags.Int("receivable", coincount.AccountsReceivable.ID, "receivable account to credit")
+		deposit := flags.Int("deposit", 0, "account the money is received into")
+		amount := flags.String("amount", "", "amount received, e.g. 12.34")
+		date := flags.String("date", "", "date received, YYYY-MM-DD")
+		apply := flags.String("apply", "", "invoices settled as INVOICE:AMOUNT,...; soonest due first if empty")
+		flags.Parse(args[1:])
+
+		if *customer == 0 || *deposit == 0 || *amount == "" || *date == "" {
+			return errors.New("receive requires -customer, -deposit, -amount and -date")
+		}
+
+		books, err := store(db).Books().Get(ctx)
+		if err != nil {
+			return err
+		}
+
+		receipt := coincount.CustomerReceipt{
+			Customer:          coincount.Customer{ID: *customer},
+			ReceivableAccount: coincount.Account{ID: *receivable},
+			DepositAccount:    coincount.Account{ID: *deposit},
+		}
+		if receipt.Date, err = parseDate(*date); err != nil {
+			return err
+		}
+		if receipt.Amount, err = coincount.ParseMoney(*amount, books.FunctionalCurrency, coincount.CentPrecision); err != nil {
+			return err
+		}
+
+		if *apply == "" {
+			invoices, receipts, err := coincount.CustomerReceivables(ctx, store(db), *customer)
+			if err != nil {
+				return err
+			}
+			receipt.Applications = coincount.ApplyToInvoices(coincount.OpenInvoices(invoices, receipts), receipt.Amount)
+		} else if receipt.Applications, err = parseReceiptApplications(*apply, books.FunctionalCurrency); err != nil {
+			return err
+		}
+
+		receipt, gl, err := coincount.ReceivePayment(ctx, store(db), receipt)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("receipt %d posted as entry %d\n", receipt.ID, gl[0].ID)
+		for _, application := range receipt.Applications {
+			fmt.Printf("  invoice %d: %v\n", application.InvoiceID, application.Amount)
+		}
+		if unapplied := receipt.Unapplied(); unapplied.Sign() > 0 {
+			fmt.Printf("  unapplied: %v\n", unapplied)
+		}
+		return nil
+
+	case "open":
+		flags.Parse(args[1:])
+
+		invoices, receipts, err := coincount.CustomerReceivables(ctx, store(db), *customer)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "INVOICE\tDATE\tDUE\tCUSTOMER\tAMOUNT\tAPPLIED\tOPEN")
+		for _, open := range coincount.OpenInvoices(invoices, receipts) {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%v\t%v\t%v\n",
+				open.Invoice.ID, open.Invoice.Date.Format("2006-01-02"), open.Invoice.DueDate.Format("2006-01-02"),
+				open.Invoice.Customer.Name, open.Invoice.Amount, open.Applied, open.Open())
+		}
+		return w.Flush()
+
+	case "balances":
+		flags.Parse(args[1:])
+
+		invoices, receipts, err := coincount.CustomerReceivables(ctx, store(db), *customer)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCUSTOMER\tINVOICED\tRECEIVED\tBALANCE")
+		for _, balance := range coincount.CustomerBalances(invoices, receipts) {
+			fmt.Fprintf(w, "%d\t%s\t%v\t%v\t%v\n",
+				balance.Customer.ID, balance.Customer.Name, balance.Invoiced, balance.Received, balance.Balance())
+		}
+		return w.Flush()
+
+	case "aging":
+		asOf := flags.String("as-of", "", "date to age as of, YYYY-MM-DD; today if empty")
+		flags.Parse(args[1:])
+
+		date, err := parseDate(*asOf)
+		if err != nil {
+			return err
+		}
+		if date.IsZero() {
+			date = time.Now().UTC()
+		}
+
+		invoices, receipts, err := coincount.CustomerReceivables(ctx, store(db), *customer)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CUSTOMER\tCURRENT\t31-60\t61-90\tOVER 90\tUNAPPLIED\tBALANCE")
+		for _, aging := range coincount.AgeReceivables(invoices, receipts, date) {
+			fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\t%v\n",
+				aging.Customer.Name, aging.Current, aging.Days30, aging.Days60, aging.Days90,
+				aging.Unapplied, aging.Balance())
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown receivable command %q", args[0])
+}
+
+// parseInvoiceLines parses KIND:ACCOUNT:AMOUNT triples separated by commas.
+func parseInvoiceLines(value, currency string) ([]coincount.InvoiceLine, error) {
+	var lines []coincount.InvoiceLine
+	for _, triple := range strings.Split(value, ",") {
+		parts := strings.SplitN(triple, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %q is not KIND:ACCOUNT:AMOUNT", triple)
+		}
+
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %q: %w", triple, err)
+		}
+		amount, err := coincount.ParseMoney(parts[2], currency, coincount.CentPrecision)
+		if err != nil {
+			return nil, fmt.Errorf("line %q: %w", triple, err)
+		}
+
+		lines = append(lines, coincount.InvoiceLine{
+			Kind:    coincount.LineKind(parts[0]),
+			Account: coincount.Account{ID: id},
+			Amount:  amount,
+		})
+	}
+	return lines, nil
+}
+
+// parseReceiptApplications parses INVOICE:AMOUNT pairs separated by commas.
+func parseReceiptApplications(value, currency string) ([]coincount.ReceiptApplication, error) {
+	var applications []coincount.ReceiptApplication
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("application %q is not INVOICE:AMOUNT", pair)
+		}
+
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("application %q: %w", pair, err)
+		}
+		amount, err := coincount.ParseMoney(parts[1], currency, coincount.CentPrecision)
+		if err != nil {
+			return nil, fmt.Errorf("application %q: %w", pair, err)
+		}
+
+		applications = append(applications, coincount.ReceiptApplication{InvoiceID: id, Amount: amount})
+	}
+	return applications, nil
+}
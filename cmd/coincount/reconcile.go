@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runReconcile(ctx context.Context, db *sql.DB, args []string) error {
+	var opts coincount.ListOptions
+
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	flags.IntVar(&opts.AccountID, "account", 0, "only this inventory account")
+	from := flags.String("from", "", "first date, YYYY-MM-DD")
+	to := flags.String("to", "", "date to stop before, YYYY-MM-DD")
+	flags.Parse(args)
+
+	var err error
+	if opts.From, err = parseDate(*from); err != nil {
+		return err
+	}
+	if opts.To, err = parseDate(*to); err != nil {
+		return err
+	}
+
+	reconciliations, err := coincount.ReconcileInventory(ctx, store(db), opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tINVENTORY\tLEDGER\tDIFFERENCE")
+	discrepancies := 0
+	for _, r := range reconciliations {
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\n", r.Account.Name, r.Inventory, r.Ledger, r.Difference())
+		for _, d := range r.Discrepancies {
+			fmt.Fprintf(w, "  %s (entry %d)\t%v\t%v\t%v\n", d.Memo, d.Entry, d.Inventory, d.Ledger, d.Difference())
+		}
+		discrepancies += len(r.Discrepancies)
+	}
+	w.Flush()
+
+	if discrepancies > 0 {
+		return fmt.Errorf("%d entries do not reconcile", discrepancies)
+	}
+	return nil
+}
+
+// parseDate parses a YYYY-MM-DD flag, leaving the zero time for "".
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runRecurring(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: coincount recurring list|add|run [flags]")
+	}
+
+	flags := flag.NewFlagSet("recurring "+args[0], flag.ExitOnError)
+
+	switch args[0] {
+	case "list":
+		flags.Parse(args[1:])
+
+		templates, _, err := store(db).Recurring().List(ctx, coincount.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tKIND\tSTART\tEVERY\tEND")
+		for _, template := range templates {
+			end := ""
+			if !template.Schedule.End.IsZero() {
+				end = template.Schedule.End.Format("2006-01-02")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d %s\t%s\n",
+				template.ID, template.Name, template.Kind(), template.Schedule.Start.Format("2006-01-02"),
+				template.Schedule.Every, template.Schedule.Unit, end)
+		}
+		return w.Flush()
+
+	case "add":
+		file := flags.String("file", "", "JSON file holding the template")
+		flags.Parse(args[1:])
+
+		if *file == "" {
+			return errors.New("add requires -file")
+		}
+
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var template coincount.RecurringTemplate
+		if err = json.NewDecoder(f).Decode(&template); err != nil {
+			return fmt.Errorf("%s: %w", *file, err)
+		}
+
+		id, err := store(db).Recurring().Save(ctx, template)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("recurring template %d saved\n", id)
+		return nil
+
+	case "run":
+		through := flags.String("through", "", "generate everything due up to this date, YYYY-MM-DD; today if empty")
+		post := flags.Bool("post", false, "post what is generated, and anything generated earlier but not posted")
+		flags.Parse(args[1:])
+
+		date, err := parseDate(*through)
+		if err != nil {
+			return err
+		}
+		if date.IsZero() {
+			date = time.Now().UTC()
+		}
+
+		instances, err := coincount.RunRecurring(ctx, store(db), date, *post)
+		for _, instance := range instances {
+			fmt.Printf("template %d due %s", instance.TemplateID, instance.Date.Format("2006-01-02"))
+			if !instance.Document.IsZero() {
+				fmt.Printf(" generated %v", instance.Document)
+			}
+			if instance.Entry != 0 {
+				fmt.Printf(" posted as entry %d", instance.Entry)
+			}
+			fmt.Println()
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown recurring command %q", args[0])
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runReverse(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("reverse", flag.ExitOnError)
+	entry := flags.Int("entry", 0, "journal entry to reverse")
+	date := flags.String("date", "", "date of the reversal, YYYY-MM-DD")
+	reason := flags.String("reason", "", "why the entry is reversed")
+	flags.Parse(args)
+
+	if *entry == 0 || *date == "" {
+		return errors.New("reverse requires -entry and -date")
+	}
+
+	on, err := parseDate(*date)
+	if err != nil {
+		return err
+	}
+
+	inv, gl, err := coincount.ReverseEntry(ctx, store(db), *entry, on, *reason)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("entry %d reversed by entry %d\n", *entry, gl[0].ID)
+	for _, transaction := range inv {
+		fmt.Printf("inventory transaction %d reversed by %d\n", transaction.Reverses, transaction.ID)
+	}
+	return nil
+}
+
+func runBalance(ctx context.Context, db *sql.DB, args []string) error {
+	var opts coincount.ListOptions
+
+	flags := flag.NewFlagSet("balance", flag.ExitOnError)
+	from := flags.String("from", "", "first date, YYYY-MM-DD")
+	to := flags.String("to", "", "date to stop before, YYYY-MM-DD")
+	net := flags.Bool("net", false, "leave out reversed entries and their reversals")
+	translate := flags.Bool("translate", false, "translate into the reporting currency at the last rate before -to")
+	flags.Parse(args)
+
+	var err error
+	if opts.From, err = parseDate(*from); err != nil {
+		return err
+	}
+	if opts.To, err = parseDate(*to); err != nil {
+		return err
+	}
+
+	gl, _, err := store(db).GLTransactions().List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if *net {
+		gl = coincount.NetOfReversals(gl)
+	}
+
+	balances := coincount.TrialBalance(gl)
+	if *translate {
+		if balances, err = translateBalances(ctx, db, balances, opts.To); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACCOUNT\tDEBIT\tCREDIT\tBALANCE")
+	for _, balance := range balances {
+		fmt.Fprintf(w, "%d\t%s\t%v\t%v\t%v\n",
+			balance.Account.ID, balance.Account.Name,
+			balance.Debit, balance.Credit, balance.Balance())
+	}
+	return w.Flush()
+}
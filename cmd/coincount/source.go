@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebittleman/coincount"
+)
+
+func runSource(ctx context.Context, db *sql.DB, args []string) error {
+	var source coincount.SourceRef
+
+	flags := flag.NewFlagSet("source", flag.ExitOnError)
+	flags.StringVar(&source.Type, "type", coincount.SourcePurchase, "document type: purchase, sale or transfer")
+	flags.IntVar(&source.ID, "id", 0, "document ID")
+	flags.Parse(args)
+
+	if source.ID == 0 {
+		return errors.New("source requires -id")
+	}
+
+	inv, gl, err := coincount.DocumentPostings(ctx, store(db), source)
+	if err != nil {
+		return err
+	}
+	if len(inv) == 0 && len(gl) == 0 {
+		return fmt.Errorf("%w: nothing posted from %s", coincount.ErrNotFound, source)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tDATE\tACCOUNT\tDEBIT\tCREDIT\tMEMO")
+	for _, line := range gl {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%s\n",
+			line.ID, line.Date.Format("2006-01-02"), line.Account.Name,
+			line.Debit, line.Credit, line.Memo)
+	}
+	w.Flush()
+
+	if len(inv) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INVENTORY\tDATE\tITEM\tIN\tOUT\tAMOUNT")
+	for _, transaction := range inv {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%v\n",
+			transaction.ID, transaction.Date.Format("2006-01-02"), transaction.Item.Name,
+			transaction.QtyIn, transaction.QtyOut, transaction.Amount)
+	}
+	return w.Flush()
+}
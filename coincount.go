@@ -2,29 +2,39 @@ package coincount
 
 import (
 	"errors"
-	"fmt"
 	"math/big"
 	"time"
 )
 
 type (
 	Account struct {
-		ID   int
-		Name string
+		ID       int
+		Name     string
+		Archived bool
 	}
 
 	GLTransaction struct {
 		ID      int
 		Date    time.Time
 		Account Account
-		Debit   int64
-		Credit  int64
+		Debit   Money
+		Credit  Money
 		Memo    string
+		// Foreign is the signed amount, debits positive, in the currency the
+		// line was originally transacted in when that is not the functional
+		// currency of the books. It is the zero Money otherwise.
+		Foreign Money
+		// Reverses is the ID of the journal entry this line reverses, 0 for
+		// ordinary lines.
+		Reverses int
+		// Source is the document the line was posted from.
+		Source SourceRef
 	}
 
 	Item struct {
-		ID   int
-		Name string
+		ID       int
+		Name     string
+		Archived bool
 	}
 
 	InventoryTransaction struct {
@@ -32,24 +42,45 @@ type (
 		Date    time.Time
 		Account Account
 		Item    Item
-		QtyIn   *big.Int
-		QtyOut  *big.Int
-		Cost    int64
-		Amount  int64
+		QtyIn   Quantity
+		QtyOut  Quantity
+		Cost    UnitCost
+		Amount  Money
 		Memo    string
+		// Reverses is the ID of the inventory transaction this one reverses,
+		// 0 for ordinary transactions.
+		Reverses int
+		// Entry is the journal entry the transaction was recorded with, 0 if
+		// none.
+		Entry int
+		// Source is the document the transaction was posted from.
+		Source SourceRef
 	}
 
 	Vendor struct {
-		ID   int
-		Name string
+		ID       int
+		Name     string
+		Archived bool
+	}
+
+	Customer struct {
+		ID       int
+		Name     string
+		Archived bool
 	}
 
 	PurchaseItem struct {
-		Item             Item
+		// Kind says how the line posts; see PurchaseItem.LineKind.
+		Kind LineKind
+		// Item is required only on inventory lines.
+		Item Item
+		// InventoryAccount is the account the line posts to: the inventory
+		// account of inventory lines, or the expense, tax or discount
+		// account of the others.
 		InventoryAccount Account
-		Qty              *big.Int
-		Cost             int64
-		Amount           int64
+		Qty              Quantity
+		Cost             UnitCost
+		Amount           Money
 	}
 
 	Purchase struct {
@@ -57,13 +88,49 @@ type (
 		Date           time.Time
 		Vendor         Vendor
 		PayableAccount Account
-		Amount         int64
+		Amount         Money
 		Items          []PurchaseItem
 	}
 )
 
-func MiningPayout(date time.Time, qty *big.Int, costOfElecricity int64) Purchase {
-	amt := multiplyRoundUp(qty, costOfElecricity)
+// LineKind says how a purchase line posts.
+type LineKind string
+
+const (
+	// LineInventory debits an inventory account and records an inventory
+	// transaction for the item.
+	LineInventory LineKind = "inventory"
+	// LineExpense debits an expense account with no inventory transaction.
+	LineExpense LineKind = "expense"
+	// LineTax debits a tax account.
+	LineTax LineKind = "tax"
+	// LineDiscount credits its account, reducing what is payable. Its
+	// Amount is positive.
+	LineDiscount LineKind = "discount"
+)
+
+// LineKind returns the kind of the line. Lines without one are expenses when
+// they are for ExpenseItem and inventory otherwise.
+func (i PurchaseItem) LineKind() LineKind {
+	switch {
+	case i.Kind != "":
+		return i.Kind
+	case i.Item.ID == ExpenseItem.ID:
+		return LineExpense
+	}
+	return LineInventory
+}
+
+// signedAmount is the line's amount as it adds to the purchase amount.
+func (i PurchaseItem) signedAmount() Money {
+	if i.LineKind() == LineDiscount {
+		return i.Amount.Neg()
+	}
+	return i.Amount
+}
+
+func MiningPayout(date time.Time, qty Quantity, costOfElecricity Money) Purchase {
+	amt := costOfElecricity.MulQuantity(qty, RoundUp)
 
 	return Purchase{
 		Date:           date,
@@ -75,31 +142,59 @@ func MiningPayout(date time.Time, qty *big.Int, costOfElecricity int64) Purchase
 				Item:             Ether,
 				InventoryAccount: EthMain,
 				Qty:              qty,
-				Cost:             costOfElecricity,
+				Cost:             UnitCostOf(costOfElecricity),
 				Amount:           amt,
 			},
 		},
 	}
 }
 
-func PostPurchase(date time.Time, purchase Purchase, nextGLTransaction int) ([]InventoryTransaction, []GLTransaction) {
+// PostPurchase posts purchase on date as journal entry nextGLTransaction, one
+// line per account in item order followed by the payable, refusing purchases
+// that fail Validate. Items on the same account share its line. Only
+// inventory lines record inventory transactions.
+func PostPurchase(date time.Time, purchase Purchase, nextGLTransaction int) ([]InventoryTransaction, []GLTransaction, error) {
+	inventoryTransactions, glTransactions, err := postPurchaseLines(date, purchase, nextGLTransaction)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inventoryTransactions, combineLines(glTransactions), nil
+}
+
+// postPurchaseLines posts purchase with a ledger line for each item, in item
+// order, followed by the payable. Items on the same account are left for
+// combineLines to merge.
+func postPurchaseLines(date time.Time, purchase Purchase, nextGLTransaction int) ([]InventoryTransaction, []GLTransaction, error) {
+	if err := purchase.Validate(); err != nil {
+		return nil, nil, err
+	}
+
 	var (
 		inventoryTransactions []InventoryTransaction
 		glTransactions        []GLTransaction
-		zero                  big.Int
 	)
 
-	memo := fmt.Sprintf("PUR-%d", purchase.ID)
+	source := PurchaseSource(purchase.ID)
+	memo := source.String()
 	for _, item := range purchase.Items {
-		if item.Item.ID <= 0 {
+		if item.LineKind() != LineInventory {
+			debitAmount, creditAmount := debitCredit(item.signedAmount())
+			glTransactions = append(glTransactions, GLTransaction{
+				ID:      nextGLTransaction,
+				Date:    date,
+				Account: item.InventoryAccount,
+				Debit:   debitAmount,
+				Credit:  creditAmount,
+				Memo:    memo,
+				Source:  source,
+			})
 			continue
 		}
 
-		qtyIn, qtyOut := new(big.Int).Set(item.Qty), new(big.Int).Set(&zero)
+		qtyIn, qtyOut := item.Qty, NewQuantity(nil, item.Qty.Decimals())
 
-		if qtyIn.Cmp(&zero) < 0 {
-			qtyOut.Neg(qtyIn)
-			qtyIn.Set(&zero)
+		if qtyIn.Sign() < 0 {
+			qtyIn, qtyOut = qtyOut, qtyIn.Neg()
 		}
 
 		inventoryTransactions = append(inventoryTransactions, InventoryTransaction{
@@ -108,14 +203,16 @@ func PostPurchase(date time.Time, purchase Purchase, nextGLTransaction int) ([]I
 			Item:    item.Item,
 			QtyIn:   qtyIn,
 			QtyOut:  qtyOut,
-			Cost:    item.Cost,
+			Cost:    NewUnitCost(item.Amount, item.Qty),
+			Amount:  item.Amount,
 			Memo:    memo,
+			Entry:   nextGLTransaction,
+			Source:  source,
 		})
 
-		debitAmount, creditAmount := item.Amount, int64(0)
-		if debitAmount < 0 {
-			creditAmount = -1 * debitAmount
-			debitAmount = 0
+		debitAmount, creditAmount := item.Amount, item.Amount.zero()
+		if debitAmount.Sign() < 0 {
+			debitAmount, creditAmount = creditAmount, debitAmount.Neg()
 		}
 
 		glTransactions = append(glTransactions, GLTransaction{
@@ -125,13 +222,13 @@ func PostPurchase(date time.Time, purchase Purchase, nextGLTransaction int) ([]I
 			Debit:   debitAmount,
 			Credit:  creditAmount,
 			Memo:    memo,
+			Source:  source,
 		})
 	}
 
-	debitAmount, creditAmount := int64(0), purchase.Amount
-	if creditAmount < 0 {
-		debitAmount = -1 * creditAmount
-		creditAmount = 0
+	debitAmount, creditAmount := purchase.Amount.zero(), purchase.Amount
+	if creditAmount.Sign() < 0 {
+		debitAmount, creditAmount = creditAmount.Neg(), debitAmount
 	}
 
 	glTransactions = append(glTransactions, GLTransaction{
@@ -141,9 +238,31 @@ func PostPurchase(date time.Time, purchase Purchase, nextGLTransaction int) ([]I
 		Debit:   debitAmount,
 		Credit:  creditAmount,
 		Memo:    memo,
+		Source:  source,
 	})
 
-	return inventoryTransactions, glTransactions
+	return inventoryTransactions, glTransactions, nil
+}
+
+// combineLines merges the lines posted to the same account into the first of
+// them, since a journal entry holds one line per account.
+func combineLines(lines []GLTransaction) []GLTransaction {
+	var (
+		combined  []GLTransaction
+		byAccount = make(map[int]int)
+	)
+	for _, line := range lines {
+		if i, ok := byAccount[line.Account.ID]; ok {
+			c := &combined[i]
+			c.Debit, c.Credit = debitCredit(c.Debit.Sub(c.Credit).Add(line.Debit.Sub(line.Credit)))
+			c.Foreign = c.Foreign.Add(line.Foreign)
+			continue
+		}
+
+		byAccount[line.Account.ID] = len(combined)
+		combined = append(combined, line)
+	}
+	return combined
 }
 
 // // TODO: continue here.
@@ -178,55 +297,59 @@ func PostPurchase(date time.Time, purchase Purchase, nextGLTransaction int) ([]I
 // 	}
 // }
 
-func CalcCost(transactions []InventoryTransaction, qty *big.Int) (cost int64, err error) {
-	var zero big.Int
-	if qty.Cmp(&zero) == 0 {
-		return 0, nil
+func CalcCost(transactions []InventoryTransaction, qty Quantity) (cost UnitCost, err error) {
+	if qty.IsZero() {
+		return UnitCost{}, nil
 	}
 
 	inQueue, outQueue := make(TransactionQueue, 0), make(TransactionQueue, 0)
 	for _, transaction := range transactions {
-		if transaction.QtyIn.Cmp(&zero) > 0 {
+		if transaction.QtyIn.Sign() > 0 {
 			inQueue.Enqueue(transaction)
-		} else if transaction.QtyOut.Cmp(&zero) > 0 {
+		} else if transaction.QtyOut.Sign() > 0 {
 			outQueue.Enqueue(transaction)
 		}
 	}
 
-	inQty, outQty := new(big.Int).Set(&zero), new(big.Int).Set(&zero)
-	var price int64
+	zero := NewQuantity(nil, qty.Decimals())
+	inQty, outQty := zero, zero
+	price := new(big.Rat)
 	var currentIn, currentOut InventoryTransaction
 	for {
-		if inQty.Cmp(&zero) == 0 {
+		if inQty.IsZero() {
 			currentIn, err = inQueue.Dequeue()
 			if err != nil {
-				return 0, errors.New("Out of Inventory")
+				return UnitCost{}, errors.New("Out of Inventory")
 			}
-			inQty.Set(currentIn.QtyIn)
+			inQty = currentIn.QtyIn
 		}
 
-		if outQty.Cmp(&zero) == 0 {
-			price = 0
+		if outQty.IsZero() {
+			price.SetInt64(0)
 			currentOut, err = outQueue.Peek()
 			if err != nil {
-				outQty.Set(qty)
+				outQty = qty
 			} else {
-				outQty.Set(currentOut.QtyOut)
+				outQty = currentOut.QtyOut
 			}
 		}
 
 		if outQty.Cmp(inQty) <= 0 {
-			inQty.Sub(inQty, outQty)
-			price += multiplyRoundUp(outQty, currentIn.Cost)
-			outQty.Set(&zero)
+			inQty = inQty.Sub(outQty)
+			price.Add(price, currentIn.Cost.extend(outQty))
+			outQty = zero
 			_, err = outQueue.Dequeue()
 			if err != nil {
-				return divideRound(price, qty), nil
+				whole := new(big.Rat).SetFrac(qty.bigInt(), pow10(qty.Decimals()))
+				return UnitCost{
+					rat:      price.Quo(price, whole),
+					currency: currentIn.Cost.Currency(),
+				}, nil
 			}
 		} else {
-			outQty.Sub(outQty, inQty)
-			price += multiplyRoundUp(inQty, currentIn.Cost)
-			inQty.Set(&zero)
+			outQty = outQty.Sub(inQty)
+			price.Add(price, currentIn.Cost.extend(inQty))
+			inQty = zero
 		}
 	}
 }
@@ -6,16 +6,27 @@ import (
 	"time"
 )
 
+func ether(amount string) Quantity {
+	return Wei(ParseEtherFloatToWei(amount))
+}
+
+func unitCost(rat string) UnitCost {
+	var cost UnitCost
+	cost.Scan(rat)
+	cost.currency = DefaultCurrency
+	return cost
+}
+
 func TestCalcCost(t *testing.T) {
-	var zero big.Int
+	zero := Wei(nil)
 	type args struct {
 		transactions []InventoryTransaction
-		qty          *big.Int
+		qty          Quantity
 	}
 	tests := []struct {
 		name     string
 		args     args
-		wantCost int64
+		wantCost UnitCost
 		wantErr  bool
 	}{
 		{
@@ -24,50 +35,106 @@ func TestCalcCost(t *testing.T) {
 				transactions: []InventoryTransaction{
 					{
 						ID:     1,
-						QtyIn:  ParseEtherFloatToWei(".2"),
-						QtyOut: &zero,
-						Cost:   350,
+						QtyIn:  ether(".2"),
+						QtyOut: zero,
+						Cost:   UnitCostOf(Cents(350)),
 					},
 					{
 						ID:     2,
-						QtyIn:  &zero,
-						QtyOut: ParseEtherFloatToWei(".1"),
-						Cost:   350,
+						QtyIn:  zero,
+						QtyOut: ether(".1"),
+						Cost:   UnitCostOf(Cents(350)),
 					},
 					{
 						ID:     3,
-						QtyIn:  ParseEtherFloatToWei(".1"),
-						QtyOut: &zero,
-						Cost:   300,
+						QtyIn:  ether(".1"),
+						QtyOut: zero,
+						Cost:   UnitCostOf(Cents(300)),
 					},
 					{
 						ID:     4,
-						QtyIn:  ParseEtherFloatToWei("1"),
-						QtyOut: &zero,
-						Cost:   270,
+						QtyIn:  ether("1"),
+						QtyOut: zero,
+						Cost:   UnitCostOf(Cents(270)),
 					},
 					{
 						ID:     5,
-						QtyIn:  &zero,
-						QtyOut: ParseEtherFloatToWei(".3"),
-						Cost:   307,
+						QtyIn:  zero,
+						QtyOut: ether(".3"),
+						Cost:   UnitCostOf(Cents(307)),
 					},
 					{
 						ID:     6,
-						QtyIn:  ParseEtherFloatToWei(".5"),
-						QtyOut: &zero,
-						Cost:   390,
+						QtyIn:  ether(".5"),
+						QtyOut: zero,
+						Cost:   UnitCostOf(Cents(390)),
 					},
 					{
 						ID:     7,
-						QtyIn:  ParseEtherFloatToWei("6"),
-						QtyOut: &zero,
-						Cost:   1,
+						QtyIn:  ether("6"),
+						QtyOut: zero,
+						Cost:   UnitCostOf(Cents(1)),
 					},
 				},
-				qty: ParseEtherFloatToWei("2.1"),
+				qty: ether("2.1"),
 			},
-			wantCost: 210,
+			wantCost: unitCost("4387/2100"),
+		},
+		{
+			name: "single wei lot",
+			args: args{
+				transactions: []InventoryTransaction{
+					{
+						ID:     1,
+						QtyIn:  Wei(big.NewInt(1)),
+						QtyOut: zero,
+						Cost:   NewUnitCost(Cents(1), Wei(big.NewInt(1))),
+					},
+				},
+				qty: Wei(big.NewInt(1)),
+			},
+			wantCost: unitCost("10000000000000000"),
+		},
+		{
+			name: "wei lots with repeating cost",
+			args: args{
+				transactions: []InventoryTransaction{
+					{
+						ID:     1,
+						QtyIn:  Wei(big.NewInt(3)),
+						QtyOut: zero,
+						Cost:   NewUnitCost(Cents(1), Wei(big.NewInt(3))),
+					},
+					{
+						ID:     2,
+						QtyIn:  zero,
+						QtyOut: Wei(big.NewInt(1)),
+					},
+					{
+						ID:     3,
+						QtyIn:  Wei(big.NewInt(7)),
+						QtyOut: zero,
+						Cost:   NewUnitCost(Cents(2), Wei(big.NewInt(7))),
+					},
+				},
+				qty: Wei(big.NewInt(9)),
+			},
+			wantCost: unitCost("80000000000000000/27"),
+		},
+		{
+			name: "out of inventory",
+			args: args{
+				transactions: []InventoryTransaction{
+					{
+						ID:     1,
+						QtyIn:  Wei(big.NewInt(1)),
+						QtyOut: zero,
+						Cost:   UnitCostOf(Cents(100)),
+					},
+				},
+				qty: Wei(big.NewInt(2)),
+			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
@@ -77,7 +144,7 @@ func TestCalcCost(t *testing.T) {
 				t.Errorf("CalcCost() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotCost != tt.wantCost {
+			if err == nil && gotCost.Cmp(tt.wantCost) != 0 {
 				t.Errorf("CalcCost() = %v, want %v", gotCost, tt.wantCost)
 			}
 		})
@@ -85,8 +152,131 @@ func TestCalcCost(t *testing.T) {
 }
 
 func TestAmountCalc(t *testing.T) {
-	qty := ParseEtherFloatToWei("0.01")
-	costOfElectricity := int64(20015)
+	qty := ether("0.01")
+	costOfElectricity := Cents(20015)
 	p := MiningPayout(time.Unix(123456789, 0), qty, costOfElectricity)
 	t.Log(p.Amount)
 }
+
+func TestUnitCostRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Money
+		qty    Quantity
+	}{
+		{name: "one wei for a cent", amount: Cents(1), qty: Wei(big.NewInt(1))},
+		{name: "three wei for a cent", amount: Cents(1), qty: Wei(big.NewInt(3))},
+		{name: "mining payout", amount: Cents(201), qty: ether("0.01")},
+		{name: "awkward lot", amount: Cents(99999), qty: Wei(big.NewInt(123456789))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := NewUnitCost(tt.amount, tt.qty).Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cost := UnitCost{currency: DefaultCurrency}
+			if err = cost.Scan(value); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cost.Extend(tt.qty, CentPrecision, RoundTruncate); got.Cmp(tt.amount) != 0 {
+				t.Errorf("Extend() = %v, want %v", got, tt.amount)
+			}
+		})
+	}
+}
+
+func TestPostPurchase(t *testing.T) {
+	date := time.Unix(0, 0)
+	base := Purchase{
+		ID:             4,
+		Date:           date,
+		Vendor:         Coinbase,
+		PayableAccount: VisaCard,
+	}
+
+	tests := []struct {
+		name      string
+		items     []PurchaseItem
+		amount    Money
+		wantInv   int
+		wantLines map[int]int64
+	}{
+		{
+			name:      "inventory",
+			items:     []PurchaseItem{{Item: Ether, InventoryAccount: EthCoinbase, Qty: ether("1"), Amount: Cents(30000)}},
+			amount:    Cents(30000),
+			wantInv:   1,
+			wantLines: map[int]int64{EthCoinbase.ID: 30000, VisaCard.ID: -30000},
+		},
+		{
+			name: "expense, tax and discount",
+			items: []PurchaseItem{
+				{Item: Ether, InventoryAccount: EthCoinbase, Qty: ether("1"), Amount: Cents(30000)},
+				{Kind: LineExpense, InventoryAccount: CoinbaseFee, Amount: Cents(450)},
+				{Kind: LineTax, InventoryAccount: SalesTax, Amount: Cents(36)},
+				{Kind: LineDiscount, InventoryAccount: PurchaseDiscounts, Amount: Cents(100)},
+			},
+			amount:  Cents(30386),
+			wantInv: 1,
+			wantLines: map[int]int64{
+				EthCoinbase.ID:       30000,
+				CoinbaseFee.ID:       450,
+				SalesTax.ID:          36,
+				PurchaseDiscounts.ID: -100,
+				VisaCard.ID:          -30386,
+			},
+		},
+		{
+			name: "two lots on one account",
+			items: []PurchaseItem{
+				{Item: Ether, InventoryAccount: EthCoinbase, Qty: ether("1"), Amount: Cents(30000)},
+				{Item: Ether, InventoryAccount: EthCoinbase, Qty: ether("0.5"), Amount: Cents(14000)},
+				{Kind: LineExpense, InventoryAccount: CoinbaseFee, Amount: Cents(450)},
+				{Kind: LineExpense, InventoryAccount: CoinbaseFee, Amount: Cents(50)},
+			},
+			amount:  Cents(44500),
+			wantInv: 2,
+			wantLines: map[int]int64{
+				EthCoinbase.ID: 44000,
+				CoinbaseFee.ID: 500,
+				VisaCard.ID:    -44500,
+			},
+		},
+		{
+			name:      "expense item",
+			items:     []PurchaseItem{{Item: ExpenseItem, InventoryAccount: EthTXFee, Qty: ether("1"), Amount: Cents(12)}},
+			amount:    Cents(12),
+			wantLines: map[int]int64{EthTXFee.ID: 12, VisaCard.ID: -12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purchase := base
+			purchase.Items, purchase.Amount = tt.items, tt.amount
+
+			inv, gl, err := PostPurchase(date, purchase, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inv) != tt.wantInv {
+				t.Errorf("PostPurchase() = %d inventory transactions, want %d", len(inv), tt.wantInv)
+			}
+			if err = CheckBalanced(gl); err != nil {
+				t.Error(err)
+			}
+
+			if len(gl) != len(tt.wantLines) {
+				t.Fatalf("PostPurchase() = %d lines, want %d", len(gl), len(tt.wantLines))
+			}
+			for _, line := range gl {
+				want := Cents(tt.wantLines[line.Account.ID])
+				if got := line.Debit.Sub(line.Credit); got.Cmp(want) != 0 {
+					t.Errorf("%s line = %v, want %v", line.Account.Name, got, want)
+				}
+			}
+		})
+	}
+}
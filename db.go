@@ -3,15 +3,58 @@ package coincount
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"strings"
 	"time"
 )
 
-const inventoryBase = 32
+var ErrInUse = errors.New("Record In Use")
 
-var SQLDbCreate = `
-BEGIN TRANSACTION;
+// ledgerAmount normalizes money to the cents stored in integer columns.
+func ledgerAmount(m Money) Money {
+	return m.Round(CentPrecision, RoundHalfEven)
+}
+
+// currencyOf returns the currency stored on a row. Rows written before
+// currencies were recorded are in DefaultCurrency.
+func currencyOf(currency sql.NullString) string {
+	if currency.Valid && currency.String != "" {
+		return currency.String
+	}
+	return DefaultCurrency
+}
+
+// nullID stores the zero ID as NULL.
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// nullString stores "" as NULL.
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// currencyValue returns the currency to store for an amount in currency.
+func currencyValue(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
 
+// SQLDbCreate creates the tables as they were before the schema was
+// versioned. Migrate runs it inside a transaction as the first version of the
+// schema and brings it up to date from there.
+var SQLDbCreate = `
 CREATE TABLE account (
 	id integer PRIMARY KEY,
 	name text
@@ -82,432 +125,2948 @@ CREATE TABLE posted_purchase (
 	FOREIGN KEY (transaction_id) REFERENCES gl_transaction (id)
 );
 
-COMMIT;
 `
 
-type AccountTable struct {
-	DB *sql.DB
-}
+// PostgresDbCreate is SQLDbCreate for Postgres. Quantities are numeric so
+// they can be summed in SQL, costs are exact text, generated IDs come from
+// sequences and text sorts byte by byte as it does in SQLite.
+var PostgresDbCreate = `
+CREATE TABLE account (
+	id integer PRIMARY KEY,
+	name text COLLATE "C"
+);
 
-func (a AccountTable) Save(ctx context.Context, acct Account) error {
-	_, err := a.DB.ExecContext(ctx,
-		"INSERT INTO account(id, name) VALUES (?, ?)",
-		acct.ID, acct.Name)
-	return err
-}
+CREATE SEQUENCE gl_transaction_id_seq;
 
-func (a AccountTable) Get(ctx context.Context, id int) (Account, error) {
-	var (
-		acct Account
-		err  error
-	)
+CREATE TABLE gl_transaction (
+	id integer,
+	account_id integer REFERENCES account (id),
+	debit bigint,
+	credit bigint,
+	memo text COLLATE "C",
+	timestamp bigint,
+	PRIMARY KEY (id, account_id)
+);
 
-	row := a.DB.QueryRowContext(ctx,
-		"SELECT id, name FROM account WHERE id=?",
-		id)
+CREATE TABLE item (
+	id serial PRIMARY KEY,
+	name text COLLATE "C"
+);
 
-	err = row.Scan(&acct.ID, &acct.Name)
+CREATE TABLE inventory_transaction (
+	id serial PRIMARY KEY,
+	account_id integer REFERENCES account (id),
+	item_id integer REFERENCES item (id),
+	qty_in numeric(78, 0),
+	qty_out numeric(78, 0),
+	cost text,
+	memo text COLLATE "C",
+	timestamp bigint
+);
 
-	return acct, err
-}
+CREATE TABLE vendor (
+	id serial PRIMARY KEY,
+	name text COLLATE "C"
+);
 
-type ItemTable struct {
-	DB *sql.DB
-}
+CREATE TABLE purchase (
+	id serial PRIMARY KEY,
+	vendor_id integer REFERENCES vendor (id),
+	payable_acct_id integer REFERENCES account (id),
+	amount bigint,
+	timestamp bigint
+);
 
-func (i ItemTable) Save(ctx context.Context, item Item) error {
-	_, err := i.DB.ExecContext(ctx,
-		"INSERT INTO item(id, name) VALUES (?, ?)",
-		item.ID, item.Name)
-	return err
+CREATE TABLE purchase_item (
+	purchase_id integer REFERENCES purchase (id),
+	item_id integer REFERENCES item (id),
+	inventory_account_id integer REFERENCES account (id),
+	qty numeric(78, 0),
+	cost text,
+	amount bigint,
+	PRIMARY KEY (purchase_id, item_id)
+);
+
+CREATE TABLE posted_purchase (
+	purchase_id integer PRIMARY KEY REFERENCES purchase (id),
+	transaction_id integer,
+	timestamp bigint
+);
+`
+
+type AccountTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
 }
 
-func (i ItemTable) Get(ctx context.Context, id int) (Item, error) {
-	var (
-		item Item
-		err  error
-	)
+func (a AccountTable) Save(ctx context.Context, acct Account) error {
+	if err := acct.Validate(); err != nil {
+		return err
+	}
 
-	row := i.DB.QueryRowContext(ctx,
-		"SELECT id, name FROM item WHERE id=?",
-		id)
+	tx, err := begin(ctx, a.DB, a.tx)
+	if err != nil {
+		return a.Dialect.wrap(err, "account %d", acct.ID)
+	}
+	defer tx.Rollback()
 
-	err = row.Scan(&item.ID, &item.Name)
+	if _, err = a.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO account(id, name) VALUES (?, ?)",
+		acct.ID, acct.Name); err != nil {
+		return a.Dialect.wrap(err, "account %d", acct.ID)
+	}
 
-	return item, err
-}
+	if err = a.Dialect.audit(ctx, tx, "save", "account", acct.ID, nil, acct); err != nil {
+		return a.Dialect.wrap(err, "account %d", acct.ID)
+	}
 
-type VendorTable struct {
-	DB *sql.DB
+	return a.Dialect.wrap(tx.Commit(), "account %d", acct.ID)
 }
 
-func (v VendorTable) Save(ctx context.Context, vendor Vendor) error {
-	_, err := v.DB.ExecContext(ctx,
-		"INSERT INTO vendor(id, name) VALUES (?, ?)",
-		vendor.ID, vendor.Name)
-	return err
+func (a AccountTable) Get(ctx context.Context, id int) (Account, error) {
+	return a.get(ctx, conn(a.DB, a.tx), id)
 }
 
-func (v VendorTable) Get(ctx context.Context, id int) (Vendor, error) {
-	var (
-		vendor Vendor
-		err    error
-	)
+func (a AccountTable) get(ctx context.Context, db querier, id int) (Account, error) {
+	var acct Account
 
-	row := v.DB.QueryRowContext(ctx,
-		"SELECT id, name FROM vendor WHERE id=?",
+	row := a.Dialect.bind(db).QueryRowContext(ctx,
+		"SELECT id, name, archived_at IS NOT NULL FROM account WHERE id=?",
 		id)
 
-	err = row.Scan(&vendor.ID, &vendor.Name)
+	err := row.Scan(&acct.ID, &acct.Name, &acct.Archived)
 
-	return vendor, err
+	return acct, a.Dialect.wrap(err, "account %d", id)
 }
 
-type PurchaseTable struct {
-	DB *sql.DB
-	PurchaseItemTable
+func (a AccountTable) Update(ctx context.Context, acct Account) error {
+	tx, err := begin(ctx, a.DB, a.tx)
+	if err != nil {
+		return a.Dialect.wrap(err, "account %d", acct.ID)
+	}
+	defer tx.Rollback()
+
+	before, err := a.get(ctx, tx, acct.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = a.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE account SET name=? WHERE id=?",
+		acct.Name, acct.ID); err != nil {
+		return a.Dialect.wrap(err, "account %d", acct.ID)
+	}
+
+	after := before
+	after.Name = acct.Name
+	if err = a.Dialect.audit(ctx, tx, "update", "account", acct.ID, before, after); err != nil {
+		return a.Dialect.wrap(err, "account %d", acct.ID)
+	}
+
+	return a.Dialect.wrap(tx.Commit(), "account %d", acct.ID)
 }
 
-func (p PurchaseTable) Save(
-	ctx context.Context,
-	purchase Purchase,
-) (int, error) {
-	var purchaseID int
-	tx, err := p.DB.BeginTx(ctx, nil)
+// Archive hides the account from List. Accounts used by purchases or ledger
+// rows cannot be archived and return ErrInUse.
+func (a AccountTable) Archive(ctx context.Context, id int) error {
+	tx, err := begin(ctx, a.DB, a.tx)
+	if err != nil {
+		return a.Dialect.wrap(err, "account %d", id)
+	}
 	defer tx.Rollback()
+
+	var used bool
+	err = a.Dialect.bind(tx).QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM purchase WHERE payable_acct_id=?
+			UNION ALL SELECT 1 FROM purchase_item WHERE inventory_account_id=?
+			UNION ALL SELECT 1 FROM vendor_payment WHERE payable_acct_id=? OR payment_acct_id=?
+			UNION ALL SELECT 1 FROM invoice WHERE receivable_acct_id=?
+			UNION ALL SELECT 1 FROM invoice_line WHERE account_id=? OR inventory_account_id=? OR cost_account_id=?
+			UNION ALL SELECT 1 FROM customer_receipt WHERE receivable_acct_id=? OR deposit_acct_id=?
+			UNION ALL SELECT 1 FROM gl_transaction WHERE account_id=?
+			UNION ALL SELECT 1 FROM inventory_transaction WHERE account_id=?
+		)`, id, id, id, id, id, id, id, id, id, id, id, id).Scan(&used)
 	if err != nil {
-		return purchaseID, err
+		return a.Dialect.wrap(err, "account %d", id)
 	}
 
-	res, err := tx.ExecContext(ctx, `
-		INSERT INTO purchase
-		(vendor_id, payable_acct_id, amount, timestamp) VALUES 
-		(?, ?, ?, ?)`,
-		purchase.Vendor.ID,
-		purchase.PayableAccount.ID,
-		purchase.Amount,
-		purchase.Date.UTC().Unix(),
-	)
+	if used {
+		return fmt.Errorf("%w: account %d", ErrInUse, id)
+	}
 
+	before, err := a.get(ctx, tx, id)
 	if err != nil {
-		return purchaseID, err
+		return err
 	}
 
-	id, err := res.LastInsertId()
+	res, err := a.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE account SET archived_at=? WHERE id=? AND archived_at IS NULL",
+		time.Now().UTC().Unix(), id)
 	if err != nil {
-		return purchaseID, err
+		return a.Dialect.wrap(err, "account %d", id)
 	}
 
-	purchaseID = int(id)
-
-	for _, item := range purchase.Items {
-		if err := p.SaveItem(ctx, tx, purchaseID, item); err != nil {
-			return purchaseID, err
-		}
+	if err = requireRow(res); err != nil {
+		return a.Dialect.wrap(err, "account %d", id)
 	}
 
-	return purchaseID, tx.Commit()
-}
+	after := before
+	after.Archived = true
+	if err = a.Dialect.audit(ctx, tx, "archive", "account", id, before, after); err != nil {
+		return a.Dialect.wrap(err, "account %d", id)
+	}
 
-type Scanner interface {
-	Scan(dest ...interface{}) error
+	return a.Dialect.wrap(tx.Commit(), "account %d", id)
 }
 
-func (p PurchaseTable) Get(ctx context.Context, id int) (Purchase, error) {
-	row := p.DB.QueryRowContext(ctx, `
-		SELECT 
-		purchase.id, 
-		purchase.vendor_id,
-		vendor.name,
-		purchase.payable_acct_id,
-		account.id,
-		purchase.amount,
-		purchase.timestamp
-		FROM purchase
-		INNER JOIN vendor on vendor.id = purchase.vendor_id
-		INNER JOIN account on account.id = purchase.payable_acct_id
-		WHERE purchase.id=?`, id)
-
-	return p.marshalFromScanner(ctx, row)
+var accountList = listSpec{
+	columns: []string{"account.id", "account.name", "account.archived_at IS NOT NULL"},
+	from:    "account",
+	sorts: map[string]string{
+		"id":   "account.id",
+		"name": "account.name",
+	},
+	keys: []string{"account.id"},
 }
 
-func (p PurchaseTable) marshalFromScanner(
-	ctx context.Context,
-	scanner Scanner,
-) (Purchase, error) {
+// List returns accounts filtered by ID and name, sortable by "id" or "name".
+func (a AccountTable) List(ctx context.Context, opts ListOptions) ([]Account, string, error) {
 	var (
-		purchase  Purchase
-		timestamp int64
-		err       error
+		accts []Account
+		query = listQuery{dialect: a.Dialect}
 	)
 
-	if err = scanner.Scan(
-		&purchase.ID,
-		&purchase.Vendor.ID,
-		&purchase.Vendor.Name,
-		&purchase.PayableAccount.ID,
-		&purchase.PayableAccount.Name,
-		&purchase.Amount,
-		&timestamp,
-	); err != nil {
-		return purchase, err
+	query.search("account.name", opts)
+	if !opts.IncludeArchived {
+		query.add("account.archived_at IS NULL")
+	}
+	if opts.AccountID != 0 {
+		query.add("account.id=?", opts.AccountID)
 	}
 
-	purchase.Date = time.Unix(timestamp, 0).UTC()
-	purchase.Items, err = p.GetItems(ctx, p.DB, purchase.ID)
-
-	return purchase, err
-}
+	cursor, err := list(ctx, a.Dialect.bind(conn(a.DB, a.tx)), accountList, opts, query, func(scanner Scanner) error {
+		var acct Account
+		err := scanner.Scan(&acct.ID, &acct.Name, &acct.Archived)
+		accts = append(accts, acct)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
 
-type PurchaseItemTable struct {
+	return accts, cursor, nil
 }
 
-func (p PurchaseItemTable) SaveItem(
-	ctx context.Context,
-	tx *sql.Tx,
-	purchaseID int,
-	item PurchaseItem,
-) error {
-	_, err := tx.ExecContext(ctx,
-		`INSERT INTO purchase_item
-			(purchase_id, item_id, inventory_account_id, qty, cost, amount) VALUES 
-			(?, ?, ?, ?, ?, ?);`,
-		purchaseID,
-		item.Item.ID,
-		item.InventoryAccount.ID,
-		item.Qty.Text(inventoryBase),
-		item.Cost,
-		item.Amount,
-	)
-	return err
+type ItemTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
 }
 
-func (p PurchaseItemTable) GetItems(ctx context.Context, db *sql.DB, purchaseID int) ([]PurchaseItem, error) {
-	var items []PurchaseItem
-	rows, err := db.QueryContext(ctx,
-		`
-		SELECT 
-			purchase_item.item_id,
-			item.name,
-			purchase_item.inventory_account_id,
-			account.name,
-			purchase_item.qty,
-			purchase_item.cost,
-			purchase_item.amount
-		FROM purchase_item
-		INNER JOIN item on item.id = purchase_item.item_id
-		INNER JOIN account on account.id = purchase_item.inventory_account_id
-		WHERE purchase_item.purchase_id=?`, purchaseID)
-
+func (i ItemTable) Save(ctx context.Context, item Item) error {
+	tx, err := begin(ctx, i.DB, i.tx)
 	if err != nil {
-		if rows != nil {
-			rows.Close()
-		}
-
-		return nil, err
-	}
-
-	for rows.Next() && err == nil {
-		qty := ""
-		items = append(items, PurchaseItem{})
-		i := len(items) - 1
-		err = rows.Scan(
-			&items[i].Item.ID,
-			&items[i].Item.Name,
-			&items[i].InventoryAccount.ID,
-			&items[i].InventoryAccount.Name,
-			&qty,
-			&items[i].Cost,
-			&items[i].Amount,
-		)
-		items[i].Qty = big.NewInt(0)
-		items[i].Qty.SetString(qty, inventoryBase)
+		return i.Dialect.wrap(err, "item %d", item.ID)
 	}
+	defer tx.Rollback()
 
-	rows.Close()
-	if err != nil {
-		return nil, err
+	if _, err = i.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO item(id, name) VALUES (?, ?)",
+		item.ID, item.Name); err != nil {
+		return i.Dialect.wrap(err, "item %d", item.ID)
 	}
 
-	if rows.Err() != nil {
-		return nil, rows.Err()
+	if err = i.Dialect.audit(ctx, tx, "save", "item", item.ID, nil, item); err != nil {
+		return i.Dialect.wrap(err, "item %d", item.ID)
 	}
 
-	return items, nil
+	return i.Dialect.wrap(tx.Commit(), "item %d", item.ID)
 }
 
-type GLTransactionTable struct {
-	DB *sql.DB
+func (i ItemTable) Get(ctx context.Context, id int) (Item, error) {
+	return i.get(ctx, conn(i.DB, i.tx), id)
 }
 
-func (g GLTransactionTable) NextID(ctx context.Context) (int, error) {
-	var nextNum int
-	row := g.DB.QueryRowContext(
-		ctx,
-		"SELECT id FROM gl_transaction ORDER BY id DESC LIMIT 1;",
-	)
+func (i ItemTable) get(ctx context.Context, db querier, id int) (Item, error) {
+	var item Item
 
-	err := row.Scan(&nextNum)
-	if err == sql.ErrNoRows {
-		return 1, nil
-	}
+	row := i.Dialect.bind(db).QueryRowContext(ctx,
+		"SELECT id, name, archived_at IS NOT NULL FROM item WHERE id=?",
+		id)
 
-	if err != nil {
-		return -1, err
-	}
+	err := row.Scan(&item.ID, &item.Name, &item.Archived)
 
-	return nextNum + 1, nil
+	return item, i.Dialect.wrap(err, "item %d", id)
 }
 
-func (g GLTransactionTable) Save(ctx context.Context, transactions []GLTransaction) error {
-	tx, err := g.DB.BeginTx(ctx, nil)
+func (i ItemTable) Update(ctx context.Context, item Item) error {
+	tx, err := begin(ctx, i.DB, i.tx)
 	if err != nil {
-		return nil
+		return i.Dialect.wrap(err, "item %d", item.ID)
 	}
 	defer tx.Rollback()
 
-	for _, transaction := range transactions {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO gl_transaction
-				(id, account_id, debit, credit, memo, timestamp) VALUES 
-				(?, ?, ?, ?, ?, ?)`,
-			transaction.ID,
-			transaction.Account.ID,
-			transaction.Debit,
-			transaction.Credit,
-			transaction.Memo,
-			transaction.Date.UTC().Unix(),
-		); err != nil {
-			return err
-		}
+	before, err := i.get(ctx, tx, item.ID)
+	if err != nil {
+		return err
 	}
 
-	tx.Commit()
-	return nil
+	if _, err = i.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE item SET name=? WHERE id=?",
+		item.Name, item.ID); err != nil {
+		return i.Dialect.wrap(err, "item %d", item.ID)
+	}
+
+	after := before
+	after.Name = item.Name
+	if err = i.Dialect.audit(ctx, tx, "update", "item", item.ID, before, after); err != nil {
+		return i.Dialect.wrap(err, "item %d", item.ID)
+	}
+
+	return i.Dialect.wrap(tx.Commit(), "item %d", item.ID)
 }
 
-func (g GLTransactionTable) Get(ctx context.Context, id int) ([]GLTransaction, error) {
-	var (
-		transactions []GLTransaction
-		timestamp    int64
-		err          error
-	)
+// Archive hides the item from List. Items used by purchases or inventory
+// transactions cannot be archived and return ErrInUse.
+func (i ItemTable) Archive(ctx context.Context, id int) error {
+	tx, err := begin(ctx, i.DB, i.tx)
+	if err != nil {
+		return i.Dialect.wrap(err, "item %d", id)
+	}
+	defer tx.Rollback()
 
-	rows, err := g.DB.QueryContext(ctx, `
-		SELECT 
-			gl_transaction.id, 
-			gl_transaction.account_id,
-			account.name,
-			gl_transaction.debit,
-			gl_transaction.credit,
-			gl_transaction.memo,
-			gl_transaction.timestamp
-		FROM gl_transaction
-		INNER JOIN account ON account.id = gl_transaction.account_id
-		WHERE id=?`, id)
+	var used bool
+	err = i.Dialect.bind(tx).QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM purchase_item WHERE item_id=?
+			UNION ALL SELECT 1 FROM invoice_line WHERE item_id=?
+			UNION ALL SELECT 1 FROM inventory_transaction WHERE item_id=?
+		)`, id, id, id).Scan(&used)
 	if err != nil {
-		return nil, nil
+		return i.Dialect.wrap(err, "item %d", id)
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		transactions = append(transactions, GLTransaction{})
-		i := len(transactions) - 1
-		err = rows.Scan(
-			&transactions[i].ID,
-			&transactions[i].Account.ID,
-			&transactions[i].Account.Name,
-			&transactions[i].Debit,
-			&transactions[i].Credit,
-			&transactions[i].Memo,
-			&timestamp,
-		)
-		transactions[i].Date = time.Unix(timestamp, 0)
+	if used {
+		return fmt.Errorf("%w: item %d", ErrInUse, id)
 	}
 
+	before, err := i.get(ctx, tx, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if rows.Err() != nil {
-		return nil, rows.Err()
+	res, err := i.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE item SET archived_at=? WHERE id=? AND archived_at IS NULL",
+		time.Now().UTC().Unix(), id)
+	if err != nil {
+		return i.Dialect.wrap(err, "item %d", id)
+	}
+
+	if err = requireRow(res); err != nil {
+		return i.Dialect.wrap(err, "item %d", id)
 	}
 
-	return transactions, err
+	after := before
+	after.Archived = true
+	if err = i.Dialect.audit(ctx, tx, "archive", "item", id, before, after); err != nil {
+		return i.Dialect.wrap(err, "item %d", id)
+	}
+
+	return i.Dialect.wrap(tx.Commit(), "item %d", id)
 }
 
-type InventoryTransactionTable struct {
-	DB *sql.DB
+var itemList = listSpec{
+	columns: []string{"item.id", "item.name", "item.archived_at IS NOT NULL"},
+	from:    "item",
+	sorts: map[string]string{
+		"id":   "item.id",
+		"name": "item.name",
+	},
+	keys: []string{"item.id"},
+}
+
+// List returns items filtered by ID and name, sortable by "id" or "name".
+func (i ItemTable) List(ctx context.Context, opts ListOptions) ([]Item, string, error) {
+	var (
+		items []Item
+		query = listQuery{dialect: i.Dialect}
+	)
+
+	query.search("item.name", opts)
+	if !opts.IncludeArchived {
+		query.add("item.archived_at IS NULL")
+	}
+	if opts.ItemID != 0 {
+		query.add("item.id=?", opts.ItemID)
+	}
+
+	cursor, err := list(ctx, i.Dialect.bind(conn(i.DB, i.tx)), itemList, opts, query, func(scanner Scanner) error {
+		var item Item
+		err := scanner.Scan(&item.ID, &item.Name, &item.Archived)
+		items = append(items, item)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return items, cursor, nil
+}
+
+type VendorTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (v VendorTable) Save(ctx context.Context, vendor Vendor) error {
+	tx, err := begin(ctx, v.DB, v.tx)
+	if err != nil {
+		return v.Dialect.wrap(err, "vendor %d", vendor.ID)
+	}
+	defer tx.Rollback()
+
+	if _, err = v.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO vendor(id, name) VALUES (?, ?)",
+		vendor.ID, vendor.Name); err != nil {
+		return v.Dialect.wrap(err, "vendor %d", vendor.ID)
+	}
+
+	if err = v.Dialect.audit(ctx, tx, "save", "vendor", vendor.ID, nil, vendor); err != nil {
+		return v.Dialect.wrap(err, "vendor %d", vendor.ID)
+	}
+
+	return v.Dialect.wrap(tx.Commit(), "vendor %d", vendor.ID)
+}
+
+func (v VendorTable) Get(ctx context.Context, id int) (Vendor, error) {
+	return v.get(ctx, conn(v.DB, v.tx), id)
+}
+
+func (v VendorTable) get(ctx context.Context, db querier, id int) (Vendor, error) {
+	var vendor Vendor
+
+	row := v.Dialect.bind(db).QueryRowContext(ctx,
+		"SELECT id, name, archived_at IS NOT NULL FROM vendor WHERE id=?",
+		id)
+
+	err := row.Scan(&vendor.ID, &vendor.Name, &vendor.Archived)
+
+	return vendor, v.Dialect.wrap(err, "vendor %d", id)
+}
+
+func (v VendorTable) Update(ctx context.Context, vendor Vendor) error {
+	tx, err := begin(ctx, v.DB, v.tx)
+	if err != nil {
+		return v.Dialect.wrap(err, "vendor %d", vendor.ID)
+	}
+	defer tx.Rollback()
+
+	before, err := v.get(ctx, tx, vendor.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = v.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE vendor SET name=? WHERE id=?",
+		vendor.Name, vendor.ID); err != nil {
+		return v.Dialect.wrap(err, "vendor %d", vendor.ID)
+	}
+
+	after := before
+	after.Name = vendor.Name
+	if err = v.Dialect.audit(ctx, tx, "update", "vendor", vendor.ID, before, after); err != nil {
+		return v.Dialect.wrap(err, "vendor %d", vendor.ID)
+	}
+
+	return v.Dialect.wrap(tx.Commit(), "vendor %d", vendor.ID)
+}
+
+// Archive hides the vendor from List. Vendors used by purchases cannot be
+// archived and return ErrInUse.
+func (v VendorTable) Archive(ctx context.Context, id int) error {
+	tx, err := begin(ctx, v.DB, v.tx)
+	if err != nil {
+		return v.Dialect.wrap(err, "vendor %d", id)
+	}
+	defer tx.Rollback()
+
+	var used bool
+	err = v.Dialect.bind(tx).QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM purchase WHERE vendor_id=?
+			UNION ALL SELECT 1 FROM vendor_payment WHERE vendor_id=?
+		)`, id, id).Scan(&used)
+	if err != nil {
+		return v.Dialect.wrap(err, "vendor %d", id)
+	}
+
+	if used {
+		return fmt.Errorf("%w: vendor %d", ErrInUse, id)
+	}
+
+	before, err := v.get(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := v.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE vendor SET archived_at=? WHERE id=? AND archived_at IS NULL",
+		time.Now().UTC().Unix(), id)
+	if err != nil {
+		return v.Dialect.wrap(err, "vendor %d", id)
+	}
+
+	if err = requireRow(res); err != nil {
+		return v.Dialect.wrap(err, "vendor %d", id)
+	}
+
+	after := before
+	after.Archived = true
+	if err = v.Dialect.audit(ctx, tx, "archive", "vendor", id, before, after); err != nil {
+		return v.Dialect.wrap(err, "vendor %d", id)
+	}
+
+	return v.Dialect.wrap(tx.Commit(), "vendor %d", id)
+}
+
+var vendorList = listSpec{
+	columns: []string{"vendor.id", "vendor.name", "vendor.archived_at IS NOT NULL"},
+	from:    "vendor",
+	sorts: map[string]string{
+		"id":   "vendor.id",
+		"name": "vendor.name",
+	},
+	keys: []string{"vendor.id"},
+}
+
+// List returns vendors filtered by ID and name, sortable by "id" or "name".
+func (v VendorTable) List(ctx context.Context, opts ListOptions) ([]Vendor, string, error) {
+	var (
+		vendors []Vendor
+		query   = listQuery{dialect: v.Dialect}
+	)
+
+	query.search("vendor.name", opts)
+	if !opts.IncludeArchived {
+		query.add("vendor.archived_at IS NULL")
+	}
+	if opts.VendorID != 0 {
+		query.add("vendor.id=?", opts.VendorID)
+	}
+
+	cursor, err := list(ctx, v.Dialect.bind(conn(v.DB, v.tx)), vendorList, opts, query, func(scanner Scanner) error {
+		var vendor Vendor
+		err := scanner.Scan(&vendor.ID, &vendor.Name, &vendor.Archived)
+		vendors = append(vendors, vendor)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return vendors, cursor, nil
+}
+
+type CustomerTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (c CustomerTable) Save(ctx context.Context, customer Customer) error {
+	tx, err := begin(ctx, c.DB, c.tx)
+	if err != nil {
+		return c.Dialect.wrap(err, "customer %d", customer.ID)
+	}
+	defer tx.Rollback()
+
+	if _, err = c.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO customer(id, name) VALUES (?, ?)",
+		customer.ID, customer.Name); err != nil {
+		return c.Dialect.wrap(err, "customer %d", customer.ID)
+	}
+
+	if err = c.Dialect.audit(ctx, tx, "save", "customer", customer.ID, nil, customer); err != nil {
+		return c.Dialect.wrap(err, "customer %d", customer.ID)
+	}
+
+	return c.Dialect.wrap(tx.Commit(), "customer %d", customer.ID)
+}
+
+func (c CustomerTable) Get(ctx context.Context, id int) (Customer, error) {
+	return c.get(ctx, conn(c.DB, c.tx), id)
+}
+
+func (c CustomerTable) get(ctx context.Context, db querier, id int) (Customer, error) {
+	var customer Customer
+
+	row := c.Dialect.bind(db).QueryRowContext(ctx,
+		"SELECT id, name, archived_at IS NOT NULL FROM customer WHERE id=?",
+		id)
+
+	err := row.Scan(&customer.ID, &customer.Name, &customer.Archived)
+
+	return customer, c.Dialect.wrap(err, "customer %d", id)
+}
+
+func (c CustomerTable) Update(ctx context.Context, customer Customer) error {
+	tx, err := begin(ctx, c.DB, c.tx)
+	if err != nil {
+		return c.Dialect.wrap(err, "customer %d", customer.ID)
+	}
+	defer tx.Rollback()
+
+	before, err := c.get(ctx, tx, customer.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE customer SET name=? WHERE id=?",
+		customer.Name, customer.ID); err != nil {
+		return c.Dialect.wrap(err, "customer %d", customer.ID)
+	}
+
+	after := before
+	after.Name = customer.Name
+	if err = c.Dialect.audit(ctx, tx, "update", "customer", customer.ID, before, after); err != nil {
+		return c.Dialect.wrap(err, "customer %d", customer.ID)
+	}
+
+	return c.Dialect.wrap(tx.Commit(), "customer %d", customer.ID)
+}
+
+// Archive hides the customer from List. Customers used by invoices or
+// receipts cannot be archived and return ErrInUse.
+func (c CustomerTable) Archive(ctx context.Context, id int) error {
+	tx, err := begin(ctx, c.DB, c.tx)
+	if err != nil {
+		return c.Dialect.wrap(err, "customer %d", id)
+	}
+	defer tx.Rollback()
+
+	var used bool
+	err = c.Dialect.bind(tx).QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM invoice WHERE customer_id=?
+			UNION ALL SELECT 1 FROM customer_receipt WHERE customer_id=?
+		)`, id, id).Scan(&used)
+	if err != nil {
+		return c.Dialect.wrap(err, "customer %d", id)
+	}
+
+	if used {
+		return fmt.Errorf("%w: customer %d", ErrInUse, id)
+	}
+
+	before, err := c.get(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE customer SET archived_at=? WHERE id=? AND archived_at IS NULL",
+		time.Now().UTC().Unix(), id)
+	if err != nil {
+		return c.Dialect.wrap(err, "customer %d", id)
+	}
+
+	if err = requireRow(res); err != nil {
+		return c.Dialect.wrap(err, "customer %d", id)
+	}
+
+	after := before
+	after.Archived = true
+	if err = c.Dialect.audit(ctx, tx, "archive", "customer", id, before, after); err != nil {
+		return c.Dialect.wrap(err, "customer %d", id)
+	}
+
+	return c.Dialect.wrap(tx.Commit(), "customer %d", id)
+}
+
+var customerList = listSpec{
+	columns: []string{"customer.id", "customer.name", "customer.archived_at IS NOT NULL"},
+	from:    "customer",
+	sorts: map[string]string{
+		"id":   "customer.id",
+		"name": "customer.name",
+	},
+	keys: []string{"customer.id"},
+}
+
+// List returns customers filtered by ID and name, sortable by "id" or "name".
+func (c CustomerTable) List(ctx context.Context, opts ListOptions) ([]Customer, string, error) {
+	var (
+		customers []Customer
+		query     = listQuery{dialect: c.Dialect}
+	)
+
+	query.search("customer.name", opts)
+	if !opts.IncludeArchived {
+		query.add("customer.archived_at IS NULL")
+	}
+	if opts.CustomerID != 0 {
+		query.add("customer.id=?", opts.CustomerID)
+	}
+
+	cursor, err := list(ctx, c.Dialect.bind(conn(c.DB, c.tx)), customerList, opts, query, func(scanner Scanner) error {
+		var customer Customer
+		err := scanner.Scan(&customer.ID, &customer.Name, &customer.Archived)
+		customers = append(customers, customer)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return customers, cursor, nil
+}
+
+type PurchaseTable struct {
+	DB *sql.DB
+	PurchaseItemTable
+	tx *sql.Tx
+}
+
+func (p PurchaseTable) Save(
+	ctx context.Context,
+	purchase Purchase,
+) (int, error) {
+	if err := purchase.Validate(); err != nil {
+		return -1, err
+	}
+
+	tx, err := begin(ctx, p.DB, p.tx)
+	if err != nil {
+		return -1, p.Dialect.wrap(err, "purchase")
+	}
+	defer tx.Rollback()
+
+	refs := map[string][]int{"vendor": {purchase.Vendor.ID}, "account": {purchase.PayableAccount.ID}}
+	for _, item := range purchase.Items {
+		refs["item"] = append(refs["item"], item.Item.ID)
+		refs["account"] = append(refs["account"], item.InventoryAccount.ID)
+	}
+	if err = requireActive(ctx, tx, p.Dialect, refs); err != nil {
+		return -1, err
+	}
+
+	purchaseID, err := p.Dialect.insert(ctx, tx, `
+		INSERT INTO purchase
+		(vendor_id, payable_acct_id, amount, timestamp, currency) VALUES 
+		(?, ?, ?, ?, ?)`,
+		purchase.Vendor.ID,
+		purchase.PayableAccount.ID,
+		ledgerAmount(purchase.Amount),
+		purchase.Date.UTC().Unix(),
+		currencyValue(purchase.Amount.Currency()),
+	)
+
+	if err != nil {
+		return -1, p.Dialect.wrap(err, "purchase")
+	}
+
+	for i, item := range purchase.Items {
+		if err := p.SaveItem(ctx, tx.Tx, purchaseID, i+1, item); err != nil {
+			return -1, err
+		}
+	}
+
+	purchase.ID = purchaseID
+	if err = p.Dialect.audit(ctx, tx, "save", "purchase", purchaseID, nil, purchase); err != nil {
+		return -1, p.Dialect.wrap(err, "purchase %d", purchaseID)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return -1, p.Dialect.wrap(err, "purchase %d", purchaseID)
+	}
+
+	return purchaseID, nil
+}
+
+// requireActive refuses with ErrArchived a new document referring to an
+// archived record. refs holds the IDs referred to by table: account, item,
+// vendor or customer. Zero IDs, and IDs of missing records, which the
+// foreign keys refuse, are skipped.
+func requireActive(ctx context.Context, db querier, d Dialect, refs map[string][]int) error {
+	for _, table := range []string{"vendor", "customer", "account", "item"} {
+		for _, id := range refs[table] {
+			if id == 0 {
+				continue
+			}
+
+			var archived bool
+			err := d.bind(db).QueryRowContext(ctx,
+				"SELECT archived_at IS NOT NULL FROM "+table+" WHERE id=?", id).Scan(&archived)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return d.wrap(err, "%s %d", table, id)
+			}
+			if archived {
+				return fmt.Errorf("%w: %s %d", ErrArchived, table, id)
+			}
+		}
+	}
+	return nil
+}
+
+// requireRow reports sql.ErrNoRows when a statement changed nothing.
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (p PurchaseTable) Get(ctx context.Context, id int) (Purchase, error) {
+	row := p.Dialect.bind(conn(p.DB, p.tx)).QueryRowContext(ctx, `
+		SELECT 
+		purchase.id, 
+		purchase.vendor_id,
+		vendor.name,
+		purchase.payable_acct_id,
+		account.name,
+		purchase.amount,
+		purchase.timestamp,
+		purchase.currency
+		FROM purchase
+		INNER JOIN vendor on vendor.id = purchase.vendor_id
+		INNER JOIN account on account.id = purchase.payable_acct_id
+		WHERE purchase.id=?`, id)
+
+	purchase, err := p.marshalFromScanner(ctx, row)
+	return purchase, p.Dialect.wrap(err, "purchase %d", id)
+}
+
+func (p PurchaseTable) marshalFromScanner(
+	ctx context.Context,
+	scanner Scanner,
+) (Purchase, error) {
+	purchase, err := scanPurchase(scanner)
+	if err != nil {
+		return purchase, err
+	}
+
+	err = p.loadItems(ctx, &purchase)
+	return purchase, err
+}
+
+func scanPurchase(scanner Scanner) (Purchase, error) {
+	var (
+		purchase  = Purchase{Amount: Cents(0)}
+		timestamp int64
+		currency  sql.NullString
+	)
+
+	if err := scanner.Scan(
+		&purchase.ID,
+		&purchase.Vendor.ID,
+		&purchase.Vendor.Name,
+		&purchase.PayableAccount.ID,
+		&purchase.PayableAccount.Name,
+		&purchase.Amount,
+		&timestamp,
+		&currency,
+	); err != nil {
+		return purchase, err
+	}
+
+	purchase.Date = time.Unix(timestamp, 0).UTC()
+	purchase.Amount.currency = currencyOf(currency)
+
+	return purchase, nil
+}
+
+func (p PurchaseTable) loadItems(ctx context.Context, purchase *Purchase) error {
+	var err error
+	purchase.Items, err = p.GetItems(ctx, conn(p.DB, p.tx), purchase.ID)
+
+	for i := range purchase.Items {
+		purchase.Items[i].Cost.currency = purchase.Amount.currency
+		purchase.Items[i].Amount.currency = purchase.Amount.currency
+	}
+
+	return err
+}
+
+var purchaseList = listSpec{
+	columns: []string{
+		"purchase.id",
+		"purchase.vendor_id",
+		"vendor.name",
+		"purchase.payable_acct_id",
+		"account.name",
+		"purchase.amount",
+		"purchase.timestamp",
+		"purchase.currency",
+	},
+	from: `purchase
+		INNER JOIN vendor on vendor.id = purchase.vendor_id
+		INNER JOIN account on account.id = purchase.payable_acct_id`,
+	sorts: map[string]string{
+		"id":     "purchase.id",
+		"date":   "purchase.timestamp",
+		"amount": "purchase.amount",
+	},
+	keys: []string{"purchase.id"},
+}
+
+// List returns purchases with their items filtered by date, vendor, item,
+// account and vendor name, sortable by "id", "date" or "amount". AccountID
+// matches either the payable account or an item's inventory account.
+func (p PurchaseTable) List(ctx context.Context, opts ListOptions) ([]Purchase, string, error) {
+	var (
+		purchases []Purchase
+		query     = listQuery{dialect: p.Dialect}
+	)
+
+	query.dateRange("purchase.timestamp", opts)
+	query.search("vendor.name", opts)
+	if opts.VendorID != 0 {
+		query.add("purchase.vendor_id=?", opts.VendorID)
+	}
+	if opts.ItemID != 0 {
+		query.add(`EXISTS (SELECT 1 FROM purchase_item
+			WHERE purchase_item.purchase_id = purchase.id AND purchase_item.item_id=?)`,
+			opts.ItemID)
+	}
+	if opts.AccountID != 0 {
+		query.add(`(purchase.payable_acct_id=? OR EXISTS (SELECT 1 FROM purchase_item
+			WHERE purchase_item.purchase_id = purchase.id AND purchase_item.inventory_account_id=?))`,
+			opts.AccountID, opts.AccountID)
+	}
+
+	cursor, err := list(ctx, p.Dialect.bind(conn(p.DB, p.tx)), purchaseList, opts, query, func(scanner Scanner) error {
+		purchase, err := scanPurchase(scanner)
+		purchases = append(purchases, purchase)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range purchases {
+		if err = p.loadItems(ctx, &purchases[i]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return purchases, cursor, nil
+}
+
+type PurchaseItemTable struct {
+	Dialect Dialect
+}
+
+// SaveItem saves item as the line'th line of the purchase, counting from 1.
+func (p PurchaseItemTable) SaveItem(
+	ctx context.Context,
+	tx *sql.Tx,
+	purchaseID int,
+	line int,
+	item PurchaseItem,
+) error {
+	_, err := p.Dialect.bind(tx).ExecContext(ctx,
+		`INSERT INTO purchase_item
+			(purchase_id, line, kind, item_id, inventory_account_id, qty, cost, amount) VALUES 
+			(?, ?, ?, ?, ?, ?, ?, ?);`,
+		purchaseID,
+		line,
+		nullString(string(item.Kind)),
+		nullID(item.Item.ID),
+		item.InventoryAccount.ID,
+		item.Qty,
+		item.Cost,
+		ledgerAmount(item.Amount),
+	)
+	return p.Dialect.wrap(err, "purchase %d line %d", purchaseID, line)
+}
+
+func (p PurchaseItemTable) GetItems(ctx context.Context, db querier, purchaseID int) ([]PurchaseItem, error) {
+	var items []PurchaseItem
+	rows, err := p.Dialect.bind(db).QueryContext(ctx,
+		`
+		SELECT 
+			purchase_item.kind,
+			purchase_item.item_id,
+			item.name,
+			purchase_item.inventory_account_id,
+			account.name,
+			purchase_item.qty,
+			purchase_item.cost,
+			purchase_item.amount
+		FROM purchase_item
+		LEFT JOIN item on item.id = purchase_item.item_id
+		INNER JOIN account on account.id = purchase_item.inventory_account_id
+		WHERE purchase_item.purchase_id=?
+		ORDER BY purchase_item.line`, purchaseID)
+
+	if err != nil {
+		if rows != nil {
+			rows.Close()
+		}
+
+		return nil, err
+	}
+
+	for rows.Next() && err == nil {
+		items = append(items, PurchaseItem{
+			Qty:    NewQuantity(nil, EtherDecimals),
+			Cost:   UnitCost{currency: DefaultCurrency},
+			Amount: Cents(0),
+		})
+		var (
+			i        = len(items) - 1
+			kind     sql.NullString
+			itemID   sql.NullInt64
+			itemName sql.NullString
+		)
+		err = rows.Scan(
+			&kind,
+			&itemID,
+			&itemName,
+			&items[i].InventoryAccount.ID,
+			&items[i].InventoryAccount.Name,
+			&items[i].Qty,
+			&items[i].Cost,
+			&items[i].Amount,
+		)
+		items[i].Kind = LineKind(kind.String)
+		items[i].Item = Item{ID: int(itemID.Int64), Name: itemName.String}
+	}
+
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return items, nil
+}
+
+type PaymentTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (p PaymentTable) Save(ctx context.Context, payment VendorPayment) (int, error) {
+	if err := payment.Validate(); err != nil {
+		return -1, err
+	}
+
+	tx, err := begin(ctx, p.DB, p.tx)
+	if err != nil {
+		return -1, p.Dialect.wrap(err, "vendor payment")
+	}
+	defer tx.Rollback()
+
+	if err = requireActive(ctx, tx, p.Dialect, map[string][]int{
+		"vendor":  {payment.Vendor.ID},
+		"account": {payment.PayableAccount.ID, payment.PaymentAccount.ID},
+	}); err != nil {
+		return -1, err
+	}
+
+	id, err := p.Dialect.insert(ctx, tx, `
+		INSERT INTO vendor_payment
+		(vendor_id, payable_acct_id, payment_acct_id, amount, currency, timestamp) VALUES
+		(?, ?, ?, ?, ?, ?)`,
+		payment.Vendor.ID,
+		payment.PayableAccount.ID,
+		payment.PaymentAccount.ID,
+		ledgerAmount(payment.Amount),
+		currencyValue(payment.Amount.Currency()),
+		payment.Date.UTC().Unix(),
+	)
+	if err != nil {
+		return -1, p.Dialect.wrap(err, "vendor payment")
+	}
+
+	for _, application := range payment.Applications {
+		if _, err = p.Dialect.bind(tx).ExecContext(ctx, `
+			INSERT INTO payment_application (payment_id, purchase_id, amount) VALUES (?, ?, ?)`,
+			id, application.PurchaseID, ledgerAmount(application.Amount),
+		); err != nil {
+			return -1, p.Dialect.wrap(err, "vendor payment %d purchase %d", id, application.PurchaseID)
+		}
+	}
+
+	payment.ID = id
+	if err = p.Dialect.audit(ctx, tx, "save", "vendor_payment", id, nil, payment); err != nil {
+		return -1, p.Dialect.wrap(err, "vendor payment %d", id)
+	}
+
+	return id, p.Dialect.wrap(tx.Commit(), "vendor payment %d", id)
+}
+
+var paymentList = listSpec{
+	columns: []string{
+		"vendor_payment.id",
+		"vendor_payment.vendor_id",
+		"vendor.name",
+		"vendor_payment.payable_acct_id",
+		"payable.name",
+		"vendor_payment.payment_acct_id",
+		"paid_from.name",
+		"vendor_payment.amount",
+		"vendor_payment.currency",
+		"vendor_payment.timestamp",
+	},
+	from: `vendor_payment
+		INNER JOIN vendor ON vendor.id = vendor_payment.vendor_id
+		INNER JOIN account payable ON payable.id = vendor_payment.payable_acct_id
+		INNER JOIN account paid_from ON paid_from.id = vendor_payment.payment_acct_id`,
+	sorts: map[string]string{
+		"id":     "vendor_payment.id",
+		"date":   "vendor_payment.timestamp",
+		"amount": "vendor_payment.amount",
+	},
+	keys: []string{"vendor_payment.id"},
+}
+
+func (p PaymentTable) Get(ctx context.Context, id int) (VendorPayment, error) {
+	row := p.Dialect.bind(conn(p.DB, p.tx)).QueryRowContext(ctx, `
+		SELECT `+strings.Join(paymentList.columns, ", ")+`
+		FROM `+paymentList.from+`
+		WHERE vendor_payment.id=?`, id)
+
+	payment, err := scanPayment(row)
+	if err != nil {
+		return payment, p.Dialect.wrap(err, "vendor payment %d", id)
+	}
+
+	err = p.loadApplications(ctx, &payment)
+	return payment, p.Dialect.wrap(err, "vendor payment %d", id)
+}
+
+// List returns vendor payments with their applications filtered by date,
+// vendor, account and vendor name, sortable by "id", "date" or "amount".
+// AccountID matches either the payable account or the account paid from.
+func (p PaymentTable) List(ctx context.Context, opts ListOptions) ([]VendorPayment, string, error) {
+	var (
+		payments []VendorPayment
+		query    = listQuery{dialect: p.Dialect}
+	)
+
+	query.dateRange("vendor_payment.timestamp", opts)
+	query.search("vendor.name", opts)
+	if opts.VendorID != 0 {
+		query.add("vendor_payment.vendor_id=?", opts.VendorID)
+	}
+	if opts.AccountID != 0 {
+		query.add("(vendor_payment.payable_acct_id=? OR vendor_payment.payment_acct_id=?)",
+			opts.AccountID, opts.AccountID)
+	}
+
+	cursor, err := list(ctx, p.Dialect.bind(conn(p.DB, p.tx)), paymentList, opts, query, func(scanner Scanner) error {
+		payment, err := scanPayment(scanner)
+		payments = append(payments, payment)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range payments {
+		if err = p.loadApplications(ctx, &payments[i]); err != nil {
+			return nil, "", p.Dialect.wrap(err, "vendor payment %d", payments[i].ID)
+		}
+	}
+
+	return payments, cursor, nil
+}
+
+func scanPayment(scanner Scanner) (VendorPayment, error) {
+	var (
+		payment   = VendorPayment{Amount: Cents(0)}
+		currency  sql.NullString
+		timestamp int64
+	)
+
+	if err := scanner.Scan(
+		&payment.ID,
+		&payment.Vendor.ID,
+		&payment.Vendor.Name,
+		&payment.PayableAccount.ID,
+		&payment.PayableAccount.Name,
+		&payment.PaymentAccount.ID,
+		&payment.PaymentAccount.Name,
+		&payment.Amount,
+		&currency,
+		&timestamp,
+	); err != nil {
+		return payment, err
+	}
+
+	payment.Date = time.Unix(timestamp, 0).UTC()
+	payment.Amount.currency = currencyOf(currency)
+	return payment, nil
+}
+
+func (p PaymentTable) loadApplications(ctx context.Context, payment *VendorPayment) error {
+	rows, err := p.Dialect.bind(conn(p.DB, p.tx)).QueryContext(ctx, `
+		SELECT purchase_id, amount FROM payment_application
+		WHERE payment_id=? ORDER BY purchase_id`, payment.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	payment.Applications = nil
+	for rows.Next() {
+		application := PaymentApplication{Amount: Cents(0)}
+		if err = rows.Scan(&application.PurchaseID, &application.Amount); err != nil {
+			return err
+		}
+		application.Amount.currency = payment.Amount.currency
+		payment.Applications = append(payment.Applications, application)
+	}
+	return rows.Err()
+}
+
+type InvoiceTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (i InvoiceTable) Save(ctx context.Context, invoice Invoice) (int, error) {
+	if err := invoice.Validate(); err != nil {
+		return -1, err
+	}
+
+	tx, err := begin(ctx, i.DB, i.tx)
+	if err != nil {
+		return -1, i.Dialect.wrap(err, "invoice")
+	}
+	defer tx.Rollback()
+
+	refs := map[string][]int{"customer": {invoice.Customer.ID}, "account": {invoice.ReceivableAccount.ID}}
+	for _, line := range invoice.Lines {
+		refs["item"] = append(refs["item"], line.Item.ID)
+		refs["account"] = append(refs["account"], line.Account.ID, line.InventoryAccount.ID, line.CostAccount.ID)
+	}
+	if err = requireActive(ctx, tx, i.Dialect, refs); err != nil {
+		return -1, err
+	}
+
+	id, err := i.Dialect.insert(ctx, tx, `
+		INSERT INTO invoice
+		(customer_id, receivable_acct_id, amount, currency, timestamp, due_at) VALUES
+		(?, ?, ?, ?, ?, ?)`,
+		invoice.Customer.ID,
+		invoice.ReceivableAccount.ID,
+		ledgerAmount(invoice.Amount),
+		currencyValue(invoice.Amount.Currency()),
+		invoice.Date.UTC().Unix(),
+		invoice.DueDate.UTC().Unix(),
+	)
+	if err != nil {
+		return -1, i.Dialect.wrap(err, "invoice")
+	}
+
+	for n, line := range invoice.Lines {
+		if _, err = i.Dialect.bind(tx).ExecContext(ctx, `
+			INSERT INTO invoice_line
+			(invoice_id, line, kind, item_id, account_id, inventory_account_id, cost_account_id, qty, amount) VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id,
+			n+1,
+			string(line.LineKind()),
+			nullID(line.Item.ID),
+			line.Account.ID,
+			nullID(line.InventoryAccount.ID),
+			nullID(line.CostAccount.ID),
+			line.Qty,
+			ledgerAmount(line.Amount),
+		); err != nil {
+			return -1, i.Dialect.wrap(err, "invoice %d line %d", id, n+1)
+		}
+	}
+
+	invoice.ID = id
+	if err = i.Dialect.audit(ctx, tx, "save", "invoice", id, nil, invoice); err != nil {
+		return -1, i.Dialect.wrap(err, "invoice %d", id)
+	}
+
+	return id, i.Dialect.wrap(tx.Commit(), "invoice %d", id)
+}
+
+var invoiceList = listSpec{
+	columns: []string{
+		"invoice.id",
+		"invoice.customer_id",
+		"customer.name",
+		"invoice.receivable_acct_id",
+		"account.name",
+		"invoice.amount",
+		"invoice.currency",
+		"invoice.timestamp",
+		"invoice.due_at",
+	},
+	from: `invoice
+		INNER JOIN customer ON customer.id = invoice.customer_id
+		INNER JOIN account ON account.id = invoice.receivable_acct_id`,
+	sorts: map[string]string{
+		"id":     "invoice.id",
+		"date":   "invoice.timestamp",
+		"due":    "invoice.due_at",
+		"amount": "invoice.amount",
+	},
+	keys: []string{"invoice.id"},
+}
+
+func (i InvoiceTable) Get(ctx context.Context, id int) (Invoice, error) {
+	row := i.Dialect.bind(conn(i.DB, i.tx)).QueryRowContext(ctx, `
+		SELECT `+strings.Join(invoiceList.columns, ", ")+`
+		FROM `+invoiceList.from+`
+		WHERE invoice.id=?`, id)
+
+	invoice, err := scanInvoice(row)
+	if err != nil {
+		return invoice, i.Dialect.wrap(err, "invoice %d", id)
+	}
+
+	err = i.loadLines(ctx, &invoice)
+	return invoice, i.Dialect.wrap(err, "invoice %d", id)
+}
+
+// List returns invoices with their lines filtered by date, customer, item,
+// account and customer name, sortable by "id", "date", "due" or "amount".
+// AccountID matches either the receivable account or an account a line
+// posts to.
+func (i InvoiceTable) List(ctx context.Context, opts ListOptions) ([]Invoice, string, error) {
+	var (
+		invoices []Invoice
+		query    = listQuery{dialect: i.Dialect}
+	)
+
+	query.dateRange("invoice.timestamp", opts)
+	query.search("customer.name", opts)
+	if opts.CustomerID != 0 {
+		query.add("invoice.customer_id=?", opts.CustomerID)
+	}
+	if opts.ItemID != 0 {
+		query.add(`EXISTS (SELECT 1 FROM invoice_line
+			WHERE invoice_line.invoice_id = invoice.id AND invoice_line.item_id=?)`,
+			opts.ItemID)
+	}
+	if opts.AccountID != 0 {
+		query.add(`(invoice.receivable_acct_id=? OR EXISTS (SELECT 1 FROM invoice_line
+			WHERE invoice_line.invoice_id = invoice.id
+			AND ? IN (invoice_line.account_id, invoice_line.inventory_account_id, invoice_line.cost_account_id)))`,
+			opts.AccountID, opts.AccountID)
+	}
+
+	cursor, err := list(ctx, i.Dialect.bind(conn(i.DB, i.tx)), invoiceList, opts, query, func(scanner Scanner) error {
+		invoice, err := scanInvoice(scanner)
+		invoices = append(invoices, invoice)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for n := range invoices {
+		if err = i.loadLines(ctx, &invoices[n]); err != nil {
+			return nil, "", i.Dialect.wrap(err, "invoice %d", invoices[n].ID)
+		}
+	}
+
+	return invoices, cursor, nil
+}
+
+func scanInvoice(scanner Scanner) (Invoice, error) {
+	var (
+		invoice   = Invoice{Amount: Cents(0)}
+		currency  sql.NullString
+		timestamp int64
+		dueAt     int64
+	)
+
+	if err := scanner.Scan(
+		&invoice.ID,
+		&invoice.Customer.ID,
+		&invoice.Customer.Name,
+		&invoice.ReceivableAccount.ID,
+		&invoice.ReceivableAccount.Name,
+		&invoice.Amount,
+		&currency,
+		&timestamp,
+		&dueAt,
+	); err != nil {
+		return invoice, err
+	}
+
+	invoice.Date = time.Unix(timestamp, 0).UTC()
+	invoice.DueDate = time.Unix(dueAt, 0).UTC()
+	invoice.Amount.currency = currencyOf(currency)
+	return invoice, nil
+}
+
+func (i InvoiceTable) loadLines(ctx context.Context, invoice *Invoice) error {
+	rows, err := i.Dialect.bind(conn(i.DB, i.tx)).QueryContext(ctx, `
+		SELECT
+			invoice_line.kind,
+			invoice_line.item_id,
+			item.name,
+			invoice_line.account_id,
+			account.name,
+			invoice_line.inventory_account_id,
+			inventory.name,
+			invoice_line.cost_account_id,
+			cost.name,
+			invoice_line.qty,
+			invoice_line.amount
+		FROM invoice_line
+		LEFT JOIN item ON item.id = invoice_line.item_id
+		INNER JOIN account ON account.id = invoice_line.account_id
+		LEFT JOIN account inventory ON inventory.id = invoice_line.inventory_account_id
+		LEFT JOIN account cost ON cost.id = invoice_line.cost_account_id
+		WHERE invoice_line.invoice_id=?
+		ORDER BY invoice_line.line`, invoice.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	invoice.Lines = nil
+	for rows.Next() {
+		var (
+			line = InvoiceLine{
+				Qty:    NewQuantity(nil, EtherDecimals),
+				Amount: Cents(0),
+			}
+			kind                              string
+			itemID, inventoryID, costID       sql.NullInt64
+			itemName, inventoryName, costName sql.NullString
+		)
+		if err = rows.Scan(
+			&kind,
+			&itemID,
+			&itemName,
+			&line.Account.ID,
+			&line.Account.Name,
+			&inventoryID,
+			&inventoryName,
+			&costID,
+			&costName,
+			&line.Qty,
+			&line.Amount,
+		); err != nil {
+			return err
+		}
+
+		line.Kind = LineKind(kind)
+		line.Item = Item{ID: int(itemID.Int64), Name: itemName.String}
+		line.InventoryAccount = Account{ID: int(inventoryID.Int64), Name: inventoryName.String}
+		line.CostAccount = Account{ID: int(costID.Int64), Name: costName.String}
+		line.Amount.currency = invoice.Amount.currency
+		invoice.Lines = append(invoice.Lines, line)
+	}
+	return rows.Err()
+}
+
+type ReceiptTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (r ReceiptTable) Save(ctx context.Context, receipt CustomerReceipt) (int, error) {
+	if err := receipt.Validate(); err != nil {
+		return -1, err
+	}
+
+	tx, err := begin(ctx, r.DB, r.tx)
+	if err != nil {
+		return -1, r.Dialect.wrap(err, "customer receipt")
+	}
+	defer tx.Rollback()
+
+	if err = requireActive(ctx, tx, r.Dialect, map[string][]int{
+		"customer": {receipt.Customer.ID},
+		"account":  {receipt.ReceivableAccount.ID, receipt.DepositAccount.ID},
+	}); err != nil {
+		return -1, err
+	}
+
+	id, err := r.Dialect.insert(ctx, tx, `
+		INSERT INTO customer_receipt
+		(customer_id, receivable_acct_id, deposit_acct_id, amount, currency, timestamp) VALUES
+		(?, ?, ?, ?, ?, ?)`,
+		receipt.Customer.ID,
+		receipt.ReceivableAccount.ID,
+		receipt.DepositAccount.ID,
+		ledgerAmount(receipt.Amount),
+		currencyValue(receipt.Amount.Currency()),
+		receipt.Date.UTC().Unix(),
+	)
+	if err != nil {
+		return -1, r.Dialect.wrap(err, "customer receipt")
+	}
+
+	for _, application := range receipt.Applications {
+		if _, err = r.Dialect.bind(tx).ExecContext(ctx, `
+			INSERT INTO receipt_application (receipt_id, invoice_id, amount) VALUES (?, ?, ?)`,
+			id, application.InvoiceID, ledgerAmount(application.Amount),
+		); err != nil {
+			return -1, r.Dialect.wrap(err, "customer receipt %d invoice %d", id, application.InvoiceID)
+		}
+	}
+
+	receipt.ID = id
+	if err = r.Dialect.audit(ctx, tx, "save", "customer_receipt", id, nil, receipt); err != nil {
+		return -1, r.Dialect.wrap(err, "customer receipt %d", id)
+	}
+
+	return id, r.Dialect.wrap(tx.Commit(), "customer receipt %d", id)
+}
+
+var receiptList = listSpec{
+	columns: []string{
+		"customer_receipt.id",
+		"customer_receipt.customer_id",
+		"customer.name",
+		"customer_receipt.receivable_acct_id",
+		"receivable.name",
+		"customer_receipt.deposit_acct_id",
+		"deposit.name",
+		"customer_receipt.amount",
+		"customer_receipt.currency",
+		"customer_receipt.timestamp",
+	},
+	from: `customer_receipt
+		INNER JOIN customer ON customer.id = customer_receipt.customer_id
+		INNER JOIN account receivable ON receivable.id = customer_receipt.receivable_acct_id
+		INNER JOIN account deposit ON deposit.id = customer_receipt.deposit_acct_id`,
+	sorts: map[string]string{
+		"id":     "customer_receipt.id",
+		"date":   "customer_receipt.timestamp",
+		"amount": "customer_receipt.amount",
+	},
+	keys: []string{"customer_receipt.id"},
+}
+
+func (r ReceiptTable) Get(ctx context.Context, id int) (CustomerReceipt, error) {
+	row := r.Dialect.bind(conn(r.DB, r.tx)).QueryRowContext(ctx, `
+		SELECT `+strings.Join(receiptList.columns, ", ")+`
+		FROM `+receiptList.from+`
+		WHERE customer_receipt.id=?`, id)
+
+	receipt, err := scanReceipt(row)
+	if err != nil {
+		return receipt, r.Dialect.wrap(err, "customer receipt %d", id)
+	}
+
+	err = r.loadApplications(ctx, &receipt)
+	return receipt, r.Dialect.wrap(err, "customer receipt %d", id)
+}
+
+// List returns customer receipts with their applications filtered by date,
+// customer, account and customer name, sortable by "id", "date" or
+// "amount". AccountID matches either the receivable account or the account
+// deposited to.
+func (r ReceiptTable) List(ctx context.Context, opts ListOptions) ([]CustomerReceipt, string, error) {
+	var (
+		receipts []CustomerReceipt
+		query    = listQuery{dialect: r.Dialect}
+	)
+
+	query.dateRange("customer_receipt.timestamp", opts)
+	query.search("customer.name", opts)
+	if opts.CustomerID != 0 {
+		query.add("customer_receipt.customer_id=?", opts.CustomerID)
+	}
+	if opts.AccountID != 0 {
+		query.add("(customer_receipt.receivable_acct_id=? OR customer_receipt.deposit_acct_id=?)",
+			opts.AccountID, opts.AccountID)
+	}
+
+	cursor, err := list(ctx, r.Dialect.bind(conn(r.DB, r.tx)), receiptList, opts, query, func(scanner Scanner) error {
+		receipt, err := scanReceipt(scanner)
+		receipts = append(receipts, receipt)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range receipts {
+		if err = r.loadApplications(ctx, &receipts[i]); err != nil {
+			return nil, "", r.Dialect.wrap(err, "customer receipt %d", receipts[i].ID)
+		}
+	}
+
+	return receipts, cursor, nil
+}
+
+func scanReceipt(scanner Scanner) (CustomerReceipt, error) {
+	var (
+		receipt   = CustomerReceipt{Amount: Cents(0)}
+		currency  sql.NullString
+		timestamp int64
+	)
+
+	if err := scanner.Scan(
+		&receipt.ID,
+		&receipt.Customer.ID,
+		&receipt.Customer.Name,
+		&receipt.ReceivableAccount.ID,
+		&receipt.ReceivableAccount.Name,
+		&receipt.DepositAccount.ID,
+		&receipt.DepositAccount.Name,
+		&receipt.Amount,
+		&currency,
+		&timestamp,
+	); err != nil {
+		return receipt, err
+	}
+
+	receipt.Date = time.Unix(timestamp, 0).UTC()
+	receipt.Amount.currency = currencyOf(currency)
+	return receipt, nil
+}
+
+func (r ReceiptTable) loadApplications(ctx context.Context, receipt *CustomerReceipt) error {
+	rows, err := r.Dialect.bind(conn(r.DB, r.tx)).QueryContext(ctx, `
+		SELECT invoice_id, amount FROM receipt_application
+		WHERE receipt_id=? ORDER BY invoice_id`, receipt.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	receipt.Applications = nil
+	for rows.Next() {
+		application := ReceiptApplication{Amount: Cents(0)}
+		if err = rows.Scan(&application.InvoiceID, &application.Amount); err != nil {
+			return err
+		}
+		application.Amount.currency = receipt.Amount.currency
+		receipt.Applications = append(receipt.Applications, application)
+	}
+	return rows.Err()
+}
+
+type RecurringTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+// recurringDocument is the body of a recurring template as it is kept in
+// document_json.
+type recurringDocument struct {
+	Purchase *Purchase       `json:",omitempty"`
+	Payment  *VendorPayment  `json:",omitempty"`
+	Entry    []GLTransaction `json:",omitempty"`
+}
+
+func (r RecurringTable) Save(ctx context.Context, template RecurringTemplate) (int, error) {
+	if err := template.Validate(); err != nil {
+		return -1, err
+	}
+
+	document, err := json.Marshal(recurringDocument{
+		Purchase: template.Purchase,
+		Payment:  template.Payment,
+		Entry:    template.Entry,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	var end sql.NullInt64
+	if !template.Schedule.End.IsZero() {
+		end = sql.NullInt64{Int64: template.Schedule.End.UTC().Unix(), Valid: true}
+	}
+
+	tx, err := begin(ctx, r.DB, r.tx)
+	if err != nil {
+		return -1, r.Dialect.wrap(err, "recurring template")
+	}
+	defer tx.Rollback()
+
+	id, err := r.Dialect.insert(ctx, tx, `
+		INSERT INTO recurring_template
+		(name, kind, start_at, every, unit, end_at, document_json) VALUES
+		(?, ?, ?, ?, ?, ?, ?)`,
+		template.Name,
+		string(template.Kind()),
+		template.Schedule.Start.UTC().Unix(),
+		template.Schedule.Every,
+		string(template.Schedule.Unit),
+		end,
+		string(document),
+	)
+	if err != nil {
+		return -1, r.Dialect.wrap(err, "recurring template")
+	}
+
+	template.ID = id
+	if err = r.Dialect.audit(ctx, tx, "save", "recurring_template", id, nil, template); err != nil {
+		return -1, r.Dialect.wrap(err, "recurring template %d", id)
+	}
+
+	return id, r.Dialect.wrap(tx.Commit(), "recurring template %d", id)
+}
+
+var recurringList = listSpec{
+	columns: []string{
+		"recurring_template.id",
+		"recurring_template.name",
+		"recurring_template.start_at",
+		"recurring_template.every",
+		"recurring_template.unit",
+		"recurring_template.end_at",
+		"recurring_template.document_json",
+	},
+	from: "recurring_template",
+	sorts: map[string]string{
+		"id":    "recurring_template.id",
+		"name":  "recurring_template.name",
+		"start": "recurring_template.start_at",
+	},
+	keys: []string{"recurring_template.id"},
+}
+
+func (r RecurringTable) Get(ctx context.Context, id int) (RecurringTemplate, error) {
+	row := r.Dialect.bind(conn(r.DB, r.tx)).QueryRowContext(ctx, `
+		SELECT `+strings.Join(recurringList.columns, ", ")+`
+		FROM `+recurringList.from+`
+		WHERE recurring_template.id=?`, id)
+
+	template, err := scanRecurring(row)
+	return template, r.Dialect.wrap(err, "recurring template %d", id)
+}
+
+// List returns recurring templates filtered by start date and name,
+// sortable by "id", "name" or "start".
+func (r RecurringTable) List(ctx context.Context, opts ListOptions) ([]RecurringTemplate, string, error) {
+	var (
+		templates []RecurringTemplate
+		query     = listQuery{dialect: r.Dialect}
+	)
+
+	query.dateRange("recurring_template.start_at", opts)
+	query.search("recurring_template.name", opts)
+
+	cursor, err := list(ctx, r.Dialect.bind(conn(r.DB, r.tx)), recurringList, opts, query, func(scanner Scanner) error {
+		template, err := scanRecurring(scanner)
+		templates = append(templates, template)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return templates, cursor, nil
+}
+
+func scanRecurring(scanner Scanner) (RecurringTemplate, error) {
+	var (
+		template RecurringTemplate
+		start    int64
+		unit     string
+		end      sql.NullInt64
+		document string
+	)
+
+	if err := scanner.Scan(
+		&template.ID,
+		&template.Name,
+		&start,
+		&template.Schedule.Every,
+		&unit,
+		&end,
+		&document,
+	); err != nil {
+		return template, err
+	}
+
+	var body recurringDocument
+	if err := json.Unmarshal([]byte(document), &body); err != nil {
+		return template, err
+	}
+
+	template.Schedule.Start = time.Unix(start, 0).UTC()
+	template.Schedule.Unit = Frequency(unit)
+	if end.Valid {
+		template.Schedule.End = time.Unix(end.Int64, 0).UTC()
+	}
+	template.Purchase, template.Payment, template.Entry = body.Purchase, body.Payment, body.Entry
+	return template, nil
+}
+
+func (r RecurringTable) Instances(ctx context.Context, templateID int) ([]RecurringInstance, error) {
+	rows, err := r.Dialect.bind(conn(r.DB, r.tx)).QueryContext(ctx, `
+		SELECT template_id, due_at, source_type, source_id, entry_id
+		FROM recurring_instance
+		WHERE template_id=? ORDER BY due_at`, templateID)
+	if err != nil {
+		return nil, r.Dialect.wrap(err, "recurring template %d instances", templateID)
+	}
+	defer rows.Close()
+
+	var instances []RecurringInstance
+	for rows.Next() {
+		var (
+			instance   RecurringInstance
+			due        int64
+			sourceType sql.NullString
+			sourceID   sql.NullInt64
+			entry      sql.NullInt64
+		)
+		if err = rows.Scan(&instance.TemplateID, &due, &sourceType, &sourceID, &entry); err != nil {
+			return nil, r.Dialect.wrap(err, "recurring template %d instances", templateID)
+		}
+
+		instance.Date = time.Unix(due, 0).UTC()
+		if sourceType.Valid {
+			instance.Document = SourceRef{Type: sourceType.String, ID: int(sourceID.Int64)}
+		}
+		instance.Entry = int(entry.Int64)
+		instances = append(instances, instance)
+	}
+	return instances, r.Dialect.wrap(rows.Err(), "recurring template %d instances", templateID)
+}
+
+func (r RecurringTable) SaveInstance(ctx context.Context, instance RecurringInstance) error {
+	key := fmt.Sprintf("%d/%s", instance.TemplateID, instance.Date.UTC().Format("2006-01-02"))
+
+	tx, err := begin(ctx, r.DB, r.tx)
+	if err != nil {
+		return r.Dialect.wrap(err, "recurring instance %s", key)
+	}
+	defer tx.Rollback()
+
+	if _, err = r.Dialect.bind(tx).ExecContext(ctx, `
+		INSERT INTO recurring_instance
+		(template_id, due_at, source_type, source_id, entry_id) VALUES
+		(?, ?, ?, ?, ?)`,
+		instance.TemplateID,
+		instance.Date.UTC().Unix(),
+		nullString(instance.Document.Type),
+		nullID(instance.Document.ID),
+		nullID(instance.Entry),
+	); err != nil {
+		return r.Dialect.wrap(err, "recurring instance %s", key)
+	}
+
+	if err = r.Dialect.audit(ctx, tx, "save", "recurring_instance", key, nil, instance); err != nil {
+		return r.Dialect.wrap(err, "recurring instance %s", key)
+	}
+
+	return r.Dialect.wrap(tx.Commit(), "recurring instance %s", key)
+}
+
+func (r RecurringTable) UpdateInstance(ctx context.Context, instance RecurringInstance) error {
+	key := fmt.Sprintf("%d/%s", instance.TemplateID, instance.Date.UTC().Format("2006-01-02"))
+
+	tx, err := begin(ctx, r.DB, r.tx)
+	if err != nil {
+		return r.Dialect.wrap(err, "recurring instance %s", key)
+	}
+	defer tx.Rollback()
+
+	result, err := r.Dialect.bind(tx).ExecContext(ctx, `
+		UPDATE recurring_instance SET source_type=?, source_id=?, entry_id=?
+		WHERE template_id=? AND due_at=?`,
+		nullString(instance.Document.Type),
+		nullID(instance.Document.ID),
+		nullID(instance.Entry),
+		instance.TemplateID,
+		instance.Date.UTC().Unix(),
+	)
+	if err == nil {
+		err = requireRow(result)
+	}
+	if err != nil {
+		return r.Dialect.wrap(err, "recurring instance %s", key)
+	}
+
+	if err = r.Dialect.audit(ctx, tx, "update", "recurring_instance", key, nil, instance); err != nil {
+		return r.Dialect.wrap(err, "recurring instance %s", key)
+	}
+
+	return r.Dialect.wrap(tx.Commit(), "recurring instance %s", key)
+}
+
+type BudgetTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (b BudgetTable) Save(ctx context.Context, budget Budget) error {
+	if err := budget.Validate(); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%d/%s", budget.Account.ID, budget.Period.Format("2006-01"))
+
+	tx, err := begin(ctx, b.DB, b.tx)
+	if err != nil {
+		return b.Dialect.wrap(err, "budget %s", key)
+	}
+	defer tx.Rollback()
+
+	var before interface{}
+	previous, err := scanBudget(b.Dialect.bind(tx).QueryRowContext(ctx, `
+		SELECT `+strings.Join(budgetList.columns, ", ")+`
+		FROM `+budgetList.from+`
+		WHERE budget.account_id=? AND budget.period_start=?`,
+		budget.Account.ID, budget.Period.Unix()))
+	switch {
+	case err == nil:
+		before = previous
+	case err != sql.ErrNoRows:
+		return b.Dialect.wrap(err, "budget %s", key)
+	}
+
+	if _, err = b.Dialect.bind(tx).ExecContext(ctx,
+		"DELETE FROM budget WHERE account_id=? AND period_start=?",
+		budget.Account.ID, budget.Period.Unix(),
+	); err != nil {
+		return b.Dialect.wrap(err, "budget %s", key)
+	}
+
+	if _, err = b.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO budget(account_id, period_start, amount, currency) VALUES (?, ?, ?, ?)",
+		budget.Account.ID,
+		budget.Period.Unix(),
+		ledgerAmount(budget.Amount),
+		currencyValue(budget.Amount.Currency()),
+	); err != nil {
+		return b.Dialect.wrap(err, "budget %s", key)
+	}
+
+	if err = b.Dialect.audit(ctx, tx, "save", "budget", key, before, budget); err != nil {
+		return b.Dialect.wrap(err, "budget %s", key)
+	}
+
+	return b.Dialect.wrap(tx.Commit(), "budget %s", key)
+}
+
+var budgetList = listSpec{
+	columns: []string{
+		"budget.account_id",
+		"account.name",
+		"budget.period_start",
+		"budget.amount",
+		"budget.currency",
+	},
+	from: "budget INNER JOIN account ON account.id = budget.account_id",
+	sorts: map[string]string{
+		"id":     "budget.account_id",
+		"period": "budget.period_start",
+		"amount": "budget.amount",
+	},
+	keys: []string{"budget.account_id", "budget.period_start"},
+}
+
+func (b BudgetTable) Get(ctx context.Context, accountID int, period time.Time) (Budget, error) {
+	row := b.Dialect.bind(conn(b.DB, b.tx)).QueryRowContext(ctx, `
+		SELECT `+strings.Join(budgetList.columns, ", ")+`
+		FROM `+budgetList.from+`
+		WHERE budget.account_id=? AND budget.period_start=?`,
+		accountID, MonthStart(period).Unix())
+
+	budget, err := scanBudget(row)
+	return budget, b.Dialect.wrap(err, "budget %d/%s", accountID, period.Format("2006-01"))
+}
+
+// List returns budgets filtered by month and account, sortable by "id" (the
+// account's), "period" or "amount". From and To bound the first day of the
+// month.
+func (b BudgetTable) List(ctx context.Context, opts ListOptions) ([]Budget, string, error) {
+	var (
+		budgets []Budget
+		query   = listQuery{dialect: b.Dialect}
+	)
+
+	query.dateRange("budget.period_start", opts)
+	query.search("account.name", opts)
+	if opts.AccountID != 0 {
+		query.add("budget.account_id=?", opts.AccountID)
+	}
+
+	cursor, err := list(ctx, b.Dialect.bind(conn(b.DB, b.tx)), budgetList, opts, query, func(scanner Scanner) error {
+		budget, err := scanBudget(scanner)
+		budgets = append(budgets, budget)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return budgets, cursor, nil
+}
+
+func scanBudget(scanner Scanner) (Budget, error) {
+	var (
+		budget   = Budget{Amount: Cents(0)}
+		currency sql.NullString
+		period   int64
+	)
+
+	if err := scanner.Scan(
+		&budget.Account.ID,
+		&budget.Account.Name,
+		&period,
+		&budget.Amount,
+		&currency,
+	); err != nil {
+		return budget, err
+	}
+
+	budget.Period = time.Unix(period, 0).UTC()
+	budget.Amount.currency = currencyOf(currency)
+	return budget, nil
+}
+
+type GLTransactionTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+// NextID returns the ID for the next journal entry. On Postgres IDs come from
+// a sequence so that concurrent writers sharing the ledger never collide; the
+// sequence skips past any IDs that were saved without it.
+func (g GLTransactionTable) NextID(ctx context.Context) (int, error) {
+	var nextNum int
+	if g.Dialect == Postgres {
+		err := conn(g.DB, g.tx).QueryRowContext(ctx, `
+			SELECT setval('gl_transaction_id_seq', GREATEST(
+				nextval('gl_transaction_id_seq'),
+				(SELECT COALESCE(MAX(id), 0) + 1 FROM gl_transaction)
+			))`).Scan(&nextNum)
+		return nextNum, err
+	}
+
+	row := g.Dialect.bind(conn(g.DB, g.tx)).QueryRowContext(
+		ctx,
+		"SELECT id FROM gl_transaction ORDER BY id DESC LIMIT 1;",
+	)
+
+	err := row.Scan(&nextNum)
+	if err == sql.ErrNoRows {
+		return 1, nil
+	}
+
+	if err != nil {
+		return -1, err
+	}
+
+	return nextNum + 1, nil
+}
+
+// Save writes the lines of one or more journal entries in a single
+// transaction. Entries whose debits and credits disagree once rounded to
+// cents are refused with ErrUnbalanced.
+func (g GLTransactionTable) Save(ctx context.Context, transactions []GLTransaction) error {
+	stored := make([]GLTransaction, len(transactions))
+	for i, transaction := range transactions {
+		transaction.Debit = ledgerAmount(transaction.Debit)
+		transaction.Credit = ledgerAmount(transaction.Credit)
+		if transaction.Foreign.Currency() != "" {
+			transaction.Foreign = ledgerAmount(transaction.Foreign)
+		}
+		stored[i] = transaction
+	}
+	if err := CheckBalanced(stored); err != nil {
+		return err
+	}
+
+	tx, err := begin(ctx, g.DB, g.tx)
+	if err != nil {
+		return g.Dialect.wrap(err, "gl transactions")
+	}
+	defer tx.Rollback()
+
+	checked := make(map[int64]bool)
+	for _, transaction := range stored {
+		if checked[transaction.Date.Unix()] {
+			continue
+		}
+		checked[transaction.Date.Unix()] = true
+
+		if err = requireOpen(ctx, g.Dialect.bind(tx), g.Dialect, transaction.Date); err != nil {
+			return err
+		}
+	}
+
+	for _, transaction := range stored {
+		var foreignCurrency, foreignAmount interface{}
+		if transaction.Foreign.Currency() != "" {
+			foreignCurrency = transaction.Foreign.Currency()
+			foreignAmount = transaction.Foreign
+		}
+
+		if _, err := g.Dialect.bind(tx).ExecContext(ctx, `
+			INSERT INTO gl_transaction
+				(id, account_id, debit, credit, memo, timestamp, currency, fx_currency, fx_amount, reverses, source_type, source_id) VALUES 
+				(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			transaction.ID,
+			transaction.Account.ID,
+			transaction.Debit,
+			transaction.Credit,
+			transaction.Memo,
+			transaction.Date.UTC().Unix(),
+			currencyValue(transaction.Debit.Add(transaction.Credit).Currency()),
+			foreignCurrency,
+			foreignAmount,
+			nullID(transaction.Reverses),
+			nullString(transaction.Source.Type),
+			nullID(transaction.Source.ID),
+		); err != nil {
+			return g.Dialect.wrap(err, "gl transaction %d account %d", transaction.ID, transaction.Account.ID)
+		}
+	}
+
+	if err = g.chain(ctx, tx, stored); err != nil {
+		return err
+	}
+
+	if len(stored) > 0 {
+		if err = g.Dialect.audit(ctx, tx, "save", "gl_transaction", stored[0].ID, nil, stored); err != nil {
+			return g.Dialect.wrap(err, "gl transaction %d", stored[0].ID)
+		}
+	}
+
+	return g.Dialect.wrap(tx.Commit(), "gl transactions")
+}
+
+// chain links the entries in stored onto the hash chain through tx when the
+// books keep one. Writers extend the chain one at a time: on Postgres the
+// books row is locked until tx ends, and SQLite already holds its write lock
+// for the rows just saved. The previous hash is unique as well, so a writer
+// that slips past either still conflicts rather than forks the chain.
+func (g GLTransactionTable) chain(ctx context.Context, tx querier, stored []GLTransaction) error {
+	books, err := BooksTable{DB: g.DB, Dialect: g.Dialect}.get(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !books.HashChain || len(stored) == 0 {
+		return nil
+	}
+
+	if g.Dialect == Postgres {
+		if _, err = tx.ExecContext(ctx, "SELECT id FROM books WHERE id=1 FOR UPDATE"); err != nil {
+			return g.Dialect.wrap(err, "ledger chain")
+		}
+	}
+
+	// Links are ordered by seq, the order they were made in, since entry
+	// IDs handed out by NextID may be saved out of order.
+	insert := "INSERT INTO ledger_chain(entry_id, previous, hash, seq) VALUES (?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM ledger_chain))"
+	if g.Dialect == Postgres {
+		insert = "INSERT INTO ledger_chain(entry_id, previous, hash) VALUES (?, ?, ?)"
+	}
+
+	var last *ChainLink
+	row := g.Dialect.bind(tx).QueryRowContext(ctx,
+		"SELECT entry_id, previous, hash FROM ledger_chain ORDER BY seq DESC LIMIT 1")
+	var link ChainLink
+	switch err = row.Scan(&link.Entry, &link.Previous, &link.Hash); err {
+	case nil:
+		last = &link
+	case sql.ErrNoRows:
+	default:
+		return g.Dialect.wrap(err, "ledger chain")
+	}
+
+	for _, entry := range splitEntries(stored) {
+		next := nextLink(last, entry)
+		if _, err = g.Dialect.bind(tx).ExecContext(ctx, insert, next.Entry, next.Previous, next.Hash); err != nil {
+			return g.Dialect.wrap(err, "ledger chain entry %d", next.Entry)
+		}
+		last = &next
+	}
+	return nil
+}
+
+// Chain returns the hash chain in the order the links were made.
+func (g GLTransactionTable) Chain(ctx context.Context) ([]ChainLink, error) {
+	rows, err := g.Dialect.bind(conn(g.DB, g.tx)).QueryContext(ctx,
+		"SELECT entry_id, previous, hash FROM ledger_chain ORDER BY seq")
+	if err != nil {
+		return nil, g.Dialect.wrap(err, "ledger chain")
+	}
+	defer rows.Close()
+
+	var links []ChainLink
+	for rows.Next() {
+		var link ChainLink
+		if err = rows.Scan(&link.Entry, &link.Previous, &link.Hash); err != nil {
+			return nil, g.Dialect.wrap(err, "ledger chain")
+		}
+		links = append(links, link)
+	}
+
+	return links, g.Dialect.wrap(rows.Err(), "ledger chain")
+}
+
+var glTransactionList = listSpec{
+	columns: []string{
+		"gl_transaction.id",
+		"gl_transaction.account_id",
+		"account.name",
+		"gl_transaction.debit",
+		"gl_transaction.credit",
+		"gl_transaction.memo",
+		"gl_transaction.timestamp",
+		"gl_transaction.currency",
+		"gl_transaction.fx_currency",
+		"gl_transaction.fx_amount",
+		"gl_transaction.reverses",
+		"gl_transaction.source_type",
+		"gl_transaction.source_id",
+	},
+	from: "gl_transaction INNER JOIN account ON account.id = gl_transaction.account_id",
+	sorts: map[string]string{
+		"id":      "gl_transaction.id",
+		"date":    "gl_transaction.timestamp",
+		"account": "gl_transaction.account_id",
+	},
+	keys: []string{"gl_transaction.id", "gl_transaction.account_id"},
+}
+
+func (g GLTransactionTable) Get(ctx context.Context, id int) ([]GLTransaction, error) {
+	var (
+		transactions []GLTransaction
+		err          error
+	)
+
+	rows, err := g.Dialect.bind(conn(g.DB, g.tx)).QueryContext(ctx, `
+		SELECT `+strings.Join(glTransactionList.columns, ", ")+`
+		FROM `+glTransactionList.from+`
+		WHERE gl_transaction.id=?`, id)
+	if err != nil {
+		return nil, g.Dialect.wrap(err, "gl transaction %d", id)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := scanGLTransaction(rows)
+		if err != nil {
+			return nil, g.Dialect.wrap(err, "gl transaction %d", id)
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, g.Dialect.wrap(err, "gl transaction %d", id)
+	}
+
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("%w: gl transaction %d", ErrNotFound, id)
+	}
+
+	return transactions, nil
+}
+
+// List returns general ledger lines filtered by date, account and memo,
+// sortable by "id", "date" or "account".
+func (g GLTransactionTable) List(ctx context.Context, opts ListOptions) ([]GLTransaction, string, error) {
+	var (
+		transactions []GLTransaction
+		query        = listQuery{dialect: g.Dialect}
+	)
+
+	query.dateRange("gl_transaction.timestamp", opts)
+	query.search("gl_transaction.memo", opts)
+	if opts.AccountID != 0 {
+		query.add("gl_transaction.account_id=?", opts.AccountID)
+	}
+	if opts.Reverses != 0 {
+		query.add("gl_transaction.reverses=?", opts.Reverses)
+	}
+	if !opts.Source.IsZero() {
+		query.add("gl_transaction.source_type=? AND gl_transaction.source_id=?", opts.Source.Type, opts.Source.ID)
+	}
+
+	cursor, err := list(ctx, g.Dialect.bind(conn(g.DB, g.tx)), glTransactionList, opts, query, func(scanner Scanner) error {
+		transaction, err := scanGLTransaction(scanner)
+		transactions = append(transactions, transaction)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return transactions, cursor, nil
+}
+
+func scanGLTransaction(scanner Scanner) (GLTransaction, error) {
+	var (
+		transaction = GLTransaction{
+			Debit:  Cents(0),
+			Credit: Cents(0),
+		}
+		timestamp       int64
+		currency        sql.NullString
+		foreignCurrency sql.NullString
+		foreignAmount   sql.NullInt64
+		reverses        sql.NullInt64
+		sourceType      sql.NullString
+		sourceID        sql.NullInt64
+	)
+
+	if err := scanner.Scan(
+		&transaction.ID,
+		&transaction.Account.ID,
+		&transaction.Account.Name,
+		&transaction.Debit,
+		&transaction.Credit,
+		&transaction.Memo,
+		&timestamp,
+		&currency,
+		&foreignCurrency,
+		&foreignAmount,
+		&reverses,
+		&sourceType,
+		&sourceID,
+	); err != nil {
+		return transaction, err
+	}
+
+	transaction.Date = time.Unix(timestamp, 0).UTC()
+	transaction.Debit.currency = currencyOf(currency)
+	transaction.Credit.currency = currencyOf(currency)
+	transaction.Reverses = int(reverses.Int64)
+	transaction.Source = SourceRef{Type: sourceType.String, ID: int(sourceID.Int64)}
+	if foreignCurrency.Valid {
+		transaction.Foreign = NewMoney(
+			big.NewInt(foreignAmount.Int64),
+			foreignCurrency.String,
+			CentPrecision,
+		)
+	}
+
+	return transaction, nil
+}
+
+type InventoryTransactionTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
 }
 
 func (i InventoryTransactionTable) Save(ctx context.Context, transaction InventoryTransaction) (int, error) {
-	res, err := i.DB.ExecContext(ctx, `
+	tx, err := begin(ctx, i.DB, i.tx)
+	if err != nil {
+		return -1, i.Dialect.wrap(err, "inventory transaction")
+	}
+	defer tx.Rollback()
+
+	if err = requireOpen(ctx, i.Dialect.bind(tx), i.Dialect, transaction.Date); err != nil {
+		return -1, err
+	}
+
+	id, err := i.Dialect.insert(ctx, tx, `
 		INSERT INTO inventory_transaction
-		(account_id, item_id, qty_in, qty_out, cost, memo, timestamp) 
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		(account_id, item_id, qty_in, qty_out, cost, memo, timestamp, currency, reverses, entry_id, source_type, source_id) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		// transaction.ID, <- autoincrement
 		transaction.Account.ID,
 		transaction.Item.ID,
-		transaction.QtyIn.Text(inventoryBase),
-		transaction.QtyOut.Text(inventoryBase),
+		transaction.QtyIn,
+		transaction.QtyOut,
 		transaction.Cost,
 		transaction.Memo,
 		transaction.Date.UTC().Unix(),
+		currencyValue(transaction.Cost.Currency()),
+		nullID(transaction.Reverses),
+		nullID(transaction.Entry),
+		nullString(transaction.Source.Type),
+		nullID(transaction.Source.ID),
 	)
 	if err != nil {
-		return -1, nil
+		return -1, i.Dialect.wrap(err, "inventory transaction")
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return -1, err
+	transaction.ID = id
+	if err = i.Dialect.audit(ctx, tx, "save", "inventory_transaction", id, nil, transaction); err != nil {
+		return -1, i.Dialect.wrap(err, "inventory transaction %d", id)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return -1, i.Dialect.wrap(err, "inventory transaction")
 	}
 
-	return int(id), nil
+	return id, nil
+}
+
+var inventoryTransactionList = listSpec{
+	columns: []string{
+		"inventory_transaction.id",
+		"inventory_transaction.account_id",
+		"account.name",
+		"inventory_transaction.item_id",
+		"item.name",
+		"inventory_transaction.qty_in",
+		"inventory_transaction.qty_out",
+		"inventory_transaction.cost",
+		"inventory_transaction.memo",
+		"inventory_transaction.timestamp",
+		"inventory_transaction.currency",
+		"inventory_transaction.reverses",
+		"inventory_transaction.entry_id",
+		"inventory_transaction.source_type",
+		"inventory_transaction.source_id",
+	},
+	from: `inventory_transaction
+		INNER JOIN account ON account.id=inventory_transaction.account_id
+		INNER JOIN item ON item.id=inventory_transaction.item_id`,
+	sorts: map[string]string{
+		"id":   "inventory_transaction.id",
+		"date": "inventory_transaction.timestamp",
+	},
+	keys: []string{"inventory_transaction.id"},
 }
 
 func (i InventoryTransactionTable) Get(ctx context.Context, id int) (InventoryTransaction, error) {
+	row := i.Dialect.bind(conn(i.DB, i.tx)).QueryRowContext(ctx, `
+		SELECT `+strings.Join(inventoryTransactionList.columns, ", ")+`
+		FROM `+inventoryTransactionList.from+`
+		WHERE inventory_transaction.id=?`,
+		id)
+
+	transaction, err := scanInventoryTransaction(row)
+	return transaction, i.Dialect.wrap(err, "inventory transaction %d", id)
+}
+
+// List returns inventory transactions filtered by date, account, item and
+// memo, sortable by "id" or "date".
+func (i InventoryTransactionTable) List(ctx context.Context, opts ListOptions) ([]InventoryTransaction, string, error) {
 	var (
-		transaction InventoryTransaction
-		timestamp   int64
-		qtyIn       string
-		qtyOut      string
-		err         error
+		transactions []InventoryTransaction
+		query        = listQuery{dialect: i.Dialect}
 	)
 
-	row := i.DB.QueryRowContext(ctx, `
-		SELECT 
-			inventory_transaction.id, 
-			inventory_transaction.account_id,
-			account.name,
-			inventory_transaction.item_id,
-			item.name,
-			inventory_transaction.qty_in,
-			inventory_transaction.qty_out,
-			inventory_transaction.memo,
-			inventory_transaction.timestamp
-		FROM inventory_transaction 
-		INNER JOIN account ON account.id=inventory_transaction.account_id
-		INNER JOIN item ON item.id=inventory_transaction.item_id
-		WHERE id=?`,
-		id)
+	query.dateRange("inventory_transaction.timestamp", opts)
+	query.search("inventory_transaction.memo", opts)
+	if opts.AccountID != 0 {
+		query.add("inventory_transaction.account_id=?", opts.AccountID)
+	}
+	if opts.ItemID != 0 {
+		query.add("inventory_transaction.item_id=?", opts.ItemID)
+	}
+	if opts.Reverses != 0 {
+		query.add("inventory_transaction.reverses=?", opts.Reverses)
+	}
+	if opts.Entry != 0 {
+		query.add("inventory_transaction.entry_id=?", opts.Entry)
+	}
+	if !opts.Source.IsZero() {
+		query.add("inventory_transaction.source_type=? AND inventory_transaction.source_id=?", opts.Source.Type, opts.Source.ID)
+	}
+
+	cursor, err := list(ctx, i.Dialect.bind(conn(i.DB, i.tx)), inventoryTransactionList, opts, query, func(scanner Scanner) error {
+		transaction, err := scanInventoryTransaction(scanner)
+		transactions = append(transactions, transaction)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return transactions, cursor, nil
+}
+
+func scanInventoryTransaction(scanner Scanner) (InventoryTransaction, error) {
+	var (
+		transaction = InventoryTransaction{
+			QtyIn:  NewQuantity(nil, EtherDecimals),
+			QtyOut: NewQuantity(nil, EtherDecimals),
+			Cost:   UnitCost{currency: DefaultCurrency},
+		}
+		timestamp  int64
+		currency   sql.NullString
+		reverses   sql.NullInt64
+		entry      sql.NullInt64
+		sourceType sql.NullString
+		sourceID   sql.NullInt64
+	)
 
-	err = row.Scan(
+	err := scanner.Scan(
 		&transaction.ID,
 		&transaction.Account.ID,
 		&transaction.Account.Name,
 		&transaction.Item.ID,
 		&transaction.Item.Name,
-		&qtyIn,
-		&qtyOut,
+		&transaction.QtyIn,
+		&transaction.QtyOut,
+		&transaction.Cost,
 		&transaction.Memo,
 		&timestamp,
+		&currency,
+		&reverses,
+		&entry,
+		&sourceType,
+		&sourceID,
 	)
 
-	transaction.QtyIn, _ = big.NewInt(0).SetString(qtyIn, inventoryBase)
-	transaction.QtyOut, _ = big.NewInt(0).SetString(qtyIn, inventoryBase)
-
 	transaction.Date = time.Unix(timestamp, 0).UTC()
+	transaction.Cost.currency = currencyOf(currency)
+	transaction.Reverses = int(reverses.Int64)
+	transaction.Entry = int(entry.Int64)
+	transaction.Source = SourceRef{Type: sourceType.String, ID: int(sourceID.Int64)}
+	transaction.Amount = transaction.Cost.Extend(
+		transaction.QtyIn.Sub(transaction.QtyOut),
+		CentPrecision,
+		RoundHalfEven,
+	)
 
 	return transaction, err
 }
+
+type BooksTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (b BooksTable) Save(ctx context.Context, books Books) error {
+	tx, err := begin(ctx, b.DB, b.tx)
+	if err != nil {
+		return b.Dialect.wrap(err, "books")
+	}
+	defer tx.Rollback()
+
+	before, err := b.get(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if books.FunctionalCurrency != before.FunctionalCurrency {
+		var posted bool
+		err = b.Dialect.bind(tx).QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM gl_transaction)").Scan(&posted)
+		if err != nil {
+			return b.Dialect.wrap(err, "books")
+		}
+		if posted {
+			return fmt.Errorf("%w: the ledger is kept in %s", ErrInUse, before.FunctionalCurrency)
+		}
+	}
+
+	if _, err = b.Dialect.bind(tx).ExecContext(ctx, "DELETE FROM books"); err != nil {
+		return b.Dialect.wrap(err, "books")
+	}
+
+	if _, err = b.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO books(id, functional_currency, reporting_currency, hash_chain) VALUES (1, ?, ?, ?)",
+		books.FunctionalCurrency, books.ReportingCurrency, books.HashChain,
+	); err != nil {
+		return b.Dialect.wrap(err, "books")
+	}
+
+	if err = b.Dialect.audit(ctx, tx, "save", "books", 1, before, books); err != nil {
+		return b.Dialect.wrap(err, "books")
+	}
+
+	return b.Dialect.wrap(tx.Commit(), "books")
+}
+
+// Get returns the saved currency settings, or DefaultBooks if there are none.
+func (b BooksTable) Get(ctx context.Context) (Books, error) {
+	return b.get(ctx, conn(b.DB, b.tx))
+}
+
+func (b BooksTable) get(ctx context.Context, db querier) (Books, error) {
+	var books Books
+
+	row := b.Dialect.bind(db).QueryRowContext(ctx,
+		"SELECT functional_currency, reporting_currency, hash_chain FROM books WHERE id=1")
+
+	err := row.Scan(&books.FunctionalCurrency, &books.ReportingCurrency, &books.HashChain)
+	if err == sql.ErrNoRows {
+		return DefaultBooks, nil
+	}
+
+	return books, b.Dialect.wrap(err, "books")
+}
+
+type FXRateTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+func (f FXRateTable) Save(ctx context.Context, rate FXRate) error {
+	key := fmt.Sprintf("%s/%s on %s", rate.Base, rate.Quote, rate.Date.Format("2006-01-02"))
+
+	tx, err := begin(ctx, f.DB, f.tx)
+	if err != nil {
+		return f.Dialect.wrap(err, "fx rate %s", key)
+	}
+	defer tx.Rollback()
+
+	if _, err = f.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO fx_rate(base, quote, rate, timestamp) VALUES (?, ?, ?, ?)",
+		rate.Base, rate.Quote, rate.Rate.String(), rate.Date.UTC().Unix()); err != nil {
+		return f.Dialect.wrap(err, "fx rate %s", key)
+	}
+
+	if err = f.Dialect.audit(ctx, tx, "save", "fx_rate", key, nil, rate); err != nil {
+		return f.Dialect.wrap(err, "fx rate %s", key)
+	}
+
+	return f.Dialect.wrap(tx.Commit(), "fx rate %s", key)
+}
+
+// Get returns the latest rate on or before date between base and quote in
+// either direction.
+func (f FXRateTable) Get(ctx context.Context, base, quote string, date time.Time) (FXRate, error) {
+	var (
+		rate      FXRate
+		value     string
+		timestamp int64
+	)
+
+	row := f.Dialect.bind(conn(f.DB, f.tx)).QueryRowContext(ctx, `
+		SELECT base, quote, rate, timestamp
+		FROM fx_rate
+		WHERE ((base=? AND quote=?) OR (base=? AND quote=?)) AND timestamp<=?
+		ORDER BY timestamp DESC
+		LIMIT 1`,
+		base, quote, quote, base, date.UTC().Unix())
+
+	err := row.Scan(&rate.Base, &rate.Quote, &value, &timestamp)
+	if err == sql.ErrNoRows {
+		return rate, fmt.Errorf("%w: %s/%s on %s", ErrNoRate, base, quote, date.Format("2006-01-02"))
+	}
+	if err != nil {
+		return rate, f.Dialect.wrap(err, "fx rate %s/%s", base, quote)
+	}
+
+	var ok bool
+	if rate.Rate, ok = new(big.Rat).SetString(value); !ok {
+		return rate, fmt.Errorf("invalid rate %q for %s/%s", value, rate.Base, rate.Quote)
+	}
+	rate.Date = time.Unix(timestamp, 0).UTC()
+
+	if rate.Base != base {
+		rate = rate.Inverse()
+	}
+
+	return rate, nil
+}
+
+type PeriodTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+// Save adds an open period. Periods may not overlap.
+func (p PeriodTable) Save(ctx context.Context, period Period) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := begin(ctx, p.DB, p.tx)
+	if err != nil {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+	defer tx.Rollback()
+
+	var overlap int64
+	err = p.Dialect.bind(tx).QueryRowContext(ctx,
+		"SELECT start_at FROM period WHERE start_at<? AND end_at>? LIMIT 1",
+		period.End.UTC().Unix(), period.Start.UTC().Unix()).Scan(&overlap)
+	if err == nil {
+		return fmt.Errorf("%w: period %s overlaps one starting %s",
+			ErrConflict, period, time.Unix(overlap, 0).UTC().Format("2006-01-02"))
+	}
+	if err != sql.ErrNoRows {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+
+	if _, err = p.Dialect.bind(tx).ExecContext(ctx,
+		"INSERT INTO period(start_at, end_at) VALUES (?, ?)",
+		period.Start.UTC().Unix(), period.End.UTC().Unix()); err != nil {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+
+	if err = p.Dialect.audit(ctx, tx, "save", "period", period.Start.Format("2006-01-02"), nil, period); err != nil {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+
+	return p.Dialect.wrap(tx.Commit(), "period %s", period)
+}
+
+func (p PeriodTable) Get(ctx context.Context, date time.Time) (Period, error) {
+	row := p.Dialect.bind(conn(p.DB, p.tx)).QueryRowContext(ctx, `
+		SELECT start_at, end_at, closed_at, closing_entry
+		FROM period
+		WHERE start_at<=? AND end_at>?`,
+		date.UTC().Unix(), date.UTC().Unix())
+
+	period, err := scanPeriod(row)
+	return period, p.Dialect.wrap(err, "period on %s", date.Format("2006-01-02"))
+}
+
+func (p PeriodTable) List(ctx context.Context) ([]Period, error) {
+	rows, err := p.Dialect.bind(conn(p.DB, p.tx)).QueryContext(ctx, `
+		SELECT start_at, end_at, closed_at, closing_entry
+		FROM period
+		ORDER BY start_at`)
+	if err != nil {
+		return nil, p.Dialect.wrap(err, "periods")
+	}
+	defer rows.Close()
+
+	var periods []Period
+	for rows.Next() {
+		period, err := scanPeriod(rows)
+		if err != nil {
+			return nil, p.Dialect.wrap(err, "periods")
+		}
+		periods = append(periods, period)
+	}
+
+	return periods, p.Dialect.wrap(rows.Err(), "periods")
+}
+
+func (p PeriodTable) Close(ctx context.Context, period Period, balances []AccountBalance) error {
+	tx, err := begin(ctx, p.DB, p.tx)
+	if err != nil {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+	defer tx.Rollback()
+
+	res, err := p.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE period SET closed_at=?, closing_entry=? WHERE start_at=? AND closed_at IS NULL",
+		period.ClosedAt.UTC().Unix(), period.ClosingEntry, period.Start.UTC().Unix())
+	if err == nil {
+		err = requireRow(res)
+	}
+	if err != nil {
+		return p.Dialect.wrap(err, "open period %s", period)
+	}
+
+	if _, err = p.Dialect.bind(tx).ExecContext(ctx,
+		"DELETE FROM period_balance WHERE period_start=?",
+		period.Start.UTC().Unix()); err != nil {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+
+	for _, balance := range balances {
+		if _, err = p.Dialect.bind(tx).ExecContext(ctx, `
+			INSERT INTO period_balance(period_start, account_id, debit, credit, currency)
+			VALUES (?, ?, ?, ?, ?)`,
+			period.Start.UTC().Unix(),
+			balance.Account.ID,
+			ledgerAmount(balance.Debit),
+			ledgerAmount(balance.Credit),
+			currencyValue(balance.Debit.Add(balance.Credit).Currency()),
+		); err != nil {
+			return p.Dialect.wrap(err, "period %s account %d", period, balance.Account.ID)
+		}
+	}
+
+	before := period
+	before.ClosedAt, before.ClosingEntry = time.Time{}, 0
+	if err = p.Dialect.audit(ctx, tx, "close", "period", period.Start.Format("2006-01-02"), before, period); err != nil {
+		return p.Dialect.wrap(err, "period %s", period)
+	}
+
+	return p.Dialect.wrap(tx.Commit(), "period %s", period)
+}
+
+func (p PeriodTable) Reopen(ctx context.Context, start time.Time) error {
+	key := start.Format("2006-01-02")
+
+	tx, err := begin(ctx, p.DB, p.tx)
+	if err != nil {
+		return p.Dialect.wrap(err, "period starting %s", key)
+	}
+	defer tx.Rollback()
+
+	before, err := scanPeriod(p.Dialect.bind(tx).QueryRowContext(ctx, `
+		SELECT start_at, end_at, closed_at, closing_entry
+		FROM period
+		WHERE start_at=? AND closed_at IS NOT NULL`,
+		start.UTC().Unix()))
+	if err != nil {
+		return p.Dialect.wrap(err, "closed period starting %s", key)
+	}
+
+	if _, err = p.Dialect.bind(tx).ExecContext(ctx,
+		"UPDATE period SET closed_at=NULL WHERE start_at=?",
+		start.UTC().Unix()); err != nil {
+		return p.Dialect.wrap(err, "period starting %s", key)
+	}
+
+	after := before
+	after.ClosedAt = time.Time{}
+	if err = p.Dialect.audit(ctx, tx, "reopen", "period", key, before, after); err != nil {
+		return p.Dialect.wrap(err, "period starting %s", key)
+	}
+
+	return p.Dialect.wrap(tx.Commit(), "period starting %s", key)
+}
+
+func (p PeriodTable) Balances(ctx context.Context, start time.Time) ([]AccountBalance, error) {
+	rows, err := p.Dialect.bind(conn(p.DB, p.tx)).QueryContext(ctx, `
+		SELECT period_balance.account_id, account.name, period_balance.debit,
+			period_balance.credit, period_balance.currency
+		FROM period_balance INNER JOIN account ON account.id = period_balance.account_id
+		WHERE period_balance.period_start=?
+		ORDER BY period_balance.account_id`,
+		start.UTC().Unix())
+	if err != nil {
+		return nil, p.Dialect.wrap(err, "period balances")
+	}
+	defer rows.Close()
+
+	var balances []AccountBalance
+	for rows.Next() {
+		var (
+			balance  = AccountBalance{Debit: Cents(0), Credit: Cents(0)}
+			currency sql.NullString
+		)
+		if err = rows.Scan(
+			&balance.Account.ID,
+			&balance.Account.Name,
+			&balance.Debit,
+			&balance.Credit,
+			&currency,
+		); err != nil {
+			return nil, p.Dialect.wrap(err, "period balances")
+		}
+
+		balance.Debit.currency = currencyOf(currency)
+		balance.Credit.currency = currencyOf(currency)
+		balances = append(balances, balance)
+	}
+
+	return balances, p.Dialect.wrap(rows.Err(), "period balances")
+}
+
+func scanPeriod(scanner Scanner) (Period, error) {
+	var (
+		period       Period
+		start, end   int64
+		closedAt     sql.NullInt64
+		closingEntry sql.NullInt64
+	)
+
+	if err := scanner.Scan(&start, &end, &closedAt, &closingEntry); err != nil {
+		return period, err
+	}
+
+	period.Start = time.Unix(start, 0).UTC()
+	period.End = time.Unix(end, 0).UTC()
+	if closedAt.Valid {
+		period.ClosedAt = time.Unix(closedAt.Int64, 0).UTC()
+	}
+	period.ClosingEntry = int(closingEntry.Int64)
+
+	return period, nil
+}
+
+// requireOpen returns ErrPeriodClosed if date falls in a closed period.
+func requireOpen(ctx context.Context, db querier, d Dialect, date time.Time) error {
+	period, err := scanPeriod(db.QueryRowContext(ctx, `
+		SELECT start_at, end_at, closed_at, closing_entry
+		FROM period
+		WHERE start_at<=? AND end_at>? AND closed_at IS NOT NULL`,
+		date.UTC().Unix(), date.UTC().Unix()))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return d.wrap(err, "period on %s", date.Format("2006-01-02"))
+	}
+
+	return closedPeriodError(period, date)
+}
+
+type AuditTable struct {
+	DB      *sql.DB
+	Dialect Dialect
+	tx      *sql.Tx
+}
+
+var auditList = listSpec{
+	columns: []string{
+		"audit_log.id",
+		"audit_log.recorded_at",
+		"audit_log.username",
+		"audit_log.operation",
+		"audit_log.entity",
+		"audit_log.entity_id",
+		"audit_log.before_json",
+		"audit_log.after_json",
+	},
+	from: "audit_log",
+	sorts: map[string]string{
+		"id":   "audit_log.id",
+		"date": "audit_log.recorded_at",
+	},
+	keys: []string{"audit_log.id"},
+}
+
+// List returns audit entries filtered by the time they were recorded and
+// entity, sortable by "id" or "date".
+func (a AuditTable) List(ctx context.Context, opts ListOptions) ([]AuditEntry, string, error) {
+	var (
+		entries []AuditEntry
+		query   = listQuery{dialect: a.Dialect}
+	)
+
+	query.dateRange("audit_log.recorded_at", opts)
+	query.search("audit_log.entity", opts)
+
+	cursor, err := list(ctx, a.Dialect.bind(conn(a.DB, a.tx)), auditList, opts, query, func(scanner Scanner) error {
+		var (
+			entry         AuditEntry
+			recordedAt    int64
+			before, after string
+		)
+		err := scanner.Scan(
+			&entry.ID,
+			&recordedAt,
+			&entry.User,
+			&entry.Operation,
+			&entry.Entity,
+			&entry.EntityID,
+			&before,
+			&after,
+		)
+		entry.Time = time.Unix(recordedAt, 0).UTC()
+		entry.Before = json.RawMessage(before)
+		entry.After = json.RawMessage(after)
+		entries = append(entries, entry)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entries, cursor, nil
+}
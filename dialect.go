@@ -0,0 +1,268 @@
+package coincount
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the flavor of SQL spoken by the database behind the tables. The
+// zero value is SQLite.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite3"
+	case Postgres:
+		return "postgres"
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// Schema returns the statements creating the tables in d.
+func (d Dialect) Schema() string {
+	if d == Postgres {
+		return PostgresDbCreate
+	}
+	return SQLDbCreate
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txn is the transaction a table method writes in. Outside SQLStore.Atomic
+// it is the method's own; inside it is a savepoint in the store's
+// transaction, so Commit and Rollback settle only the method's writes.
+type txn struct {
+	*sql.Tx
+	savepoint bool
+	done      bool
+}
+
+// begin starts a transaction on db, or a savepoint in shared when set.
+func begin(ctx context.Context, db *sql.DB, shared *sql.Tx) (*txn, error) {
+	if shared == nil {
+		tx, err := db.BeginTx(ctx, nil)
+		return &txn{Tx: tx}, err
+	}
+
+	if _, err := shared.ExecContext(ctx, "SAVEPOINT write"); err != nil {
+		return nil, err
+	}
+	return &txn{Tx: shared, savepoint: true}, nil
+}
+
+func (t *txn) Commit() error {
+	if !t.savepoint {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+	_, err := t.Tx.Exec("RELEASE SAVEPOINT write")
+	return err
+}
+
+func (t *txn) Rollback() error {
+	if !t.savepoint {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+	if _, err := t.Tx.Exec("ROLLBACK TO SAVEPOINT write"); err != nil {
+		return err
+	}
+	_, err := t.Tx.Exec("RELEASE SAVEPOINT write")
+	return err
+}
+
+// conn returns what a table reads from: shared inside SQLStore.Atomic, so
+// that reads see the writes made there, and db otherwise.
+func conn(db *sql.DB, shared *sql.Tx) querier {
+	if shared != nil {
+		return shared
+	}
+	return db
+}
+
+// rebind rewrites the ? placeholders in query into the form d expects.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var (
+		b      strings.Builder
+		n      int
+		quoted bool
+	)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// like returns the case insensitive LIKE operator of d.
+func (d Dialect) like() string {
+	if d == Postgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// insert runs an INSERT and returns the ID generated for the new row.
+func (d Dialect) insert(ctx context.Context, db querier, query string, args ...interface{}) (int, error) {
+	if d == Postgres {
+		var id int
+		err := db.QueryRowContext(ctx, d.rebind(query)+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return -1, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+	return int(id), nil
+}
+
+// boundQuerier rebinds every query for its dialect before running it.
+type boundQuerier struct {
+	db      querier
+	dialect Dialect
+}
+
+// bind returns db rebinding placeholders for d.
+func (d Dialect) bind(db querier) querier {
+	return boundQuerier{db: db, dialect: d}
+}
+
+func (b boundQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return b.db.ExecContext(ctx, b.dialect.rebind(query), args...)
+}
+
+func (b boundQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return b.db.QueryContext(ctx, b.dialect.rebind(query), args...)
+}
+
+func (b boundQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return b.db.QueryRowContext(ctx, b.dialect.rebind(query), args...)
+}
+
+// wrap says which record err is about and maps missing rows and constraint
+// violations to ErrNotFound, ErrConflict and ErrMissingReference.
+func (d Dialect) wrap(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	what := fmt.Sprintf(format, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrNotFound, what)
+	}
+	if constraint := d.constraint(err); constraint != nil {
+		return fmt.Errorf("%w: %s: %w", constraint, what, err)
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// constraint returns the error for a constraint violation reported by the
+// driver, or nil. The drivers are not imported here so their messages are
+// matched instead.
+func (d Dialect) constraint(err error) error {
+	messages := map[error]string{
+		ErrConflict:         "UNIQUE constraint failed",
+		ErrMissingReference: "FOREIGN KEY constraint failed",
+	}
+	if d == Postgres {
+		messages = map[error]string{
+			ErrConflict:         "duplicate key value violates unique constraint",
+			ErrMissingReference: "violates foreign key constraint",
+		}
+		// A serializable transaction that lost to a concurrent one.
+		if strings.Contains(err.Error(), "could not serialize access") {
+			return ErrConflict
+		}
+	}
+
+	for constraint, message := range messages {
+		if strings.Contains(err.Error(), message) {
+			return constraint
+		}
+	}
+	return nil
+}
+
+// Open opens the database at dsn. SQLite connections are opened with
+// foreign keys enforced, as they always are in Postgres.
+func Open(d Dialect, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(d.String(), dsn)
+	if err != nil || d != SQLite {
+		return db, err
+	}
+
+	drv := db.Driver()
+	db.Close()
+	return sql.OpenDB(foreignKeysConnector{driver: drv, dsn: dsn}), nil
+}
+
+// foreignKeysConnector turns on SQLite's foreign key enforcement, which is
+// a per connection setting, for every connection in the pool.
+type foreignKeysConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c foreignKeysConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := conn.Prepare("PRAGMA foreign_keys = ON")
+	if err == nil {
+		_, err = stmt.Exec(nil)
+		stmt.Close()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (c foreignKeysConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,38 @@
+package coincount
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "sqlite unchanged",
+			dialect: SQLite,
+			query:   "SELECT id FROM account WHERE id=? AND name=?",
+			want:    "SELECT id FROM account WHERE id=? AND name=?",
+		},
+		{
+			name:    "postgres numbered",
+			dialect: Postgres,
+			query:   "SELECT id FROM account WHERE id=? AND name=?",
+			want:    "SELECT id FROM account WHERE id=$1 AND name=$2",
+		},
+		{
+			name:    "postgres skips literals",
+			dialect: Postgres,
+			query:   `SELECT '?' FROM gl_transaction WHERE memo LIKE ? ESCAPE '\'`,
+			want:    `SELECT '?' FROM gl_transaction WHERE memo LIKE $1 ESCAPE '\'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
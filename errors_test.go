@@ -0,0 +1,265 @@
+package coincount
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var errBroken = errors.New("broken connection")
+
+// failingDriver opens connections that fail at the step named in the DSN:
+// "begin", "exec", "query", "commit", "unique" or "foreign". Queries that do
+// not fail return no rows.
+type failingDriver struct{}
+
+func init() {
+	sql.Register("coincount-failing", failingDriver{})
+}
+
+func (failingDriver) Open(name string) (driver.Conn, error) {
+	return failingConn(name), nil
+}
+
+type failingConn string
+
+func (c failingConn) Prepare(query string) (driver.Stmt, error) {
+	return failingStmt(c), nil
+}
+
+func (c failingConn) Close() error {
+	return nil
+}
+
+func (c failingConn) Begin() (driver.Tx, error) {
+	if c == "begin" {
+		return nil, errBroken
+	}
+	return failingTx(c), nil
+}
+
+type failingTx string
+
+func (tx failingTx) Commit() error {
+	if tx == "commit" {
+		return errBroken
+	}
+	return nil
+}
+
+func (tx failingTx) Rollback() error {
+	return nil
+}
+
+type failingStmt string
+
+func (s failingStmt) Close() error {
+	return nil
+}
+
+func (s failingStmt) NumInput() int {
+	return -1
+}
+
+func (s failingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch s {
+	case "exec":
+		return nil, errBroken
+	case "unique":
+		return nil, errors.New("UNIQUE constraint failed: account.id")
+	case "foreign":
+		return nil, errors.New("FOREIGN KEY constraint failed")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s failingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s == "query" {
+		return nil, errBroken
+	}
+	return noRows{}, nil
+}
+
+type noRows struct{}
+
+func (noRows) Columns() []string {
+	return nil
+}
+
+func (noRows) Close() error {
+	return nil
+}
+
+func (noRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
+
+func TestTableErrors(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		date    = time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+		balance = []GLTransaction{
+			{ID: 1, Date: date, Account: EthMain, Debit: Cents(100)},
+			{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(100)},
+		}
+	)
+
+	tests := []struct {
+		name    string
+		fail    string
+		run     func(db *sql.DB) error
+		wantErr error
+	}{
+		{
+			name: "gl save begin",
+			fail: "begin",
+			run: func(db *sql.DB) error {
+				return GLTransactionTable{DB: db}.Save(ctx, balance)
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "gl save insert",
+			fail: "exec",
+			run: func(db *sql.DB) error {
+				return GLTransactionTable{DB: db}.Save(ctx, balance)
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "gl save commit",
+			fail: "commit",
+			run: func(db *sql.DB) error {
+				return GLTransactionTable{DB: db}.Save(ctx, balance)
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "gl save unbalanced",
+			run: func(db *sql.DB) error {
+				return GLTransactionTable{DB: db}.Save(ctx, balance[:1])
+			},
+			wantErr: ErrUnbalanced,
+		},
+		{
+			name: "gl get query",
+			fail: "query",
+			run: func(db *sql.DB) error {
+				_, err := GLTransactionTable{DB: db}.Get(ctx, 1)
+				return err
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "gl get missing",
+			run: func(db *sql.DB) error {
+				_, err := GLTransactionTable{DB: db}.Get(ctx, 1)
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "inventory save insert",
+			fail: "exec",
+			run: func(db *sql.DB) error {
+				_, err := InventoryTransactionTable{DB: db}.Save(ctx, InventoryTransaction{})
+				return err
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "purchase save begin",
+			fail: "begin",
+			run: func(db *sql.DB) error {
+				_, err := PurchaseTable{DB: db}.Save(ctx, MiningPayout(time.Unix(0, 0), ether("1"), Cents(100)))
+				return err
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "account get missing",
+			run: func(db *sql.DB) error {
+				_, err := AccountTable{DB: db}.Get(ctx, 1)
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "account save duplicate",
+			fail: "unique",
+			run: func(db *sql.DB) error {
+				return AccountTable{DB: db}.Save(ctx, VisaCard)
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name: "gl save missing account",
+			fail: "foreign",
+			run: func(db *sql.DB) error {
+				return GLTransactionTable{DB: db}.Save(ctx, balance)
+			},
+			wantErr: ErrMissingReference,
+		},
+		{
+			name: "period get missing",
+			run: func(db *sql.DB) error {
+				_, err := PeriodTable{DB: db}.Get(ctx, date)
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "period save invalid",
+			run: func(db *sql.DB) error {
+				return PeriodTable{DB: db}.Save(ctx, Period{Start: date, End: date})
+			},
+			wantErr: ErrInvalidPeriod,
+		},
+		{
+			name: "inventory save closed check",
+			fail: "query",
+			run: func(db *sql.DB) error {
+				_, err := InventoryTransactionTable{DB: db}.Save(ctx, InventoryTransaction{})
+				return err
+			},
+			wantErr: errBroken,
+		},
+		{
+			name: "vendor archive query",
+			fail: "query",
+			run: func(db *sql.DB) error {
+				return VendorTable{DB: db}.Archive(ctx, 1)
+			},
+			wantErr: errBroken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open("coincount-failing", tt.fail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if err = tt.run(db); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForeignKeysConnector(t *testing.T) {
+	connector := foreignKeysConnector{driver: failingDriver{}, dsn: "exec"}
+	if _, err := connector.Connect(context.Background()); !errors.Is(err, errBroken) {
+		t.Errorf("Connect() error = %v, want %v", err, errBroken)
+	}
+
+	connector.dsn = ""
+	if _, err := connector.Connect(context.Background()); err != nil {
+		t.Errorf("Connect() error = %v", err)
+	}
+}
@@ -26,6 +26,11 @@ var (
 		Name: "ETH-Gemini",
 	}
 
+	AccountsReceivable = Account{
+		ID:   1200,
+		Name: "Accounts Receivable",
+	}
+
 	EnsDomains = Account{
 		ID:   1510,
 		Name: "ENS Domains",
@@ -36,11 +41,21 @@ var (
 		Name: "Electric Bill",
 	}
 
+	RetainedEarnings = Account{
+		ID:   3900,
+		Name: "Retained Earnings",
+	}
+
 	RevenueEth = Account{
 		ID:   4010,
 		Name: "Revenue ETH",
 	}
 
+	ServiceRevenue = Account{
+		ID:   4020,
+		Name: "Service Revenue",
+	}
+
 	CostOfEthSold = Account{
 		ID:   5010,
 		Name: "Cost of ETH Sold",
@@ -51,6 +66,11 @@ var (
 		Name: "Eth Adjustments",
 	}
 
+	PurchaseDiscounts = Account{
+		ID:   5900,
+		Name: "Purchase Discounts",
+	}
+
 	EthTXFee = Account{
 		ID:   6200,
 		Name: "Ethereum Transaction Fee",
@@ -66,26 +86,42 @@ var (
 		Name: "Gemini Fee",
 	}
 
+	SalesTax = Account{
+		ID:   6300,
+		Name: "Sales Tax",
+	}
+
 	AssetSales = Account{
 		ID:   7900,
 		Name: "Gain/Loss Asset Sales",
 	}
 
+	UnrealizedFX = Account{
+		ID:   7910,
+		Name: "Unrealized FX Gain/Loss",
+	}
+
 	GLAccounts = []Account{
 		VisaCard,
 		GeminiUSD,
 		EthMain,
 		EthCoinbase,
 		EthGemini,
+		AccountsReceivable,
 		EnsDomains,
 		ElectricBill,
+		RetainedEarnings,
 		RevenueEth,
+		ServiceRevenue,
 		CostOfEthSold,
 		EthAdjustments,
+		PurchaseDiscounts,
 		EthTXFee,
 		CoinbaseFee,
 		GeminiFee,
+		SalesTax,
 		AssetSales,
+		UnrealizedFX,
 	}
 
 	Ether = Item{
@@ -129,4 +165,13 @@ var (
 		Coinbase,
 		Gemini,
 	}
+
+	OTCDesk = Customer{
+		ID:   1,
+		Name: "OTC Desk",
+	}
+
+	Customers = []Customer{
+		OTCDesk,
+	}
 )
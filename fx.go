@@ -0,0 +1,394 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+var ErrNoRate = errors.New("No Exchange Rate")
+
+// Books holds the currency settings of a set of books. Amounts are posted to
+// the general ledger in the functional currency and reports may be
+// translated into the reporting currency.
+type Books struct {
+	FunctionalCurrency string
+	ReportingCurrency  string
+	// HashChain links every journal entry saved to the one before it so
+	// that VerifyLedger can detect changes made behind the store's back.
+	HashChain bool
+}
+
+var DefaultBooks = Books{
+	FunctionalCurrency: DefaultCurrency,
+	ReportingCurrency:  DefaultCurrency,
+}
+
+// FXRate says that on Date one unit of Base was worth Rate units of Quote.
+type FXRate struct {
+	Date  time.Time
+	Base  string
+	Quote string
+	Rate  *big.Rat
+}
+
+// Inverse returns the rate quoting Base in terms of Quote.
+func (r FXRate) Inverse() FXRate {
+	return FXRate{
+		Date:  r.Date,
+		Base:  r.Quote,
+		Quote: r.Base,
+		Rate:  new(big.Rat).Inv(r.Rate),
+	}
+}
+
+// Convert translates m from Base into Quote, or from Quote into Base using
+// the inverse rate, rounding to precision with mode.
+func (r FXRate) Convert(m Money, precision int, mode RoundingMode) (Money, error) {
+	rate := r
+	switch m.Currency() {
+	case r.Base:
+	case r.Quote:
+		rate = r.Inverse()
+	default:
+		return Money{}, fmt.Errorf("%w: cannot convert %s with %s/%s", ErrCurrencyMismatch, m.Currency(), r.Base, r.Quote)
+	}
+
+	value := new(big.Rat).SetFrac(m.bigInt(), pow10(m.Precision()))
+	return ratToMoney(value.Mul(value, rate.Rate), rate.Quote, precision, mode), nil
+}
+
+func (r FXRate) String() string {
+	return fmt.Sprintf("%s 1 %s = %s %s", r.Date.Format("2006-01-02"), r.Base, r.Rate.FloatString(6), r.Quote)
+}
+
+// FXRates is a history of exchange rates.
+type FXRates []FXRate
+
+// Find returns the latest rate on or before date that converts between base
+// and quote, inverting a stored quote/base rate if needed.
+func (rates FXRates) Find(base, quote string, date time.Time) (FXRate, error) {
+	var (
+		found FXRate
+		ok    bool
+	)
+
+	for _, rate := range rates {
+		if rate.Date.After(date) || ok && !rate.Date.After(found.Date) {
+			continue
+		}
+
+		switch {
+		case rate.Base == base && rate.Quote == quote:
+			found, ok = rate, true
+		case rate.Base == quote && rate.Quote == base:
+			found, ok = rate.Inverse(), true
+		}
+	}
+
+	if !ok {
+		return FXRate{}, fmt.Errorf("%w: %s/%s on %s", ErrNoRate, base, quote, date.Format("2006-01-02"))
+	}
+	return found, nil
+}
+
+// PostPurchase posts a purchase in any currency into the books. Purchases in
+// the functional currency post exactly as the package level PostPurchase.
+// Foreign purchases are converted at rate and each general ledger line keeps
+// the original amount in Foreign so the balance can be revalued later.
+func (b Books) PostPurchase(
+	date time.Time,
+	purchase Purchase,
+	nextGLTransaction int,
+	rate FXRate,
+) ([]InventoryTransaction, []GLTransaction, error) {
+	currency := purchase.Amount.Currency()
+	if currency == "" || currency == b.FunctionalCurrency {
+		return PostPurchase(date, purchase, nextGLTransaction)
+	}
+
+	inventoryTransactions, glTransactions, err := postPurchaseLines(date, purchase, nextGLTransaction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payable, err := rate.Convert(purchase.Amount, CentPrecision, RoundHalfEven)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := glTransactions[:len(glTransactions)-1]
+	converted, err := convertLines(lines, payable, purchase.Amount, rate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Lines follow the items, and inventory transactions the inventory items.
+	inventory := 0
+	for i := range lines {
+		foreign := lines[i].Debit.Sub(lines[i].Credit)
+		lines[i].Debit, lines[i].Credit = debitCredit(converted[i])
+		lines[i].Foreign = foreign
+
+		if item := purchase.Items[i]; item.LineKind() == LineInventory {
+			inventoryTransactions[inventory].Amount = converted[i]
+			inventoryTransactions[inventory].Cost = NewUnitCost(converted[i], item.Qty)
+			inventory++
+		}
+	}
+
+	sum := payable.zero()
+	for _, amount := range converted {
+		sum = sum.Add(amount)
+	}
+
+	last := &glTransactions[len(glTransactions)-1]
+	last.Foreign = purchase.Amount.Neg()
+	last.Debit, last.Credit = debitCredit(sum.Neg())
+
+	return inventoryTransactions, combineLines(glTransactions), nil
+}
+
+// PostPayment posts a vendor payment in any currency into the books.
+// Payments in the functional currency post exactly as the package level
+// PostPayment. Foreign payments are converted at rate and both lines keep
+// the original amount in Foreign, like the payable of a foreign purchase.
+func (b Books) PostPayment(payment VendorPayment, nextGLTransaction int, rate FXRate) ([]GLTransaction, error) {
+	glTransactions, err := PostPayment(payment, nextGLTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := payment.Amount.Currency()
+	if currency == "" || currency == b.FunctionalCurrency {
+		return glTransactions, nil
+	}
+
+	amount, err := rate.Convert(payment.Amount, CentPrecision, RoundHalfEven)
+	if err != nil {
+		return nil, err
+	}
+
+	foreign := ledgerAmount(payment.Amount)
+	debit, credit := &glTransactions[0], &glTransactions[1]
+	debit.Debit, debit.Credit, debit.Foreign = amount, amount.zero(), foreign
+	credit.Debit, credit.Credit, credit.Foreign = amount.zero(), amount, foreign.Neg()
+
+	return glTransactions, nil
+}
+
+// convertLines converts the signed item lines of a purchase. When every line
+// is a debit and they add up to the purchase the converted payable is
+// allocated across them so nothing is lost to rounding; otherwise each line
+// is converted on its own.
+func convertLines(lines []GLTransaction, payable, total Money, rate FXRate) ([]Money, error) {
+	var (
+		ratios    = make([]int64, len(lines))
+		sum       = total.zero()
+		allocated = true
+	)
+
+	for i, line := range lines {
+		amount := line.Debit.Sub(line.Credit)
+		sum = sum.Add(amount)
+		if amount.Sign() < 0 || !amount.bigInt().IsInt64() {
+			allocated = false
+			continue
+		}
+		ratios[i] = amount.bigInt().Int64()
+	}
+
+	if allocated && sum.Cmp(total) == 0 && len(lines) > 0 {
+		return payable.Allocate(ratios...), nil
+	}
+
+	converted := make([]Money, len(lines))
+	for i, line := range lines {
+		amount, err := rate.Convert(line.Debit.Sub(line.Credit), CentPrecision, RoundHalfEven)
+		if err != nil {
+			return nil, err
+		}
+		converted[i] = amount
+	}
+	return converted, nil
+}
+
+// debitCredit splits a signed amount into a debit and credit pair.
+func debitCredit(amount Money) (Money, Money) {
+	if amount.Sign() < 0 {
+		return amount.zero(), amount.Neg()
+	}
+	return amount, amount.zero()
+}
+
+// Revalue restates the functional balance an account holds in the foreign
+// currency rate converts into the functional currency. transactions are the
+// account's general ledger lines up to date; only those carrying an amount
+// in that currency are revalued, so an account holding several currencies is
+// revalued once for each with its own rate. The difference between the
+// carrying value and the revalued balance is posted against gainLoss; no
+// entry is returned when they agree. The line on account carries a zero
+// Foreign amount in the currency so later revaluations count it.
+func (b Books) Revalue(
+	date time.Time,
+	account Account,
+	transactions []GLTransaction,
+	rate FXRate,
+	gainLoss Account,
+	nextGLTransaction int,
+) ([]GLTransaction, error) {
+	currency := rate.Base
+	if currency == b.FunctionalCurrency {
+		currency = rate.Quote
+	}
+	if rate.Base != b.FunctionalCurrency && rate.Quote != b.FunctionalCurrency {
+		return nil, fmt.Errorf("%w: revaluing with %s/%s, books are in %s", ErrCurrencyMismatch, rate.Base, rate.Quote, b.FunctionalCurrency)
+	}
+
+	carrying, foreign := Money{}, Money{}
+	for _, transaction := range transactions {
+		if transaction.Account.ID != account.ID || transaction.Date.After(date) || transaction.Foreign.Currency() != currency {
+			continue
+		}
+
+		for _, amount := range []Money{transaction.Debit, transaction.Credit} {
+			if c := amount.Currency(); c != "" && c != b.FunctionalCurrency {
+				return nil, fmt.Errorf("%w: entry %d is carried in %s, books are in %s", ErrCurrencyMismatch, transaction.ID, c, b.FunctionalCurrency)
+			}
+		}
+		carrying = carrying.Add(transaction.Debit.Sub(transaction.Credit))
+		foreign = foreign.Add(transaction.Foreign)
+	}
+
+	if foreign.Currency() == "" {
+		return nil, nil
+	}
+
+	revalued, err := rate.Convert(foreign, CentPrecision, RoundHalfEven)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := revalued.Sub(carrying)
+	if diff.IsZero() {
+		return nil, nil
+	}
+
+	memo := fmt.Sprintf("FXR-%s-%s", foreign.Currency(), date.Format("20060102"))
+	debit, credit := debitCredit(diff)
+
+	return []GLTransaction{
+		{
+			ID:      nextGLTransaction,
+			Date:    date,
+			Account: account,
+			Debit:   debit,
+			Credit:  credit,
+			Memo:    memo,
+			Foreign: foreign.zero(),
+		},
+		{
+			ID:      nextGLTransaction,
+			Date:    date,
+			Account: gainLoss,
+			Debit:   credit,
+			Credit:  debit,
+			Memo:    memo,
+		},
+	}, nil
+}
+
+// RevalueAccount revalues each foreign currency balance account holds in
+// the ledger in store, at that currency's rate on date, posting the
+// differences against gainLoss. The entries are saved in one transaction
+// and returned. A currency without a rate on date fails with ErrNoRate.
+func RevalueAccount(ctx context.Context, store Store, date time.Time, account, gainLoss Account) ([]GLTransaction, error) {
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = requirePeriodOpen(ctx, store, date); err != nil {
+		return nil, err
+	}
+
+	var posted []GLTransaction
+	err = store.Atomic(ctx, func(tx Store) error {
+		posted = nil
+
+		gl, _, err := tx.GLTransactions().List(ctx, ListOptions{AccountID: account.ID})
+		if err != nil {
+			return err
+		}
+
+		held := make(map[string]bool)
+		var currencies []string
+		for _, transaction := range gl {
+			currency := transaction.Foreign.Currency()
+			if currency == "" || held[currency] || transaction.Date.After(date) {
+				continue
+			}
+			held[currency] = true
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+
+		for _, currency := range currencies {
+			rate, err := tx.FXRates().Get(ctx, currency, books.FunctionalCurrency, date)
+			if err != nil {
+				return err
+			}
+
+			nextID, err := tx.GLTransactions().NextID(ctx)
+			if err != nil {
+				return err
+			}
+
+			entry, err := books.Revalue(date, account, gl, rate, gainLoss, nextID)
+			if err != nil {
+				return err
+			}
+			if len(entry) == 0 {
+				continue
+			}
+
+			if err = tx.GLTransactions().Save(ctx, entry); err != nil {
+				return err
+			}
+			gl = append(gl, entry[0])
+			posted = append(posted, entry...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return posted, nil
+}
+
+// Translate converts balances into the reporting currency at rate. Balances
+// already in the reporting currency are returned unchanged.
+func (b Books) Translate(balances []AccountBalance, rate FXRate) ([]AccountBalance, error) {
+	translated := make([]AccountBalance, len(balances))
+	for i, balance := range balances {
+		translated[i] = balance
+		currency := balance.Debit.Add(balance.Credit).Currency()
+		if currency == "" || currency == b.ReportingCurrency {
+			continue
+		}
+
+		debit, err := rate.Convert(balance.Debit, CentPrecision, RoundHalfEven)
+		if err != nil {
+			return nil, err
+		}
+		credit, err := rate.Convert(balance.Credit, CentPrecision, RoundHalfEven)
+		if err != nil {
+			return nil, err
+		}
+		translated[i].Debit, translated[i].Credit = debit, credit
+	}
+
+	return translated, nil
+}
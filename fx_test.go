@@ -0,0 +1,161 @@
+package coincount
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func euros(cents int64) Money {
+	return NewMoney(big.NewInt(cents), "EUR", CentPrecision)
+}
+
+func TestFXRatesFind(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2017, 8, d, 0, 0, 0, 0, time.UTC) }
+	rates := FXRates{
+		{Date: day(1), Base: "USD", Quote: "EUR", Rate: big.NewRat(85, 100)},
+		{Date: day(10), Base: "EUR", Quote: "USD", Rate: big.NewRat(5, 4)},
+	}
+
+	got, err := rates.Find("USD", "EUR", day(5))
+	if err != nil || got.Rate.Cmp(big.NewRat(85, 100)) != 0 {
+		t.Errorf("Find() = %v, %v", got, err)
+	}
+
+	got, err = rates.Find("USD", "EUR", day(12))
+	if err != nil || got.Rate.Cmp(big.NewRat(4, 5)) != 0 {
+		t.Errorf("Find() inverse = %v, %v", got, err)
+	}
+
+	if _, err = rates.Find("USD", "GBP", day(12)); err == nil {
+		t.Error("Find() expected ErrNoRate")
+	}
+}
+
+func TestBooksPostPurchase(t *testing.T) {
+	books := Books{FunctionalCurrency: "EUR", ReportingCurrency: "USD"}
+	rate := FXRate{Base: "USD", Quote: "EUR", Rate: big.NewRat(9, 10)}
+
+	purchase := Purchase{
+		ID:             7,
+		Date:           time.Unix(0, 0),
+		Vendor:         Gemini,
+		PayableAccount: GeminiUSD,
+		Amount:         Cents(1000),
+		Items: []PurchaseItem{
+			{Item: Ether, InventoryAccount: EthGemini, Qty: ether("0.003"), Amount: Cents(333)},
+			{Item: Ether, InventoryAccount: EthMain, Qty: ether("0.003"), Amount: Cents(333)},
+			{Item: Ether, InventoryAccount: EthCoinbase, Qty: ether("0.003"), Amount: Cents(334)},
+		},
+	}
+
+	inv, gl, err := books.PostPurchase(time.Unix(0, 0), purchase, 1, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	debits, credits := Money{}, Money{}
+	for _, line := range gl {
+		if line.Debit.Add(line.Credit).Currency() != "EUR" {
+			t.Errorf("line %v not in functional currency", line)
+		}
+		debits, credits = debits.Add(line.Debit), credits.Add(line.Credit)
+	}
+	if debits.Cmp(credits) != 0 || credits.Cmp(euros(900)) != 0 {
+		t.Errorf("entry debits %v credits %v, want balanced at 9.00 EUR", debits, credits)
+	}
+
+	if payable := gl[len(gl)-1]; payable.Foreign.Cmp(Cents(-1000)) != 0 {
+		t.Errorf("payable foreign amount = %v", payable.Foreign)
+	}
+
+	for i, transaction := range inv {
+		extended := transaction.Cost.Extend(transaction.QtyIn, CentPrecision, RoundTruncate)
+		if extended.Cmp(gl[i].Debit) != 0 {
+			t.Errorf("inventory %d extends to %v, ledger has %v", i, extended, gl[i].Debit)
+		}
+	}
+}
+
+func TestBooksRevalue(t *testing.T) {
+	books := Books{FunctionalCurrency: "EUR", ReportingCurrency: "EUR"}
+	date := time.Unix(1000, 0)
+
+	history := []GLTransaction{
+		{Date: time.Unix(0, 0), Account: GeminiUSD, Debit: euros(900), Credit: euros(0), Foreign: Cents(1000)},
+	}
+
+	entry, err := books.Revalue(date, GeminiUSD, history,
+		FXRate{Base: "USD", Quote: "EUR", Rate: big.NewRat(95, 100)}, UnrealizedFX, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entry) != 2 || entry[0].Debit.Cmp(euros(50)) != 0 || entry[1].Credit.Cmp(euros(50)) != 0 {
+		t.Errorf("Revalue() gain = %v", entry)
+	}
+
+	again, err := books.Revalue(date, GeminiUSD, append(history, entry...),
+		FXRate{Base: "USD", Quote: "EUR", Rate: big.NewRat(95, 100)}, UnrealizedFX, 3)
+	if err != nil || again != nil {
+		t.Errorf("Revalue() again at the same rate = %v, %v", again, err)
+	}
+
+	entry, err = books.Revalue(date, GeminiUSD, history,
+		FXRate{Base: "USD", Quote: "EUR", Rate: big.NewRat(9, 10)}, UnrealizedFX, 2)
+	if err != nil || entry != nil {
+		t.Errorf("Revalue() at carrying rate = %v, %v", entry, err)
+	}
+
+	entry, err = books.Revalue(date, GeminiUSD, history,
+		FXRate{Base: "EUR", Quote: "USD", Rate: big.NewRat(5, 4)}, UnrealizedFX, 2)
+	if err != nil || len(entry) != 2 || entry[0].Credit.Cmp(euros(100)) != 0 || entry[1].Debit.Cmp(euros(100)) != 0 {
+		t.Errorf("Revalue() loss = %v, %v", entry, err)
+	}
+}
+
+func TestBooksRevalueCurrencies(t *testing.T) {
+	books := Books{FunctionalCurrency: "EUR", ReportingCurrency: "EUR"}
+	date := time.Unix(1000, 0)
+	pounds := NewMoney(big.NewInt(500), "GBP", CentPrecision)
+
+	history := []GLTransaction{
+		{ID: 1, Date: time.Unix(0, 0), Account: GeminiUSD, Debit: euros(900), Credit: euros(0), Foreign: Cents(1000)},
+		{ID: 2, Date: time.Unix(0, 0), Account: GeminiUSD, Debit: euros(600), Credit: euros(0), Foreign: pounds},
+		{ID: 3, Date: time.Unix(0, 0), Account: GeminiUSD, Debit: euros(0), Credit: euros(25)},
+	}
+
+	tests := []struct {
+		name          string
+		rate          FXRate
+		debit, credit int64
+		memo          string
+	}{
+		{name: "dollars", rate: FXRate{Base: "USD", Quote: "EUR", Rate: big.NewRat(95, 100)}, debit: 50, memo: "FXR-USD-"},
+		{name: "pounds", rate: FXRate{Base: "GBP", Quote: "EUR", Rate: big.NewRat(11, 10)}, credit: 50, memo: "FXR-GBP-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := books.Revalue(date, GeminiUSD, history, tt.rate, UnrealizedFX, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entry) != 2 || entry[0].Debit.Cmp(euros(tt.debit)) != 0 || entry[0].Credit.Cmp(euros(tt.credit)) != 0 ||
+				entry[0].Memo != tt.memo+date.Format("20060102") {
+				t.Errorf("Revalue() = %v", entry)
+			}
+		})
+	}
+
+	if _, err := books.Revalue(date, GeminiUSD, history,
+		FXRate{Base: "USD", Quote: "GBP", Rate: big.NewRat(4, 5)}, UnrealizedFX, 4); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Revalue() with a rate not into the books' currency error = %v", err)
+	}
+
+	balances := TrialBalance(history)
+	if len(balances) != 1 || len(balances[0].Foreign) != 2 ||
+		balances[0].Foreign[0].Cmp(pounds) != 0 || balances[0].Foreign[1].Cmp(Cents(1000)) != 0 {
+		t.Errorf("TrialBalance() = %+v", balances)
+	}
+}
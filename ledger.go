@@ -0,0 +1,162 @@
+package coincount
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LedgerLine is one general ledger line in an account ledger.
+type LedgerLine struct {
+	Entry int       `json:"entry"`
+	Date  time.Time `json:"date"`
+	Memo  string    `json:"memo"`
+	// Source names the document the line was posted from, such as PUR-12,
+	// or is empty for manual entries.
+	Source string `json:"source,omitempty"`
+	Debit  Money  `json:"debit"`
+	Credit Money  `json:"credit"`
+	// Balance is the running balance after the line, debits positive.
+	Balance Money `json:"balance"`
+}
+
+// AccountLedger lists the lines of one account over a date range between
+// its opening and closing balances.
+type AccountLedger struct {
+	Account Account      `json:"account"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Opening Money        `json:"opening"`
+	Lines   []LedgerLine `json:"lines"`
+	Closing Money        `json:"closing"`
+}
+
+var sourcePattern = regexp.MustCompile(`^([A-Z]+-[0-9]+)(:|$)`)
+
+// SourceDocument returns the document reference a memo starts with, such as
+// PUR-12 or REV-3, or "".
+func SourceDocument(memo string) string {
+	if match := sourcePattern.FindStringSubmatch(memo); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// lineSource names the document line was posted from, falling back to its
+// memo for lines posted before sources were kept.
+func lineSource(line GLTransaction) string {
+	if !line.Source.IsZero() {
+		return line.Source.String()
+	}
+	return SourceDocument(line.Memo)
+}
+
+// NewAccountLedger runs a balance from opening over the lines of gl that are
+// on account, in date and entry order.
+func NewAccountLedger(account Account, opening Money, gl []GLTransaction) AccountLedger {
+	ledger := AccountLedger{Account: account, Opening: opening, Closing: opening}
+
+	var lines []GLTransaction
+	for _, line := range gl {
+		if line.Account.ID == account.ID {
+			lines = append(lines, line)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if !lines[i].Date.Equal(lines[j].Date) {
+			return lines[i].Date.Before(lines[j].Date)
+		}
+		return lines[i].ID < lines[j].ID
+	})
+
+	for _, line := range lines {
+		ledger.Closing = ledger.Closing.Add(line.Debit).Sub(line.Credit)
+		ledger.Lines = append(ledger.Lines, LedgerLine{
+			Entry:   line.ID,
+			Date:    line.Date,
+			Memo:    line.Memo,
+			Source:  lineSource(line),
+			Debit:   line.Debit,
+			Credit:  line.Credit,
+			Balance: ledger.Closing,
+		})
+	}
+	return ledger
+}
+
+// AccountLedgerReport builds the ledger of the account with accountID from
+// from up to to, either of which may be zero to leave that side open. The
+// opening balance totals every line before from.
+func AccountLedgerReport(ctx context.Context, store Store, accountID int, from, to time.Time) (AccountLedger, error) {
+	account, err := store.Accounts().Get(ctx, accountID)
+	if err != nil {
+		return AccountLedger{}, err
+	}
+
+	var opening Money
+	if !from.IsZero() {
+		before, _, err := store.GLTransactions().List(ctx, ListOptions{AccountID: accountID, To: from})
+		if err != nil {
+			return AccountLedger{}, err
+		}
+		for _, line := range before {
+			opening = opening.Add(line.Debit).Sub(line.Credit)
+		}
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, ListOptions{AccountID: accountID, From: from, To: to})
+	if err != nil {
+		return AccountLedger{}, err
+	}
+
+	ledger := NewAccountLedger(account, opening, gl)
+	ledger.From, ledger.To = from, to
+	return ledger, nil
+}
+
+// WriteCSV writes the ledger as CSV with an opening and a closing row around
+// the lines.
+func (l AccountLedger) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"entry", "date", "memo", "source", "debit", "credit", "balance", "currency"})
+	out.Write([]string{"", formatDate(l.From), "Opening balance", "", "", "", l.Opening.Decimal(), l.Opening.Currency()})
+	for _, line := range l.Lines {
+		out.Write([]string{
+			strconv.Itoa(line.Entry),
+			formatDate(line.Date),
+			line.Memo,
+			line.Source,
+			line.Debit.Decimal(),
+			line.Credit.Decimal(),
+			line.Balance.Decimal(),
+			line.Balance.Currency(),
+		})
+	}
+	out.Write([]string{"", formatDate(l.To), "Closing balance", "", "", "", l.Closing.Decimal(), l.Closing.Currency()})
+	out.Flush()
+	return out.Error()
+}
+
+// WriteJSON writes the ledger as an indented JSON document.
+func (l AccountLedger) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(l); err != nil {
+		return fmt.Errorf("encoding ledger of account %d: %w", l.Account.ID, err)
+	}
+	return nil
+}
+
+// formatDate formats t as YYYY-MM-DD, or "" for the zero time.
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,74 @@
+package coincount
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSourceDocument(t *testing.T) {
+	tests := []struct {
+		memo string
+		want string
+	}{
+		{"PUR-12", "PUR-12"},
+		{"REV-3: wrong vendor", "REV-3"},
+		{"CLOSE-2017-12-31", ""},
+		{"paid the electric bill", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.memo, func(t *testing.T) {
+			if got := SourceDocument(tt.memo); got != tt.want {
+				t.Errorf("SourceDocument(%q) = %q, want %q", tt.memo, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccountLedger(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2017, 8, d, 0, 0, 0, 0, time.UTC) }
+	gl := []GLTransaction{
+		{ID: 3, Date: day(2), Account: EthMain, Debit: Cents(0), Credit: Cents(300), Memo: "REV-1"},
+		{ID: 1, Date: day(1), Account: EthMain, Debit: Cents(500), Credit: Cents(0), Memo: "PUR-1"},
+		{ID: 1, Date: day(1), Account: VisaCard, Debit: Cents(0), Credit: Cents(500), Memo: "PUR-1"},
+		{ID: 2, Date: day(2), Account: EthMain, Debit: Cents(100), Credit: Cents(0)},
+	}
+
+	tests := []struct {
+		name    string
+		opening Money
+		entries []int
+		balance []int64
+		closing int64
+	}{
+		{name: "no opening", opening: Cents(0), entries: []int{1, 2, 3}, balance: []int64{500, 600, 300}, closing: 300},
+		{name: "opening", opening: Cents(-1000), entries: []int{1, 2, 3}, balance: []int64{-500, -400, -700}, closing: -700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewAccountLedger(EthMain, tt.opening, gl)
+			if len(ledger.Lines) != len(tt.entries) {
+				t.Fatalf("NewAccountLedger() = %d lines, want %d", len(ledger.Lines), len(tt.entries))
+			}
+			for i, line := range ledger.Lines {
+				if line.Entry != tt.entries[i] || line.Balance.Cmp(Cents(tt.balance[i])) != 0 {
+					t.Errorf("line %d = entry %d balance %v, want entry %d balance %v",
+						i, line.Entry, line.Balance, tt.entries[i], Cents(tt.balance[i]))
+				}
+			}
+			if ledger.Closing.Cmp(Cents(tt.closing)) != 0 {
+				t.Errorf("Closing = %v, want %v", ledger.Closing, Cents(tt.closing))
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := NewAccountLedger(EthMain, Cents(0), gl).WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "1,2017-08-01,PUR-1,PUR-1,5.00,0.00,5.00,USD\n") {
+		t.Errorf("WriteCSV() = %s", buf.String())
+	}
+}
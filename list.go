@@ -0,0 +1,252 @@
+package coincount
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor = errors.New("Invalid Cursor")
+	ErrInvalidSort   = errors.New("Invalid Sort")
+)
+
+// ListOptions filters, orders and pages the results of a table's List.
+// Filters that do not apply to a table are ignored.
+type ListOptions struct {
+	// From and To bound the date, From inclusive and To exclusive. Zero
+	// times leave that side open.
+	From time.Time
+	To   time.Time
+
+	AccountID  int
+	VendorID   int
+	CustomerID int
+	ItemID     int
+	// Reverses lists only the ledger rows reversing the journal entry or
+	// inventory transaction with this ID.
+	Reverses int
+	// Entry lists only the inventory transactions recorded with the journal
+	// entry with this ID.
+	Entry int
+	// Source lists only the ledger rows posted from this document.
+	Source SourceRef
+
+	// IncludeArchived lists archived accounts, items, vendors and customers
+	// too. Documents are listed whether or not what they refer to has since
+	// been archived.
+	IncludeArchived bool
+
+	// Search matches a substring of the memo for ledger rows, of the name
+	// for accounts, items, vendors, customers, recurring templates, a
+	// purchase's vendor, an invoice's customer and a budget's account, or
+	// of the entity for audit entries.
+	Search string
+
+	// SortBy names the field to order by, "id" by default. Ties are broken
+	// by the table's key.
+	SortBy     string
+	Descending bool
+
+	// Cursor continues a previous List from where it stopped.
+	Cursor string
+	// Limit caps the number of results, with 0 meaning no limit. When more
+	// results remain List returns a cursor for the next page.
+	Limit int
+}
+
+// listSpec describes how a table can be listed.
+type listSpec struct {
+	// columns and from make up the body of the SELECT.
+	columns []string
+	from    string
+	// sorts maps the names accepted in SortBy to columns.
+	sorts map[string]string
+	// keys uniquely identify a row and break ties in the sort.
+	keys []string
+}
+
+// listQuery collects the WHERE clause of a List.
+type listQuery struct {
+	dialect Dialect
+	where   []string
+	args    []interface{}
+}
+
+func (q *listQuery) add(clause string, args ...interface{}) {
+	q.where = append(q.where, clause)
+	q.args = append(q.args, args...)
+}
+
+func (q *listQuery) dateRange(column string, opts ListOptions) {
+	if !opts.From.IsZero() {
+		q.add(column+">=?", opts.From.UTC().Unix())
+	}
+	if !opts.To.IsZero() {
+		q.add(column+"<?", opts.To.UTC().Unix())
+	}
+}
+
+func (q *listQuery) search(column string, opts ListOptions) {
+	if opts.Search == "" {
+		return
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(opts.Search)
+	q.add(column+" "+q.dialect.like()+` ? ESCAPE '\'`, "%"+escaped+"%")
+}
+
+// cursorScanner appends the columns that make up the cursor to every Scan.
+type cursorScanner struct {
+	rows   *sql.Rows
+	values []interface{}
+}
+
+func (c *cursorScanner) Scan(dest ...interface{}) error {
+	for i := range c.values {
+		dest = append(dest, &c.values[i])
+	}
+	return c.rows.Scan(dest...)
+}
+
+// list runs a keyset paginated query for spec and calls scan for every row
+// on the page. It returns the cursor of the next page, or "" on the last.
+func list(
+	ctx context.Context,
+	db querier,
+	spec listSpec,
+	opts ListOptions,
+	query listQuery,
+	scan func(Scanner) error,
+) (string, error) {
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	sortColumn, ok := spec.sorts[sortBy]
+	if !ok {
+		return "", fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, sortBy)
+	}
+
+	cursorColumns := append([]string{sortColumn}, spec.keys...)
+
+	if opts.Cursor != "" {
+		values, err := decodeCursor(opts.Cursor, len(cursorColumns))
+		if err != nil {
+			return "", err
+		}
+		clause, args := keysetClause(cursorColumns, values, opts.Descending)
+		query.add(clause, args...)
+	}
+
+	direction := " ASC"
+	if opts.Descending {
+		direction = " DESC"
+	}
+
+	order := make([]string, len(cursorColumns))
+	for i, column := range cursorColumns {
+		order[i] = column + direction
+	}
+
+	stmt := "SELECT " + strings.Join(append(append([]string{}, spec.columns...), cursorColumns...), ", ") +
+		" FROM " + spec.from
+	if len(query.where) > 0 {
+		stmt += " WHERE " + strings.Join(query.where, " AND ")
+	}
+	stmt += " ORDER BY " + strings.Join(order, ", ")
+	if opts.Limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d", opts.Limit+1)
+	}
+
+	rows, err := db.QueryContext(ctx, stmt, query.args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	scanner := &cursorScanner{rows: rows, values: make([]interface{}, len(cursorColumns))}
+	var last []interface{}
+	for count := 0; rows.Next(); count++ {
+		if opts.Limit > 0 && count == opts.Limit {
+			return encodeCursor(last)
+		}
+
+		if err = scan(scanner); err != nil {
+			return "", err
+		}
+		last = append(last[:0], scanner.values...)
+	}
+
+	return "", rows.Err()
+}
+
+// keysetClause selects the rows after values in the sort order of columns.
+func keysetClause(columns []string, values []interface{}, descending bool) (string, []interface{}) {
+	op := ">"
+	if descending {
+		op = "<"
+	}
+
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	for i := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+"=?")
+			args = append(args, values[j])
+		}
+		parts = append(parts, columns[i]+op+"?")
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+func encodeCursor(values []interface{}) (string, error) {
+	for i, value := range values {
+		if b, ok := value.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string, n int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&values); err != nil || len(values) != n {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+
+	for i, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if values[i], err = number.Int64(); err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,73 @@
+package coincount
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestKeysetClause(t *testing.T) {
+	tests := []struct {
+		name       string
+		columns    []string
+		values     []interface{}
+		descending bool
+		want       string
+		wantArgs   []interface{}
+	}{
+		{
+			name:     "single key",
+			columns:  []string{"id"},
+			values:   []interface{}{int64(3)},
+			want:     "((id>?))",
+			wantArgs: []interface{}{int64(3)},
+		},
+		{
+			name:       "sort with tie breakers",
+			columns:    []string{"timestamp", "id", "account_id"},
+			values:     []interface{}{int64(100), int64(3), int64(1020)},
+			descending: true,
+			want:       "((timestamp<?) OR (timestamp=? AND id<?) OR (timestamp=? AND id=? AND account_id<?))",
+			wantArgs: []interface{}{
+				int64(100),
+				int64(100), int64(3),
+				int64(100), int64(3), int64(1020),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := keysetClause(tt.columns, tt.values, tt.descending)
+			if got != tt.want {
+				t.Errorf("keysetClause() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("keysetClause() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := []interface{}{"Electric Company", int64(1)}
+
+	cursor, err := encodeCursor([]interface{}{[]byte("Electric Company"), int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decodeCursor(cursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCursor() = %#v, want %#v", got, want)
+	}
+
+	if _, err = decodeCursor(cursor, 3); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("decodeCursor() with wrong arity error = %v", err)
+	}
+	if _, err = decodeCursor("not a cursor!", 2); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("decodeCursor() with garbage error = %v", err)
+	}
+}
@@ -0,0 +1,2072 @@
+package coincount
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in memory. It behaves like
+// the SQL tables and is meant for tests and dry runs.
+type MemoryStore struct {
+	mu sync.Mutex
+	memoryData
+}
+
+// memoryData is everything a MemoryStore keeps.
+type memoryData struct {
+	accounts  map[int]Account
+	items     map[int]Item
+	vendors   map[int]Vendor
+	customers map[int]Customer
+	purchases map[int]Purchase
+	payments  []VendorPayment
+	invoices  []Invoice
+	receipts  []CustomerReceipt
+	recurring []RecurringTemplate
+	instances []RecurringInstance
+	budgets   []Budget
+	gl        []GLTransaction
+	inventory []InventoryTransaction
+	books     *Books
+	rates     FXRates
+	periods   []Period
+	audit     []AuditEntry
+	chain     []ChainLink
+	// closing holds the balances each period was last closed with, by the
+	// Unix time it starts.
+	closing map[int64][]AccountBalance
+
+	lastPurchaseID  int
+	lastInventoryID int
+}
+
+// copy returns d with its own maps and slices, so that changes made to
+// either afterwards do not show in the other.
+func (d memoryData) copy() memoryData {
+	c := d
+	c.accounts = make(map[int]Account, len(d.accounts))
+	for id, acct := range d.accounts {
+		c.accounts[id] = acct
+	}
+	c.items = make(map[int]Item, len(d.items))
+	for id, item := range d.items {
+		c.items[id] = item
+	}
+	c.vendors = make(map[int]Vendor, len(d.vendors))
+	for id, vendor := range d.vendors {
+		c.vendors[id] = vendor
+	}
+	c.customers = make(map[int]Customer, len(d.customers))
+	for id, customer := range d.customers {
+		c.customers[id] = customer
+	}
+	c.purchases = make(map[int]Purchase, len(d.purchases))
+	for id, purchase := range d.purchases {
+		c.purchases[id] = purchase
+	}
+	c.payments = append([]VendorPayment(nil), d.payments...)
+	c.invoices = append([]Invoice(nil), d.invoices...)
+	c.receipts = append([]CustomerReceipt(nil), d.receipts...)
+	c.recurring = append([]RecurringTemplate(nil), d.recurring...)
+	c.instances = append([]RecurringInstance(nil), d.instances...)
+	c.budgets = append([]Budget(nil), d.budgets...)
+	c.gl = append([]GLTransaction(nil), d.gl...)
+	c.inventory = append([]InventoryTransaction(nil), d.inventory...)
+	c.rates = append(FXRates(nil), d.rates...)
+	c.periods = append([]Period(nil), d.periods...)
+	c.audit = append([]AuditEntry(nil), d.audit...)
+	c.chain = append([]ChainLink(nil), d.chain...)
+	c.closing = make(map[int64][]AccountBalance, len(d.closing))
+	for start, balances := range d.closing {
+		c.closing[start] = balances
+	}
+	return c
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryData: memoryData{
+		accounts:  make(map[int]Account),
+		items:     make(map[int]Item),
+		vendors:   make(map[int]Vendor),
+		customers: make(map[int]Customer),
+		purchases: make(map[int]Purchase),
+		closing:   make(map[int64][]AccountBalance),
+	}}
+}
+
+func (m *MemoryStore) Accounts() AccountStore {
+	return memoryAccounts{m}
+}
+
+func (m *MemoryStore) Items() ItemStore {
+	return memoryItems{m}
+}
+
+func (m *MemoryStore) Vendors() VendorStore {
+	return memoryVendors{m}
+}
+
+func (m *MemoryStore) Customers() CustomerStore {
+	return memoryCustomers{m}
+}
+
+func (m *MemoryStore) Purchases() PurchaseStore {
+	return memoryPurchases{m}
+}
+
+func (m *MemoryStore) Payments() PaymentStore {
+	return memoryPayments{m}
+}
+
+func (m *MemoryStore) Invoices() InvoiceStore {
+	return memoryInvoices{m}
+}
+
+func (m *MemoryStore) Receipts() ReceiptStore {
+	return memoryReceipts{m}
+}
+
+func (m *MemoryStore) Recurring() RecurringStore {
+	return memoryRecurring{m}
+}
+
+func (m *MemoryStore) Budgets() BudgetStore {
+	return memoryBudgets{m}
+}
+
+func (m *MemoryStore) GLTransactions() GLTransactionStore {
+	return memoryGLTransactions{m}
+}
+
+func (m *MemoryStore) InventoryTransactions() InventoryTransactionStore {
+	return memoryInventoryTransactions{m}
+}
+
+func (m *MemoryStore) Books() BooksStore {
+	return memoryBooks{m}
+}
+
+func (m *MemoryStore) FXRates() FXRateStore {
+	return memoryFXRates{m}
+}
+
+func (m *MemoryStore) Periods() PeriodStore {
+	return memoryPeriods{m}
+}
+
+func (m *MemoryStore) Audit() AuditStore {
+	return memoryAudit{m}
+}
+
+// Atomic calls fn with m and, if fn fails, puts back everything as it was
+// before. It does not isolate fn from other callers: their writes made
+// while fn runs are put back too.
+func (m *MemoryStore) Atomic(ctx context.Context, fn func(Store) error) error {
+	m.mu.Lock()
+	saved := m.memoryData.copy()
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.memoryData = saved
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// storedTime drops what the SQL tables cannot keep: anything below a second
+// and the location.
+func storedTime(t time.Time) time.Time {
+	return time.Unix(t.Unix(), 0).UTC()
+}
+
+func (m *MemoryStore) account(id int) Account {
+	if acct, ok := m.accounts[id]; ok {
+		return Account{ID: acct.ID, Name: acct.Name}
+	}
+	return Account{ID: id}
+}
+
+func (m *MemoryStore) item(id int) Item {
+	if item, ok := m.items[id]; ok {
+		return Item{ID: item.ID, Name: item.Name}
+	}
+	return Item{ID: id}
+}
+
+func (m *MemoryStore) vendor(id int) Vendor {
+	if vendor, ok := m.vendors[id]; ok {
+		return Vendor{ID: vendor.ID, Name: vendor.Name}
+	}
+	return Vendor{ID: id}
+}
+
+func (m *MemoryStore) customer(id int) Customer {
+	if customer, ok := m.customers[id]; ok {
+		return Customer{ID: customer.ID, Name: customer.Name}
+	}
+	return Customer{ID: id}
+}
+
+// requireAccount, requireItem, requireVendor and requireCustomer refuse
+// references to missing records the way the foreign keys of the SQL tables
+// do.
+func (m *MemoryStore) requireAccount(id int) error {
+	if _, ok := m.accounts[id]; !ok {
+		return fmt.Errorf("%w: account %d", ErrMissingReference, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) requireItem(id int) error {
+	if _, ok := m.items[id]; !ok {
+		return fmt.Errorf("%w: item %d", ErrMissingReference, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) requireVendor(id int) error {
+	if _, ok := m.vendors[id]; !ok {
+		return fmt.Errorf("%w: vendor %d", ErrMissingReference, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) requireCustomer(id int) error {
+	if _, ok := m.customers[id]; !ok {
+		return fmt.Errorf("%w: customer %d", ErrMissingReference, id)
+	}
+	return nil
+}
+
+// activeAccount, activeItem, activeVendor and activeCustomer also refuse
+// archived records, which new documents may not refer to.
+func (m *MemoryStore) activeAccount(id int) error {
+	if err := m.requireAccount(id); err != nil {
+		return err
+	}
+	if m.accounts[id].Archived {
+		return fmt.Errorf("%w: account %d", ErrArchived, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) activeItem(id int) error {
+	if err := m.requireItem(id); err != nil {
+		return err
+	}
+	if m.items[id].Archived {
+		return fmt.Errorf("%w: item %d", ErrArchived, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) activeVendor(id int) error {
+	if err := m.requireVendor(id); err != nil {
+		return err
+	}
+	if m.vendors[id].Archived {
+		return fmt.Errorf("%w: vendor %d", ErrArchived, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) activeCustomer(id int) error {
+	if err := m.requireCustomer(id); err != nil {
+		return err
+	}
+	if m.customers[id].Archived {
+		return fmt.Errorf("%w: customer %d", ErrArchived, id)
+	}
+	return nil
+}
+
+// record appends an entry for a write to the audit log.
+func (m *MemoryStore) record(ctx context.Context, operation, entity string, id, before, after interface{}) error {
+	entry, err := newAuditEntry(ctx, operation, entity, id, before, after)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = len(m.audit) + 1
+	entry.Time = storedTime(entry.Time)
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+// requireOpen refuses postings into closed periods like the SQL tables do.
+func (m *MemoryStore) requireOpen(date time.Time) error {
+	for _, period := range m.periods {
+		if period.Closed() && period.Contains(date) {
+			return closedPeriodError(period, date)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) accountInUse(id int) bool {
+	for _, purchase := range m.purchases {
+		if purchase.PayableAccount.ID == id {
+			return true
+		}
+		for _, item := range purchase.Items {
+			if item.InventoryAccount.ID == id {
+				return true
+			}
+		}
+	}
+	for _, payment := range m.payments {
+		if payment.PayableAccount.ID == id || payment.PaymentAccount.ID == id {
+			return true
+		}
+	}
+	for _, invoice := range m.invoices {
+		if invoice.ReceivableAccount.ID == id {
+			return true
+		}
+		for _, line := range invoice.Lines {
+			if line.Account.ID == id || line.InventoryAccount.ID == id || line.CostAccount.ID == id {
+				return true
+			}
+		}
+	}
+	for _, receipt := range m.receipts {
+		if receipt.ReceivableAccount.ID == id || receipt.DepositAccount.ID == id {
+			return true
+		}
+	}
+	for _, transaction := range m.gl {
+		if transaction.Account.ID == id {
+			return true
+		}
+	}
+	for _, transaction := range m.inventory {
+		if transaction.Account.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) itemInUse(id int) bool {
+	for _, purchase := range m.purchases {
+		for _, item := range purchase.Items {
+			if item.Item.ID == id {
+				return true
+			}
+		}
+	}
+	for _, invoice := range m.invoices {
+		for _, line := range invoice.Lines {
+			if line.Item.ID == id {
+				return true
+			}
+		}
+	}
+	for _, transaction := range m.inventory {
+		if transaction.Item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) vendorInUse(id int) bool {
+	for _, purchase := range m.purchases {
+		if purchase.Vendor.ID == id {
+			return true
+		}
+	}
+	for _, payment := range m.payments {
+		if payment.Vendor.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) customerInUse(id int) bool {
+	for _, invoice := range m.invoices {
+		if invoice.Customer.ID == id {
+			return true
+		}
+	}
+	for _, receipt := range m.receipts {
+		if receipt.Customer.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(str, substr string) bool {
+	return strings.Contains(strings.ToLower(str), strings.ToLower(substr))
+}
+
+func inDateRange(date time.Time, opts ListOptions) bool {
+	if !opts.From.IsZero() && date.Unix() < opts.From.Unix() {
+		return false
+	}
+	if !opts.To.IsZero() && date.Unix() >= opts.To.Unix() {
+		return false
+	}
+	return true
+}
+
+// memoryList orders n filtered records the way list orders rows and returns
+// the indexes on the requested page along with the next page's cursor.
+func memoryList(
+	n int,
+	opts ListOptions,
+	sorts map[string]func(i int) interface{},
+	keys func(i int) []interface{},
+) ([]int, string, error) {
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	sortValue, ok := sorts[sortBy]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, sortBy)
+	}
+
+	if n == 0 {
+		return nil, "", nil
+	}
+
+	direction := 1
+	if opts.Descending {
+		direction = -1
+	}
+
+	values := make([][]interface{}, n)
+	for i := range values {
+		values[i] = append([]interface{}{sortValue(i)}, keys(i)...)
+	}
+
+	var after []interface{}
+	if opts.Cursor != "" {
+		var err error
+		if after, err = decodeCursor(opts.Cursor, 1+len(keys(0))); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var page []int
+	for i := range values {
+		if after == nil || compareValues(values[i], after)*direction > 0 {
+			page = append(page, i)
+		}
+	}
+
+	sort.Slice(page, func(a, b int) bool {
+		return compareValues(values[page[a]], values[page[b]])*direction < 0
+	})
+
+	if opts.Limit <= 0 || len(page) <= opts.Limit {
+		return page, "", nil
+	}
+
+	page = page[:opts.Limit]
+	cursor, err := encodeCursor(append([]interface{}{}, values[page[len(page)-1]]...))
+	return page, cursor, err
+}
+
+func compareValues(a, b []interface{}) int {
+	for i := range a {
+		var c int
+		switch x := a[i].(type) {
+		case int64:
+			y, _ := b[i].(int64)
+			switch {
+			case x < y:
+				c = -1
+			case x > y:
+				c = 1
+			}
+		default:
+			c = strings.Compare(fmt.Sprint(a[i]), fmt.Sprint(b[i]))
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+type memoryAccounts struct {
+	*MemoryStore
+}
+
+func (m memoryAccounts) Save(ctx context.Context, acct Account) error {
+	if err := acct.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[acct.ID]; ok {
+		return fmt.Errorf("%w: account %d already exists", ErrConflict, acct.ID)
+	}
+
+	stored := Account{ID: acct.ID, Name: acct.Name}
+	if err := m.record(ctx, "save", "account", acct.ID, nil, stored); err != nil {
+		return err
+	}
+
+	m.accounts[acct.ID] = stored
+	return nil
+}
+
+func (m memoryAccounts) Get(ctx context.Context, id int) (Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acct, ok := m.accounts[id]
+	if !ok {
+		return Account{}, fmt.Errorf("%w: account %d", ErrNotFound, id)
+	}
+	return acct, nil
+}
+
+func (m memoryAccounts) List(ctx context.Context, opts ListOptions) ([]Account, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Account
+	for _, acct := range m.accounts {
+		if opts.AccountID != 0 && acct.ID != opts.AccountID ||
+			!opts.IncludeArchived && acct.Archived ||
+			!containsFold(acct.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, acct)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":   func(i int) interface{} { return int64(matched[i].ID) },
+		"name": func(i int) interface{} { return matched[i].Name },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var accts []Account
+	for _, i := range page {
+		accts = append(accts, matched[i])
+	}
+	return accts, cursor, nil
+}
+
+func (m memoryAccounts) Update(ctx context.Context, acct Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.accounts[acct.ID]
+	if !ok {
+		return fmt.Errorf("%w: account %d", ErrNotFound, acct.ID)
+	}
+
+	after := stored
+	after.Name = acct.Name
+	if err := m.record(ctx, "update", "account", acct.ID, stored, after); err != nil {
+		return err
+	}
+
+	m.accounts[acct.ID] = after
+	return nil
+}
+
+func (m memoryAccounts) Archive(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.accountInUse(id) {
+		return fmt.Errorf("%w: account %d", ErrInUse, id)
+	}
+
+	stored, ok := m.accounts[id]
+	if !ok || stored.Archived {
+		return fmt.Errorf("%w: account %d", ErrNotFound, id)
+	}
+
+	after := stored
+	after.Archived = true
+	if err := m.record(ctx, "archive", "account", id, stored, after); err != nil {
+		return err
+	}
+
+	m.accounts[id] = after
+	return nil
+}
+
+type memoryItems struct {
+	*MemoryStore
+}
+
+func (m memoryItems) Save(ctx context.Context, item Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[item.ID]; ok {
+		return fmt.Errorf("%w: item %d already exists", ErrConflict, item.ID)
+	}
+
+	stored := Item{ID: item.ID, Name: item.Name}
+	if err := m.record(ctx, "save", "item", item.ID, nil, stored); err != nil {
+		return err
+	}
+
+	m.items[item.ID] = stored
+	return nil
+}
+
+func (m memoryItems) Get(ctx context.Context, id int) (Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[id]
+	if !ok {
+		return Item{}, fmt.Errorf("%w: item %d", ErrNotFound, id)
+	}
+	return item, nil
+}
+
+func (m memoryItems) List(ctx context.Context, opts ListOptions) ([]Item, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Item
+	for _, item := range m.items {
+		if opts.ItemID != 0 && item.ID != opts.ItemID ||
+			!opts.IncludeArchived && item.Archived ||
+			!containsFold(item.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":   func(i int) interface{} { return int64(matched[i].ID) },
+		"name": func(i int) interface{} { return matched[i].Name },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []Item
+	for _, i := range page {
+		items = append(items, matched[i])
+	}
+	return items, cursor, nil
+}
+
+func (m memoryItems) Update(ctx context.Context, item Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.items[item.ID]
+	if !ok {
+		return fmt.Errorf("%w: item %d", ErrNotFound, item.ID)
+	}
+
+	after := stored
+	after.Name = item.Name
+	if err := m.record(ctx, "update", "item", item.ID, stored, after); err != nil {
+		return err
+	}
+
+	m.items[item.ID] = after
+	return nil
+}
+
+func (m memoryItems) Archive(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.itemInUse(id) {
+		return fmt.Errorf("%w: item %d", ErrInUse, id)
+	}
+
+	stored, ok := m.items[id]
+	if !ok || stored.Archived {
+		return fmt.Errorf("%w: item %d", ErrNotFound, id)
+	}
+
+	after := stored
+	after.Archived = true
+	if err := m.record(ctx, "archive", "item", id, stored, after); err != nil {
+		return err
+	}
+
+	m.items[id] = after
+	return nil
+}
+
+type memoryVendors struct {
+	*MemoryStore
+}
+
+func (m memoryVendors) Save(ctx context.Context, vendor Vendor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.vendors[vendor.ID]; ok {
+		return fmt.Errorf("%w: vendor %d already exists", ErrConflict, vendor.ID)
+	}
+
+	stored := Vendor{ID: vendor.ID, Name: vendor.Name}
+	if err := m.record(ctx, "save", "vendor", vendor.ID, nil, stored); err != nil {
+		return err
+	}
+
+	m.vendors[vendor.ID] = stored
+	return nil
+}
+
+func (m memoryVendors) Get(ctx context.Context, id int) (Vendor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vendor, ok := m.vendors[id]
+	if !ok {
+		return Vendor{}, fmt.Errorf("%w: vendor %d", ErrNotFound, id)
+	}
+	return vendor, nil
+}
+
+func (m memoryVendors) List(ctx context.Context, opts ListOptions) ([]Vendor, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Vendor
+	for _, vendor := range m.vendors {
+		if opts.VendorID != 0 && vendor.ID != opts.VendorID ||
+			!opts.IncludeArchived && vendor.Archived ||
+			!containsFold(vendor.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, vendor)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":   func(i int) interface{} { return int64(matched[i].ID) },
+		"name": func(i int) interface{} { return matched[i].Name },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var vendors []Vendor
+	for _, i := range page {
+		vendors = append(vendors, matched[i])
+	}
+	return vendors, cursor, nil
+}
+
+func (m memoryVendors) Update(ctx context.Context, vendor Vendor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.vendors[vendor.ID]
+	if !ok {
+		return fmt.Errorf("%w: vendor %d", ErrNotFound, vendor.ID)
+	}
+
+	after := stored
+	after.Name = vendor.Name
+	if err := m.record(ctx, "update", "vendor", vendor.ID, stored, after); err != nil {
+		return err
+	}
+
+	m.vendors[vendor.ID] = after
+	return nil
+}
+
+func (m memoryVendors) Archive(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.vendorInUse(id) {
+		return fmt.Errorf("%w: vendor %d", ErrInUse, id)
+	}
+
+	stored, ok := m.vendors[id]
+	if !ok || stored.Archived {
+		return fmt.Errorf("%w: vendor %d", ErrNotFound, id)
+	}
+
+	after := stored
+	after.Archived = true
+	if err := m.record(ctx, "archive", "vendor", id, stored, after); err != nil {
+		return err
+	}
+
+	m.vendors[id] = after
+	return nil
+}
+
+type memoryCustomers struct {
+	*MemoryStore
+}
+
+func (m memoryCustomers) Save(ctx context.Context, customer Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.customers[customer.ID]; ok {
+		return fmt.Errorf("%w: customer %d already exists", ErrConflict, customer.ID)
+	}
+
+	stored := Customer{ID: customer.ID, Name: customer.Name}
+	if err := m.record(ctx, "save", "customer", customer.ID, nil, stored); err != nil {
+		return err
+	}
+
+	m.customers[customer.ID] = stored
+	return nil
+}
+
+func (m memoryCustomers) Get(ctx context.Context, id int) (Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	customer, ok := m.customers[id]
+	if !ok {
+		return Customer{}, fmt.Errorf("%w: customer %d", ErrNotFound, id)
+	}
+	return customer, nil
+}
+
+func (m memoryCustomers) List(ctx context.Context, opts ListOptions) ([]Customer, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Customer
+	for _, customer := range m.customers {
+		if opts.CustomerID != 0 && customer.ID != opts.CustomerID ||
+			!opts.IncludeArchived && customer.Archived ||
+			!containsFold(customer.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, customer)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":   func(i int) interface{} { return int64(matched[i].ID) },
+		"name": func(i int) interface{} { return matched[i].Name },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var customers []Customer
+	for _, i := range page {
+		customers = append(customers, matched[i])
+	}
+	return customers, cursor, nil
+}
+
+func (m memoryCustomers) Update(ctx context.Context, customer Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.customers[customer.ID]
+	if !ok {
+		return fmt.Errorf("%w: customer %d", ErrNotFound, customer.ID)
+	}
+
+	after := stored
+	after.Name = customer.Name
+	if err := m.record(ctx, "update", "customer", customer.ID, stored, after); err != nil {
+		return err
+	}
+
+	m.customers[customer.ID] = after
+	return nil
+}
+
+func (m memoryCustomers) Archive(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.customerInUse(id) {
+		return fmt.Errorf("%w: customer %d", ErrInUse, id)
+	}
+
+	stored, ok := m.customers[id]
+	if !ok || stored.Archived {
+		return fmt.Errorf("%w: customer %d", ErrNotFound, id)
+	}
+
+	after := stored
+	after.Archived = true
+	if err := m.record(ctx, "archive", "customer", id, stored, after); err != nil {
+		return err
+	}
+
+	m.customers[id] = after
+	return nil
+}
+
+type memoryPurchases struct {
+	*MemoryStore
+}
+
+func (m memoryPurchases) Save(ctx context.Context, purchase Purchase) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := purchase.Validate(); err != nil {
+		return -1, err
+	}
+	if err := m.activeVendor(purchase.Vendor.ID); err != nil {
+		return -1, err
+	}
+	if err := m.activeAccount(purchase.PayableAccount.ID); err != nil {
+		return -1, err
+	}
+	for _, item := range purchase.Items {
+		// Expense, tax and discount lines need not name an item.
+		if item.Item.ID != 0 {
+			if err := m.activeItem(item.Item.ID); err != nil {
+				return -1, err
+			}
+		}
+		if err := m.activeAccount(item.InventoryAccount.ID); err != nil {
+			return -1, err
+		}
+	}
+
+	stored := purchase
+	stored.ID = m.lastPurchaseID + 1
+	stored.Date = storedTime(purchase.Date)
+	stored.Amount = ledgerAmount(purchase.Amount)
+	stored.Items = make([]PurchaseItem, len(purchase.Items))
+	for i, item := range purchase.Items {
+		item.Amount = ledgerAmount(item.Amount)
+		stored.Items[i] = item
+	}
+
+	if err := m.record(ctx, "save", "purchase", stored.ID, nil, stored); err != nil {
+		return -1, err
+	}
+
+	m.lastPurchaseID = stored.ID
+	m.purchases[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// resolve fills in names from the master data the way the SQL joins do.
+func (m memoryPurchases) resolve(purchase Purchase) Purchase {
+	purchase.Vendor = m.vendor(purchase.Vendor.ID)
+	purchase.PayableAccount = m.account(purchase.PayableAccount.ID)
+
+	items := make([]PurchaseItem, len(purchase.Items))
+	for i, item := range purchase.Items {
+		item.Item = m.item(item.Item.ID)
+		item.InventoryAccount = m.account(item.InventoryAccount.ID)
+		items[i] = item
+	}
+	purchase.Items = items
+
+	return purchase
+}
+
+func (m memoryPurchases) Get(ctx context.Context, id int) (Purchase, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purchase, ok := m.purchases[id]
+	if !ok {
+		return Purchase{}, fmt.Errorf("%w: purchase %d", ErrNotFound, id)
+	}
+	return m.resolve(purchase), nil
+}
+
+func (m memoryPurchases) List(ctx context.Context, opts ListOptions) ([]Purchase, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Purchase
+	for _, purchase := range m.purchases {
+		purchase = m.resolve(purchase)
+		if opts.VendorID != 0 && purchase.Vendor.ID != opts.VendorID ||
+			!inDateRange(purchase.Date, opts) ||
+			!containsFold(purchase.Vendor.Name, opts.Search) {
+			continue
+		}
+
+		hasItem, hasAccount := opts.ItemID == 0, opts.AccountID == 0 || purchase.PayableAccount.ID == opts.AccountID
+		for _, item := range purchase.Items {
+			hasItem = hasItem || item.Item.ID == opts.ItemID
+			hasAccount = hasAccount || item.InventoryAccount.ID == opts.AccountID
+		}
+		if !hasItem || !hasAccount {
+			continue
+		}
+
+		matched = append(matched, purchase)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":     func(i int) interface{} { return int64(matched[i].ID) },
+		"date":   func(i int) interface{} { return matched[i].Date.Unix() },
+		"amount": func(i int) interface{} { return matched[i].Amount.Minor().Int64() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var purchases []Purchase
+	for _, i := range page {
+		purchases = append(purchases, matched[i])
+	}
+	return purchases, cursor, nil
+}
+
+type memoryPayments struct {
+	*MemoryStore
+}
+
+func (m memoryPayments) Save(ctx context.Context, payment VendorPayment) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := payment.Validate(); err != nil {
+		return -1, err
+	}
+	if err := m.activeVendor(payment.Vendor.ID); err != nil {
+		return -1, err
+	}
+	for _, id := range []int{payment.PayableAccount.ID, payment.PaymentAccount.ID} {
+		if err := m.activeAccount(id); err != nil {
+			return -1, err
+		}
+	}
+	for _, application := range payment.Applications {
+		if _, ok := m.purchases[application.PurchaseID]; !ok {
+			return -1, fmt.Errorf("%w: purchase %d", ErrMissingReference, application.PurchaseID)
+		}
+	}
+
+	stored := payment
+	stored.ID = len(m.payments) + 1
+	stored.Date = storedTime(payment.Date)
+	stored.Amount = ledgerAmount(payment.Amount)
+	stored.Applications = make([]PaymentApplication, len(payment.Applications))
+	for i, application := range payment.Applications {
+		application.Amount = ledgerAmount(application.Amount)
+		stored.Applications[i] = application
+	}
+
+	if err := m.record(ctx, "save", "vendor_payment", stored.ID, nil, stored); err != nil {
+		return -1, err
+	}
+
+	m.payments = append(m.payments, stored)
+	return stored.ID, nil
+}
+
+func (m memoryPayments) resolve(payment VendorPayment) VendorPayment {
+	payment.Vendor = m.vendor(payment.Vendor.ID)
+	payment.PayableAccount = m.account(payment.PayableAccount.ID)
+	payment.PaymentAccount = m.account(payment.PaymentAccount.ID)
+	payment.Applications = append([]PaymentApplication(nil), payment.Applications...)
+	return payment
+}
+
+func (m memoryPayments) Get(ctx context.Context, id int) (VendorPayment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id <= 0 || id > len(m.payments) {
+		return VendorPayment{}, fmt.Errorf("%w: vendor payment %d", ErrNotFound, id)
+	}
+	return m.resolve(m.payments[id-1]), nil
+}
+
+func (m memoryPayments) List(ctx context.Context, opts ListOptions) ([]VendorPayment, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []VendorPayment
+	for _, payment := range m.payments {
+		payment = m.resolve(payment)
+		if opts.VendorID != 0 && payment.Vendor.ID != opts.VendorID ||
+			opts.AccountID != 0 && payment.PayableAccount.ID != opts.AccountID && payment.PaymentAccount.ID != opts.AccountID ||
+			!inDateRange(payment.Date, opts) ||
+			!containsFold(payment.Vendor.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, payment)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":     func(i int) interface{} { return int64(matched[i].ID) },
+		"date":   func(i int) interface{} { return matched[i].Date.Unix() },
+		"amount": func(i int) interface{} { return matched[i].Amount.Minor().Int64() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var payments []VendorPayment
+	for _, i := range page {
+		payments = append(payments, matched[i])
+	}
+	return payments, cursor, nil
+}
+
+type memoryInvoices struct {
+	*MemoryStore
+}
+
+func (m memoryInvoices) Save(ctx context.Context, invoice Invoice) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := invoice.Validate(); err != nil {
+		return -1, err
+	}
+	if err := m.activeCustomer(invoice.Customer.ID); err != nil {
+		return -1, err
+	}
+	if err := m.activeAccount(invoice.ReceivableAccount.ID); err != nil {
+		return -1, err
+	}
+	for _, line := range invoice.Lines {
+		if line.Item.ID != 0 {
+			if err := m.activeItem(line.Item.ID); err != nil {
+				return -1, err
+			}
+		}
+		for _, id := range []int{line.Account.ID, line.InventoryAccount.ID, line.CostAccount.ID} {
+			if id == 0 {
+				continue
+			}
+			if err := m.activeAccount(id); err != nil {
+				return -1, err
+			}
+		}
+	}
+
+	stored := invoice
+	stored.ID = len(m.invoices) + 1
+	stored.Date = storedTime(invoice.Date)
+	stored.DueDate = storedTime(invoice.DueDate)
+	stored.Amount = ledgerAmount(invoice.Amount)
+	stored.Lines = make([]InvoiceLine, len(invoice.Lines))
+	for i, line := range invoice.Lines {
+		line.Kind = line.LineKind()
+		line.Amount = ledgerAmount(line.Amount)
+		stored.Lines[i] = line
+	}
+
+	if err := m.record(ctx, "save", "invoice", stored.ID, nil, stored); err != nil {
+		return -1, err
+	}
+
+	m.invoices = append(m.invoices, stored)
+	return stored.ID, nil
+}
+
+// resolve fills in names from the master data the way the SQL joins do.
+func (m memoryInvoices) resolve(invoice Invoice) Invoice {
+	invoice.Customer = m.customer(invoice.Customer.ID)
+	invoice.ReceivableAccount = m.account(invoice.ReceivableAccount.ID)
+
+	lines := make([]InvoiceLine, len(invoice.Lines))
+	for i, line := range invoice.Lines {
+		if line.Item.ID != 0 {
+			line.Item = m.item(line.Item.ID)
+		}
+		line.Account = m.account(line.Account.ID)
+		if line.InventoryAccount.ID != 0 {
+			line.InventoryAccount = m.account(line.InventoryAccount.ID)
+		}
+		if line.CostAccount.ID != 0 {
+			line.CostAccount = m.account(line.CostAccount.ID)
+		}
+		lines[i] = line
+	}
+	invoice.Lines = lines
+
+	return invoice
+}
+
+func (m memoryInvoices) Get(ctx context.Context, id int) (Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id <= 0 || id > len(m.invoices) {
+		return Invoice{}, fmt.Errorf("%w: invoice %d", ErrNotFound, id)
+	}
+	return m.resolve(m.invoices[id-1]), nil
+}
+
+func (m memoryInvoices) List(ctx context.Context, opts ListOptions) ([]Invoice, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Invoice
+	for _, invoice := range m.invoices {
+		invoice = m.resolve(invoice)
+		if opts.CustomerID != 0 && invoice.Customer.ID != opts.CustomerID ||
+			!inDateRange(invoice.Date, opts) ||
+			!containsFold(invoice.Customer.Name, opts.Search) {
+			continue
+		}
+
+		hasItem, hasAccount := opts.ItemID == 0, opts.AccountID == 0 || invoice.ReceivableAccount.ID == opts.AccountID
+		for _, line := range invoice.Lines {
+			hasItem = hasItem || line.Item.ID == opts.ItemID
+			hasAccount = hasAccount || line.Account.ID == opts.AccountID ||
+				line.InventoryAccount.ID == opts.AccountID || line.CostAccount.ID == opts.AccountID
+		}
+		if !hasItem || !hasAccount {
+			continue
+		}
+
+		matched = append(matched, invoice)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":     func(i int) interface{} { return int64(matched[i].ID) },
+		"date":   func(i int) interface{} { return matched[i].Date.Unix() },
+		"due":    func(i int) interface{} { return matched[i].DueDate.Unix() },
+		"amount": func(i int) interface{} { return matched[i].Amount.Minor().Int64() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var invoices []Invoice
+	for _, i := range page {
+		invoices = append(invoices, matched[i])
+	}
+	return invoices, cursor, nil
+}
+
+type memoryReceipts struct {
+	*MemoryStore
+}
+
+func (m memoryReceipts) Save(ctx context.Context, receipt CustomerReceipt) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := receipt.Validate(); err != nil {
+		return -1, err
+	}
+	if err := m.activeCustomer(receipt.Customer.ID); err != nil {
+		return -1, err
+	}
+	for _, id := range []int{receipt.ReceivableAccount.ID, receipt.DepositAccount.ID} {
+		if err := m.activeAccount(id); err != nil {
+			return -1, err
+		}
+	}
+	for _, application := range receipt.Applications {
+		if application.InvoiceID > len(m.invoices) {
+			return -1, fmt.Errorf("%w: invoice %d", ErrMissingReference, application.InvoiceID)
+		}
+	}
+
+	stored := receipt
+	stored.ID = len(m.receipts) + 1
+	stored.Date = storedTime(receipt.Date)
+	stored.Amount = ledgerAmount(receipt.Amount)
+	stored.Applications = make([]ReceiptApplication, len(receipt.Applications))
+	for i, application := range receipt.Applications {
+		application.Amount = ledgerAmount(application.Amount)
+		stored.Applications[i] = application
+	}
+
+	if err := m.record(ctx, "save", "customer_receipt", stored.ID, nil, stored); err != nil {
+		return -1, err
+	}
+
+	m.receipts = append(m.receipts, stored)
+	return stored.ID, nil
+}
+
+func (m memoryReceipts) resolve(receipt CustomerReceipt) CustomerReceipt {
+	receipt.Customer = m.customer(receipt.Customer.ID)
+	receipt.ReceivableAccount = m.account(receipt.ReceivableAccount.ID)
+	receipt.DepositAccount = m.account(receipt.DepositAccount.ID)
+	receipt.Applications = append([]ReceiptApplication(nil), receipt.Applications...)
+	return receipt
+}
+
+func (m memoryReceipts) Get(ctx context.Context, id int) (CustomerReceipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id <= 0 || id > len(m.receipts) {
+		return CustomerReceipt{}, fmt.Errorf("%w: customer receipt %d", ErrNotFound, id)
+	}
+	return m.resolve(m.receipts[id-1]), nil
+}
+
+func (m memoryReceipts) List(ctx context.Context, opts ListOptions) ([]CustomerReceipt, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []CustomerReceipt
+	for _, receipt := range m.receipts {
+		receipt = m.resolve(receipt)
+		if opts.CustomerID != 0 && receipt.Customer.ID != opts.CustomerID ||
+			opts.AccountID != 0 && receipt.ReceivableAccount.ID != opts.AccountID && receipt.DepositAccount.ID != opts.AccountID ||
+			!inDateRange(receipt.Date, opts) ||
+			!containsFold(receipt.Customer.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, receipt)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":     func(i int) interface{} { return int64(matched[i].ID) },
+		"date":   func(i int) interface{} { return matched[i].Date.Unix() },
+		"amount": func(i int) interface{} { return matched[i].Amount.Minor().Int64() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var receipts []CustomerReceipt
+	for _, i := range page {
+		receipts = append(receipts, matched[i])
+	}
+	return receipts, cursor, nil
+}
+
+type memoryRecurring struct {
+	*MemoryStore
+}
+
+func (m memoryRecurring) Save(ctx context.Context, template RecurringTemplate) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := template.Validate(); err != nil {
+		return -1, err
+	}
+
+	// The SQL table keeps the body as JSON; a round trip through it keeps
+	// the stored copy from sharing anything with the caller's.
+	document, err := json.Marshal(recurringDocument{
+		Purchase: template.Purchase,
+		Payment:  template.Payment,
+		Entry:    template.Entry,
+	})
+	if err != nil {
+		return -1, err
+	}
+	var body recurringDocument
+	if err = json.Unmarshal(document, &body); err != nil {
+		return -1, err
+	}
+
+	stored := RecurringTemplate{
+		ID:   len(m.recurring) + 1,
+		Name: template.Name,
+		Schedule: Schedule{
+			Start: storedTime(template.Schedule.Start),
+			Every: template.Schedule.Every,
+			Unit:  template.Schedule.Unit,
+		},
+		Purchase: body.Purchase,
+		Payment:  body.Payment,
+		Entry:    body.Entry,
+	}
+	if !template.Schedule.End.IsZero() {
+		stored.Schedule.End = storedTime(template.Schedule.End)
+	}
+
+	if err = m.record(ctx, "save", "recurring_template", stored.ID, nil, stored); err != nil {
+		return -1, err
+	}
+
+	m.recurring = append(m.recurring, stored)
+	return stored.ID, nil
+}
+
+func (m memoryRecurring) Get(ctx context.Context, id int) (RecurringTemplate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id <= 0 || id > len(m.recurring) {
+		return RecurringTemplate{}, fmt.Errorf("%w: recurring template %d", ErrNotFound, id)
+	}
+	return m.recurring[id-1], nil
+}
+
+func (m memoryRecurring) List(ctx context.Context, opts ListOptions) ([]RecurringTemplate, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []RecurringTemplate
+	for _, template := range m.recurring {
+		if !inDateRange(template.Schedule.Start, opts) || !containsFold(template.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, template)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":    func(i int) interface{} { return int64(matched[i].ID) },
+		"name":  func(i int) interface{} { return matched[i].Name },
+		"start": func(i int) interface{} { return matched[i].Schedule.Start.Unix() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var templates []RecurringTemplate
+	for _, i := range page {
+		templates = append(templates, matched[i])
+	}
+	return templates, cursor, nil
+}
+
+func (m memoryRecurring) Instances(ctx context.Context, templateID int) ([]RecurringInstance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var instances []RecurringInstance
+	for _, instance := range m.instances {
+		if instance.TemplateID == templateID {
+			instances = append(instances, instance)
+		}
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instances[i].Date.Before(instances[j].Date)
+	})
+	return instances, nil
+}
+
+// instance returns the index of the instance of templateID due on date, or
+// -1.
+func (m memoryRecurring) instance(templateID int, date time.Time) int {
+	for i, instance := range m.instances {
+		if instance.TemplateID == templateID && instance.Date.Unix() == date.Unix() {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m memoryRecurring) SaveInstance(ctx context.Context, instance RecurringInstance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprintf("%d/%s", instance.TemplateID, instance.Date.UTC().Format("2006-01-02"))
+	if instance.TemplateID <= 0 || instance.TemplateID > len(m.recurring) {
+		return fmt.Errorf("%w: recurring template %d", ErrMissingReference, instance.TemplateID)
+	}
+	if m.instance(instance.TemplateID, instance.Date) >= 0 {
+		return fmt.Errorf("%w: recurring instance %s already exists", ErrConflict, key)
+	}
+
+	instance.Date = storedTime(instance.Date)
+	if err := m.record(ctx, "save", "recurring_instance", key, nil, instance); err != nil {
+		return err
+	}
+
+	m.instances = append(m.instances, instance)
+	return nil
+}
+
+func (m memoryRecurring) UpdateInstance(ctx context.Context, instance RecurringInstance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprintf("%d/%s", instance.TemplateID, instance.Date.UTC().Format("2006-01-02"))
+	i := m.instance(instance.TemplateID, instance.Date)
+	if i < 0 {
+		return fmt.Errorf("%w: recurring instance %s", ErrNotFound, key)
+	}
+
+	instance.Date = storedTime(instance.Date)
+	if err := m.record(ctx, "update", "recurring_instance", key, nil, instance); err != nil {
+		return err
+	}
+
+	m.instances[i] = instance
+	return nil
+}
+
+type memoryBudgets struct {
+	*MemoryStore
+}
+
+// budget returns the index of the budget for accountID in the month starting
+// at period, or -1.
+func (m memoryBudgets) budget(accountID int, period time.Time) int {
+	for i, budget := range m.budgets {
+		if budget.Account.ID == accountID && budget.Period.Equal(period) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m memoryBudgets) Save(ctx context.Context, budget Budget) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := budget.Validate(); err != nil {
+		return err
+	}
+	if err := m.requireAccount(budget.Account.ID); err != nil {
+		return err
+	}
+
+	stored := Budget{
+		Account: Account{ID: budget.Account.ID},
+		Period:  storedTime(budget.Period),
+		Amount:  ledgerAmount(budget.Amount),
+	}
+	key := fmt.Sprintf("%d/%s", budget.Account.ID, budget.Period.Format("2006-01"))
+
+	i := m.budget(stored.Account.ID, stored.Period)
+	var before interface{}
+	if i >= 0 {
+		before = m.resolve(m.budgets[i])
+	}
+	if err := m.record(ctx, "save", "budget", key, before, budget); err != nil {
+		return err
+	}
+
+	if i >= 0 {
+		m.budgets[i] = stored
+	} else {
+		m.budgets = append(m.budgets, stored)
+	}
+	return nil
+}
+
+func (m memoryBudgets) resolve(budget Budget) Budget {
+	budget.Account = m.account(budget.Account.ID)
+	return budget
+}
+
+func (m memoryBudgets) Get(ctx context.Context, accountID int, period time.Time) (Budget, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.budget(accountID, MonthStart(period))
+	if i < 0 {
+		return Budget{}, fmt.Errorf("%w: budget %d/%s", ErrNotFound, accountID, period.Format("2006-01"))
+	}
+	return m.resolve(m.budgets[i]), nil
+}
+
+func (m memoryBudgets) List(ctx context.Context, opts ListOptions) ([]Budget, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []Budget
+	for _, budget := range m.budgets {
+		budget = m.resolve(budget)
+		if opts.AccountID != 0 && budget.Account.ID != opts.AccountID ||
+			!inDateRange(budget.Period, opts) ||
+			!containsFold(budget.Account.Name, opts.Search) {
+			continue
+		}
+		matched = append(matched, budget)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":     func(i int) interface{} { return int64(matched[i].Account.ID) },
+		"period": func(i int) interface{} { return matched[i].Period.Unix() },
+		"amount": func(i int) interface{} { return matched[i].Amount.Minor().Int64() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].Account.ID), matched[i].Period.Unix()}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var budgets []Budget
+	for _, i := range page {
+		budgets = append(budgets, matched[i])
+	}
+	return budgets, cursor, nil
+}
+
+type memoryGLTransactions struct {
+	*MemoryStore
+}
+
+func (m memoryGLTransactions) NextID(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := 1
+	for _, transaction := range m.gl {
+		if transaction.ID >= next {
+			next = transaction.ID + 1
+		}
+	}
+	return next, nil
+}
+
+func (m memoryGLTransactions) Save(ctx context.Context, transactions []GLTransaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exists := make(map[[2]int]bool, len(m.gl)+len(transactions))
+	for _, existing := range m.gl {
+		exists[[2]int{existing.ID, existing.Account.ID}] = true
+	}
+
+	stored := make([]GLTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		if err := m.requireAccount(transaction.Account.ID); err != nil {
+			return err
+		}
+		if err := m.requireOpen(transaction.Date); err != nil {
+			return err
+		}
+
+		key := [2]int{transaction.ID, transaction.Account.ID}
+		if exists[key] {
+			return fmt.Errorf("%w: gl transaction %d already has account %d", ErrConflict, transaction.ID, transaction.Account.ID)
+		}
+		exists[key] = true
+
+		transaction.Date = storedTime(transaction.Date)
+		transaction.Debit = ledgerAmount(transaction.Debit)
+		transaction.Credit = ledgerAmount(transaction.Credit)
+		if transaction.Foreign.Currency() != "" {
+			transaction.Foreign = ledgerAmount(transaction.Foreign)
+		}
+		stored = append(stored, transaction)
+	}
+
+	if err := CheckBalanced(stored); err != nil {
+		return err
+	}
+
+	if len(stored) > 0 {
+		if err := m.record(ctx, "save", "gl_transaction", stored[0].ID, nil, stored); err != nil {
+			return err
+		}
+	}
+
+	if m.books != nil && m.books.HashChain {
+		for _, entry := range splitEntries(stored) {
+			var last *ChainLink
+			if len(m.chain) > 0 {
+				last = &m.chain[len(m.chain)-1]
+			}
+			m.chain = append(m.chain, nextLink(last, entry))
+		}
+	}
+
+	m.gl = append(m.gl, stored...)
+	return nil
+}
+
+func (m memoryGLTransactions) Chain(ctx context.Context) ([]ChainLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]ChainLink(nil), m.chain...), nil
+}
+
+func (m memoryGLTransactions) Get(ctx context.Context, id int) ([]GLTransaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var transactions []GLTransaction
+	for _, transaction := range m.gl {
+		if transaction.ID == id {
+			transaction.Account = m.account(transaction.Account.ID)
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("%w: gl transaction %d", ErrNotFound, id)
+	}
+	return transactions, nil
+}
+
+func (m memoryGLTransactions) List(ctx context.Context, opts ListOptions) ([]GLTransaction, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []GLTransaction
+	for _, transaction := range m.gl {
+		if opts.AccountID != 0 && transaction.Account.ID != opts.AccountID ||
+			opts.Reverses != 0 && transaction.Reverses != opts.Reverses ||
+			!opts.Source.IsZero() && transaction.Source != opts.Source ||
+			!inDateRange(transaction.Date, opts) ||
+			!containsFold(transaction.Memo, opts.Search) {
+			continue
+		}
+		transaction.Account = m.account(transaction.Account.ID)
+		matched = append(matched, transaction)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":      func(i int) interface{} { return int64(matched[i].ID) },
+		"date":    func(i int) interface{} { return matched[i].Date.Unix() },
+		"account": func(i int) interface{} { return int64(matched[i].Account.ID) },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID), int64(matched[i].Account.ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var transactions []GLTransaction
+	for _, i := range page {
+		transactions = append(transactions, matched[i])
+	}
+	return transactions, cursor, nil
+}
+
+type memoryInventoryTransactions struct {
+	*MemoryStore
+}
+
+func (m memoryInventoryTransactions) Save(ctx context.Context, transaction InventoryTransaction) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.requireAccount(transaction.Account.ID); err != nil {
+		return -1, err
+	}
+	if err := m.requireItem(transaction.Item.ID); err != nil {
+		return -1, err
+	}
+	if err := m.requireOpen(transaction.Date); err != nil {
+		return -1, err
+	}
+
+	transaction.ID = m.lastInventoryID + 1
+	transaction.Date = storedTime(transaction.Date)
+	if transaction.Cost.Currency() == "" {
+		transaction.Cost.currency = DefaultCurrency
+	}
+
+	if err := m.record(ctx, "save", "inventory_transaction", transaction.ID, nil, transaction); err != nil {
+		return -1, err
+	}
+
+	m.lastInventoryID = transaction.ID
+	m.inventory = append(m.inventory, transaction)
+	return transaction.ID, nil
+}
+
+// resolve fills in names and derives the amount the way the SQL table does.
+func (m memoryInventoryTransactions) resolve(transaction InventoryTransaction) InventoryTransaction {
+	transaction.Account = m.account(transaction.Account.ID)
+	transaction.Item = m.item(transaction.Item.ID)
+	transaction.Amount = transaction.Cost.Extend(
+		transaction.QtyIn.Sub(transaction.QtyOut),
+		CentPrecision,
+		RoundHalfEven,
+	)
+	return transaction
+}
+
+func (m memoryInventoryTransactions) Get(ctx context.Context, id int) (InventoryTransaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, transaction := range m.inventory {
+		if transaction.ID == id {
+			return m.resolve(transaction), nil
+		}
+	}
+	return InventoryTransaction{}, fmt.Errorf("%w: inventory transaction %d", ErrNotFound, id)
+}
+
+func (m memoryInventoryTransactions) List(ctx context.Context, opts ListOptions) ([]InventoryTransaction, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []InventoryTransaction
+	for _, transaction := range m.inventory {
+		if opts.AccountID != 0 && transaction.Account.ID != opts.AccountID ||
+			opts.ItemID != 0 && transaction.Item.ID != opts.ItemID ||
+			opts.Reverses != 0 && transaction.Reverses != opts.Reverses ||
+			opts.Entry != 0 && transaction.Entry != opts.Entry ||
+			!opts.Source.IsZero() && transaction.Source != opts.Source ||
+			!inDateRange(transaction.Date, opts) ||
+			!containsFold(transaction.Memo, opts.Search) {
+			continue
+		}
+		matched = append(matched, m.resolve(transaction))
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":   func(i int) interface{} { return int64(matched[i].ID) },
+		"date": func(i int) interface{} { return matched[i].Date.Unix() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var transactions []InventoryTransaction
+	for _, i := range page {
+		transactions = append(transactions, matched[i])
+	}
+	return transactions, cursor, nil
+}
+
+type memoryBooks struct {
+	*MemoryStore
+}
+
+func (m memoryBooks) Save(ctx context.Context, books Books) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := DefaultBooks
+	if m.books != nil {
+		before = *m.books
+	}
+	if books.FunctionalCurrency != before.FunctionalCurrency && len(m.gl) > 0 {
+		return fmt.Errorf("%w: the ledger is kept in %s", ErrInUse, before.FunctionalCurrency)
+	}
+	if err := m.record(ctx, "save", "books", 1, before, books); err != nil {
+		return err
+	}
+
+	m.books = &books
+	return nil
+}
+
+func (m memoryBooks) Get(ctx context.Context) (Books, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.books == nil {
+		return DefaultBooks, nil
+	}
+	return *m.books, nil
+}
+
+type memoryFXRates struct {
+	*MemoryStore
+}
+
+func (m memoryFXRates) Save(ctx context.Context, rate FXRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rate.Date = storedTime(rate.Date)
+	key := fmt.Sprintf("%s/%s on %s", rate.Base, rate.Quote, rate.Date.Format("2006-01-02"))
+	if err := m.record(ctx, "save", "fx_rate", key, nil, rate); err != nil {
+		return err
+	}
+
+	m.rates = append(m.rates, rate)
+	return nil
+}
+
+func (m memoryFXRates) Get(ctx context.Context, base, quote string, date time.Time) (FXRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.rates.Find(base, quote, date)
+}
+
+type memoryPeriods struct {
+	*MemoryStore
+}
+
+func (m memoryPeriods) Save(ctx context.Context, period Period) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	period = Period{Start: storedTime(period.Start), End: storedTime(period.End)}
+	for _, existing := range m.periods {
+		if existing.Start.Before(period.End) && existing.End.After(period.Start) {
+			return fmt.Errorf("%w: period %s overlaps one starting %s",
+				ErrConflict, period, existing.Start.Format("2006-01-02"))
+		}
+	}
+
+	if err := m.record(ctx, "save", "period", period.Start.Format("2006-01-02"), nil, period); err != nil {
+		return err
+	}
+
+	m.periods = append(m.periods, period)
+	sort.Slice(m.periods, func(i, j int) bool {
+		return m.periods[i].Start.Before(m.periods[j].Start)
+	})
+	return nil
+}
+
+// find returns the index of the period containing date, or -1.
+func (m memoryPeriods) find(date time.Time) int {
+	for i, period := range m.periods {
+		if period.Contains(date) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m memoryPeriods) Get(ctx context.Context, date time.Time) (Period, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.find(date)
+	if i < 0 {
+		return Period{}, fmt.Errorf("%w: period on %s", ErrNotFound, date.Format("2006-01-02"))
+	}
+	return m.periods[i], nil
+}
+
+func (m memoryPeriods) List(ctx context.Context) ([]Period, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Period(nil), m.periods...), nil
+}
+
+func (m memoryPeriods) Close(ctx context.Context, period Period, balances []AccountBalance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.find(period.Start)
+	if i < 0 || !m.periods[i].Start.Equal(period.Start) || m.periods[i].Closed() {
+		return fmt.Errorf("%w: open period %s", ErrNotFound, period)
+	}
+
+	for _, balance := range balances {
+		if err := m.requireAccount(balance.Account.ID); err != nil {
+			return err
+		}
+	}
+
+	after := m.periods[i]
+	after.ClosedAt = storedTime(period.ClosedAt)
+	after.ClosingEntry = period.ClosingEntry
+	if err := m.record(ctx, "close", "period", period.Start.Format("2006-01-02"), m.periods[i], after); err != nil {
+		return err
+	}
+	m.periods[i] = after
+
+	stored := make([]AccountBalance, len(balances))
+	for j, balance := range balances {
+		stored[j] = AccountBalance{
+			Account: Account{ID: balance.Account.ID},
+			Debit:   ledgerAmount(balance.Debit),
+			Credit:  ledgerAmount(balance.Credit),
+		}
+	}
+	m.closing[period.Start.Unix()] = stored
+	return nil
+}
+
+func (m memoryPeriods) Reopen(ctx context.Context, start time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.find(start)
+	if i < 0 || !m.periods[i].Start.Equal(start) || !m.periods[i].Closed() {
+		return fmt.Errorf("%w: closed period starting %s", ErrNotFound, start.Format("2006-01-02"))
+	}
+
+	after := m.periods[i]
+	after.ClosedAt = time.Time{}
+	if err := m.record(ctx, "reopen", "period", start.Format("2006-01-02"), m.periods[i], after); err != nil {
+		return err
+	}
+
+	m.periods[i] = after
+	return nil
+}
+
+func (m memoryPeriods) Balances(ctx context.Context, start time.Time) ([]AccountBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var balances []AccountBalance
+	for _, balance := range m.closing[start.Unix()] {
+		balance.Account = m.account(balance.Account.ID)
+		balances = append(balances, balance)
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Account.ID < balances[j].Account.ID
+	})
+	return balances, nil
+}
+
+type memoryAudit struct {
+	*MemoryStore
+}
+
+func (m memoryAudit) List(ctx context.Context, opts ListOptions) ([]AuditEntry, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []AuditEntry
+	for _, entry := range m.audit {
+		if !inDateRange(entry.Time, opts) || !containsFold(entry.Entity, opts.Search) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	page, cursor, err := memoryList(len(matched), opts, map[string]func(int) interface{}{
+		"id":   func(i int) interface{} { return int64(matched[i].ID) },
+		"date": func(i int) interface{} { return matched[i].Time.Unix() },
+	}, func(i int) []interface{} {
+		return []interface{}{int64(matched[i].ID)}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var entries []AuditEntry
+	for _, i := range page {
+		entries = append(entries, matched[i])
+	}
+	return entries, cursor, nil
+}
@@ -0,0 +1,166 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func seededMemoryStore(t *testing.T) *MemoryStore {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, acct := range GLAccounts {
+		if err := store.Accounts().Save(ctx, acct); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, item := range InventoryItems {
+		if err := store.Items().Save(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, vendor := range Vendors {
+		if err := store.Vendors().Save(ctx, vendor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return store
+}
+
+func TestRecordPurchase(t *testing.T) {
+	ctx := context.Background()
+	store := seededMemoryStore(t)
+
+	for day := 1; day <= 3; day++ {
+		date := time.Date(2017, 8, day, 0, 0, 0, 0, time.UTC)
+		id, err := store.Purchases().Save(ctx, MiningPayout(date, ether("0.5"), Cents(30000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		purchase, err := store.Purchases().Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err = RecordPurchase(ctx, store, purchase); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gl) != 6 {
+		t.Fatalf("got %d gl lines, want 6", len(gl))
+	}
+
+	balances := TrialBalance(gl)
+	for _, balance := range balances {
+		want := Cents(45000)
+		if balance.Account.ID == ElectricBill.ID {
+			want = want.Neg()
+		}
+		if balance.Balance().Cmp(want) != 0 {
+			t.Errorf("%s balance = %v, want %v", balance.Account.Name, balance.Balance(), want)
+		}
+	}
+
+	inv, _, err := store.InventoryTransactions().List(ctx, ListOptions{ItemID: Ether.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var onHand Quantity
+	for _, transaction := range inv {
+		onHand = onHand.Add(transaction.QtyIn).Sub(transaction.QtyOut)
+	}
+	if onHand.Cmp(ether("1.5")) != 0 {
+		t.Errorf("ether on hand = %v, want 1.5", onHand)
+	}
+
+	cost, err := CalcCost(inv, ether("1.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Cmp(UnitCostOf(Cents(30000))) != 0 {
+		t.Errorf("CalcCost() = %v", cost)
+	}
+}
+
+func TestMemoryStoreList(t *testing.T) {
+	ctx := context.Background()
+	store := seededMemoryStore(t)
+
+	var (
+		opts  = ListOptions{SortBy: "name", Limit: 4}
+		names []string
+	)
+	for {
+		accts, cursor, err := store.Accounts().List(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(accts) > opts.Limit {
+			t.Fatalf("page of %d accounts, limit %d", len(accts), opts.Limit)
+		}
+		for _, acct := range accts {
+			names = append(names, acct.Name)
+		}
+		if cursor == "" {
+			break
+		}
+		opts.Cursor = cursor
+	}
+
+	if len(names) != len(GLAccounts) {
+		t.Fatalf("paged through %d accounts, want %d", len(names), len(GLAccounts))
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Errorf("accounts out of order: %q before %q", names[i-1], names[i])
+		}
+	}
+
+	if _, _, err := store.Accounts().List(ctx, ListOptions{SortBy: "balance"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("List() with unknown sort error = %v", err)
+	}
+}
+
+func TestMemoryStoreArchive(t *testing.T) {
+	ctx := context.Background()
+	store := seededMemoryStore(t)
+
+	if _, err := store.Purchases().Save(ctx, MiningPayout(time.Unix(0, 0), ether("1"), Cents(100))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Vendors().Archive(ctx, ElectricCompany.ID); !errors.Is(err, ErrInUse) {
+		t.Errorf("Archive() of a used vendor error = %v", err)
+	}
+
+	if err := store.Vendors().Archive(ctx, Gemini.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	vendors, _, err := store.Vendors().List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vendor := range vendors {
+		if vendor.ID == Gemini.ID {
+			t.Error("archived vendor listed")
+		}
+	}
+
+	if err = store.Vendors().Update(ctx, Vendor{ID: Coinbase.ID, Name: "Coinbase Pro"}); err != nil {
+		t.Fatal(err)
+	}
+	if vendor, _ := store.Vendors().Get(ctx, Coinbase.ID); vendor.Name != "Coinbase Pro" {
+		t.Errorf("Update() left name %q", vendor.Name)
+	}
+}
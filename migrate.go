@@ -0,0 +1,665 @@
+package coincount
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// legacyQuantityBase is the base quantities were stored in before version 5
+// of the schema.
+const legacyQuantityBase = 32
+
+// migration upgrades the schema to version.
+type migration struct {
+	version int
+	up      func(ctx context.Context, tx *sql.Tx, d Dialect) error
+}
+
+var migrations = []migration{
+	{version: 1, up: createSchema},
+	{version: 2, up: exactUnitCosts},
+	{version: 3, up: currencies},
+	{version: 4, up: archiving},
+	{version: 5, up: decimalQuantities},
+	{version: 6, up: postedPurchaseKeys},
+	{version: 7, up: fiscalPeriods},
+	{version: 8, up: reversals},
+	{version: 9, up: auditLog},
+	{version: 10, up: ledgerChain},
+	{version: 11, up: sourceDocuments},
+	{version: 12, up: purchaseLines},
+	{version: 13, up: vendorPayments},
+	{version: 14, up: receivables},
+	{version: 15, up: recurringTemplates},
+	{version: 16, up: budgets},
+	{version: 17, up: chainSequence},
+	{version: 18, up: inventoryEntries},
+}
+
+// Migrate creates the schema in db or upgrades it to the latest version.
+// Databases created before versions were recorded are taken to be at
+// version 1.
+func Migrate(ctx context.Context, db *sql.DB, d Dialect) error {
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migration (
+			version integer PRIMARY KEY,
+			applied_at bigint
+		)`); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := migrate(ctx, db, d, m); err != nil {
+			return fmt.Errorf("migrating to version %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// migrate applies m unless the schema is already at its version.
+func migrate(ctx context.Context, db *sql.DB, d Dialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another process may be migrating the same shared database.
+	if d == Postgres {
+		if _, err = tx.ExecContext(ctx, "LOCK TABLE schema_migration IN EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+	}
+
+	version, err := schemaVersion(ctx, tx, d)
+	if err != nil || version >= m.version {
+		return err
+	}
+
+	if err = m.up(ctx, tx, d); err != nil {
+		return err
+	}
+
+	if _, err = d.bind(tx).ExecContext(ctx,
+		"INSERT INTO schema_migration(version, applied_at) VALUES (?, ?)",
+		m.version, time.Now().UTC().Unix()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// schemaVersion returns the latest version applied, 1 for a database that
+// predates schema_migration and 0 for an empty one.
+func schemaVersion(ctx context.Context, tx *sql.Tx, d Dialect) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version), 0) FROM schema_migration").Scan(&version)
+	if err != nil || version > 0 {
+		return version, err
+	}
+
+	query := "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type='table' AND name='account')"
+	if d == Postgres {
+		query = `SELECT EXISTS (SELECT 1 FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = 'account')`
+	}
+
+	var exists bool
+	if err = tx.QueryRowContext(ctx, query).Scan(&exists); err != nil || !exists {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func createSchema(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	_, err := tx.ExecContext(ctx, d.Schema())
+	return err
+}
+
+// addColumn adds column to table unless it is already there, as it is in
+// databases created by releases that had the column before the schema was
+// versioned.
+func addColumn(ctx context.Context, tx *sql.Tx, d Dialect, table, column, definition string) error {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?"
+	if d == Postgres {
+		query = `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name=? AND column_name=?`
+	}
+
+	var n int
+	if err := d.bind(tx).QueryRowContext(ctx, query, table, column).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "ALTER TABLE "+table+" ADD COLUMN "+column+" "+definition)
+	return err
+}
+
+// exactUnitCosts rewrites the integer costs SQLite kept in cents per whole
+// unit as the exact fractions unit costs are stored as. Postgres has always
+// stored them as text.
+func exactUnitCosts(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	if d == Postgres {
+		return nil
+	}
+
+	for _, table := range []string{"inventory_transaction", "purchase_item"} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"UPDATE %s SET cost = CAST(cost AS text) || '/%s' WHERE typeof(cost) = 'integer'",
+			table, pow10(CentPrecision)),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currencies adds the currency of every amount, the foreign amounts of
+// ledger lines, the currencies the books are kept in and FX rates. Rows
+// written before have no currency and are read as DefaultCurrency.
+func currencies(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	bigint := "integer"
+	if d == Postgres {
+		bigint = "bigint"
+	}
+
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"gl_transaction", "currency", "text"},
+		{"gl_transaction", "fx_currency", "text"},
+		{"gl_transaction", "fx_amount", bigint},
+		{"inventory_transaction", "currency", "text"},
+		{"purchase", "currency", "text"},
+	}
+	for _, c := range columns {
+		if err := addColumn(ctx, tx, d, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS books (
+			id integer PRIMARY KEY,
+			functional_currency text,
+			reporting_currency text
+		);
+
+		CREATE TABLE IF NOT EXISTS fx_rate (
+			base text,
+			quote text,
+			rate text,
+			timestamp `+bigint+`,
+			PRIMARY KEY (base, quote, timestamp)
+		);`)
+	return err
+}
+
+// archiving adds the time accounts, items and vendors were archived.
+func archiving(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	bigint := "integer"
+	if d == Postgres {
+		bigint = "bigint"
+	}
+
+	for _, table := range []string{"account", "item", "vendor"} {
+		if err := addColumn(ctx, tx, d, table, "archived_at", bigint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decimalQuantities rewrites the base 32 quantities SQLite used to store in
+// base 10. Postgres has always kept them in numeric columns.
+func decimalQuantities(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	if d == Postgres {
+		return nil
+	}
+
+	columns := []struct {
+		table, column string
+	}{
+		{"inventory_transaction", "qty_in"},
+		{"inventory_transaction", "qty_out"},
+		{"purchase_item", "qty"},
+	}
+
+	for _, c := range columns {
+		values, err := legacyQuantities(ctx, tx, c.table, c.column)
+		if err != nil {
+			return err
+		}
+
+		for rowid, value := range values {
+			if _, err = tx.ExecContext(ctx,
+				"UPDATE "+c.table+" SET "+c.column+"=? WHERE rowid=?",
+				value, rowid); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// legacyQuantities reads a base 32 quantity column and returns its values in
+// base 10 by rowid.
+func legacyQuantities(ctx context.Context, tx *sql.Tx, table, column string) (map[int64]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT rowid, "+column+" FROM "+table+" WHERE "+column+" IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[int64]string)
+	for rows.Next() {
+		var (
+			rowid int64
+			str   string
+		)
+		if err = rows.Scan(&rowid, &str); err != nil {
+			return nil, err
+		}
+
+		if values[rowid], err = decimalQuantity(str); err != nil {
+			return nil, fmt.Errorf("%s.%s row %d: %w", table, column, rowid, err)
+		}
+	}
+
+	return values, rows.Err()
+}
+
+// decimalQuantity converts a quantity stored in legacyQuantityBase to base 10.
+func decimalQuantity(legacy string) (string, error) {
+	value, ok := new(big.Int).SetString(legacy, legacyQuantityBase)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidQuantity, legacy)
+	}
+	return value.String(), nil
+}
+
+// postedPurchaseKeys drops the foreign key from posted_purchase to
+// gl_transaction. gl_transaction.id is not unique on its own, so SQLite
+// refuses writes to posted_purchase once foreign keys are enforced.
+func postedPurchaseKeys(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	if d == Postgres {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE posted_purchase_v3 (
+			purchase_id integer PRIMARY KEY,
+			transaction_id integer,
+			timestamp integer,
+			FOREIGN KEY (purchase_id) REFERENCES purchase (id)
+		);
+		INSERT INTO posted_purchase_v3 SELECT purchase_id, transaction_id, timestamp FROM posted_purchase;
+		DROP TABLE posted_purchase;
+		ALTER TABLE posted_purchase_v3 RENAME TO posted_purchase;`)
+	return err
+}
+
+// fiscalPeriods adds the periods that can be closed to postings and the
+// balances they were closed with.
+func fiscalPeriods(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	// SQLite integers are already 64 bits.
+	bigint := "integer"
+	if d == Postgres {
+		bigint = "bigint"
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE period (
+			start_at `+bigint+` PRIMARY KEY,
+			end_at `+bigint+`,
+			closed_at `+bigint+`,
+			closing_entry integer
+		);
+
+		CREATE TABLE period_balance (
+			period_start `+bigint+` REFERENCES period (start_at),
+			account_id integer REFERENCES account (id),
+			debit `+bigint+`,
+			credit `+bigint+`,
+			currency text,
+			PRIMARY KEY (period_start, account_id)
+		);`)
+	return err
+}
+
+// reversals links reversing journal entries and inventory transactions to
+// the ones they reverse.
+func reversals(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE gl_transaction ADD COLUMN reverses integer;
+		ALTER TABLE inventory_transaction ADD COLUMN reverses integer;`)
+	return err
+}
+
+// auditLog adds the log every write is recorded in. Rows can be added but
+// not changed or removed.
+func auditLog(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	schema := `
+		CREATE TABLE audit_log (
+			id integer PRIMARY KEY AUTOINCREMENT,
+			recorded_at integer,
+			username text,
+			operation text,
+			entity text,
+			entity_id text,
+			before_json text,
+			after_json text
+		);
+
+		CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append only'); END;
+
+		CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append only'); END;`
+	if d == Postgres {
+		schema = `
+		CREATE TABLE audit_log (
+			id serial PRIMARY KEY,
+			recorded_at bigint,
+			username text,
+			operation text,
+			entity text COLLATE "C",
+			entity_id text,
+			before_json text,
+			after_json text
+		);
+
+		CREATE RULE audit_log_no_update AS ON UPDATE TO audit_log DO INSTEAD NOTHING;
+		CREATE RULE audit_log_no_delete AS ON DELETE TO audit_log DO INSTEAD NOTHING;`
+	}
+
+	_, err := tx.ExecContext(ctx, schema)
+	return err
+}
+
+// ledgerChain adds the optional hash chain over journal entries.
+func ledgerChain(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE books ADD COLUMN hash_chain boolean NOT NULL DEFAULT false;
+
+		CREATE TABLE ledger_chain (
+			entry_id integer PRIMARY KEY,
+			previous text UNIQUE,
+			hash text
+		);`)
+	return err
+}
+
+// sourceDocuments records the document each ledger row was posted from, and
+// fills it in for rows posted earlier from memos like PUR-12.
+func sourceDocuments(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE gl_transaction ADD COLUMN source_type text;
+		ALTER TABLE gl_transaction ADD COLUMN source_id integer;
+		ALTER TABLE inventory_transaction ADD COLUMN source_type text;
+		ALTER TABLE inventory_transaction ADD COLUMN source_id integer;
+
+		CREATE INDEX gl_transaction_source ON gl_transaction (source_type, source_id);
+		CREATE INDEX inventory_transaction_source ON inventory_transaction (source_type, source_id);`,
+	); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"gl_transaction", "inventory_transaction"} {
+		rows, err := tx.QueryContext(ctx, "SELECT DISTINCT memo FROM "+table+" WHERE memo IS NOT NULL")
+		if err != nil {
+			return err
+		}
+
+		var memos []string
+		for rows.Next() {
+			var memo string
+			if err = rows.Scan(&memo); err != nil {
+				rows.Close()
+				return err
+			}
+			memos = append(memos, memo)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, memo := range memos {
+			source, ok := memoSource(memo)
+			if !ok {
+				continue
+			}
+			if _, err = d.bind(tx).ExecContext(ctx,
+				"UPDATE "+table+" SET source_type=?, source_id=? WHERE memo=?",
+				source.Type, source.ID, memo,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purchaseLines keys purchase items by line number rather than item so that
+// a purchase can carry expense, tax and discount lines without an item.
+// Existing lines are numbered by their item.
+func purchaseLines(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	schema := `
+		CREATE TABLE purchase_item_v9 (
+			purchase_id integer,
+			line integer,
+			kind text,
+			item_id integer,
+			inventory_account_id integer,
+			qty text,
+			cost text,
+			amount integer,
+			PRIMARY KEY (purchase_id, line),
+			FOREIGN KEY (purchase_id) REFERENCES purchase (id),
+			FOREIGN KEY (item_id) REFERENCES item (id),
+			FOREIGN KEY (inventory_account_id) REFERENCES account (id)
+		);
+		INSERT INTO purchase_item_v9
+			SELECT purchase_id, item_id, NULL, item_id, inventory_account_id, qty, cost, amount
+			FROM purchase_item;
+		DROP TABLE purchase_item;
+		ALTER TABLE purchase_item_v9 RENAME TO purchase_item;`
+	if d == Postgres {
+		schema = `
+		ALTER TABLE purchase_item DROP CONSTRAINT purchase_item_pkey;
+		ALTER TABLE purchase_item ALTER COLUMN item_id DROP NOT NULL;
+		ALTER TABLE purchase_item ADD COLUMN line integer;
+		ALTER TABLE purchase_item ADD COLUMN kind text;
+		UPDATE purchase_item SET line = item_id;
+		ALTER TABLE purchase_item ADD PRIMARY KEY (purchase_id, line);`
+	}
+
+	_, err := tx.ExecContext(ctx, schema)
+	return err
+}
+
+// vendorPayments adds payments to vendors and the purchases they settle.
+func vendorPayments(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	id, bigint := "integer PRIMARY KEY AUTOINCREMENT", "integer"
+	if d == Postgres {
+		id, bigint = "serial PRIMARY KEY", "bigint"
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE vendor_payment (
+			id `+id+`,
+			vendor_id integer REFERENCES vendor (id),
+			payable_acct_id integer REFERENCES account (id),
+			payment_acct_id integer REFERENCES account (id),
+			amount `+bigint+`,
+			currency text,
+			timestamp `+bigint+`
+		);
+
+		CREATE TABLE payment_application (
+			payment_id integer REFERENCES vendor_payment (id),
+			purchase_id integer REFERENCES purchase (id),
+			amount `+bigint+`,
+			PRIMARY KEY (payment_id, purchase_id)
+		);`)
+	return err
+}
+
+// receivables adds customers, the invoices sold to them and the receipts
+// that settle those invoices.
+func receivables(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	id, bigint, name := "integer PRIMARY KEY AUTOINCREMENT", "integer", "text"
+	if d == Postgres {
+		id, bigint, name = "serial PRIMARY KEY", "bigint", `text COLLATE "C"`
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE customer (
+			id `+id+`,
+			name `+name+`,
+			archived_at `+bigint+`
+		);
+
+		CREATE TABLE invoice (
+			id `+id+`,
+			customer_id integer REFERENCES customer (id),
+			receivable_acct_id integer REFERENCES account (id),
+			amount `+bigint+`,
+			currency text,
+			timestamp `+bigint+`,
+			due_at `+bigint+`
+		);
+
+		CREATE TABLE invoice_line (
+			invoice_id integer REFERENCES invoice (id),
+			line integer,
+			kind text,
+			item_id integer REFERENCES item (id),
+			account_id integer REFERENCES account (id),
+			inventory_account_id integer REFERENCES account (id),
+			cost_account_id integer REFERENCES account (id),
+			qty text,
+			amount `+bigint+`,
+			PRIMARY KEY (invoice_id, line)
+		);
+
+		CREATE TABLE customer_receipt (
+			id `+id+`,
+			customer_id integer REFERENCES customer (id),
+			receivable_acct_id integer REFERENCES account (id),
+			deposit_acct_id integer REFERENCES account (id),
+			amount `+bigint+`,
+			currency text,
+			timestamp `+bigint+`
+		);
+
+		CREATE TABLE receipt_application (
+			receipt_id integer REFERENCES customer_receipt (id),
+			invoice_id integer REFERENCES invoice (id),
+			amount `+bigint+`,
+			PRIMARY KEY (receipt_id, invoice_id)
+		);`)
+	return err
+}
+
+// recurringTemplates adds recurring templates and the instances generated
+// from them, one per template and due date.
+func recurringTemplates(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	id, bigint, name := "integer PRIMARY KEY AUTOINCREMENT", "integer", "text"
+	if d == Postgres {
+		id, bigint, name = "serial PRIMARY KEY", "bigint", `text COLLATE "C"`
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE recurring_template (
+			id `+id+`,
+			name `+name+`,
+			kind text,
+			start_at `+bigint+`,
+			every integer,
+			unit text,
+			end_at `+bigint+`,
+			document_json text
+		);
+
+		CREATE TABLE recurring_instance (
+			template_id integer REFERENCES recurring_template (id),
+			due_at `+bigint+`,
+			source_type text,
+			source_id integer,
+			entry_id integer,
+			PRIMARY KEY (template_id, due_at)
+		);`)
+	return err
+}
+
+// budgets adds monthly budgets by account.
+func budgets(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	bigint := "integer"
+	if d == Postgres {
+		bigint = "bigint"
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE budget (
+			account_id integer REFERENCES account (id),
+			period_start `+bigint+`,
+			amount `+bigint+`,
+			currency text,
+			PRIMARY KEY (account_id, period_start)
+		);`)
+	return err
+}
+
+// chainSequence orders the hash chain by when links were made rather than by
+// entry ID, which writers may save out of order. Existing links keep the
+// order they had.
+func chainSequence(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	schema := `
+		ALTER TABLE ledger_chain ADD COLUMN seq integer;
+		UPDATE ledger_chain SET seq = entry_id;
+		CREATE UNIQUE INDEX ledger_chain_seq ON ledger_chain (seq);`
+	if d == Postgres {
+		schema = `
+		ALTER TABLE ledger_chain ADD COLUMN seq bigint;
+		UPDATE ledger_chain SET seq = entry_id;
+		CREATE SEQUENCE ledger_chain_seq_seq OWNED BY ledger_chain.seq;
+		SELECT setval('ledger_chain_seq_seq', (SELECT COALESCE(MAX(seq), 0) + 1 FROM ledger_chain), false);
+		ALTER TABLE ledger_chain
+			ALTER COLUMN seq SET DEFAULT nextval('ledger_chain_seq_seq'),
+			ALTER COLUMN seq SET NOT NULL;
+		CREATE UNIQUE INDEX ledger_chain_seq ON ledger_chain (seq);`
+	}
+
+	_, err := tx.ExecContext(ctx, schema)
+	return err
+}
+
+// inventoryEntries links each inventory transaction to the journal entry it
+// was recorded with. Existing rows are linked to the only entry sharing
+// their memo on their account; rows whose memo is shared by several
+// entries, such as a purchase posted twice, are left unlinked.
+func inventoryEntries(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE inventory_transaction ADD COLUMN entry_id integer;
+		UPDATE inventory_transaction SET entry_id = (
+			SELECT MIN(gl_transaction.id) FROM gl_transaction
+			WHERE gl_transaction.memo = inventory_transaction.memo
+			AND gl_transaction.account_id = inventory_transaction.account_id
+		)
+		WHERE inventory_transaction.memo <> '' AND (
+			SELECT COUNT(DISTINCT gl_transaction.id) FROM gl_transaction
+			WHERE gl_transaction.memo = inventory_transaction.memo
+			AND gl_transaction.account_id = inventory_transaction.account_id
+		) = 1;
+		CREATE INDEX inventory_transaction_entry ON inventory_transaction (entry_id);`)
+	return err
+}
@@ -0,0 +1,158 @@
+package coincount
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecimalQuantity(t *testing.T) {
+	tests := []struct {
+		name    string
+		legacy  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "zero",
+			legacy: "0",
+			want:   "0",
+		},
+		{
+			name:   "half an ether",
+			legacy: "ds2rb79r4000",
+			want:   "500000000000000000",
+		},
+		{
+			name:   "negative",
+			legacy: "-10",
+			want:   "-32",
+		},
+		{
+			name:    "not base 32",
+			legacy:  "1.5",
+			wantErr: ErrInvalidQuantity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decimalQuantity(tt.legacy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decimalQuantity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decimalQuantity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMigrateBaseline upgrades a database created by the first release, which
+// stored quantities in base 32 and costs in integer cents, and reads its rows
+// back. It needs the SQLite driver: go test -tags sqlite
+func TestMigrateBaseline(t *testing.T) {
+	linked := false
+	for _, name := range sql.Drivers() {
+		linked = linked || name == SQLite.String()
+	}
+	if !linked {
+		t.Skip("the SQLite driver is not linked in, run with -tags sqlite")
+	}
+
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "baseline.db")
+
+	// The first release did not enforce foreign keys.
+	db, err := sql.Open(SQLite.String(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	qty := ether("1.5")
+	legacy := qty.bigInt().Text(legacyQuantityBase)
+
+	if _, err = db.ExecContext(ctx, SQLDbCreate); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO account (id, name) VALUES (?, ?), (?, ?)", []interface{}{EthMain.ID, EthMain.Name, ElectricBill.ID, ElectricBill.Name}},
+		{"INSERT INTO item (id, name) VALUES (?, ?)", []interface{}{Ether.ID, Ether.Name}},
+		{"INSERT INTO vendor (id, name) VALUES (?, ?)", []interface{}{ElectricCompany.ID, ElectricCompany.Name}},
+		{"INSERT INTO purchase (id, vendor_id, payable_acct_id, amount, timestamp) VALUES (1, ?, ?, 150, ?)",
+			[]interface{}{ElectricCompany.ID, ElectricBill.ID, date.Unix()}},
+		{"INSERT INTO purchase_item (purchase_id, item_id, inventory_account_id, qty, cost, amount) VALUES (1, ?, ?, ?, 100, 150)",
+			[]interface{}{Ether.ID, EthMain.ID, legacy}},
+		{"INSERT INTO inventory_transaction (account_id, item_id, qty_in, qty_out, cost, memo, timestamp) VALUES (?, ?, ?, '0', 100, 'PUR-1', ?)",
+			[]interface{}{EthMain.ID, Ether.ID, legacy, date.Unix()}},
+		{"INSERT INTO gl_transaction (id, account_id, debit, credit, memo, timestamp) VALUES (1, ?, 150, 0, 'PUR-1', ?), (1, ?, 0, 150, 'PUR-1', ?)",
+			[]interface{}{EthMain.ID, date.Unix(), ElectricBill.ID, date.Unix()}},
+		{"INSERT INTO posted_purchase (purchase_id, transaction_id, timestamp) VALUES (1, 1, ?)", []interface{}{date.Unix()}},
+	} {
+		if _, err = db.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			t.Fatalf("%s: %v", stmt.query, err)
+		}
+	}
+
+	db.Close()
+
+	if db, err = Open(SQLite, dsn); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		if err = Migrate(ctx, db, SQLite); err != nil {
+			t.Fatalf("Migrate() run %d: %v", i+1, err)
+		}
+	}
+
+	store := SQLStore{DB: db, Dialect: SQLite}
+	cost := UnitCostOf(Cents(100))
+
+	purchase, err := store.Purchases().Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purchase.Vendor != ElectricCompany || purchase.Amount.Cmp(Cents(150)) != 0 || purchase.Amount.Currency() != DefaultCurrency ||
+		len(purchase.Items) != 1 || purchase.Items[0].Qty.Cmp(qty) != 0 || purchase.Items[0].Cost.Cmp(cost) != 0 {
+		t.Errorf("Purchases().Get() = %+v", purchase)
+	}
+
+	transaction, err := store.InventoryTransactions().Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction.QtyIn.Cmp(qty) != 0 || transaction.QtyOut.Sign() != 0 || transaction.Cost.Cmp(cost) != 0 ||
+		transaction.Source != PurchaseSource(1) || transaction.Entry != 1 {
+		t.Errorf("InventoryTransactions().Get() = %+v", transaction)
+	}
+
+	entry, err := store.GLTransactions().Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckBalanced(entry); err != nil || len(entry) != 2 || entry[0].Debit.Currency() != DefaultCurrency ||
+		entry[0].Source != PurchaseSource(1) {
+		t.Errorf("GLTransactions().Get() = %+v, %v", entry, err)
+	}
+
+	accounts, _, err := store.Accounts().List(ctx, ListOptions{})
+	if err != nil || len(accounts) != 2 {
+		t.Errorf("Accounts().List() = %+v, %v", accounts, err)
+	}
+	if books, err := store.Books().Get(ctx); err != nil || books != DefaultBooks {
+		t.Errorf("Books().Get() = %+v, %v", books, err)
+	}
+
+	problems, err := CheckReferences(ctx, db)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("CheckReferences() = %+v, %v", problems, err)
+	}
+}
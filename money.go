@@ -0,0 +1,331 @@
+package coincount
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	DefaultCurrency = "USD"
+	CentPrecision   = 2
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("Currency Mismatch")
+	ErrInvalidMoney     = errors.New("Invalid Money")
+)
+
+// RoundingMode selects how results that fall between two representable
+// amounts are resolved.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest amount, ties to the even one.
+	RoundHalfEven RoundingMode = iota
+	// RoundUp rounds away from zero whenever anything is left over.
+	RoundUp
+	// RoundTruncate drops anything left over, rounding toward zero.
+	RoundTruncate
+)
+
+// Money is an amount of a currency held as an integer count of minor units,
+// where one major unit is 10^precision minor units. A precision of 2 counts
+// cents; higher precisions carry fractions of a cent. Money is immutable.
+//
+// The zero value is zero with no currency and adopts the currency of
+// whatever it is combined with. Combining two different currencies panics
+// with ErrCurrencyMismatch.
+type Money struct {
+	amount    *big.Int
+	currency  string
+	precision int
+}
+
+func NewMoney(amount *big.Int, currency string, precision int) Money {
+	m := Money{amount: new(big.Int), currency: currency, precision: precision}
+	if amount != nil {
+		m.amount.Set(amount)
+	}
+	return m
+}
+
+func Cents(cents int64) Money {
+	return NewMoney(big.NewInt(cents), DefaultCurrency, CentPrecision)
+}
+
+func ParseMoney(amount, currency string, precision int) (Money, error) {
+	value, err := parseDecimal(amount, precision)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, amount)
+	}
+	return Money{amount: value, currency: currency, precision: precision}, nil
+}
+
+func (m Money) bigInt() *big.Int {
+	if m.amount == nil {
+		return new(big.Int)
+	}
+	return m.amount
+}
+
+func (m Money) zero() Money {
+	return NewMoney(nil, m.currency, m.precision)
+}
+
+func (m Money) Currency() string {
+	return m.currency
+}
+
+func (m Money) Precision() int {
+	return m.precision
+}
+
+// Minor returns a copy of the amount in minor units.
+func (m Money) Minor() *big.Int {
+	return new(big.Int).Set(m.bigInt())
+}
+
+func (m Money) Sign() int {
+	return m.bigInt().Sign()
+}
+
+func (m Money) IsZero() bool {
+	return m.Sign() == 0
+}
+
+func (m Money) align(o Money) (*big.Int, *big.Int, string, int) {
+	currency := m.currency
+	switch {
+	case currency == "":
+		currency = o.currency
+	case o.currency != "" && o.currency != currency:
+		panic(fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency))
+	}
+
+	precision := m.precision
+	if o.precision > precision {
+		precision = o.precision
+	}
+
+	a, b := new(big.Int).Set(m.bigInt()), new(big.Int).Set(o.bigInt())
+	if precision > m.precision {
+		a.Mul(a, pow10(precision-m.precision))
+	}
+	if precision > o.precision {
+		b.Mul(b, pow10(precision-o.precision))
+	}
+
+	return a, b, currency, precision
+}
+
+func (m Money) Cmp(o Money) int {
+	a, b, _, _ := m.align(o)
+	return a.Cmp(b)
+}
+
+func (m Money) Add(o Money) Money {
+	a, b, currency, precision := m.align(o)
+	return Money{amount: a.Add(a, b), currency: currency, precision: precision}
+}
+
+func (m Money) Sub(o Money) Money {
+	a, b, currency, precision := m.align(o)
+	return Money{amount: a.Sub(a, b), currency: currency, precision: precision}
+}
+
+func (m Money) Neg() Money {
+	return Money{amount: new(big.Int).Neg(m.bigInt()), currency: m.currency, precision: m.precision}
+}
+
+func (m Money) Abs() Money {
+	return Money{amount: new(big.Int).Abs(m.bigInt()), currency: m.currency, precision: m.precision}
+}
+
+// Round returns m expressed with the given precision. Increasing precision is
+// exact; decreasing it rounds with mode.
+func (m Money) Round(precision int, mode RoundingMode) Money {
+	amount := new(big.Int).Set(m.bigInt())
+	switch {
+	case precision > m.precision:
+		amount.Mul(amount, pow10(precision-m.precision))
+	case precision < m.precision:
+		amount = divRound(amount, pow10(m.precision-precision), mode)
+	}
+	return Money{amount: amount, currency: m.currency, precision: precision}
+}
+
+// MulQuantity treats m as a price per whole unit and returns the price of
+// qty, rounded to m's precision with mode.
+func (m Money) MulQuantity(qty Quantity, mode RoundingMode) Money {
+	amount := new(big.Int).Mul(m.bigInt(), qty.bigInt())
+	return Money{
+		amount:    divRound(amount, pow10(qty.Decimals()), mode),
+		currency:  m.currency,
+		precision: m.precision,
+	}
+}
+
+// DivQuantity treats m as the price of qty and returns the price per whole
+// unit, rounded to m's precision with mode.
+func (m Money) DivQuantity(qty Quantity, mode RoundingMode) Money {
+	amount := new(big.Int).Mul(m.bigInt(), pow10(qty.Decimals()))
+	return Money{
+		amount:    divRound(amount, qty.bigInt(), mode),
+		currency:  m.currency,
+		precision: m.precision,
+	}
+}
+
+// Allocate splits m in proportion to ratios. Shares are truncated and the
+// minor units left over are handed out one at a time from the first share,
+// so the results always sum to m exactly.
+func (m Money) Allocate(ratios ...int64) []Money {
+	var total big.Int
+	for _, ratio := range ratios {
+		if ratio < 0 {
+			panic(fmt.Errorf("%w: negative allocation ratio %d", ErrInvalidMoney, ratio))
+		}
+		total.Add(&total, big.NewInt(ratio))
+	}
+
+	shares := make([]Money, len(ratios))
+	if total.Sign() == 0 {
+		for i := range shares {
+			shares[i] = m.zero()
+		}
+		return shares
+	}
+
+	remainder := new(big.Int).Set(m.bigInt())
+	for i, ratio := range ratios {
+		share := new(big.Int).Mul(m.bigInt(), big.NewInt(ratio))
+		share.Quo(share, &total)
+		remainder.Sub(remainder, share)
+		shares[i] = Money{amount: share, currency: m.currency, precision: m.precision}
+	}
+
+	unit := big.NewInt(int64(remainder.Sign()))
+	for i := 0; remainder.Sign() != 0; i = (i + 1) % len(shares) {
+		if ratios[i] == 0 {
+			continue
+		}
+		shares[i].amount.Add(shares[i].amount, unit)
+		remainder.Sub(remainder, unit)
+	}
+
+	return shares
+}
+
+// Split allocates m into n equal shares.
+func (m Money) Split(n int) []Money {
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// Decimal formats the amount in major units, e.g. "12.34".
+func (m Money) Decimal() string {
+	return formatDecimal(m.bigInt(), m.precision)
+}
+
+func (m Money) String() string {
+	return strings.TrimSpace(m.Decimal() + " " + m.currency)
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": "12.34", "currency": "USD"}; the number
+// of decimals in amount carries the precision.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	precision := 0
+	if i := strings.IndexByte(raw.Amount, '.'); i >= 0 {
+		precision = len(raw.Amount) - i - 1
+	}
+
+	parsed, err := ParseMoney(raw.Amount, raw.Currency, precision)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as an integer count of minor units.
+func (m Money) Value() (driver.Value, error) {
+	if !m.bigInt().IsInt64() {
+		return nil, fmt.Errorf("%w: %s overflows storage", ErrInvalidMoney, m)
+	}
+	return m.bigInt().Int64(), nil
+}
+
+// Scan reads minor units written by Value. The currency and precision
+// already set on m are kept since the schema does not store them.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		m.amount = new(big.Int)
+	case int64:
+		m.amount = big.NewInt(v)
+	case []byte, string:
+		str := fmt.Sprintf("%s", v)
+		amount, ok := new(big.Int).SetString(str, 10)
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrInvalidMoney, str)
+		}
+		m.amount = amount
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidMoney, src)
+	}
+	return nil
+}
+
+// divRound divides num by den, rounding the quotient with mode.
+func divRound(num, den *big.Int, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	away := false
+	switch mode {
+	case RoundUp:
+		away = true
+	case RoundHalfEven:
+		twice := new(big.Int).Abs(rem)
+		twice.Lsh(twice, 1)
+		switch twice.Cmp(new(big.Int).Abs(den)) {
+		case 1:
+			away = true
+		case 0:
+			away = quo.Bit(0) == 1
+		}
+	}
+
+	if away {
+		if num.Sign()*den.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
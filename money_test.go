@@ -0,0 +1,110 @@
+package coincount
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestMoneyRound(t *testing.T) {
+	type args struct {
+		minor int64
+		mode  RoundingMode
+	}
+	tests := []struct {
+		name string
+		args args
+		want int64
+	}{
+		{name: "half even down", args: args{minor: 12250, mode: RoundHalfEven}, want: 122},
+		{name: "half even up", args: args{minor: 12350, mode: RoundHalfEven}, want: 124},
+		{name: "half even nearest", args: args{minor: 12251, mode: RoundHalfEven}, want: 123},
+		{name: "half even negative", args: args{minor: -12350, mode: RoundHalfEven}, want: -124},
+		{name: "up", args: args{minor: 12201, mode: RoundUp}, want: 123},
+		{name: "up negative", args: args{minor: -12201, mode: RoundUp}, want: -123},
+		{name: "up exact", args: args{minor: 12200, mode: RoundUp}, want: 122},
+		{name: "truncate", args: args{minor: 12299, mode: RoundTruncate}, want: 122},
+		{name: "truncate negative", args: args{minor: -12299, mode: RoundTruncate}, want: -122},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMoney(big.NewInt(tt.args.minor), DefaultCurrency, 4)
+			got := m.Round(CentPrecision, tt.args.mode)
+			if got.Precision() != CentPrecision || got.Minor().Int64() != tt.want {
+				t.Errorf("Money.Round() = %v, want %d cents", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Money
+		ratios []int64
+		want   []int64
+	}{
+		{name: "thirds", amount: Cents(100), ratios: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "weighted", amount: Cents(1001), ratios: []int64{70, 30}, want: []int64{701, 300}},
+		{name: "negative", amount: Cents(-100), ratios: []int64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		{name: "zero ratio skipped", amount: Cents(5), ratios: []int64{0, 1, 1}, want: []int64{0, 3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.amount.Allocate(tt.ratios...)
+			sum := tt.amount.zero()
+			for i, share := range got {
+				sum = sum.Add(share)
+				if share.Minor().Int64() != tt.want[i] {
+					t.Errorf("Money.Allocate()[%d] = %v, want %d", i, share, tt.want[i])
+				}
+			}
+			if sum.Cmp(tt.amount) != 0 {
+				t.Errorf("Money.Allocate() sums to %v, want %v", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestMoneyQuantity(t *testing.T) {
+	price := Cents(20015)
+
+	if got := price.MulQuantity(ether("0.01"), RoundUp); got.Cmp(Cents(201)) != 0 {
+		t.Errorf("MulQuantity(RoundUp) = %v", got)
+	}
+	if got := price.MulQuantity(ether("0.01"), RoundHalfEven); got.Cmp(Cents(200)) != 0 {
+		t.Errorf("MulQuantity(RoundHalfEven) = %v", got)
+	}
+	if got := Cents(201).DivQuantity(ether("0.01"), RoundTruncate); got.Cmp(Cents(20100)) != 0 {
+		t.Errorf("DivQuantity() = %v", got)
+	}
+}
+
+func TestMoneyCurrencyMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic adding different currencies")
+		}
+	}()
+	Cents(1).Add(NewMoney(big.NewInt(1), "EUR", CentPrecision))
+}
+
+func TestMoneyJSON(t *testing.T) {
+	want := NewMoney(big.NewInt(-123456), DefaultCurrency, 4)
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":"-12.3456","currency":"USD"}` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	var got Money
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(want) != 0 || got.Precision() != 4 || got.Currency() != DefaultCurrency {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+}
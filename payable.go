@@ -0,0 +1,457 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrInvalidPayment = errors.New("Invalid Payment")
+
+type (
+	// PaymentApplication settles Amount of the purchase with PurchaseID.
+	PaymentApplication struct {
+		PurchaseID int
+		Amount     Money
+	}
+
+	// VendorPayment pays a vendor from PaymentAccount, such as a bank or
+	// card, reducing what is owed on PayableAccount. Applications say which
+	// purchases it settles; any remainder is held as a credit with the
+	// vendor.
+	VendorPayment struct {
+		ID             int
+		Date           time.Time
+		Vendor         Vendor
+		PayableAccount Account
+		PaymentAccount Account
+		Amount         Money
+		Applications   []PaymentApplication
+	}
+)
+
+// PaymentSource refers to the vendor payment with id.
+func PaymentSource(id int) SourceRef {
+	return SourceRef{Type: SourcePayment, ID: id}
+}
+
+// Applied totals the payment's applications.
+func (p VendorPayment) Applied() Money {
+	applied := p.Amount.zero()
+	for _, application := range p.Applications {
+		applied = applied.Add(application.Amount)
+	}
+	return applied
+}
+
+// Unapplied is the part of the payment not applied to any purchase.
+func (p VendorPayment) Unapplied() Money {
+	return p.Amount.Sub(p.Applied())
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidPayment listing
+// every field of p that cannot be saved or posted. Whether the purchases are
+// open is left to PayVendor.
+func (p VendorPayment) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidPayment}
+
+	if p.Date.IsZero() {
+		invalid.add("date", "is missing")
+	}
+	if p.Vendor.ID <= 0 {
+		invalid.add("vendor", "is missing")
+	}
+	if p.PayableAccount.ID <= 0 {
+		invalid.add("payable_account", "is missing")
+	}
+	if p.PaymentAccount.ID <= 0 {
+		invalid.add("payment_account", "is missing")
+	} else if p.PaymentAccount.ID == p.PayableAccount.ID {
+		invalid.add("payment_account", "is the payable account")
+	}
+	if p.Amount.Sign() <= 0 {
+		invalid.add("amount", "is not positive")
+	}
+
+	currency, matched := p.Amount.Currency(), true
+	applied := make(map[int]bool)
+	for i, application := range p.Applications {
+		field := fmt.Sprintf("applications[%d]", i)
+		if application.PurchaseID <= 0 {
+			invalid.add(field+".purchase", "is missing")
+		} else if applied[application.PurchaseID] {
+			invalid.add(field+".purchase", "%d is applied to twice", application.PurchaseID)
+		}
+		applied[application.PurchaseID] = true
+
+		if application.Amount.Sign() <= 0 {
+			invalid.add(field+".amount", "is not positive")
+		}
+		if c := application.Amount.Currency(); c != "" && currency != "" && c != currency {
+			invalid.add(field+".amount", "is in %s, not %s", c, currency)
+			matched = false
+		}
+	}
+
+	if matched && p.Amount.Sign() > 0 && p.Unapplied().Sign() < 0 {
+		invalid.add("applications", "total %v, more than the payment", p.Applied())
+	}
+
+	return invalid.err()
+}
+
+// PostPayment posts payment as journal entry nextGLTransaction, debiting the
+// payable account and crediting the account paid from.
+func PostPayment(payment VendorPayment, nextGLTransaction int) ([]GLTransaction, error) {
+	if err := payment.Validate(); err != nil {
+		return nil, err
+	}
+
+	source := PaymentSource(payment.ID)
+	amount := ledgerAmount(payment.Amount)
+	return []GLTransaction{
+		{
+			ID:      nextGLTransaction,
+			Date:    payment.Date,
+			Account: payment.PayableAccount,
+			Debit:   amount,
+			Credit:  amount.zero(),
+			Memo:    source.String(),
+			Source:  source,
+		},
+		{
+			ID:      nextGLTransaction,
+			Date:    payment.Date,
+			Account: payment.PaymentAccount,
+			Debit:   amount.zero(),
+			Credit:  amount,
+			Memo:    source.String(),
+			Source:  source,
+		},
+	}, nil
+}
+
+// PayVendor saves payment after checking that each application settles no
+// more than is still open on a purchase from the vendor, then posts it,
+// converted into the functional currency of the books if needed. The check,
+// the payment and its entry are made in one transaction. It returns the
+// payment with its ID and the journal entry.
+func PayVendor(ctx context.Context, store Store, payment VendorPayment) (VendorPayment, []GLTransaction, error) {
+	if err := payment.Validate(); err != nil {
+		return payment, nil, err
+	}
+
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return payment, nil, err
+	}
+
+	var rate FXRate
+	if currency := payment.Amount.Currency(); currency != "" && currency != books.FunctionalCurrency {
+		rate, err = store.FXRates().Get(ctx, currency, books.FunctionalCurrency, payment.Date)
+		if err != nil {
+			return payment, nil, err
+		}
+	}
+
+	if err = requirePeriodOpen(ctx, store, payment.Date); err != nil {
+		return payment, nil, err
+	}
+
+	var (
+		posted = payment
+		gl     []GLTransaction
+	)
+	err = store.Atomic(ctx, func(tx Store) error {
+		if err := checkApplications(ctx, tx, posted); err != nil {
+			return err
+		}
+
+		var err error
+		if posted.ID, err = tx.Payments().Save(ctx, posted); err != nil {
+			return err
+		}
+
+		nextID, err := tx.GLTransactions().NextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if gl, err = books.PostPayment(posted, nextID, rate); err != nil {
+			return err
+		}
+
+		return tx.GLTransactions().Save(ctx, gl)
+	})
+	if err != nil {
+		return payment, nil, err
+	}
+
+	return posted, gl, nil
+}
+
+// checkApplications returns a *ValidationError wrapping ErrInvalidPayment
+// if payment applies anything to a purchase from another vendor, in another
+// currency or beyond what is still open on it.
+func checkApplications(ctx context.Context, store Store, payment VendorPayment) error {
+	purchases, payments, err := VendorPayables(ctx, store, payment.Vendor.ID)
+	if err != nil {
+		return err
+	}
+
+	open := make(map[int]Money)
+	for _, purchase := range OpenPurchases(purchases, payments) {
+		open[purchase.Purchase.ID] = purchase.Open()
+	}
+
+	invalid := &ValidationError{Err: ErrInvalidPayment}
+	for i, application := range payment.Applications {
+		remaining, ok := open[application.PurchaseID]
+		switch {
+		case !ok:
+			invalid.add(fmt.Sprintf("applications[%d].purchase", i),
+				"%d is not an open purchase from %s", application.PurchaseID, payment.Vendor.Name)
+		case application.Amount.Currency() != remaining.Currency():
+			invalid.add(fmt.Sprintf("applications[%d].amount", i),
+				"is in %s, not %s like purchase %d", application.Amount.Currency(), remaining.Currency(), application.PurchaseID)
+		case application.Amount.Cmp(remaining) > 0:
+			invalid.add(fmt.Sprintf("applications[%d].amount", i),
+				"%v is more than the %v open", application.Amount, remaining)
+		}
+	}
+	return invalid.err()
+}
+
+// VendorPayables returns every purchase from and payment to the vendor with
+// vendorID, or to all vendors when it is 0.
+func VendorPayables(ctx context.Context, store Store, vendorID int) ([]Purchase, []VendorPayment, error) {
+	opts := ListOptions{VendorID: vendorID}
+
+	purchases, _, err := store.Purchases().List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payments, _, err := store.Payments().List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return purchases, payments, nil
+}
+
+// OpenPurchase is a purchase that payments have not fully settled.
+type OpenPurchase struct {
+	Purchase Purchase
+	Applied  Money
+}
+
+// Open is what is still owed on the purchase.
+func (o OpenPurchase) Open() Money {
+	return ledgerAmount(o.Purchase.Amount).Sub(o.Applied)
+}
+
+// OpenPurchases returns the purchases payments leave something owing on,
+// oldest first.
+func OpenPurchases(purchases []Purchase, payments []VendorPayment) []OpenPurchase {
+	applied := make(map[int]Money)
+	for _, payment := range payments {
+		for _, application := range payment.Applications {
+			applied[application.PurchaseID] = applied[application.PurchaseID].Add(application.Amount)
+		}
+	}
+
+	var open []OpenPurchase
+	for _, purchase := range purchases {
+		o := OpenPurchase{Purchase: purchase, Applied: applied[purchase.ID]}
+		if o.Open().Sign() > 0 {
+			open = append(open, o)
+		}
+	}
+
+	sort.SliceStable(open, func(i, j int) bool {
+		a, b := open[i].Purchase, open[j].Purchase
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.ID < b.ID
+	})
+	return open
+}
+
+// ApplyOldestFirst spreads amount over open, which is oldest first, settling
+// each purchase in full before moving to the next. Purchases in a currency
+// other than amount's are passed over.
+func ApplyOldestFirst(open []OpenPurchase, amount Money) []PaymentApplication {
+	var applications []PaymentApplication
+	for _, purchase := range open {
+		if amount.Sign() <= 0 {
+			break
+		}
+		if purchase.Open().Currency() != amount.Currency() {
+			continue
+		}
+
+		applied := purchase.Open()
+		if applied.Cmp(amount) > 0 {
+			applied = amount
+		}
+		applications = append(applications, PaymentApplication{PurchaseID: purchase.Purchase.ID, Amount: applied})
+		amount = amount.Sub(applied)
+	}
+	return applications
+}
+
+// VendorBalance is what has been bought from and paid to a vendor in one
+// currency.
+type VendorBalance struct {
+	Vendor    Vendor
+	Purchased Money
+	Paid      Money
+}
+
+// Balance is what is owed to the vendor, negative when it owes us.
+func (b VendorBalance) Balance() Money {
+	return b.Purchased.Sub(b.Paid)
+}
+
+// vendorCurrency keys what is owed to a vendor in one currency.
+type vendorCurrency struct {
+	vendor   int
+	currency string
+}
+
+// VendorBalances totals purchases and payments by vendor and currency,
+// ordered by vendor ID, then currency.
+func VendorBalances(purchases []Purchase, payments []VendorPayment) []VendorBalance {
+	byVendor := make(map[vendorCurrency]*VendorBalance)
+	balance := func(vendor Vendor, amount Money) *VendorBalance {
+		key := vendorCurrency{vendor.ID, amount.Currency()}
+		b, ok := byVendor[key]
+		if !ok {
+			b = &VendorBalance{Vendor: vendor, Purchased: amount.zero(), Paid: amount.zero()}
+			byVendor[key] = b
+		}
+		return b
+	}
+
+	for _, purchase := range purchases {
+		amount := ledgerAmount(purchase.Amount)
+		b := balance(purchase.Vendor, amount)
+		b.Purchased = b.Purchased.Add(amount)
+	}
+	for _, payment := range payments {
+		amount := ledgerAmount(payment.Amount)
+		b := balance(payment.Vendor, amount)
+		b.Paid = b.Paid.Add(amount)
+	}
+
+	balances := make([]VendorBalance, 0, len(byVendor))
+	for _, b := range byVendor {
+		balances = append(balances, *b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Vendor.ID != balances[j].Vendor.ID {
+			return balances[i].Vendor.ID < balances[j].Vendor.ID
+		}
+		return balances[i].Purchased.Currency() < balances[j].Purchased.Currency()
+	})
+	return balances
+}
+
+// Aging buckets open amounts by how many days old they are.
+type Aging struct {
+	// Current is up to 30 days old.
+	Current Money
+	Days30  Money
+	Days60  Money
+	// Days90 is over 90 days old.
+	Days90 Money
+}
+
+// add puts amount dated date into its bucket as of asOf.
+func (a *Aging) add(date, asOf time.Time, amount Money) {
+	switch days := int(asOf.Sub(date).Hours() / 24); {
+	case days <= 30:
+		a.Current = a.Current.Add(amount)
+	case days <= 60:
+		a.Days30 = a.Days30.Add(amount)
+	case days <= 90:
+		a.Days60 = a.Days60.Add(amount)
+	default:
+		a.Days90 = a.Days90.Add(amount)
+	}
+}
+
+func (a Aging) Total() Money {
+	return a.Current.Add(a.Days30).Add(a.Days60).Add(a.Days90)
+}
+
+// VendorAging is what is owed to one vendor in one currency by age, along
+// with payments in that currency not yet applied to any purchase.
+type VendorAging struct {
+	Vendor Vendor
+	Aging
+	Unapplied Money
+}
+
+// Balance is the aged total less the unapplied payments.
+func (a VendorAging) Balance() Money {
+	return a.Total().Sub(a.Unapplied)
+}
+
+// AgePayables ages what is open on purchases made up to asOf by vendor and
+// currency, ordered by vendor ID, then currency. Vendors with nothing open
+// and no unapplied payments are left out.
+func AgePayables(purchases []Purchase, payments []VendorPayment, asOf time.Time) []VendorAging {
+	var (
+		byVendor = make(map[vendorCurrency]*VendorAging)
+		asOfPaid []VendorPayment
+	)
+	aging := func(vendor Vendor, currency Money) *VendorAging {
+		key := vendorCurrency{vendor.ID, currency.Currency()}
+		a, ok := byVendor[key]
+		if !ok {
+			zero := currency.zero()
+			a = &VendorAging{Vendor: vendor, Aging: Aging{zero, zero, zero, zero}, Unapplied: zero}
+			byVendor[key] = a
+		}
+		return a
+	}
+
+	for _, payment := range payments {
+		if payment.Date.After(asOf) {
+			continue
+		}
+		asOfPaid = append(asOfPaid, payment)
+		if unapplied := ledgerAmount(payment.Unapplied()); unapplied.Sign() > 0 {
+			a := aging(payment.Vendor, unapplied)
+			a.Unapplied = a.Unapplied.Add(unapplied)
+		}
+	}
+
+	var made []Purchase
+	for _, purchase := range purchases {
+		if !purchase.Date.After(asOf) {
+			made = append(made, purchase)
+		}
+	}
+	for _, open := range OpenPurchases(made, asOfPaid) {
+		amount := open.Open()
+		aging(open.Purchase.Vendor, amount).add(open.Purchase.Date, asOf, amount)
+	}
+
+	agings := make([]VendorAging, 0, len(byVendor))
+	for _, a := range byVendor {
+		agings = append(agings, *a)
+	}
+	sort.Slice(agings, func(i, j int) bool {
+		if agings[i].Vendor.ID != agings[j].Vendor.ID {
+			return agings[i].Vendor.ID < agings[j].Vendor.ID
+		}
+		return agings[i].Unapplied.Currency() < agings[j].Unapplied.Currency()
+	})
+	return agings
+}
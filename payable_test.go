@@ -0,0 +1,132 @@
+package coincount
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVendorPaymentValidate(t *testing.T) {
+	valid := VendorPayment{
+		Date:           time.Unix(0, 0),
+		Vendor:         Coinbase,
+		PayableAccount: ElectricBill,
+		PaymentAccount: VisaCard,
+		Amount:         Cents(1000),
+		Applications:   []PaymentApplication{{PurchaseID: 1, Amount: Cents(600)}},
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(p *VendorPayment)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(p *VendorPayment) {}},
+		{name: "unapplied", modify: func(p *VendorPayment) { p.Applications = nil }},
+		{name: "no vendor", modify: func(p *VendorPayment) { p.Vendor = Vendor{} }, wantErr: true},
+		{name: "same accounts", modify: func(p *VendorPayment) { p.PaymentAccount = ElectricBill }, wantErr: true},
+		{name: "zero amount", modify: func(p *VendorPayment) { p.Amount = Cents(0) }, wantErr: true},
+		{
+			name: "overapplied",
+			modify: func(p *VendorPayment) {
+				p.Applications = append(p.Applications, PaymentApplication{PurchaseID: 2, Amount: Cents(401)})
+			},
+			wantErr: true,
+		},
+		{
+			name: "applied twice",
+			modify: func(p *VendorPayment) {
+				p.Applications = append(p.Applications, PaymentApplication{PurchaseID: 1, Amount: Cents(1)})
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := valid
+			payment.Applications = append([]PaymentApplication(nil), valid.Applications...)
+			tt.modify(&payment)
+
+			err := payment.Validate()
+			if tt.wantErr != errors.Is(err, ErrInvalidPayment) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgePayables(t *testing.T) {
+	asOf := time.Date(2017, 12, 31, 0, 0, 0, 0, time.UTC)
+	purchase := func(id int, vendor Vendor, daysOld int, cents int64) Purchase {
+		return Purchase{ID: id, Vendor: vendor, Date: asOf.AddDate(0, 0, -daysOld), Amount: Cents(cents)}
+	}
+	purchases := []Purchase{
+		purchase(1, Coinbase, 10, 100),
+		purchase(2, Coinbase, 45, 200),
+		purchase(3, Coinbase, 75, 300),
+		purchase(4, Coinbase, 120, 400),
+		purchase(5, Gemini, 5, 500),
+		purchase(6, Gemini, -1, 600),
+	}
+	payments := []VendorPayment{
+		{Vendor: Coinbase, Date: asOf, Amount: Cents(250), Applications: []PaymentApplication{{PurchaseID: 4, Amount: Cents(150)}}},
+		{Vendor: Gemini, Date: asOf.AddDate(0, 0, 1), Amount: Cents(500), Applications: []PaymentApplication{{PurchaseID: 5, Amount: Cents(500)}}},
+	}
+
+	tests := []struct {
+		name string
+		got  func(agings []VendorAging) Money
+		want int64
+	}{
+		{"coinbase current", func(a []VendorAging) Money { return a[0].Current }, 100},
+		{"coinbase 30", func(a []VendorAging) Money { return a[0].Days30 }, 200},
+		{"coinbase 60", func(a []VendorAging) Money { return a[0].Days60 }, 300},
+		{"coinbase 90", func(a []VendorAging) Money { return a[0].Days90 }, 250},
+		{"coinbase unapplied", func(a []VendorAging) Money { return a[0].Unapplied }, 100},
+		{"coinbase balance", func(a []VendorAging) Money { return a[0].Balance() }, 750},
+		{"gemini paid after", func(a []VendorAging) Money { return a[1].Current }, 500},
+	}
+
+	agings := AgePayables(purchases, payments, asOf)
+	if len(agings) != 2 || agings[0].Vendor.ID != Coinbase.ID || agings[1].Vendor.ID != Gemini.ID {
+		t.Fatalf("AgePayables() = %+v", agings)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got(agings); got.Cmp(Cents(tt.want)) != 0 {
+				t.Errorf("got %v, want %v", got, Cents(tt.want))
+			}
+		})
+	}
+}
+
+func TestApplyOldestFirst(t *testing.T) {
+	open := []OpenPurchase{
+		{Purchase: Purchase{ID: 1, Amount: Cents(100)}, Applied: Cents(40)},
+		{Purchase: Purchase{ID: 2, Amount: Cents(200)}},
+	}
+
+	tests := []struct {
+		name   string
+		amount int64
+		want   []int64
+	}{
+		{"part of the first", 50, []int64{50}},
+		{"first and part of the second", 100, []int64{60, 40}},
+		{"more than open", 500, []int64{60, 200}},
+	}
+	open = append(open, OpenPurchase{Purchase: Purchase{ID: 3, Amount: euros(300)}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applications := ApplyOldestFirst(open, Cents(tt.amount))
+			if len(applications) != len(tt.want) {
+				t.Fatalf("ApplyOldestFirst() = %+v", applications)
+			}
+			for i, application := range applications {
+				if application.PurchaseID != i+1 || application.Amount.Cmp(Cents(tt.want[i])) != 0 {
+					t.Errorf("application %d = %+v, want %v", i, application, Cents(tt.want[i]))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPeriod = errors.New("Invalid Period")
+
+// Period is a fiscal period of the books. Once closed, nothing dated within
+// it can be posted until it is reopened.
+type Period struct {
+	// Start is inclusive and End exclusive.
+	Start time.Time
+	End   time.Time
+	// ClosedAt is when the period was closed, the zero time while it is open.
+	ClosedAt time.Time
+	// ClosingEntry is the journal entry that closed the period's revenue and
+	// expense accounts to retained earnings, 0 if there was nothing to close.
+	ClosingEntry int
+}
+
+// Closed reports whether postings dated within p are refused.
+func (p Period) Closed() bool {
+	return !p.ClosedAt.IsZero()
+}
+
+// Contains reports whether date falls within p.
+func (p Period) Contains(date time.Time) bool {
+	return !date.Before(p.Start) && date.Before(p.End)
+}
+
+func (p Period) String() string {
+	return p.Start.Format("2006-01-02") + " to " + p.End.Format("2006-01-02")
+}
+
+// Validate returns ErrInvalidPeriod unless p ends after it starts.
+func (p Period) Validate() error {
+	if !p.End.After(p.Start) {
+		return fmt.Errorf("%w: %s ends before it starts", ErrInvalidPeriod, p)
+	}
+	return nil
+}
+
+// closedPeriodError is the error for posting into the closed period p.
+func closedPeriodError(p Period, date time.Time) error {
+	return fmt.Errorf("%w: %s is in %s", ErrPeriodClosed, date.Format("2006-01-02"), p)
+}
+
+// requirePeriodOpen returns ErrPeriodClosed if date falls in a closed period
+// of store. Callers check it before saving a document so that the document
+// is not refused only once its posting is.
+func requirePeriodOpen(ctx context.Context, store Store, date time.Time) error {
+	period, err := store.Periods().Get(ctx, date)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if period.Closed() {
+		return closedPeriodError(period, date)
+	}
+	return nil
+}
+
+// Temporary reports whether the account is closed to retained earnings at
+// the end of every period: revenue and expense accounts, numbered from
+// FirstTemporaryAccount up. Account.Validate keeps every ID in the chart's
+// four digit range.
+func (a Account) Temporary() bool {
+	return a.ID >= FirstTemporaryAccount
+}
+
+// closingMemoPrefix starts the memo of every line of a closing entry.
+const closingMemoPrefix = "CLOSE-"
+
+// isClosing reports whether line is part of a period's closing entry.
+func isClosing(line GLTransaction) bool {
+	return strings.HasPrefix(line.Memo, closingMemoPrefix)
+}
+
+// ClosingEntry returns the journal entry id, dated the last second of
+// period, that zeroes every temporary account in balances against retained.
+func ClosingEntry(period Period, balances []AccountBalance, retained Account, id int) []GLTransaction {
+	var (
+		date  = period.End.Add(-time.Second)
+		memo  = closingMemoPrefix + period.Start.Format("2006-01-02")
+		lines []GLTransaction
+		net   Money
+	)
+
+	for _, balance := range balances {
+		amount := balance.Balance()
+		if !balance.Account.Temporary() || amount.IsZero() {
+			continue
+		}
+
+		debit, credit := debitCredit(amount.Neg())
+		lines = append(lines, GLTransaction{
+			ID:      id,
+			Date:    date,
+			Account: balance.Account,
+			Debit:   debit,
+			Credit:  credit,
+			Memo:    memo,
+		})
+		net = net.Add(amount)
+	}
+
+	if net.IsZero() {
+		return lines
+	}
+
+	debit, credit := debitCredit(net)
+	return append(lines, GLTransaction{
+		ID:      id,
+		Date:    date,
+		Account: retained,
+		Debit:   debit,
+		Credit:  credit,
+		Memo:    memo,
+	})
+}
+
+// ClosePeriod closes the open period containing date. It snapshots the
+// trial balance of the period, posts the closing entry to RetainedEarnings
+// and refuses further postings, all in one transaction.
+func ClosePeriod(ctx context.Context, store Store, date time.Time) (Period, error) {
+	var closed Period
+	err := store.Atomic(ctx, func(tx Store) error {
+		period, err := tx.Periods().Get(ctx, date)
+		if err != nil {
+			return err
+		}
+		if period.Closed() {
+			return fmt.Errorf("%w: %s", ErrPeriodClosed, period)
+		}
+
+		gl, _, err := tx.GLTransactions().List(ctx, ListOptions{From: period.Start, To: period.End})
+		if err != nil {
+			return err
+		}
+		balances := TrialBalance(gl)
+
+		id, err := tx.GLTransactions().NextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if entry := ClosingEntry(period, balances, RetainedEarnings, id); len(entry) > 0 {
+			if err = tx.GLTransactions().Save(ctx, entry); err != nil {
+				return err
+			}
+			period.ClosingEntry = id
+		}
+
+		period.ClosedAt = time.Now().UTC()
+		if err = tx.Periods().Close(ctx, period, balances); err != nil {
+			return err
+		}
+
+		closed = period
+		return nil
+	})
+	return closed, err
+}
+
+// ReopenPeriod allows postings into the closed period containing date again.
+// Closing it again posts a further entry for whatever changed meanwhile.
+func ReopenPeriod(ctx context.Context, store Store, date time.Time) (Period, error) {
+	period, err := store.Periods().Get(ctx, date)
+	if err != nil {
+		return period, err
+	}
+	if !period.Closed() {
+		return period, fmt.Errorf("%w: %s is open", ErrInvalidPeriod, period)
+	}
+
+	if err = store.Periods().Reopen(ctx, period.Start); err != nil {
+		return period, err
+	}
+	period.ClosedAt = time.Time{}
+	return period, nil
+}
@@ -0,0 +1,161 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClosingEntry(t *testing.T) {
+	period := Period{
+		Start: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name     string
+		balances []AccountBalance
+		want     []AccountBalance
+	}{
+		{
+			name: "nothing to close",
+			balances: []AccountBalance{
+				{Account: EthMain, Debit: Cents(500)},
+				{Account: VisaCard, Credit: Cents(500)},
+			},
+		},
+		{
+			name: "profit",
+			balances: []AccountBalance{
+				{Account: EthMain, Debit: Cents(500)},
+				{Account: RevenueEth, Credit: Cents(700)},
+				{Account: EthTXFee, Debit: Cents(200)},
+			},
+			want: []AccountBalance{
+				{Account: RetainedEarnings, Credit: Cents(500)},
+				{Account: RevenueEth, Debit: Cents(700)},
+				{Account: EthTXFee, Credit: Cents(200)},
+			},
+		},
+		{
+			name: "loss",
+			balances: []AccountBalance{
+				{Account: EthTXFee, Debit: Cents(200)},
+			},
+			want: []AccountBalance{
+				{Account: RetainedEarnings, Debit: Cents(200)},
+				{Account: EthTXFee, Credit: Cents(200)},
+			},
+		},
+		{
+			name: "break even",
+			balances: []AccountBalance{
+				{Account: RevenueEth, Credit: Cents(200)},
+				{Account: EthTXFee, Debit: Cents(200)},
+			},
+			want: []AccountBalance{
+				{Account: RevenueEth, Debit: Cents(200)},
+				{Account: EthTXFee, Credit: Cents(200)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := ClosingEntry(period, tt.balances, RetainedEarnings, 7)
+			if err := CheckBalanced(entry); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range entry {
+				if line.ID != 7 || !line.Date.Equal(period.End.Add(-time.Second)) || line.Memo != "CLOSE-2017-01-01" {
+					t.Errorf("ClosingEntry() line = %+v", line)
+				}
+			}
+
+			got := TrialBalance(entry)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ClosingEntry() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Account != tt.want[i].Account || got[i].Balance().Cmp(tt.want[i].Balance()) != 0 {
+					t.Errorf("ClosingEntry()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// failingClose is a Store whose Periods().Close always fails.
+type failingClose struct {
+	Store
+}
+
+func (s failingClose) Periods() PeriodStore {
+	return failingPeriods{s.Store.Periods()}
+}
+
+func (s failingClose) Atomic(ctx context.Context, fn func(Store) error) error {
+	return s.Store.Atomic(ctx, func(tx Store) error {
+		return fn(failingClose{tx})
+	})
+}
+
+type failingPeriods struct {
+	PeriodStore
+}
+
+func (p failingPeriods) Close(ctx context.Context, period Period, balances []AccountBalance) error {
+	return errClose
+}
+
+var errClose = errors.New("Close failed")
+
+// atomicOnly is a Store that can only be used through Atomic; anything else
+// calls the nil Store and panics.
+type atomicOnly struct {
+	Store
+	tx Store
+}
+
+func (s atomicOnly) Atomic(ctx context.Context, fn func(Store) error) error {
+	return s.tx.Atomic(ctx, fn)
+}
+
+func TestClosePeriodAtomic(t *testing.T) {
+	ctx := context.Background()
+	store := seededMemoryStore(t)
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	period := Period{Start: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := store.Periods().Save(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	sale := []GLTransaction{
+		{ID: 1, Date: date, Account: EthMain, Debit: Cents(500), Memo: "JE-1"},
+		{ID: 1, Date: date, Account: RevenueEth, Credit: Cents(500), Memo: "JE-1"},
+	}
+	if err := store.GLTransactions().Save(ctx, sale); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ClosePeriod(ctx, failingClose{store}, date); !errors.Is(err, errClose) {
+		t.Fatalf("ClosePeriod() error = %v, want errClose", err)
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gl) != len(sale) {
+		t.Errorf("ClosePeriod() left %d lines after failing, want %d", len(gl), len(sale))
+	}
+
+	closed, err := ClosePeriod(ctx, atomicOnly{tx: store}, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.ClosingEntry != 2 {
+		t.Errorf("ClosePeriod() closing entry = %d, want 2", closed.ClosingEntry)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build postgres
+
+package coincount_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ebittleman/coincount"
+	"github.com/ebittleman/coincount/storetest"
+	_ "github.com/lib/pq"
+)
+
+// Run with: COINCOUNT_POSTGRES_DSN=postgres://... go test -tags postgres
+//
+// The DSN may point at a local server or an embedded one. Each test drops
+// and recreates the schema, so do not point it at a database you care about.
+func TestPostgresStoreConformance(t *testing.T) {
+	dsn := os.Getenv("COINCOUNT_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("COINCOUNT_POSTGRES_DSN is not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) coincount.Store {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if _, err = db.Exec(`
+			DROP SCHEMA public CASCADE;
+			CREATE SCHEMA public;`); err != nil {
+			t.Fatal(err)
+		}
+		if err = coincount.Migrate(context.Background(), db, coincount.Postgres); err != nil {
+			t.Fatal(err)
+		}
+		return coincount.SQLStore{DB: db, Dialect: coincount.Postgres}
+	})
+}
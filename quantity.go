@@ -0,0 +1,266 @@
+package coincount
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// EtherDecimals is the number of decimal places between one ether and one wei.
+const EtherDecimals = 18
+
+var ErrInvalidQuantity = errors.New("Invalid Quantity")
+
+// Quantity is a fixed point decimal amount of an item. The value is held in
+// the item's smallest unit (wei for ether) alongside the number of decimal
+// places that make up one whole unit. Quantities are immutable; arithmetic
+// returns a new value.
+type Quantity struct {
+	value    *big.Int
+	decimals int
+}
+
+func NewQuantity(value *big.Int, decimals int) Quantity {
+	q := Quantity{value: new(big.Int), decimals: decimals}
+	if value != nil {
+		q.value.Set(value)
+	}
+	return q
+}
+
+func Wei(wei *big.Int) Quantity {
+	return NewQuantity(wei, EtherDecimals)
+}
+
+func ParseQuantity(amount string, decimals int) (Quantity, error) {
+	value, err := parseDecimal(amount, decimals)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{value: value, decimals: decimals}, nil
+}
+
+// parseDecimal parses a plain decimal string such as "-1.25" into an integer
+// scaled by 10^decimals. More fractional digits than decimals is an error
+// rather than a silent truncation.
+func parseDecimal(amount string, decimals int) (*big.Int, error) {
+	str := strings.TrimSpace(amount)
+	neg := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	whole, frac := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		whole, frac = str[:i], str[i+1:]
+	}
+
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidQuantity, amount)
+	}
+
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("%w: %q has more than %d decimals", ErrInvalidQuantity, amount, decimals)
+	}
+
+	value, ok := new(big.Int).SetString("0"+whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidQuantity, amount)
+	}
+
+	if neg {
+		value.Neg(value)
+	}
+	return value, nil
+}
+
+func isDigits(str string) bool {
+	for _, r := range str {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDecimal renders value scaled by 10^decimals, padding the fraction to
+// exactly decimals digits.
+func formatDecimal(value *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(value).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	str := digits
+	if decimals > 0 {
+		str = digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+	}
+
+	if value.Sign() < 0 {
+		str = "-" + str
+	}
+	return str
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (q Quantity) bigInt() *big.Int {
+	if q.value == nil {
+		return new(big.Int)
+	}
+	return q.value
+}
+
+// scaled returns the raw value expressed with the given number of decimals,
+// which must not be less than q's.
+func (q Quantity) scaled(decimals int) *big.Int {
+	value := new(big.Int).Set(q.bigInt())
+	if decimals > q.decimals {
+		value.Mul(value, pow10(decimals-q.decimals))
+	}
+	return value
+}
+
+func (q Quantity) align(o Quantity) (*big.Int, *big.Int, int) {
+	decimals := q.decimals
+	if o.decimals > decimals {
+		decimals = o.decimals
+	}
+	return q.scaled(decimals), o.scaled(decimals), decimals
+}
+
+// Int returns a copy of the quantity in its smallest unit.
+func (q Quantity) Int() *big.Int {
+	return new(big.Int).Set(q.bigInt())
+}
+
+func (q Quantity) Decimals() int {
+	return q.decimals
+}
+
+func (q Quantity) Sign() int {
+	return q.bigInt().Sign()
+}
+
+func (q Quantity) IsZero() bool {
+	return q.Sign() == 0
+}
+
+func (q Quantity) Cmp(o Quantity) int {
+	a, b, _ := q.align(o)
+	return a.Cmp(b)
+}
+
+func (q Quantity) Add(o Quantity) Quantity {
+	a, b, decimals := q.align(o)
+	return Quantity{value: a.Add(a, b), decimals: decimals}
+}
+
+func (q Quantity) Sub(o Quantity) Quantity {
+	a, b, decimals := q.align(o)
+	return Quantity{value: a.Sub(a, b), decimals: decimals}
+}
+
+func (q Quantity) Neg() Quantity {
+	return Quantity{value: new(big.Int).Neg(q.bigInt()), decimals: q.decimals}
+}
+
+func (q Quantity) Abs() Quantity {
+	return Quantity{value: new(big.Int).Abs(q.bigInt()), decimals: q.decimals}
+}
+
+// String formats the quantity in whole units without trailing zeros, e.g. "0.2".
+func (q Quantity) String() string {
+	str := q.StringFixed()
+	if strings.Contains(str, ".") {
+		str = strings.TrimRight(strings.TrimRight(str, "0"), ".")
+	}
+	return str
+}
+
+// StringFixed formats the quantity in whole units with every decimal place,
+// e.g. "0.200000000000000000".
+func (q Quantity) StringFixed() string {
+	return formatDecimal(q.bigInt(), q.decimals)
+}
+
+// MarshalJSON encodes the quantity as a fixed decimal string so the number of
+// decimals survives a round trip.
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + q.StringFixed() + `"`), nil
+}
+
+// UnmarshalJSON accepts a decimal string or number. The result keeps q's
+// decimals, widened if the input carries more fractional digits.
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "null" {
+		return nil
+	}
+
+	decimals := q.decimals
+	if i := strings.IndexByte(str, '.'); i >= 0 && len(str)-i-1 > decimals {
+		decimals = len(str) - i - 1
+	}
+
+	parsed, err := ParseQuantity(str, decimals)
+	if err != nil {
+		return err
+	}
+
+	*q = parsed
+	return nil
+}
+
+// Value stores the value in wei, EtherDecimals places, as base 10 text,
+// which Postgres reads into a numeric column and SQLite can aggregate. The
+// schema keeps every quantity at that scale, so a quantity with more
+// decimals is refused unless the extra places are zero.
+func (q Quantity) Value() (driver.Value, error) {
+	if q.decimals <= EtherDecimals {
+		return q.scaled(EtherDecimals).String(), nil
+	}
+
+	value, rem := new(big.Int).QuoRem(q.bigInt(), pow10(q.decimals-EtherDecimals), new(big.Int))
+	if rem.Sign() != 0 {
+		return nil, fmt.Errorf("%w: %v has more than %d decimals", ErrInvalidQuantity, q, EtherDecimals)
+	}
+	return value.String(), nil
+}
+
+// Scan reads a value written by Value, which is always in wei.
+func (q *Quantity) Scan(src interface{}) error {
+	q.decimals = EtherDecimals
+
+	var str string
+	switch v := src.(type) {
+	case nil:
+		q.value = new(big.Int)
+		return nil
+	case int64:
+		q.value = big.NewInt(v)
+		return nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidQuantity, src)
+	}
+
+	value, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidQuantity, str)
+	}
+
+	q.value = value
+	return nil
+}
@@ -0,0 +1,208 @@
+package coincount
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	type args struct {
+		amount   string
+		decimals int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "whole",
+			args: args{amount: "2", decimals: EtherDecimals},
+			want: "2000000000000000000",
+		},
+		{
+			name: "fraction only",
+			args: args{amount: ".5", decimals: EtherDecimals},
+			want: "500000000000000000",
+		},
+		{
+			name: "one wei",
+			args: args{amount: "0.000000000000000001", decimals: EtherDecimals},
+			want: "1",
+		},
+		{
+			name: "negative",
+			args: args{amount: "-1.25", decimals: 2},
+			want: "-125",
+		},
+		{
+			name:    "too many decimals",
+			args:    args{amount: "0.0000000000000000001", decimals: EtherDecimals},
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			args:    args{amount: "1.2.3", decimals: EtherDecimals},
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			args:    args{amount: "", decimals: EtherDecimals},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuantity(tt.args.amount, tt.args.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseQuantity() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Int().String() != tt.want {
+				t.Errorf("ParseQuantity() = %v, want %v", got.Int(), tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	tests := []struct {
+		name      string
+		qty       Quantity
+		want      string
+		wantFixed string
+	}{
+		{
+			name:      "fraction",
+			qty:       ether("0.2"),
+			want:      "0.2",
+			wantFixed: "0.200000000000000000",
+		},
+		{
+			name:      "whole",
+			qty:       ether("3"),
+			want:      "3",
+			wantFixed: "3.000000000000000000",
+		},
+		{
+			name:      "negative wei",
+			qty:       Wei(big.NewInt(-1)),
+			want:      "-0.000000000000000001",
+			wantFixed: "-0.000000000000000001",
+		},
+		{
+			name:      "zero value",
+			qty:       Quantity{},
+			want:      "0",
+			wantFixed: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.qty.String(); got != tt.want {
+				t.Errorf("Quantity.String() = %v, want %v", got, tt.want)
+			}
+			if got := tt.qty.StringFixed(); got != tt.wantFixed {
+				t.Errorf("Quantity.StringFixed() = %v, want %v", got, tt.wantFixed)
+			}
+		})
+	}
+}
+
+func TestQuantityArithmetic(t *testing.T) {
+	a, b := ether("1.5"), ether("0.25")
+
+	if got := a.Add(b); got.Cmp(ether("1.75")) != 0 {
+		t.Errorf("Add() = %v", got)
+	}
+	if got := b.Sub(a); got.Sign() >= 0 || got.Neg().Cmp(ether("1.25")) != 0 {
+		t.Errorf("Sub() = %v", got)
+	}
+	if got := b.Sub(a).Abs(); got.Cmp(ether("1.25")) != 0 {
+		t.Errorf("Abs() = %v", got)
+	}
+	if a.Cmp(b) <= 0 || b.Cmp(a) >= 0 || a.Cmp(a) != 0 {
+		t.Errorf("Cmp() ordering is wrong")
+	}
+
+	mixed := NewQuantity(big.NewInt(15), 1).Add(NewQuantity(big.NewInt(5), 2))
+	if mixed.Decimals() != 2 || mixed.Int().Int64() != 155 {
+		t.Errorf("Add() across decimals = %v (%d decimals)", mixed, mixed.Decimals())
+	}
+}
+
+func TestQuantityJSON(t *testing.T) {
+	want := ether("0.000000000000000001")
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Quantity
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Cmp(want) != 0 || got.Decimals() != want.Decimals() {
+		t.Errorf("round trip = %v (%d decimals), want %v", got, got.Decimals(), want)
+	}
+}
+
+func TestQuantitySQL(t *testing.T) {
+	want := ether("12.345")
+
+	value, err := want.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "12345000000000000000" {
+		t.Errorf("Value() = %v, want base 10 wei", value)
+	}
+
+	got := Wei(nil)
+	if err = got.Scan([]byte(value.(string))); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Cmp(want) != 0 {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+		wantErr  bool
+	}{
+		{amount: "1", decimals: 0, want: "1000000000000000000"},
+		{amount: "0.5", decimals: 1, want: "500000000000000000"},
+		{amount: "1.0000000000000000010", decimals: 19, want: "1000000000000000001"},
+		{amount: "1.0000000000000000001", decimals: 19, wantErr: true},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuantity(tt.amount, tt.decimals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := q.Value()
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidQuantity) {
+				t.Errorf("Value() of %s error = %v, want ErrInvalidQuantity", tt.amount, err)
+			}
+			continue
+		}
+		if err != nil || value != tt.want {
+			t.Errorf("Value() of %s with %d decimals = %v, %v, want %s", tt.amount, tt.decimals, value, err, tt.want)
+		}
+
+		var scanned Quantity
+		if err = scanned.Scan(value); err != nil || scanned.Cmp(q) != 0 || scanned.Decimals() != EtherDecimals {
+			t.Errorf("Scan(%v) = %v with %d decimals, %v", value, scanned, scanned.Decimals(), err)
+		}
+	}
+}
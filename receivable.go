@@ -0,0 +1,730 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidInvoice = errors.New("Invalid Invoice")
+	ErrInvalidReceipt = errors.New("Invalid Receipt")
+)
+
+// LineService credits revenue for work done, with no inventory transaction.
+// It is only used on invoices.
+const LineService LineKind = "service"
+
+type (
+	// InvoiceLine is one line of a sale to a customer.
+	InvoiceLine struct {
+		// Kind says how the line posts; see InvoiceLine.LineKind.
+		Kind LineKind
+		// Item is required only on inventory lines.
+		Item Item
+		// Account is credited with the line's amount: the revenue account of
+		// inventory and service lines or the tax account of tax lines.
+		// Discount lines debit it.
+		Account Account
+		// InventoryAccount is the account inventory lines take the item out
+		// of at cost, expensing it to CostAccount.
+		InventoryAccount Account
+		CostAccount      Account
+		Qty              Quantity
+		Amount           Money
+	}
+
+	// Invoice sells ether or services to a customer on credit, due by
+	// DueDate.
+	Invoice struct {
+		ID                int
+		Date              time.Time
+		DueDate           time.Time
+		Customer          Customer
+		ReceivableAccount Account
+		Amount            Money
+		Lines             []InvoiceLine
+	}
+
+	// ReceiptApplication settles Amount of the invoice with InvoiceID.
+	ReceiptApplication struct {
+		InvoiceID int
+		Amount    Money
+	}
+
+	// CustomerReceipt is money received from a customer into
+	// DepositAccount, reducing what is owed on ReceivableAccount.
+	// Applications say which invoices it settles; any remainder is held as
+	// a credit for the customer.
+	CustomerReceipt struct {
+		ID                int
+		Date              time.Time
+		Customer          Customer
+		ReceivableAccount Account
+		DepositAccount    Account
+		Amount            Money
+		Applications      []ReceiptApplication
+	}
+)
+
+// SaleSource refers to the invoice with id.
+func SaleSource(id int) SourceRef {
+	return SourceRef{Type: SourceSale, ID: id}
+}
+
+// ReceiptSource refers to the customer receipt with id.
+func ReceiptSource(id int) SourceRef {
+	return SourceRef{Type: SourceReceipt, ID: id}
+}
+
+// LineKind returns the kind of the line. Lines without one are inventory
+// when they name an item and services otherwise.
+func (l InvoiceLine) LineKind() LineKind {
+	switch {
+	case l.Kind != "":
+		return l.Kind
+	case l.Item.ID > 0:
+		return LineInventory
+	}
+	return LineService
+}
+
+// signedAmount is the line's amount as it adds to the invoice amount.
+func (l InvoiceLine) signedAmount() Money {
+	if l.LineKind() == LineDiscount {
+		return l.Amount.Neg()
+	}
+	return l.Amount
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidInvoice listing
+// every field of i that cannot be saved or posted. Whether the customer and
+// accounts exist is left to the store.
+func (i Invoice) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidInvoice}
+
+	if i.Date.IsZero() {
+		invalid.add("date", "is missing")
+	}
+	if i.DueDate.IsZero() {
+		invalid.add("due_date", "is missing")
+	} else if i.DueDate.Before(i.Date) {
+		invalid.add("due_date", "is before the invoice date")
+	}
+	if i.Customer.ID <= 0 {
+		invalid.add("customer", "is missing")
+	}
+	if i.ReceivableAccount.ID <= 0 {
+		invalid.add("receivable_account", "is missing")
+	}
+	if len(i.Lines) == 0 {
+		invalid.add("lines", "are missing")
+	}
+
+	currency := i.Amount.Currency()
+	total, matched := i.Amount.zero(), true
+	for n, line := range i.Lines {
+		field := fmt.Sprintf("lines[%d]", n)
+
+		var lineInvalid *ValidationError
+		if errors.As(line.Validate(), &lineInvalid) {
+			for _, f := range lineInvalid.Fields {
+				invalid.add(field+"."+f.Field, "%s", f.Problem)
+			}
+		}
+		if line.Account.ID > 0 && line.Account.ID == i.ReceivableAccount.ID {
+			invalid.add(field+".account", "is the receivable account")
+		}
+
+		if lineCurrency := line.Amount.Currency(); lineCurrency != "" && currency != "" && lineCurrency != currency {
+			invalid.add(field+".amount", "is in %s, not %s", lineCurrency, currency)
+			matched = false
+			continue
+		}
+		total = total.Add(ledgerAmount(line.signedAmount()))
+	}
+
+	if matched && len(i.Lines) > 0 && total.Cmp(ledgerAmount(i.Amount)) != 0 {
+		invalid.add("amount", "%v does not match the lines' total of %v", ledgerAmount(i.Amount), total)
+	}
+
+	return invalid.err()
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidInvoice listing
+// every field of l that cannot be posted. Only inventory lines need an item,
+// quantity and the accounts to take its cost from and to.
+func (l InvoiceLine) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidInvoice}
+
+	kind := l.LineKind()
+	switch kind {
+	case LineInventory, LineService, LineTax, LineDiscount:
+	default:
+		invalid.add("kind", "%q is unknown", l.Kind)
+	}
+	if l.Amount.Sign() < 0 {
+		invalid.add("amount", "is negative")
+	}
+
+	if kind == LineInventory && l.Item.ID <= 0 {
+		invalid.add("item", "is missing")
+	}
+	if l.Account.ID <= 0 {
+		invalid.add("account", "is missing")
+	}
+	if kind == LineInventory {
+		if l.InventoryAccount.ID <= 0 {
+			invalid.add("inventory_account", "is missing")
+		}
+		if l.CostAccount.ID <= 0 {
+			invalid.add("cost_account", "is missing")
+		}
+		if l.Qty.IsZero() {
+			invalid.add("qty", "is missing")
+		} else if l.Qty.Sign() < 0 {
+			invalid.add("qty", "is negative")
+		}
+	}
+
+	return invalid.err()
+}
+
+// PostInvoice posts invoice as journal entry nextGLTransaction, debiting the
+// receivable and crediting each line's account. Inventory lines also take
+// their item out of inventory at costs[i], the unit cost of the i'th line,
+// and expense it. Lines posting to the same account are combined.
+func PostInvoice(invoice Invoice, nextGLTransaction int, costs []UnitCost) ([]InventoryTransaction, []GLTransaction, error) {
+	if err := invoice.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		inventoryTransactions []InventoryTransaction
+		glTransactions        []GLTransaction
+		byAccount             = make(map[int]int)
+	)
+
+	source := SaleSource(invoice.ID)
+	memo := source.String()
+	post := func(account Account, amount Money) {
+		if i, ok := byAccount[account.ID]; ok {
+			line := &glTransactions[i]
+			line.Debit, line.Credit = debitCredit(line.Debit.Sub(line.Credit).Add(amount))
+			return
+		}
+
+		byAccount[account.ID] = len(glTransactions)
+		debitAmount, creditAmount := debitCredit(amount)
+		glTransactions = append(glTransactions, GLTransaction{
+			ID:      nextGLTransaction,
+			Date:    invoice.Date,
+			Account: account,
+			Debit:   debitAmount,
+			Credit:  creditAmount,
+			Memo:    memo,
+			Source:  source,
+		})
+	}
+
+	post(invoice.ReceivableAccount, ledgerAmount(invoice.Amount))
+	for i, line := range invoice.Lines {
+		post(line.Account, ledgerAmount(line.signedAmount()).Neg())
+		if line.LineKind() != LineInventory {
+			continue
+		}
+
+		if i >= len(costs) || costs[i].Currency() == "" {
+			return nil, nil, fmt.Errorf("%w: lines[%d] has no cost", ErrInvalidInvoice, i)
+		}
+
+		value := costs[i].Extend(line.Qty, CentPrecision, RoundHalfEven)
+		inventoryTransactions = append(inventoryTransactions, InventoryTransaction{
+			Date:    invoice.Date,
+			Account: line.InventoryAccount,
+			Item:    line.Item,
+			QtyIn:   NewQuantity(nil, line.Qty.Decimals()),
+			QtyOut:  line.Qty,
+			Cost:    costs[i],
+			Amount:  value.Neg(),
+			Memo:    memo,
+			Entry:   nextGLTransaction,
+			Source:  source,
+		})
+
+		post(line.CostAccount, value)
+		post(line.InventoryAccount, value.Neg())
+	}
+
+	return inventoryTransactions, glTransactions, nil
+}
+
+// InvoiceCosts works out the first in, first out unit cost of each inventory
+// line of invoice from the item's history in the account it is taken from,
+// as PostInvoice expects them. Earlier lines are taken out before later ones.
+func InvoiceCosts(ctx context.Context, store Store, invoice Invoice) ([]UnitCost, error) {
+	type key struct {
+		account, item int
+	}
+
+	var (
+		history = make(map[key][]InventoryTransaction)
+		costs   = make([]UnitCost, len(invoice.Lines))
+	)
+
+	for i, line := range invoice.Lines {
+		if line.LineKind() != LineInventory {
+			continue
+		}
+
+		k := key{line.InventoryAccount.ID, line.Item.ID}
+		if _, ok := history[k]; !ok {
+			inv, _, err := store.InventoryTransactions().List(ctx, ListOptions{
+				AccountID: k.account,
+				ItemID:    k.item,
+				To:        invoice.Date.Add(time.Second),
+				SortBy:    "date",
+			})
+			if err != nil {
+				return nil, err
+			}
+			history[k] = NetInventoryOfReversals(inv)
+		}
+
+		cost, err := CalcCost(history[k], line.Qty)
+		if err != nil {
+			return nil, fmt.Errorf("lines[%d] %s in %s: %w", i, line.Item.Name, line.InventoryAccount.Name, err)
+		}
+		costs[i] = cost
+
+		history[k] = append(history[k], InventoryTransaction{
+			QtyIn:  NewQuantity(nil, line.Qty.Decimals()),
+			QtyOut: line.Qty,
+			Cost:   cost,
+		})
+	}
+
+	return costs, nil
+}
+
+// RecordInvoice saves invoice, posts it at the cost of the inventory it takes
+// and saves the resulting inventory and general ledger rows, all together or
+// not at all. Invoices are kept in the functional currency of the books. It
+// returns the invoice with its ID.
+func RecordInvoice(
+	ctx context.Context,
+	store Store,
+	invoice Invoice,
+) (Invoice, []InventoryTransaction, []GLTransaction, error) {
+	if err := invoice.Validate(); err != nil {
+		return invoice, nil, nil, err
+	}
+
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return invoice, nil, nil, err
+	}
+	if currency := invoice.Amount.Currency(); currency != "" && currency != books.FunctionalCurrency {
+		return invoice, nil, nil, fmt.Errorf("%w: invoice in %s, books in %s",
+			ErrCurrencyMismatch, currency, books.FunctionalCurrency)
+	}
+
+	if err = requirePeriodOpen(ctx, store, invoice.Date); err != nil {
+		return invoice, nil, nil, err
+	}
+
+	var (
+		posted = invoice
+		inv    []InventoryTransaction
+		gl     []GLTransaction
+	)
+	err = store.Atomic(ctx, func(tx Store) error {
+		costs, err := InvoiceCosts(ctx, tx, posted)
+		if err != nil {
+			return err
+		}
+
+		if posted.ID, err = tx.Invoices().Save(ctx, posted); err != nil {
+			return err
+		}
+
+		nextID, err := tx.GLTransactions().NextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if inv, gl, err = PostInvoice(posted, nextID, costs); err != nil {
+			return err
+		}
+
+		for i, transaction := range inv {
+			if inv[i].ID, err = tx.InventoryTransactions().Save(ctx, transaction); err != nil {
+				return err
+			}
+		}
+
+		return tx.GLTransactions().Save(ctx, gl)
+	})
+	if err != nil {
+		return invoice, nil, nil, err
+	}
+
+	return posted, inv, gl, nil
+}
+
+// Applied totals the receipt's applications.
+func (r CustomerReceipt) Applied() Money {
+	applied := r.Amount.zero()
+	for _, application := range r.Applications {
+		applied = applied.Add(application.Amount)
+	}
+	return applied
+}
+
+// Unapplied is the part of the receipt not applied to any invoice.
+func (r CustomerReceipt) Unapplied() Money {
+	return r.Amount.Sub(r.Applied())
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidReceipt listing
+// every field of r that cannot be saved or posted. Whether the invoices are
+// open is left to ReceivePayment.
+func (r CustomerReceipt) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidReceipt}
+
+	if r.Date.IsZero() {
+		invalid.add("date", "is missing")
+	}
+	if r.Customer.ID <= 0 {
+		invalid.add("customer", "is missing")
+	}
+	if r.ReceivableAccount.ID <= 0 {
+		invalid.add("receivable_account", "is missing")
+	}
+	if r.DepositAccount.ID <= 0 {
+		invalid.add("deposit_account", "is missing")
+	} else if r.DepositAccount.ID == r.ReceivableAccount.ID {
+		invalid.add("deposit_account", "is the receivable account")
+	}
+	if r.Amount.Sign() <= 0 {
+		invalid.add("amount", "is not positive")
+	}
+
+	currency, matched := r.Amount.Currency(), true
+	applied := make(map[int]bool)
+	for i, application := range r.Applications {
+		field := fmt.Sprintf("applications[%d]", i)
+		if application.InvoiceID <= 0 {
+			invalid.add(field+".invoice", "is missing")
+		} else if applied[application.InvoiceID] {
+			invalid.add(field+".invoice", "%d is applied to twice", application.InvoiceID)
+		}
+		applied[application.InvoiceID] = true
+
+		if application.Amount.Sign() <= 0 {
+			invalid.add(field+".amount", "is not positive")
+		}
+		if c := application.Amount.Currency(); c != "" && currency != "" && c != currency {
+			invalid.add(field+".amount", "is in %s, not %s", c, currency)
+			matched = false
+		}
+	}
+
+	if matched && r.Amount.Sign() > 0 && r.Unapplied().Sign() < 0 {
+		invalid.add("applications", "total %v, more than the receipt", r.Applied())
+	}
+
+	return invalid.err()
+}
+
+// PostReceipt posts receipt as journal entry nextGLTransaction, debiting the
+// deposit account and crediting the receivable.
+func PostReceipt(receipt CustomerReceipt, nextGLTransaction int) ([]GLTransaction, error) {
+	if err := receipt.Validate(); err != nil {
+		return nil, err
+	}
+
+	source := ReceiptSource(receipt.ID)
+	amount := ledgerAmount(receipt.Amount)
+	return []GLTransaction{
+		{
+			ID:      nextGLTransaction,
+			Date:    receipt.Date,
+			Account: receipt.DepositAccount,
+			Debit:   amount,
+			Credit:  amount.zero(),
+			Memo:    source.String(),
+			Source:  source,
+		},
+		{
+			ID:      nextGLTransaction,
+			Date:    receipt.Date,
+			Account: receipt.ReceivableAccount,
+			Debit:   amount.zero(),
+			Credit:  amount,
+			Memo:    source.String(),
+			Source:  source,
+		},
+	}, nil
+}
+
+// ReceivePayment saves receipt after checking that each application settles
+// no more than is still open on an invoice to the customer, then posts it.
+// Like invoices, receipts are kept in the functional currency of the books.
+// The receipt and its entry are saved together or not at all. It returns the
+// receipt with its ID and the journal entry.
+func ReceivePayment(ctx context.Context, store Store, receipt CustomerReceipt) (CustomerReceipt, []GLTransaction, error) {
+	if err := receipt.Validate(); err != nil {
+		return receipt, nil, err
+	}
+
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return receipt, nil, err
+	}
+	if currency := receipt.Amount.Currency(); currency != "" && currency != books.FunctionalCurrency {
+		return receipt, nil, fmt.Errorf("%w: receipt in %s, books in %s",
+			ErrCurrencyMismatch, currency, books.FunctionalCurrency)
+	}
+
+	invoices, receipts, err := CustomerReceivables(ctx, store, receipt.Customer.ID)
+	if err != nil {
+		return receipt, nil, err
+	}
+
+	open := make(map[int]Money)
+	for _, invoice := range OpenInvoices(invoices, receipts) {
+		open[invoice.Invoice.ID] = invoice.Open()
+	}
+
+	invalid := &ValidationError{Err: ErrInvalidReceipt}
+	for i, application := range receipt.Applications {
+		remaining, ok := open[application.InvoiceID]
+		switch {
+		case !ok:
+			invalid.add(fmt.Sprintf("applications[%d].invoice", i),
+				"%d is not an open invoice to %s", application.InvoiceID, receipt.Customer.Name)
+		case application.Amount.Cmp(remaining) > 0:
+			invalid.add(fmt.Sprintf("applications[%d].amount", i),
+				"%v is more than the %v open", application.Amount, remaining)
+		}
+	}
+	if err = invalid.err(); err != nil {
+		return receipt, nil, err
+	}
+
+	if err = requirePeriodOpen(ctx, store, receipt.Date); err != nil {
+		return receipt, nil, err
+	}
+
+	var (
+		posted = receipt
+		gl     []GLTransaction
+	)
+	err = store.Atomic(ctx, func(tx Store) error {
+		var err error
+		if posted.ID, err = tx.Receipts().Save(ctx, posted); err != nil {
+			return err
+		}
+
+		nextID, err := tx.GLTransactions().NextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if gl, err = PostReceipt(posted, nextID); err != nil {
+			return err
+		}
+
+		return tx.GLTransactions().Save(ctx, gl)
+	})
+	if err != nil {
+		return receipt, nil, err
+	}
+
+	return posted, gl, nil
+}
+
+// CustomerReceivables returns every invoice to and receipt from the customer
+// with customerID, or from all customers when it is 0.
+func CustomerReceivables(ctx context.Context, store Store, customerID int) ([]Invoice, []CustomerReceipt, error) {
+	opts := ListOptions{CustomerID: customerID}
+
+	invoices, _, err := store.Invoices().List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	receipts, _, err := store.Receipts().List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return invoices, receipts, nil
+}
+
+// OpenInvoice is an invoice that receipts have not fully settled.
+type OpenInvoice struct {
+	Invoice Invoice
+	Applied Money
+}
+
+// Open is what is still owed on the invoice.
+func (o OpenInvoice) Open() Money {
+	return ledgerAmount(o.Invoice.Amount).Sub(o.Applied)
+}
+
+// OpenInvoices returns the invoices receipts leave something owing on, those
+// due soonest first.
+func OpenInvoices(invoices []Invoice, receipts []CustomerReceipt) []OpenInvoice {
+	applied := make(map[int]Money)
+	for _, receipt := range receipts {
+		for _, application := range receipt.Applications {
+			applied[application.InvoiceID] = applied[application.InvoiceID].Add(application.Amount)
+		}
+	}
+
+	var open []OpenInvoice
+	for _, invoice := range invoices {
+		o := OpenInvoice{Invoice: invoice, Applied: applied[invoice.ID]}
+		if o.Open().Sign() > 0 {
+			open = append(open, o)
+		}
+	}
+
+	sort.SliceStable(open, func(i, j int) bool {
+		a, b := open[i].Invoice, open[j].Invoice
+		if !a.DueDate.Equal(b.DueDate) {
+			return a.DueDate.Before(b.DueDate)
+		}
+		return a.ID < b.ID
+	})
+	return open
+}
+
+// ApplyToInvoices spreads amount over open, which is due soonest first,
+// settling each invoice in full before moving to the next.
+func ApplyToInvoices(open []OpenInvoice, amount Money) []ReceiptApplication {
+	var applications []ReceiptApplication
+	for _, invoice := range open {
+		if amount.Sign() <= 0 {
+			break
+		}
+
+		applied := invoice.Open()
+		if applied.Cmp(amount) > 0 {
+			applied = amount
+		}
+		applications = append(applications, ReceiptApplication{InvoiceID: invoice.Invoice.ID, Amount: applied})
+		amount = amount.Sub(applied)
+	}
+	return applications
+}
+
+// CustomerBalance is what has been invoiced to and received from a customer.
+type CustomerBalance struct {
+	Customer Customer
+	Invoiced Money
+	Received Money
+}
+
+// Balance is what the customer owes, negative when we owe it.
+func (b CustomerBalance) Balance() Money {
+	return b.Invoiced.Sub(b.Received)
+}
+
+// CustomerBalances totals invoices and receipts by customer, ordered by
+// customer ID.
+func CustomerBalances(invoices []Invoice, receipts []CustomerReceipt) []CustomerBalance {
+	byCustomer := make(map[int]*CustomerBalance)
+	balance := func(customer Customer) *CustomerBalance {
+		b, ok := byCustomer[customer.ID]
+		if !ok {
+			b = &CustomerBalance{Customer: customer}
+			byCustomer[customer.ID] = b
+		}
+		return b
+	}
+
+	for _, invoice := range invoices {
+		b := balance(invoice.Customer)
+		b.Invoiced = b.Invoiced.Add(ledgerAmount(invoice.Amount))
+	}
+	for _, receipt := range receipts {
+		b := balance(receipt.Customer)
+		b.Received = b.Received.Add(ledgerAmount(receipt.Amount))
+	}
+
+	balances := make([]CustomerBalance, 0, len(byCustomer))
+	for _, b := range byCustomer {
+		balances = append(balances, *b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Customer.ID < balances[j].Customer.ID
+	})
+	return balances
+}
+
+// CustomerAging is what one customer owes by how far past due it is, along
+// with receipts not yet applied to any invoice.
+type CustomerAging struct {
+	Customer Customer
+	Aging
+	Unapplied Money
+}
+
+// Balance is the aged total less the unapplied receipts.
+func (a CustomerAging) Balance() Money {
+	return a.Total().Sub(a.Unapplied)
+}
+
+// AgeReceivables ages what is open on invoices made up to asOf by customer,
+// ordered by customer ID. Invoices are aged from their due date, so those
+// not yet due are current. Customers with nothing open and no unapplied
+// receipts are left out.
+func AgeReceivables(invoices []Invoice, receipts []CustomerReceipt, asOf time.Time) []CustomerAging {
+	var (
+		byCustomer   = make(map[int]*CustomerAging)
+		asOfReceived []CustomerReceipt
+	)
+	aging := func(customer Customer) *CustomerAging {
+		a, ok := byCustomer[customer.ID]
+		if !ok {
+			a = &CustomerAging{Customer: customer}
+			byCustomer[customer.ID] = a
+		}
+		return a
+	}
+
+	for _, receipt := range receipts {
+		if receipt.Date.After(asOf) {
+			continue
+		}
+		asOfReceived = append(asOfReceived, receipt)
+		if unapplied := ledgerAmount(receipt.Unapplied()); unapplied.Sign() > 0 {
+			a := aging(receipt.Customer)
+			a.Unapplied = a.Unapplied.Add(unapplied)
+		}
+	}
+
+	var made []Invoice
+	for _, invoice := range invoices {
+		if !invoice.Date.After(asOf) {
+			made = append(made, invoice)
+		}
+	}
+	for _, open := range OpenInvoices(made, asOfReceived) {
+		aging(open.Invoice.Customer).add(open.Invoice.DueDate, asOf, open.Open())
+	}
+
+	agings := make([]CustomerAging, 0, len(byCustomer))
+	for _, a := range byCustomer {
+		agings = append(agings, *a)
+	}
+	sort.Slice(agings, func(i, j int) bool {
+		return agings[i].Customer.ID < agings[j].Customer.ID
+	})
+	return agings
+}
@@ -0,0 +1,184 @@
+package coincount
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func sale(date time.Time) Invoice {
+	return Invoice{
+		Date:              date,
+		DueDate:           date.AddDate(0, 0, 30),
+		Customer:          OTCDesk,
+		ReceivableAccount: AccountsReceivable,
+		Amount:            Cents(1100),
+		Lines: []InvoiceLine{
+			{
+				Item:             Ether,
+				Account:          RevenueEth,
+				InventoryAccount: EthMain,
+				CostAccount:      CostOfEthSold,
+				Qty:              ether("2"),
+				Amount:           Cents(1000),
+			},
+			{Account: ServiceRevenue, Amount: Cents(150)},
+			{Kind: LineDiscount, Account: RevenueEth, Amount: Cents(50)},
+		},
+	}
+}
+
+func TestInvoiceValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(i *Invoice)
+		want   []string
+	}{
+		{name: "valid", modify: func(i *Invoice) {}},
+		{
+			name:   "empty",
+			modify: func(i *Invoice) { *i = Invoice{} },
+			want:   []string{"date", "due_date", "customer", "receivable_account", "lines"},
+		},
+		{
+			name:   "due before sold",
+			modify: func(i *Invoice) { i.DueDate = i.Date.AddDate(0, 0, -1) },
+			want:   []string{"due_date"},
+		},
+		{
+			name:   "amount off",
+			modify: func(i *Invoice) { i.Amount = Cents(1150) },
+			want:   []string{"amount"},
+		},
+		{
+			name: "bad inventory line",
+			modify: func(i *Invoice) {
+				i.Lines[0] = InvoiceLine{Kind: LineInventory, Account: RevenueEth, Amount: Cents(1000)}
+			},
+			want: []string{"lines[0].item", "lines[0].inventory_account", "lines[0].cost_account", "lines[0].qty"},
+		},
+		{
+			name:   "credits the receivable",
+			modify: func(i *Invoice) { i.Lines[1].Account = AccountsReceivable },
+			want:   []string{"lines[1].account"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := sale(time.Unix(0, 0))
+			tt.modify(&invoice)
+
+			err := invoice.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidInvoice) {
+				t.Fatalf("Validate() error = %v, want a *ValidationError", err)
+			}
+			var fields []string
+			for _, field := range invalid.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostInvoice(t *testing.T) {
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	invoice := sale(date)
+	invoice.ID = 7
+
+	inv, gl, err := PostInvoice(invoice, 3, []UnitCost{NewUnitCost(Cents(300), ether("1"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inv) != 1 || inv[0].QtyOut.Cmp(ether("2")) != 0 || inv[0].Amount.Cmp(Cents(-600)) != 0 ||
+		inv[0].Source != SaleSource(7) {
+		t.Errorf("PostInvoice() inventory = %+v", inv)
+	}
+
+	want := []struct {
+		account       Account
+		debit, credit int64
+	}{
+		{AccountsReceivable, 1100, 0},
+		{RevenueEth, 0, 950},
+		{CostOfEthSold, 600, 0},
+		{EthMain, 0, 600},
+		{ServiceRevenue, 0, 150},
+	}
+	if len(gl) != len(want) {
+		t.Fatalf("PostInvoice() entry = %+v", gl)
+	}
+	for i, w := range want {
+		line := gl[i]
+		if line.ID != 3 || line.Account != w.account || line.Memo != "SAL-7" ||
+			line.Debit.Cmp(Cents(w.debit)) != 0 || line.Credit.Cmp(Cents(w.credit)) != 0 {
+			t.Errorf("line %d = %+v, want %v Dr %v Cr %v", i, line, w.account.Name, Cents(w.debit), Cents(w.credit))
+		}
+	}
+	if err = CheckBalanced(gl); err != nil {
+		t.Error(err)
+	}
+
+	reconciliations, err := Reconcile(inv, gl)
+	if err != nil || len(reconciliations) != 1 || len(reconciliations[0].Discrepancies) != 0 {
+		t.Errorf("Reconcile() = %+v, %v", reconciliations, err)
+	}
+
+	if _, _, err = PostInvoice(invoice, 3, nil); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("PostInvoice() without costs error = %v", err)
+	}
+}
+
+func TestAgeReceivables(t *testing.T) {
+	asOf := time.Date(2017, 12, 31, 0, 0, 0, 0, time.UTC)
+	invoice := func(id int, daysPastDue int, cents int64) Invoice {
+		due := asOf.AddDate(0, 0, -daysPastDue)
+		return Invoice{ID: id, Customer: OTCDesk, Date: due.AddDate(0, 0, -30), DueDate: due, Amount: Cents(cents)}
+	}
+	invoices := []Invoice{
+		invoice(1, -20, 100),
+		invoice(2, 45, 200),
+		invoice(3, 100, 300),
+		invoice(4, -40, 400),
+	}
+	receipts := []CustomerReceipt{
+		{Customer: OTCDesk, Date: asOf, Amount: Cents(150), Applications: []ReceiptApplication{{InvoiceID: 3, Amount: Cents(100)}}},
+		{Customer: OTCDesk, Date: asOf.AddDate(0, 0, 1), Amount: Cents(200), Applications: []ReceiptApplication{{InvoiceID: 2, Amount: Cents(200)}}},
+	}
+
+	agings := AgeReceivables(invoices, receipts, asOf)
+	if len(agings) != 1 {
+		t.Fatalf("AgeReceivables() = %+v", agings)
+	}
+
+	tests := []struct {
+		name string
+		got  Money
+		want int64
+	}{
+		{"not yet due", agings[0].Current, 100},
+		{"30", agings[0].Days30, 200},
+		{"90", agings[0].Days90, 200},
+		{"unapplied", agings[0].Unapplied, 50},
+		{"balance", agings[0].Balance(), 450},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.Cmp(Cents(tt.want)) != 0 {
+				t.Errorf("got %v, want %v", tt.got, Cents(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package coincount
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Reconciliation compares the value of an inventory account's subledger with
+// the balance of the same account in the general ledger.
+type Reconciliation struct {
+	Account Account
+	// Inventory is the sum of quantity times unit cost of the account's
+	// inventory transactions.
+	Inventory Money
+	// Ledger is the account's general ledger balance, debits positive.
+	Ledger        Money
+	Discrepancies []Discrepancy
+}
+
+// Difference returns how far the subledger is above the general ledger.
+func (r Reconciliation) Difference() Money {
+	return r.Inventory.Sub(r.Ledger)
+}
+
+// Discrepancy is an entry, identified by the memo both ledgers record it
+// under, whose inventory value and general ledger lines disagree.
+type Discrepancy struct {
+	Memo string
+	// Entry is the journal entry posted under Memo, 0 if there is none.
+	Entry     int
+	Inventory Money
+	Ledger    Money
+}
+
+// Difference returns how far the subledger is above the general ledger.
+func (d Discrepancy) Difference() Money {
+	return d.Inventory.Sub(d.Ledger)
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s (entry %d): inventory %v, general ledger %v",
+		d.Memo, d.Entry, d.Inventory, d.Ledger)
+}
+
+// ReconcileInventory lists the inventory and general ledger transactions
+// matching opts and reconciles them.
+func ReconcileInventory(ctx context.Context, store Store, opts ListOptions) ([]Reconciliation, error) {
+	inv, _, err := store.InventoryTransactions().List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return Reconcile(inv, gl)
+}
+
+// Reconcile compares every account that inv posts to with its lines in gl,
+// ordered by account ID. Lines in gl on other accounts are ignored.
+func Reconcile(inv []InventoryTransaction, gl []GLTransaction) ([]Reconciliation, error) {
+	var (
+		byAccount = make(map[int]*Reconciliation)
+		byEntry   = make(map[int]map[string]*Discrepancy)
+		memos     = make(map[int][]string)
+		err       error
+	)
+
+	entry := func(account int, memo string) *Discrepancy {
+		d, ok := byEntry[account][memo]
+		if !ok {
+			d = &Discrepancy{Memo: memo}
+			byEntry[account][memo] = d
+			memos[account] = append(memos[account], memo)
+		}
+		return d
+	}
+
+	for _, transaction := range inv {
+		r, ok := byAccount[transaction.Account.ID]
+		if !ok {
+			r = &Reconciliation{Account: transaction.Account}
+			byAccount[transaction.Account.ID] = r
+			byEntry[transaction.Account.ID] = make(map[string]*Discrepancy)
+		}
+
+		value := transaction.Cost.Extend(
+			transaction.QtyIn.Sub(transaction.QtyOut),
+			CentPrecision,
+			RoundHalfEven,
+		)
+
+		d := entry(transaction.Account.ID, transaction.Memo)
+		if d.Inventory, err = addMoney(d.Inventory, value); err != nil {
+			return nil, fmt.Errorf("inventory transaction %d: %w", transaction.ID, err)
+		}
+	}
+
+	for _, transaction := range gl {
+		if _, ok := byAccount[transaction.Account.ID]; !ok {
+			continue
+		}
+
+		d := entry(transaction.Account.ID, transaction.Memo)
+		if d.Entry == 0 {
+			d.Entry = transaction.ID
+		}
+		if d.Ledger, err = addMoney(d.Ledger, transaction.Debit.Sub(transaction.Credit)); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", transaction.ID, err)
+		}
+	}
+
+	reconciliations := make([]Reconciliation, 0, len(byAccount))
+	for id, r := range byAccount {
+		sort.Strings(memos[id])
+		for _, memo := range memos[id] {
+			d := byEntry[id][memo]
+			if r.Inventory, err = addMoney(r.Inventory, d.Inventory); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.Account.Name, err)
+			}
+			if r.Ledger, err = addMoney(r.Ledger, d.Ledger); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.Account.Name, err)
+			}
+
+			difference, err := addMoney(d.Inventory, d.Ledger.Neg())
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", r.Account.Name, memo, err)
+			}
+			if !difference.IsZero() {
+				r.Discrepancies = append(r.Discrepancies, *d)
+			}
+		}
+		reconciliations = append(reconciliations, *r)
+	}
+
+	sort.Slice(reconciliations, func(i, j int) bool {
+		return reconciliations[i].Account.ID < reconciliations[j].Account.ID
+	})
+	return reconciliations, nil
+}
+
+// addMoney adds amount to sum, returning ErrCurrencyMismatch rather than
+// panicking when their currencies differ.
+func addMoney(sum, amount Money) (Money, error) {
+	if sum.Currency() != "" && amount.Currency() != "" && sum.Currency() != amount.Currency() {
+		return sum, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, sum.Currency(), amount.Currency())
+	}
+	return sum.Add(amount), nil
+}
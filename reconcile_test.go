@@ -0,0 +1,111 @@
+package coincount
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	var (
+		date = time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+		inv  = []InventoryTransaction{
+			{ID: 1, Date: date, Account: EthMain, Item: Ether, QtyIn: ether("2"), Cost: NewUnitCost(Cents(300), ether("2")), Memo: "PUR-1"},
+			{ID: 2, Date: date, Account: EthMain, Item: Ether, QtyIn: ether("1"), Cost: NewUnitCost(Cents(200), ether("1")), Memo: "PUR-2"},
+			{ID: 3, Date: date, Account: EthMain, Item: Ether, QtyOut: ether("1"), Cost: NewUnitCost(Cents(150), ether("1")), Memo: "SAL-1"},
+		}
+		posted = []GLTransaction{
+			{ID: 1, Date: date, Account: EthMain, Debit: Cents(300), Memo: "PUR-1"},
+			{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(300), Memo: "PUR-1"},
+			{ID: 2, Date: date, Account: EthMain, Debit: Cents(200), Memo: "PUR-2"},
+			{ID: 2, Date: date, Account: ElectricBill, Credit: Cents(200), Memo: "PUR-2"},
+			{ID: 3, Date: date, Account: EthMain, Credit: Cents(150), Memo: "SAL-1"},
+			{ID: 3, Date: date, Account: ElectricBill, Debit: Cents(150), Memo: "SAL-1"},
+		}
+	)
+
+	tests := []struct {
+		name    string
+		gl      []GLTransaction
+		want    []Reconciliation
+		wantErr error
+	}{
+		{
+			name: "reconciled",
+			gl:   posted,
+			want: []Reconciliation{
+				{Account: EthMain, Inventory: Cents(350), Ledger: Cents(350)},
+			},
+		},
+		{
+			name: "entry missing",
+			gl:   posted[:4],
+			want: []Reconciliation{
+				{
+					Account:   EthMain,
+					Inventory: Cents(350),
+					Ledger:    Cents(500),
+					Discrepancies: []Discrepancy{
+						{Memo: "SAL-1", Inventory: Cents(-150)},
+					},
+				},
+			},
+		},
+		{
+			name: "entry off",
+			gl: append([]GLTransaction{
+				{ID: 1, Date: date, Account: EthMain, Debit: Cents(290), Memo: "PUR-1"},
+				{ID: 1, Date: date, Account: ElectricBill, Credit: Cents(290), Memo: "PUR-1"},
+			}, posted[2:]...),
+			want: []Reconciliation{
+				{
+					Account:   EthMain,
+					Inventory: Cents(350),
+					Ledger:    Cents(340),
+					Discrepancies: []Discrepancy{
+						{Memo: "PUR-1", Entry: 1, Inventory: Cents(300), Ledger: Cents(290)},
+					},
+				},
+			},
+		},
+		{
+			name: "mixed currencies",
+			gl: []GLTransaction{
+				{ID: 1, Date: date, Account: EthMain, Debit: euros(300), Memo: "PUR-1"},
+			},
+			wantErr: ErrCurrencyMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Reconcile(inv, tt.gl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reconcile() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Reconcile() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Account != tt.want[i].Account ||
+					got[i].Inventory.Cmp(tt.want[i].Inventory) != 0 ||
+					got[i].Ledger.Cmp(tt.want[i].Ledger) != 0 {
+					t.Errorf("Reconcile()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+				if !reflect.DeepEqual(discrepancies(got[i]), discrepancies(tt.want[i])) {
+					t.Errorf("Reconcile()[%d] discrepancies = %v, want %v",
+						i, got[i].Discrepancies, tt.want[i].Discrepancies)
+				}
+			}
+		})
+	}
+}
+
+// discrepancies formats r's discrepancies for comparison.
+func discrepancies(r Reconciliation) []string {
+	var s []string
+	for _, d := range r.Discrepancies {
+		s = append(s, d.String())
+	}
+	return s
+}
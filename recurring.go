@@ -0,0 +1,363 @@
+package coincount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidTemplate = errors.New("Invalid Template")
+
+// RecurringKind says what a recurring template generates.
+type RecurringKind string
+
+const (
+	RecurringPurchase RecurringKind = "purchase"
+	RecurringPayment  RecurringKind = "payment"
+	RecurringJournal  RecurringKind = "journal"
+)
+
+// Frequency is the unit a schedule repeats in.
+type Frequency string
+
+const (
+	Daily   Frequency = "day"
+	Weekly  Frequency = "week"
+	Monthly Frequency = "month"
+	Yearly  Frequency = "year"
+)
+
+// Schedule falls due on Start and then every Every Units, up to and
+// including End unless it is zero. Monthly and yearly schedules starting
+// late in a month fall on the last day of shorter months.
+type Schedule struct {
+	Start time.Time
+	Every int
+	Unit  Frequency
+	End   time.Time
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidTemplate listing
+// every field of s that cannot be scheduled.
+func (s Schedule) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidTemplate}
+
+	if s.Start.IsZero() {
+		invalid.add("start", "is missing")
+	}
+	if s.Every <= 0 {
+		invalid.add("every", "is not positive")
+	}
+	switch s.Unit {
+	case Daily, Weekly, Monthly, Yearly:
+	default:
+		invalid.add("unit", "%q is unknown", s.Unit)
+	}
+	if !s.End.IsZero() && s.End.Before(s.Start) {
+		invalid.add("end", "is before the start")
+	}
+
+	return invalid.err()
+}
+
+// Dates returns every date s falls due on up to and including through, or
+// nothing when s is invalid.
+func (s Schedule) Dates(through time.Time) []time.Time {
+	if s.Validate() != nil {
+		return nil
+	}
+
+	var dates []time.Time
+	for n := 0; ; n++ {
+		date := s.occurrence(n)
+		if date.After(through) || !s.End.IsZero() && date.After(s.End) {
+			return dates
+		}
+		dates = append(dates, date)
+	}
+}
+
+// occurrence is the n'th date s falls due on, counting from 0.
+func (s Schedule) occurrence(n int) time.Time {
+	every := n * s.Every
+	switch s.Unit {
+	case Daily:
+		return s.Start.AddDate(0, 0, every)
+	case Weekly:
+		return s.Start.AddDate(0, 0, 7*every)
+	case Monthly:
+		return addMonths(s.Start, every)
+	}
+	return addMonths(s.Start, 12*every)
+}
+
+// addMonths adds months to t, keeping to the last day of the month rather
+// than running into the next one.
+func addMonths(t time.Time, months int) time.Time {
+	date := t.AddDate(0, months, 0)
+	if date.Day() != t.Day() {
+		date = date.AddDate(0, 0, -date.Day())
+	}
+	return date
+}
+
+// RecurringTemplate generates a purchase, vendor payment or journal entry
+// each time its schedule falls due. Exactly one of Purchase, Payment and
+// Entry is set; its date is replaced by the due date. Payments are applied
+// to the vendor's open purchases oldest first when they are generated.
+type RecurringTemplate struct {
+	ID       int
+	Name     string
+	Schedule Schedule
+	Purchase *Purchase       `json:",omitempty"`
+	Payment  *VendorPayment  `json:",omitempty"`
+	Entry    []GLTransaction `json:",omitempty"`
+}
+
+// RecurringSource refers to the recurring template with id, the source of
+// the journal entries it generates.
+func RecurringSource(id int) SourceRef {
+	return SourceRef{Type: SourceRecurring, ID: id}
+}
+
+// Kind returns what t generates, or "" when it has no body.
+func (t RecurringTemplate) Kind() RecurringKind {
+	switch {
+	case t.Purchase != nil:
+		return RecurringPurchase
+	case t.Payment != nil:
+		return RecurringPayment
+	case len(t.Entry) > 0:
+		return RecurringJournal
+	}
+	return ""
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidTemplate listing
+// every field of t that cannot be saved, including the problems its body
+// would have on the schedule's start date.
+func (t RecurringTemplate) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidTemplate}
+
+	if t.Name == "" {
+		invalid.add("name", "is missing")
+	}
+
+	var scheduleInvalid *ValidationError
+	if errors.As(t.Schedule.Validate(), &scheduleInvalid) {
+		for _, field := range scheduleInvalid.Fields {
+			invalid.add("schedule."+field.Field, "%s", field.Problem)
+		}
+	}
+
+	bodies := 0
+	for _, set := range []bool{t.Purchase != nil, t.Payment != nil, len(t.Entry) > 0} {
+		if set {
+			bodies++
+		}
+	}
+	if bodies != 1 {
+		invalid.add("body", "needs exactly one of purchase, payment or entry, not %d", bodies)
+	}
+
+	var bodyErr error
+	switch t.Kind() {
+	case RecurringPurchase:
+		purchase := *t.Purchase
+		purchase.Date = t.Schedule.Start
+		bodyErr = purchase.Validate()
+	case RecurringPayment:
+		payment := *t.Payment
+		payment.Date = t.Schedule.Start
+		bodyErr = payment.Validate()
+	case RecurringJournal:
+		if len(t.Entry) < 2 {
+			invalid.add("entry", "needs at least two lines")
+		}
+		if err := CheckBalanced(t.Entry); err != nil {
+			invalid.add("entry", "%v", err)
+		}
+	}
+
+	var bodyInvalid *ValidationError
+	if errors.As(bodyErr, &bodyInvalid) {
+		for _, field := range bodyInvalid.Fields {
+			invalid.add(string(t.Kind())+"."+field.Field, "%s", field.Problem)
+		}
+	}
+
+	return invalid.err()
+}
+
+// RecurringInstance is one due date of a recurring template. It is recorded
+// together with what is generated and posted for it so that running the
+// schedule again never generates or posts the same date twice.
+type RecurringInstance struct {
+	TemplateID int
+	Date       time.Time
+	// Document is the purchase or payment generated, the zero SourceRef for
+	// journal entries and until it is generated.
+	Document SourceRef
+	// Entry is the journal entry the instance was posted as, 0 until it is
+	// posted.
+	Entry int
+}
+
+// RunRecurring generates an instance of every template for each date it has
+// fallen due on up to and including through, and when post is set posts
+// those instances and any generated earlier but not posted. Purchases and
+// payments are saved as they are generated; journal entries only exist
+// once posted. It returns the instances it changed.
+func RunRecurring(ctx context.Context, store Store, through time.Time, post bool) ([]RecurringInstance, error) {
+	templates, _, err := store.Recurring().List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []RecurringInstance
+	for _, template := range templates {
+		instances, err := store.Recurring().Instances(ctx, template.ID)
+		if err != nil {
+			return changed, err
+		}
+
+		recorded := make(map[int64]RecurringInstance, len(instances))
+		for _, instance := range instances {
+			recorded[instance.Date.Unix()] = instance
+		}
+
+		for _, date := range template.Schedule.Dates(through) {
+			instance, ok := recorded[date.Unix()]
+			if !ok {
+				instance = RecurringInstance{TemplateID: template.ID, Date: date}
+			}
+
+			// The instance is saved in the same transaction as the document
+			// it generates and the entry it posts, so a run that fails part
+			// way through never leaves a document the instance does not
+			// know about.
+			generating := instance.Document.IsZero() && template.Kind() != RecurringJournal
+			if !ok || generating {
+				err = store.Atomic(ctx, func(tx Store) error {
+					if !ok {
+						if err := tx.Recurring().SaveInstance(ctx, instance); err != nil {
+							return err
+						}
+					}
+					if !generating {
+						return nil
+					}
+
+					var err error
+					if instance.Document, err = generate(ctx, tx, template, date); err != nil {
+						return err
+					}
+					return tx.Recurring().UpdateInstance(ctx, instance)
+				})
+				if err != nil {
+					return changed, fmt.Errorf("%s on %s: %w", template.Name, date.Format("2006-01-02"), err)
+				}
+			}
+
+			posting := post && instance.Entry == 0
+			if posting {
+				err = store.Atomic(ctx, func(tx Store) error {
+					var err error
+					if instance.Entry, err = postInstance(ctx, tx, template, instance); err != nil {
+						return err
+					}
+					return tx.Recurring().UpdateInstance(ctx, instance)
+				})
+				if err != nil {
+					return changed, fmt.Errorf("%s on %s: %w", template.Name, date.Format("2006-01-02"), err)
+				}
+			}
+
+			if !ok || generating || posting {
+				changed = append(changed, instance)
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+// generate saves the purchase or payment template makes on date.
+func generate(ctx context.Context, store Store, template RecurringTemplate, date time.Time) (SourceRef, error) {
+	switch template.Kind() {
+	case RecurringPurchase:
+		purchase := *template.Purchase
+		purchase.Date = date
+		id, err := store.Purchases().Save(ctx, purchase)
+		return PurchaseSource(id), err
+
+	case RecurringPayment:
+		payment := *template.Payment
+		payment.Date = date
+
+		purchases, payments, err := VendorPayables(ctx, store, payment.Vendor.ID)
+		if err != nil {
+			return SourceRef{}, err
+		}
+		payment.Applications = ApplyOldestFirst(OpenPurchases(purchases, payments), payment.Amount)
+
+		id, err := store.Payments().Save(ctx, payment)
+		return PaymentSource(id), err
+	}
+	return SourceRef{}, fmt.Errorf("%w: %s generates no document", ErrInvalidTemplate, template.Kind())
+}
+
+// postInstance posts the document generated for instance, or the template's
+// journal entry, and returns the entry's ID.
+func postInstance(ctx context.Context, store Store, template RecurringTemplate, instance RecurringInstance) (int, error) {
+	switch template.Kind() {
+	case RecurringPurchase:
+		purchase, err := store.Purchases().Get(ctx, instance.Document.ID)
+		if err != nil {
+			return 0, err
+		}
+		_, gl, err := RecordPurchase(ctx, store, purchase)
+		if err != nil {
+			return 0, err
+		}
+		return gl[0].ID, nil
+	}
+
+	nextID, err := store.GLTransactions().NextID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var gl []GLTransaction
+	switch template.Kind() {
+	case RecurringPayment:
+		payment, err := store.Payments().Get(ctx, instance.Document.ID)
+		if err != nil {
+			return 0, err
+		}
+		if gl, err = PostPayment(payment, nextID); err != nil {
+			return 0, err
+		}
+
+	case RecurringJournal:
+		source := RecurringSource(template.ID)
+		for _, line := range template.Entry {
+			line.ID = nextID
+			line.Date = instance.Date
+			line.Source = source
+			if line.Memo == "" {
+				line.Memo = source.String()
+			}
+			gl = append(gl, line)
+		}
+
+	default:
+		return 0, fmt.Errorf("%w: template %d has no body", ErrInvalidTemplate, template.ID)
+	}
+
+	if err = store.GLTransactions().Save(ctx, gl); err != nil {
+		return 0, err
+	}
+	return nextID, nil
+}
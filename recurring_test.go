@@ -0,0 +1,168 @@
+package coincount
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduleDates(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2017, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		through  time.Time
+		want     []time.Time
+	}{
+		{
+			name:     "monthly from month end",
+			schedule: Schedule{Start: day(1, 31), Every: 1, Unit: Monthly},
+			through:  day(4, 30),
+			want:     []time.Time{day(1, 31), day(2, 28), day(3, 31), day(4, 30)},
+		},
+		{
+			name:     "every two weeks",
+			schedule: Schedule{Start: day(1, 2), Every: 2, Unit: Weekly},
+			through:  day(1, 31),
+			want:     []time.Time{day(1, 2), day(1, 16), day(1, 30)},
+		},
+		{
+			name:     "ends inclusive",
+			schedule: Schedule{Start: day(1, 1), Every: 1, Unit: Daily, End: day(1, 3)},
+			through:  day(2, 1),
+			want:     []time.Time{day(1, 1), day(1, 2), day(1, 3)},
+		},
+		{
+			name:     "quarterly",
+			schedule: Schedule{Start: day(1, 15), Every: 3, Unit: Monthly},
+			through:  day(12, 31),
+			want:     []time.Time{day(1, 15), day(4, 15), day(7, 15), day(10, 15)},
+		},
+		{
+			name:     "yearly from leap day",
+			schedule: Schedule{Start: time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC), Every: 1, Unit: Yearly},
+			through:  day(12, 31),
+			want:     []time.Time{time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC), day(2, 28)},
+		},
+		{
+			name:     "not yet started",
+			schedule: Schedule{Start: day(6, 1), Every: 1, Unit: Monthly},
+			through:  day(5, 31),
+		},
+		{
+			name:     "invalid",
+			schedule: Schedule{Start: day(1, 1), Unit: Daily},
+			through:  day(1, 31),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Dates(tt.through); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurringTemplateValidate(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	payout := MiningPayout(time.Time{}, ether("1"), Cents(1000))
+
+	tests := []struct {
+		name     string
+		template RecurringTemplate
+		want     []string
+	}{
+		{
+			name: "purchase",
+			template: RecurringTemplate{
+				Name:     "Pool payout",
+				Schedule: Schedule{Start: start, Every: 1, Unit: Monthly},
+				Purchase: &payout,
+			},
+		},
+		{
+			name: "journal",
+			template: RecurringTemplate{
+				Name:     "Hosting",
+				Schedule: Schedule{Start: start, Every: 1, Unit: Monthly},
+				Entry: []GLTransaction{
+					{Account: CoinbaseFee, Debit: Cents(500), Credit: Cents(0)},
+					{Account: VisaCard, Debit: Cents(0), Credit: Cents(500)},
+				},
+			},
+		},
+		{
+			name:     "empty",
+			template: RecurringTemplate{},
+			want:     []string{"name", "schedule.start", "schedule.every", "schedule.unit", "body"},
+		},
+		{
+			name: "two bodies",
+			template: RecurringTemplate{
+				Name:     "Both",
+				Schedule: Schedule{Start: start, Every: 1, Unit: Weekly},
+				Purchase: &payout,
+				Payment:  &VendorPayment{},
+			},
+			want: []string{"body"},
+		},
+		{
+			name: "ends before it starts",
+			template: RecurringTemplate{
+				Name:     "Backwards",
+				Schedule: Schedule{Start: start, Every: 1, Unit: Daily, End: start.AddDate(0, 0, -1)},
+				Purchase: &payout,
+			},
+			want: []string{"schedule.end"},
+		},
+		{
+			name: "invalid payment",
+			template: RecurringTemplate{
+				Name:     "Electricity",
+				Schedule: Schedule{Start: start, Every: 1, Unit: Monthly},
+				Payment:  &VendorPayment{Vendor: ElectricCompany, PayableAccount: ElectricBill, Amount: Cents(1000)},
+			},
+			want: []string{"payment.payment_account"},
+		},
+		{
+			name: "unbalanced entry",
+			template: RecurringTemplate{
+				Name:     "Hosting",
+				Schedule: Schedule{Start: start, Every: 1, Unit: Monthly},
+				Entry: []GLTransaction{
+					{Account: CoinbaseFee, Debit: Cents(500), Credit: Cents(0)},
+					{Account: VisaCard, Debit: Cents(0), Credit: Cents(400)},
+				},
+			},
+			want: []string{"entry"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.template.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidTemplate) {
+				t.Fatalf("Validate() error = %v, want a *ValidationError", err)
+			}
+			var fields []string
+			for _, field := range invalid.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package coincount
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AccountBalance totals the general ledger lines of one account.
+type AccountBalance struct {
+	Account Account
+	Debit   Money
+	Credit  Money
+	// Foreign holds the balance in each foreign currency the account's lines
+	// carry, ordered by currency.
+	Foreign []Money
+}
+
+// Balance returns the net balance, debits positive.
+func (b AccountBalance) Balance() Money {
+	return b.Debit.Sub(b.Credit)
+}
+
+// TrialBalance totals transactions by account, ordered by account ID.
+func TrialBalance(transactions []GLTransaction) []AccountBalance {
+	byAccount := make(map[int]*AccountBalance)
+	for _, transaction := range transactions {
+		balance, ok := byAccount[transaction.Account.ID]
+		if !ok {
+			balance = &AccountBalance{Account: transaction.Account}
+			byAccount[transaction.Account.ID] = balance
+		}
+
+		balance.Debit = balance.Debit.Add(transaction.Debit)
+		balance.Credit = balance.Credit.Add(transaction.Credit)
+		balance.Foreign = addForeign(balance.Foreign, transaction.Foreign)
+	}
+
+	balances := make([]AccountBalance, 0, len(byAccount))
+	for _, balance := range byAccount {
+		balances = append(balances, *balance)
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Account.ID < balances[j].Account.ID
+	})
+	return balances
+}
+
+// addForeign adds amount to the balance in its currency among balances.
+func addForeign(balances []Money, amount Money) []Money {
+	currency := amount.Currency()
+	if currency == "" {
+		return balances
+	}
+
+	i := sort.Search(len(balances), func(i int) bool { return balances[i].Currency() >= currency })
+	if i < len(balances) && balances[i].Currency() == currency {
+		balances[i] = balances[i].Add(amount)
+		return balances
+	}
+
+	balances = append(balances, Money{})
+	copy(balances[i+1:], balances[i:])
+	balances[i] = amount
+	return balances
+}
+
+// CheckBalanced returns ErrUnbalanced unless the debits and credits of every
+// journal entry in transactions agree and are in one currency.
+func CheckBalanced(transactions []GLTransaction) error {
+	var (
+		ids  []int
+		sums = make(map[int]Money)
+	)
+
+	for _, transaction := range transactions {
+		sum, ok := sums[transaction.ID]
+		if !ok {
+			ids = append(ids, transaction.ID)
+		}
+
+		for _, amount := range []Money{transaction.Debit, transaction.Credit.Neg()} {
+			if sum.Currency() != "" && amount.Currency() != "" && sum.Currency() != amount.Currency() {
+				return fmt.Errorf("%w: entry %d mixes %s and %s",
+					ErrUnbalanced, transaction.ID, sum.Currency(), amount.Currency())
+			}
+			sum = sum.Add(amount)
+		}
+		sums[transaction.ID] = sum
+	}
+
+	for _, id := range ids {
+		if !sums[id].IsZero() {
+			return fmt.Errorf("%w: entry %d is off by %v", ErrUnbalanced, id, sums[id])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package coincount
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReversalMemo is the memo of the rows reversing entry id for reason.
+func ReversalMemo(id int, reason string) string {
+	memo := fmt.Sprintf("REV-%d", id)
+	if reason != "" {
+		memo += ": " + reason
+	}
+	return memo
+}
+
+// ReverseEntry posts a journal entry dated date that offsets entry glID,
+// along with rows reversing the inventory transactions recorded with it.
+// Reversals cannot themselves be reversed and an entry can only be reversed
+// once; either returns ErrConflict. The checks and the rows are made in one
+// transaction.
+func ReverseEntry(
+	ctx context.Context,
+	store Store,
+	glID int,
+	date time.Time,
+	reason string,
+) ([]InventoryTransaction, []GLTransaction, error) {
+	if err := requirePeriodOpen(ctx, store, date); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		inv []InventoryTransaction
+		gl  []GLTransaction
+	)
+	err := store.Atomic(ctx, func(tx Store) error {
+		original, err := tx.GLTransactions().Get(ctx, glID)
+		if err != nil {
+			return err
+		}
+		if original[0].Reverses != 0 {
+			return fmt.Errorf("%w: entry %d reverses entry %d", ErrConflict, glID, original[0].Reverses)
+		}
+
+		reversed, _, err := tx.GLTransactions().List(ctx, ListOptions{Reverses: glID, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(reversed) > 0 {
+			return fmt.Errorf("%w: entry %d is already reversed by entry %d", ErrConflict, glID, reversed[0].ID)
+		}
+
+		if inv, err = entryInventory(ctx, tx, glID); err != nil {
+			return err
+		}
+
+		nextID, err := tx.GLTransactions().NextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		memo := ReversalMemo(glID, reason)
+		for i, transaction := range inv {
+			inv[i] = InventoryTransaction{
+				Date:     date,
+				Account:  transaction.Account,
+				Item:     transaction.Item,
+				QtyIn:    transaction.QtyOut,
+				QtyOut:   transaction.QtyIn,
+				Cost:     transaction.Cost,
+				Amount:   transaction.Amount.Neg(),
+				Memo:     memo,
+				Reverses: transaction.ID,
+				Entry:    nextID,
+				Source:   transaction.Source,
+			}
+		}
+
+		gl = make([]GLTransaction, len(original))
+		for i, line := range original {
+			gl[i] = GLTransaction{
+				ID:       nextID,
+				Date:     date,
+				Account:  line.Account,
+				Debit:    line.Credit,
+				Credit:   line.Debit,
+				Memo:     memo,
+				Foreign:  line.Foreign.Neg(),
+				Reverses: glID,
+				Source:   line.Source,
+			}
+		}
+
+		for i, transaction := range inv {
+			if inv[i].ID, err = tx.InventoryTransactions().Save(ctx, transaction); err != nil {
+				return err
+			}
+		}
+
+		return tx.GLTransactions().Save(ctx, gl)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, gl, nil
+}
+
+// entryInventory returns the inventory transactions recorded with journal
+// entry glID that nothing has reversed yet.
+func entryInventory(ctx context.Context, store Store, glID int) ([]InventoryTransaction, error) {
+	found, _, err := store.InventoryTransactions().List(ctx, ListOptions{Entry: glID})
+	if err != nil {
+		return nil, err
+	}
+
+	var inv []InventoryTransaction
+	for _, transaction := range found {
+		if transaction.Reverses != 0 {
+			continue
+		}
+
+		reversals, _, err := store.InventoryTransactions().List(ctx, ListOptions{Reverses: transaction.ID, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(reversals) == 0 {
+			inv = append(inv, transaction)
+		}
+	}
+	return inv, nil
+}
+
+// NetOfReversals drops the entries in gl reversed within gl along with the
+// entries reversing them, leaving only what still stands.
+func NetOfReversals(gl []GLTransaction) []GLTransaction {
+	present := make(map[int]bool)
+	for _, line := range gl {
+		present[line.ID] = true
+	}
+
+	reversed := make(map[int]bool)
+	for _, line := range gl {
+		if present[line.Reverses] {
+			reversed[line.Reverses] = true
+		}
+	}
+
+	var net []GLTransaction
+	for _, line := range gl {
+		if reversed[line.ID] || present[line.Reverses] {
+			continue
+		}
+		net = append(net, line)
+	}
+	return net
+}
+
+// NetInventoryOfReversals is NetOfReversals for inventory transactions.
+func NetInventoryOfReversals(inv []InventoryTransaction) []InventoryTransaction {
+	present := make(map[int]bool)
+	for _, transaction := range inv {
+		present[transaction.ID] = true
+	}
+
+	reversed := make(map[int]bool)
+	for _, transaction := range inv {
+		if present[transaction.Reverses] {
+			reversed[transaction.Reverses] = true
+		}
+	}
+
+	var net []InventoryTransaction
+	for _, transaction := range inv {
+		if reversed[transaction.ID] || present[transaction.Reverses] {
+			continue
+		}
+		net = append(net, transaction)
+	}
+	return net
+}
@@ -0,0 +1,41 @@
+package coincount
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetOfReversals(t *testing.T) {
+	tests := []struct {
+		name string
+		gl   []GLTransaction
+		want []int
+	}{
+		{
+			name: "no reversals",
+			gl:   []GLTransaction{{ID: 1}, {ID: 1}, {ID: 2}},
+			want: []int{1, 1, 2},
+		},
+		{
+			name: "reversed",
+			gl:   []GLTransaction{{ID: 1}, {ID: 1}, {ID: 2}, {ID: 3, Reverses: 1}, {ID: 3, Reverses: 1}},
+			want: []int{2},
+		},
+		{
+			name: "reversal outside the range",
+			gl:   []GLTransaction{{ID: 2}, {ID: 3, Reverses: 1}},
+			want: []int{2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, line := range NetOfReversals(tt.gl) {
+				got = append(got, line.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NetOfReversals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
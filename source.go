@@ -0,0 +1,93 @@
+package coincount
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Source document types.
+const (
+	SourcePurchase  = "purchase"
+	SourceSale      = "sale"
+	SourceTransfer  = "transfer"
+	SourcePayment   = "payment"
+	SourceReceipt   = "receipt"
+	SourceRecurring = "recurring"
+)
+
+// sourcePrefixes are the memo prefixes of the source document types.
+var sourcePrefixes = map[string]string{
+	SourcePurchase:  "PUR",
+	SourceSale:      "SAL",
+	SourceTransfer:  "TRF",
+	SourcePayment:   "PAY",
+	SourceReceipt:   "RCT",
+	SourceRecurring: "REC",
+}
+
+// SourceRef identifies the document a ledger row was posted from. The zero
+// SourceRef is a manual entry.
+type SourceRef struct {
+	Type string
+	ID   int
+}
+
+// PurchaseSource refers to the purchase with id.
+func PurchaseSource(id int) SourceRef {
+	return SourceRef{Type: SourcePurchase, ID: id}
+}
+
+func (s SourceRef) IsZero() bool {
+	return s == SourceRef{}
+}
+
+// String formats s the way memos refer to it, such as PUR-12, or "" for
+// the zero SourceRef.
+func (s SourceRef) String() string {
+	if s.IsZero() {
+		return ""
+	}
+	prefix, ok := sourcePrefixes[s.Type]
+	if !ok {
+		prefix = s.Type
+	}
+	return fmt.Sprintf("%s-%d", prefix, s.ID)
+}
+
+var memoSourcePattern = regexp.MustCompile(`^([A-Z]+)-([0-9]+)$`)
+
+// memoSource recovers the source a memo like PUR-12 was written for, for rows
+// posted before sources were kept.
+func memoSource(memo string) (SourceRef, bool) {
+	match := memoSourcePattern.FindStringSubmatch(memo)
+	if match == nil {
+		return SourceRef{}, false
+	}
+	for sourceType, prefix := range sourcePrefixes {
+		if prefix == match[1] {
+			id, err := strconv.Atoi(match[2])
+			return SourceRef{Type: sourceType, ID: id}, err == nil
+		}
+	}
+	return SourceRef{}, false
+}
+
+// DocumentPostings returns every inventory transaction and general ledger
+// line posted from source, reversals included.
+func DocumentPostings(ctx context.Context, store Store, source SourceRef) ([]InventoryTransaction, []GLTransaction, error) {
+	opts := ListOptions{Source: source}
+
+	inv, _, err := store.InventoryTransactions().List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, gl, nil
+}
@@ -0,0 +1,28 @@
+package coincount
+
+import "testing"
+
+func TestMemoSource(t *testing.T) {
+	tests := []struct {
+		memo   string
+		want   SourceRef
+		wantOK bool
+	}{
+		{"PUR-12", PurchaseSource(12), true},
+		{"TRF-3", SourceRef{Type: SourceTransfer, ID: 3}, true},
+		{"REV-3", SourceRef{}, false},
+		{"PUR-12: refund", SourceRef{}, false},
+		{"", SourceRef{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.memo, func(t *testing.T) {
+			got, ok := memoSource(tt.memo)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("memoSource(%q) = %v, %v, want %v, %v", tt.memo, got, ok, tt.want, tt.wantOK)
+			}
+			if ok && got.String() != tt.memo {
+				t.Errorf("String() = %q, want %q", got.String(), tt.memo)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+//go:build sqlite
+
+package coincount_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ebittleman/coincount"
+	"github.com/ebittleman/coincount/storetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Run with: go test -tags sqlite
+func TestSQLiteStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) coincount.Store {
+		db, err := coincount.Open(coincount.SQLite, ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every connection to :memory: is a new database.
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+
+		if err = coincount.Migrate(context.Background(), db, coincount.SQLite); err != nil {
+			t.Fatal(err)
+		}
+		return coincount.SQLStore{DB: db}
+	})
+}
@@ -0,0 +1,339 @@
+package coincount
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for records that do not exist.
+	ErrNotFound = errors.New("Not Found")
+	// ErrConflict is returned when saving a record whose key is taken.
+	ErrConflict = errors.New("Conflict")
+	// ErrMissingReference is returned when saving a record that refers to an
+	// account, item, vendor, customer, purchase or invoice that does not
+	// exist.
+	ErrMissingReference = errors.New("Missing Reference")
+	// ErrArchived is returned when saving a document that refers to an
+	// archived account, item, vendor or customer.
+	ErrArchived = errors.New("Archived")
+	// ErrUnbalanced is returned for journal entries whose debits and credits
+	// disagree.
+	ErrUnbalanced = errors.New("Unbalanced Entry")
+	// ErrPeriodClosed is returned when posting into a closed fiscal period.
+	ErrPeriodClosed = errors.New("Period Closed")
+)
+
+type (
+	AccountStore interface {
+		Save(ctx context.Context, acct Account) error
+		Get(ctx context.Context, id int) (Account, error)
+		List(ctx context.Context, opts ListOptions) ([]Account, string, error)
+		Update(ctx context.Context, acct Account) error
+		Archive(ctx context.Context, id int) error
+	}
+
+	ItemStore interface {
+		Save(ctx context.Context, item Item) error
+		Get(ctx context.Context, id int) (Item, error)
+		List(ctx context.Context, opts ListOptions) ([]Item, string, error)
+		Update(ctx context.Context, item Item) error
+		Archive(ctx context.Context, id int) error
+	}
+
+	VendorStore interface {
+		Save(ctx context.Context, vendor Vendor) error
+		Get(ctx context.Context, id int) (Vendor, error)
+		List(ctx context.Context, opts ListOptions) ([]Vendor, string, error)
+		Update(ctx context.Context, vendor Vendor) error
+		Archive(ctx context.Context, id int) error
+	}
+
+	CustomerStore interface {
+		Save(ctx context.Context, customer Customer) error
+		Get(ctx context.Context, id int) (Customer, error)
+		List(ctx context.Context, opts ListOptions) ([]Customer, string, error)
+		Update(ctx context.Context, customer Customer) error
+		Archive(ctx context.Context, id int) error
+	}
+
+	PurchaseStore interface {
+		Save(ctx context.Context, purchase Purchase) (int, error)
+		Get(ctx context.Context, id int) (Purchase, error)
+		List(ctx context.Context, opts ListOptions) ([]Purchase, string, error)
+	}
+
+	// PaymentStore keeps payments made to vendors.
+	PaymentStore interface {
+		Save(ctx context.Context, payment VendorPayment) (int, error)
+		Get(ctx context.Context, id int) (VendorPayment, error)
+		List(ctx context.Context, opts ListOptions) ([]VendorPayment, string, error)
+	}
+
+	// InvoiceStore keeps sales invoiced to customers.
+	InvoiceStore interface {
+		Save(ctx context.Context, invoice Invoice) (int, error)
+		Get(ctx context.Context, id int) (Invoice, error)
+		List(ctx context.Context, opts ListOptions) ([]Invoice, string, error)
+	}
+
+	// ReceiptStore keeps payments received from customers.
+	ReceiptStore interface {
+		Save(ctx context.Context, receipt CustomerReceipt) (int, error)
+		Get(ctx context.Context, id int) (CustomerReceipt, error)
+		List(ctx context.Context, opts ListOptions) ([]CustomerReceipt, string, error)
+	}
+
+	// RecurringStore keeps recurring templates and the instances generated
+	// from them.
+	RecurringStore interface {
+		Save(ctx context.Context, template RecurringTemplate) (int, error)
+		Get(ctx context.Context, id int) (RecurringTemplate, error)
+		List(ctx context.Context, opts ListOptions) ([]RecurringTemplate, string, error)
+		// Instances returns the instances of the template with templateID in
+		// date order.
+		Instances(ctx context.Context, templateID int) ([]RecurringInstance, error)
+		// SaveInstance records instance, failing with ErrConflict when its
+		// template already has one on the same date.
+		SaveInstance(ctx context.Context, instance RecurringInstance) error
+		UpdateInstance(ctx context.Context, instance RecurringInstance) error
+	}
+
+	// BudgetStore keeps monthly budgets by account.
+	BudgetStore interface {
+		// Save records budget, replacing any budget for the same account and
+		// month.
+		Save(ctx context.Context, budget Budget) error
+		Get(ctx context.Context, accountID int, period time.Time) (Budget, error)
+		List(ctx context.Context, opts ListOptions) ([]Budget, string, error)
+	}
+
+	GLTransactionStore interface {
+		NextID(ctx context.Context) (int, error)
+		Save(ctx context.Context, transactions []GLTransaction) error
+		Get(ctx context.Context, id int) ([]GLTransaction, error)
+		List(ctx context.Context, opts ListOptions) ([]GLTransaction, string, error)
+		// Chain returns the links of the hash chain in the order they were
+		// made, which need not be entry order.
+		Chain(ctx context.Context) ([]ChainLink, error)
+	}
+
+	InventoryTransactionStore interface {
+		Save(ctx context.Context, transaction InventoryTransaction) (int, error)
+		Get(ctx context.Context, id int) (InventoryTransaction, error)
+		List(ctx context.Context, opts ListOptions) ([]InventoryTransaction, string, error)
+	}
+
+	BooksStore interface {
+		// Save returns ErrInUse for a change of functional currency once
+		// the ledger has lines, which are kept in the old one.
+		Save(ctx context.Context, books Books) error
+		Get(ctx context.Context) (Books, error)
+	}
+
+	FXRateStore interface {
+		Save(ctx context.Context, rate FXRate) error
+		Get(ctx context.Context, base, quote string, date time.Time) (FXRate, error)
+	}
+
+	PeriodStore interface {
+		Save(ctx context.Context, period Period) error
+		// Get returns the period containing date.
+		Get(ctx context.Context, date time.Time) (Period, error)
+		List(ctx context.Context) ([]Period, error)
+		// Close records period as closed along with its trial balance.
+		Close(ctx context.Context, period Period, balances []AccountBalance) error
+		Reopen(ctx context.Context, start time.Time) error
+		// Balances returns the trial balance saved when the period starting
+		// at start was last closed.
+		Balances(ctx context.Context, start time.Time) ([]AccountBalance, error)
+	}
+
+	// AuditStore browses the log of every write made to the store.
+	AuditStore interface {
+		List(ctx context.Context, opts ListOptions) ([]AuditEntry, string, error)
+	}
+
+	// Store is everything coincount keeps, independent of where it is kept.
+	Store interface {
+		Accounts() AccountStore
+		Items() ItemStore
+		Vendors() VendorStore
+		Customers() CustomerStore
+		Purchases() PurchaseStore
+		Payments() PaymentStore
+		Invoices() InvoiceStore
+		Receipts() ReceiptStore
+		Recurring() RecurringStore
+		Budgets() BudgetStore
+		GLTransactions() GLTransactionStore
+		InventoryTransactions() InventoryTransactionStore
+		Books() BooksStore
+		FXRates() FXRateStore
+		Periods() PeriodStore
+		Audit() AuditStore
+		// Atomic calls fn with a view of the store whose writes are all
+		// kept if fn returns nil and all discarded if it returns an error.
+		Atomic(ctx context.Context, fn func(Store) error) error
+	}
+)
+
+// SQLStore is a Store backed by the SQL tables of a SQLite or Postgres
+// database.
+type SQLStore struct {
+	DB      *sql.DB
+	Dialect Dialect
+	// tx is set on the store Atomic passes to fn.
+	tx *sql.Tx
+}
+
+var _ Store = SQLStore{}
+
+func (s SQLStore) Accounts() AccountStore {
+	return AccountTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Items() ItemStore {
+	return ItemTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Vendors() VendorStore {
+	return VendorTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Customers() CustomerStore {
+	return CustomerTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Purchases() PurchaseStore {
+	return PurchaseTable{DB: s.DB, PurchaseItemTable: PurchaseItemTable{Dialect: s.Dialect}, tx: s.tx}
+}
+
+func (s SQLStore) Payments() PaymentStore {
+	return PaymentTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Invoices() InvoiceStore {
+	return InvoiceTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Receipts() ReceiptStore {
+	return ReceiptTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Recurring() RecurringStore {
+	return RecurringTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Budgets() BudgetStore {
+	return BudgetTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) GLTransactions() GLTransactionStore {
+	return GLTransactionTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) InventoryTransactions() InventoryTransactionStore {
+	return InventoryTransactionTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Books() BooksStore {
+	return BooksTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) FXRates() FXRateStore {
+	return FXRateTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Periods() PeriodStore {
+	return PeriodTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+func (s SQLStore) Audit() AuditStore {
+	return AuditTable{DB: s.DB, Dialect: s.Dialect, tx: s.tx}
+}
+
+// Atomic runs fn in one database transaction. Within it every table method
+// runs in a savepoint, so fn may carry on after a method fails. Calling
+// Atomic on the store passed to fn runs in the same transaction. What fn
+// reads stays true until it commits: SQLite allows one writer at a time and
+// Postgres runs the transaction serializably, failing with ErrConflict when
+// a concurrent one got in first.
+func (s SQLStore) Atomic(ctx context.Context, fn func(Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	var opts *sql.TxOptions
+	if s.Dialect == Postgres {
+		opts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+
+	tx, err := s.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	s.tx = tx
+	if err = fn(s); err != nil {
+		return err
+	}
+	return s.Dialect.wrap(tx.Commit(), "commit")
+}
+
+// RecordPurchase posts purchase into the books kept in store, converting it
+// into the functional currency if needed, and saves the resulting inventory
+// and general ledger rows together.
+func RecordPurchase(
+	ctx context.Context,
+	store Store,
+	purchase Purchase,
+) ([]InventoryTransaction, []GLTransaction, error) {
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rate FXRate
+	if currency := purchase.Amount.Currency(); currency != "" && currency != books.FunctionalCurrency {
+		rate, err = store.FXRates().Get(ctx, currency, books.FunctionalCurrency, purchase.Date)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err = requirePeriodOpen(ctx, store, purchase.Date); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		inv []InventoryTransaction
+		gl  []GLTransaction
+	)
+	err = store.Atomic(ctx, func(tx Store) error {
+		nextID, err := tx.GLTransactions().NextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if inv, gl, err = books.PostPurchase(purchase.Date, purchase, nextID, rate); err != nil {
+			return err
+		}
+
+		for i, transaction := range inv {
+			if inv[i].ID, err = tx.InventoryTransactions().Save(ctx, transaction); err != nil {
+				return err
+			}
+		}
+
+		return tx.GLTransactions().Save(ctx, gl)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inv, gl, nil
+}
@@ -0,0 +1,14 @@
+package coincount_test
+
+import (
+	"testing"
+
+	"github.com/ebittleman/coincount"
+	"github.com/ebittleman/coincount/storetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) coincount.Store {
+		return coincount.NewMemoryStore()
+	})
+}
@@ -0,0 +1,1451 @@
+// Package storetest is a conformance suite for coincount.Store
+// implementations. Every backend is expected to pass it unchanged.
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/coincount"
+)
+
+// Run runs the suite. open is called once per test and must return an empty
+// store with the schema in place.
+func Run(t *testing.T, open func(t *testing.T) coincount.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store coincount.Store)
+	}{
+		{"MasterData", testMasterData},
+		{"Archive", testArchive},
+		{"ListPages", testListPages},
+		{"Purchases", testPurchases},
+		{"RecordPurchase", testRecordPurchase},
+		{"PurchaseLines", testPurchaseLines},
+		{"Payables", testPayables},
+		{"Receivables", testReceivables},
+		{"Recurring", testRecurring},
+		{"Budgets", testBudgets},
+		{"References", testReferences},
+		{"Atomic", testAtomic},
+		{"Journal", testJournal},
+		{"Quantities", testQuantities},
+		{"Books", testBooks},
+		{"FXRates", testFXRates},
+		{"Periods", testPeriods},
+		{"Reversals", testReversals},
+		{"Audit", testAudit},
+		{"Chain", testChain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := open(t)
+			Seed(t, store)
+			tt.test(t, store)
+		})
+	}
+}
+
+// Seed saves the fixture accounts, items, vendors and customers.
+func Seed(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	for _, acct := range coincount.GLAccounts {
+		if err := store.Accounts().Save(ctx, acct); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, item := range coincount.InventoryItems {
+		if err := store.Items().Save(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, vendor := range coincount.Vendors {
+		if err := store.Vendors().Save(ctx, vendor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, customer := range coincount.Customers {
+		if err := store.Customers().Save(ctx, customer); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ether returns a whole number of ether.
+func ether(n int64) coincount.Quantity {
+	wei := new(big.Int).Mul(big.NewInt(n), new(big.Int).Exp(big.NewInt(10), big.NewInt(coincount.EtherDecimals), nil))
+	return coincount.Wei(wei)
+}
+
+func testMasterData(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	acct, err := store.Accounts().Get(ctx, coincount.ElectricBill.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct != coincount.ElectricBill {
+		t.Errorf("Accounts().Get() = %v, want %v", acct, coincount.ElectricBill)
+	}
+
+	if err = store.Accounts().Save(ctx, coincount.ElectricBill); !errors.Is(err, coincount.ErrConflict) {
+		t.Errorf("Accounts().Save() of a duplicate ID error = %v", err)
+	}
+	if err = store.Accounts().Save(ctx, coincount.Account{ID: 42, Name: "Cash"}); !errors.Is(err, coincount.ErrInvalidAccount) {
+		t.Errorf("Accounts().Save() outside the chart's numbering error = %v", err)
+	}
+
+	if _, err = store.Items().Get(ctx, -1); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Items().Get() of a missing item error = %v", err)
+	}
+
+	if err = store.Items().Update(ctx, coincount.Item{ID: -1, Name: "Nothing"}); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Items().Update() of a missing item error = %v", err)
+	}
+
+	renamed := coincount.Vendor{ID: coincount.Coinbase.ID, Name: "Coinbase Pro"}
+	if err = store.Vendors().Update(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	vendor, err := store.Vendors().Get(ctx, renamed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vendor != renamed {
+		t.Errorf("Vendors().Get() after Update() = %v, want %v", vendor, renamed)
+	}
+
+	vendors, _, err := store.Vendors().List(ctx, coincount.ListOptions{Search: "COINBASE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vendors) != 1 || vendors[0] != renamed {
+		t.Errorf("Vendors().List() searching %q = %v", "COINBASE", vendors)
+	}
+}
+
+func testArchive(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	purchase := coincount.MiningPayout(time.Unix(0, 0), ether(1), coincount.Cents(100))
+	if _, err := store.Purchases().Save(ctx, purchase); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Vendors().Archive(ctx, coincount.ElectricCompany.ID); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Vendors().Archive() of a used vendor error = %v", err)
+	}
+	if err := store.Accounts().Archive(ctx, coincount.EthMain.ID); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Accounts().Archive() of a used account error = %v", err)
+	}
+	if err := store.Items().Archive(ctx, coincount.Ether.ID); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Items().Archive() of a used item error = %v", err)
+	}
+
+	if err := store.Vendors().Archive(ctx, coincount.Gemini.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Vendors().Archive(ctx, coincount.Gemini.ID); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Vendors().Archive() twice error = %v", err)
+	}
+
+	vendor, err := store.Vendors().Get(ctx, coincount.Gemini.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vendor.Archived {
+		t.Error("Vendors().Get() of an archived vendor is not Archived")
+	}
+
+	for _, includeArchived := range []bool{false, true} {
+		vendors, _, err := store.Vendors().List(ctx, coincount.ListOptions{IncludeArchived: includeArchived})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listed := false
+		for _, vendor := range vendors {
+			listed = listed || vendor.ID == coincount.Gemini.ID
+		}
+		if listed != includeArchived {
+			t.Errorf("Vendors().List(IncludeArchived: %v) listed archived vendor: %v", includeArchived, listed)
+		}
+	}
+
+	fromGemini := purchase
+	fromGemini.Vendor = coincount.Gemini
+	if _, err = store.Purchases().Save(ctx, fromGemini); !errors.Is(err, coincount.ErrArchived) {
+		t.Errorf("Purchases().Save() from an archived vendor error = %v", err)
+	}
+
+	purchases, _, err := store.Purchases().List(ctx, coincount.ListOptions{})
+	if err != nil || len(purchases) != 1 {
+		t.Errorf("Purchases().List() = %d purchases, %v, want the 1 saved", len(purchases), err)
+	}
+}
+
+func testListPages(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	for _, descending := range []bool{false, true} {
+		var (
+			opts  = coincount.ListOptions{SortBy: "name", Descending: descending, Limit: 4}
+			names []string
+		)
+		for {
+			accts, cursor, err := store.Accounts().List(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(accts) > opts.Limit {
+				t.Fatalf("page of %d accounts, limit %d", len(accts), opts.Limit)
+			}
+			for _, acct := range accts {
+				names = append(names, acct.Name)
+			}
+			if cursor == "" {
+				break
+			}
+			opts.Cursor = cursor
+		}
+
+		if len(names) != len(coincount.GLAccounts) {
+			t.Fatalf("paged through %d accounts, want %d", len(names), len(coincount.GLAccounts))
+		}
+		for i := 1; i < len(names); i++ {
+			if names[i-1] == names[i] || (names[i-1] > names[i]) != descending {
+				t.Errorf("accounts out of order: %q before %q", names[i-1], names[i])
+			}
+		}
+	}
+
+	if _, _, err := store.Accounts().List(ctx, coincount.ListOptions{SortBy: "balance"}); !errors.Is(err, coincount.ErrInvalidSort) {
+		t.Errorf("List() with unknown sort error = %v", err)
+	}
+	if _, _, err := store.Accounts().List(ctx, coincount.ListOptions{Cursor: "!"}); !errors.Is(err, coincount.ErrInvalidCursor) {
+		t.Errorf("List() with bad cursor error = %v", err)
+	}
+}
+
+func testPurchases(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	// 1000 ether in wei does not fit in 64 bits.
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	want := coincount.MiningPayout(date, ether(1000), coincount.Cents(30001))
+
+	invalid := want
+	invalid.Amount = coincount.Cents(1)
+	if _, err := store.Purchases().Save(ctx, invalid); !errors.Is(err, coincount.ErrInvalidPurchase) {
+		t.Errorf("Purchases().Save() of a purchase not matching its items error = %v", err)
+	}
+
+	id, err := store.Purchases().Save(ctx, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := store.Purchases().Save(ctx, coincount.MiningPayout(date.AddDate(0, 0, 1), ether(1), coincount.Cents(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= id {
+		t.Errorf("Purchases().Save() returned ID %d after %d", next, id)
+	}
+
+	got, err := store.Purchases().Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != id || !got.Date.Equal(want.Date) || got.Vendor != want.Vendor ||
+		got.PayableAccount != want.PayableAccount || got.Amount.Cmp(want.Amount) != 0 {
+		t.Errorf("Purchases().Get() = %v, want %v", got, want)
+	}
+	if len(got.Items) != 1 {
+		t.Fatalf("Purchases().Get() has %d items, want 1", len(got.Items))
+	}
+
+	item, wantItem := got.Items[0], want.Items[0]
+	if item.Item != wantItem.Item || item.InventoryAccount != wantItem.InventoryAccount ||
+		item.Qty.Cmp(wantItem.Qty) != 0 || item.Cost.Cmp(wantItem.Cost) != 0 ||
+		item.Amount.Cmp(wantItem.Amount) != 0 {
+		t.Errorf("Purchases().Get() item = %+v, want %+v", item, wantItem)
+	}
+
+	if _, err = store.Purchases().Get(ctx, next+1); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Purchases().Get() of a missing purchase error = %v", err)
+	}
+
+	purchases, _, err := store.Purchases().List(ctx, coincount.ListOptions{
+		From:       date,
+		To:         date.AddDate(0, 0, 1),
+		ItemID:     coincount.Ether.ID,
+		SortBy:     "amount",
+		Descending: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purchases) != 1 || purchases[0].ID != id || len(purchases[0].Items) != 1 {
+		t.Errorf("Purchases().List() = %v, want purchase %d", purchases, id)
+	}
+}
+
+func testRecordPurchase(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	var recorded [][]coincount.GLTransaction
+	for day := 1; day <= 3; day++ {
+		date := time.Date(2017, 8, day, 0, 0, 0, 0, time.UTC)
+		id, err := store.Purchases().Save(ctx, coincount.MiningPayout(date, ether(1), coincount.Cents(30000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		purchase, err := store.Purchases().Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inv, gl, err := coincount.RecordPurchase(ctx, store, purchase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, gl)
+
+		got, err := store.InventoryTransactions().Get(ctx, inv[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.QtyIn.Cmp(ether(1)) != 0 || got.Amount.Cmp(coincount.Cents(30000)) != 0 || !got.Date.Equal(date) {
+			t.Errorf("InventoryTransactions().Get() = %+v", got)
+		}
+	}
+
+	for i := 1; i < len(recorded); i++ {
+		if recorded[i][0].ID <= recorded[i-1][0].ID {
+			t.Errorf("journal entry %d recorded after %d", recorded[i][0].ID, recorded[i-1][0].ID)
+		}
+	}
+
+	last := recorded[len(recorded)-1]
+	next, err := store.GLTransactions().NextID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= last[0].ID {
+		t.Errorf("GLTransactions().NextID() = %d after %d", next, last[0].ID)
+	}
+
+	entry, err := store.GLTransactions().Get(ctx, last[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry) != len(last) {
+		t.Fatalf("GLTransactions().Get() = %d lines, want %d", len(entry), len(last))
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, coincount.ListOptions{Search: "pur-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gl) != 6 {
+		t.Fatalf("GLTransactions().List() = %d lines, want 6", len(gl))
+	}
+
+	for _, balance := range coincount.TrialBalance(gl) {
+		want := coincount.Cents(90000)
+		if balance.Account.ID == coincount.ElectricBill.ID {
+			want = want.Neg()
+		}
+		if balance.Balance().Cmp(want) != 0 {
+			t.Errorf("%s balance = %v, want %v", balance.Account.Name, balance.Balance(), want)
+		}
+	}
+
+	inv, _, err := store.InventoryTransactions().List(ctx, coincount.ListOptions{ItemID: coincount.Ether.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost, err := coincount.CalcCost(inv, ether(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Cmp(coincount.UnitCostOf(coincount.Cents(30000))) != 0 {
+		t.Errorf("CalcCost() = %v", cost)
+	}
+
+	source := recorded[1][0].Source
+	if source.Type != coincount.SourcePurchase || source.ID == 0 {
+		t.Fatalf("recorded source = %+v", source)
+	}
+	postedInv, postedGL, err := coincount.DocumentPostings(ctx, store, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(postedInv) != 1 || len(postedGL) != 2 || postedGL[0].ID != recorded[1][0].ID || postedInv[0].Source != source {
+		t.Errorf("DocumentPostings(%v) = %+v, %+v", source, postedInv, postedGL)
+	}
+}
+
+func testPurchaseLines(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	purchase := coincount.Purchase{
+		Date:           date,
+		Vendor:         coincount.Coinbase,
+		PayableAccount: coincount.VisaCard,
+		Amount:         coincount.Cents(30436),
+		Items: []coincount.PurchaseItem{
+			{Item: coincount.Ether, InventoryAccount: coincount.EthCoinbase, Qty: ether(1), Amount: coincount.Cents(30000)},
+			{Kind: coincount.LineExpense, InventoryAccount: coincount.CoinbaseFee, Amount: coincount.Cents(450)},
+			{Kind: coincount.LineTax, InventoryAccount: coincount.SalesTax, Amount: coincount.Cents(36)},
+			{Kind: coincount.LineDiscount, InventoryAccount: coincount.PurchaseDiscounts, Amount: coincount.Cents(100)},
+			{Kind: coincount.LineExpense, InventoryAccount: coincount.CoinbaseFee, Amount: coincount.Cents(50)},
+		},
+	}
+
+	id, err := store.Purchases().Save(ctx, purchase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Purchases().Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != len(purchase.Items) {
+		t.Fatalf("Purchases().Get() = %d items, want %d", len(got.Items), len(purchase.Items))
+	}
+	for i, item := range got.Items {
+		want := purchase.Items[i]
+		if item.LineKind() != want.LineKind() || item.InventoryAccount.ID != want.InventoryAccount.ID || item.Amount.Cmp(want.Amount) != 0 {
+			t.Errorf("item %d = %+v, want %+v", i, item, want)
+		}
+	}
+
+	inv, gl, err := coincount.RecordPurchase(ctx, store, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv) != 1 || len(gl) != 5 {
+		t.Errorf("RecordPurchase() = %d inventory transactions and %d lines, want 1 and 5", len(inv), len(gl))
+	}
+	for _, line := range gl {
+		if line.Account.ID == coincount.CoinbaseFee.ID && line.Debit.Cmp(coincount.Cents(500)) != 0 {
+			t.Errorf("RecordPurchase() fee line = %+v, want both fees on it", line)
+		}
+	}
+}
+
+func testPayables(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	var ids []int
+	for _, cents := range []int64{1000, 2000} {
+		id, err := store.Purchases().Save(ctx, coincount.MiningPayout(date, ether(1), coincount.Cents(cents)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	payment := coincount.VendorPayment{
+		Date:           date.AddDate(0, 0, 10),
+		Vendor:         coincount.ElectricCompany,
+		PayableAccount: coincount.ElectricBill,
+		PaymentAccount: coincount.VisaCard,
+		Amount:         coincount.Cents(1500),
+		Applications: []coincount.PaymentApplication{
+			{PurchaseID: ids[0], Amount: coincount.Cents(1000)},
+			{PurchaseID: ids[1], Amount: coincount.Cents(500)},
+		},
+	}
+
+	paid, gl, err := coincount.PayVendor(ctx, store, payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gl) != 2 || gl[0].Account.ID != coincount.ElectricBill.ID || gl[0].Debit.Cmp(coincount.Cents(1500)) != 0 {
+		t.Errorf("PayVendor() entry = %+v", gl)
+	}
+
+	got, err := store.Payments().Get(ctx, paid.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PaymentAccount.Name != coincount.VisaCard.Name || len(got.Applications) != 2 || got.Applications[1].Amount.Cmp(coincount.Cents(500)) != 0 {
+		t.Errorf("Payments().Get() = %+v", got)
+	}
+
+	over := payment
+	over.Applications = []coincount.PaymentApplication{{PurchaseID: ids[1], Amount: coincount.Cents(1501)}}
+	if _, _, err = coincount.PayVendor(ctx, store, over); !errors.Is(err, coincount.ErrInvalidPayment) {
+		t.Errorf("PayVendor() applying more than is open error = %v", err)
+	}
+
+	purchases, payments, err := coincount.VendorPayables(ctx, store, coincount.ElectricCompany.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := coincount.OpenPurchases(purchases, payments)
+	if len(open) != 1 || open[0].Purchase.ID != ids[1] || open[0].Open().Cmp(coincount.Cents(1500)) != 0 {
+		t.Errorf("OpenPurchases() = %+v", open)
+	}
+
+	balances := coincount.VendorBalances(purchases, payments)
+	if len(balances) != 1 || balances[0].Balance().Cmp(coincount.Cents(1500)) != 0 {
+		t.Errorf("VendorBalances() = %+v", balances)
+	}
+
+	if err = store.Vendors().Archive(ctx, coincount.ElectricCompany.ID); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Vendors().Archive() of a paid vendor error = %v", err)
+	}
+
+	euros := coincount.NewMoney(big.NewInt(800), "EUR", coincount.CentPrecision)
+	eurID, err := store.Purchases().Save(ctx, coincount.MiningPayout(date, ether(1), euros))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dollars := payment
+	dollars.Applications = []coincount.PaymentApplication{{PurchaseID: eurID, Amount: coincount.Cents(500)}}
+	if _, _, err = coincount.PayVendor(ctx, store, dollars); !errors.Is(err, coincount.ErrInvalidPayment) {
+		t.Errorf("PayVendor() applying dollars to a purchase in euros error = %v", err)
+	}
+
+	if purchases, payments, err = coincount.VendorPayables(ctx, store, coincount.ElectricCompany.ID); err != nil {
+		t.Fatal(err)
+	}
+	balances = coincount.VendorBalances(purchases, payments)
+	if len(balances) != 2 || balances[0].Balance().Cmp(euros) != 0 || balances[1].Balance().Cmp(coincount.Cents(1500)) != 0 {
+		t.Errorf("VendorBalances() in two currencies = %+v", balances)
+	}
+	agings := coincount.AgePayables(purchases, payments, date.AddDate(0, 1, 0))
+	if len(agings) != 2 || agings[0].Balance().Cmp(euros) != 0 || agings[1].Balance().Cmp(coincount.Cents(1500)) != 0 {
+		t.Errorf("AgePayables() in two currencies = %+v", agings)
+	}
+
+	// A payment in euros posts in dollars at the rate on its date.
+	err = store.FXRates().Save(ctx, coincount.FXRate{Date: date, Base: "EUR", Quote: "USD", Rate: big.NewRat(5, 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inEuros := payment
+	inEuros.Amount = euros
+	inEuros.Applications = []coincount.PaymentApplication{{PurchaseID: eurID, Amount: euros}}
+	if _, gl, err = coincount.PayVendor(ctx, store, inEuros); err != nil {
+		t.Fatal(err)
+	}
+	if len(gl) != 2 || gl[0].Debit.Cmp(coincount.Cents(1000)) != 0 || gl[0].Foreign.Cmp(euros) != 0 ||
+		gl[1].Credit.Cmp(coincount.Cents(1000)) != 0 || gl[1].Foreign.Cmp(euros.Neg()) != 0 {
+		t.Errorf("PayVendor() in euros entry = %+v", gl)
+	}
+
+	ledger, _, err := store.GLTransactions().List(ctx, coincount.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, balance := range coincount.TrialBalance(ledger) {
+		if balance.Balance().Currency() != coincount.DefaultCurrency {
+			t.Errorf("TrialBalance() after paying in euros = %+v", balance)
+		}
+	}
+}
+
+func testReceivables(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	for _, cents := range []int64{100, 300} {
+		if _, _, err := coincount.RecordPurchase(ctx, store, coincount.MiningPayout(date, ether(1), coincount.Cents(cents))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sold := date.AddDate(0, 0, 5)
+	invoice := coincount.Invoice{
+		Date:              sold,
+		DueDate:           sold.AddDate(0, 0, 30),
+		Customer:          coincount.OTCDesk,
+		ReceivableAccount: coincount.AccountsReceivable,
+		Amount:            coincount.Cents(1000),
+		Lines: []coincount.InvoiceLine{
+			{
+				Item:             coincount.Ether,
+				Account:          coincount.RevenueEth,
+				InventoryAccount: coincount.EthMain,
+				CostAccount:      coincount.CostOfEthSold,
+				Qty:              ether(1),
+				Amount:           coincount.Cents(800),
+			},
+			{Account: coincount.ServiceRevenue, Amount: coincount.Cents(200)},
+		},
+	}
+
+	invoice, inv, gl, err := coincount.RecordInvoice(ctx, store, invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv) != 1 || inv[0].QtyOut.Cmp(ether(1)) != 0 || inv[0].Cost.Extend(ether(1), 2, coincount.RoundHalfEven).Cmp(coincount.Cents(100)) != 0 {
+		t.Errorf("RecordInvoice() inventory = %+v", inv)
+	}
+	if err = coincount.CheckBalanced(gl); err != nil || len(gl) != 5 {
+		t.Errorf("RecordInvoice() entry = %+v, %v", gl, err)
+	}
+
+	got, err := store.Invoices().Get(ctx, invoice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Customer != coincount.OTCDesk || !got.DueDate.Equal(invoice.DueDate) || len(got.Lines) != 2 ||
+		got.Lines[0].CostAccount != coincount.CostOfEthSold || got.Lines[1].LineKind() != coincount.LineService {
+		t.Errorf("Invoices().Get() = %+v", got)
+	}
+
+	second := invoice
+	second.Lines = second.Lines[:1]
+	second.Amount = coincount.Cents(800)
+	if _, _, _, err = coincount.RecordInvoice(ctx, store, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = coincount.RecordInvoice(ctx, store, second); err == nil {
+		t.Error("RecordInvoice() selling more ether than is on hand succeeded")
+	}
+
+	receipt := coincount.CustomerReceipt{
+		Date:              sold.AddDate(0, 0, 10),
+		Customer:          coincount.OTCDesk,
+		ReceivableAccount: coincount.AccountsReceivable,
+		DepositAccount:    coincount.GeminiUSD,
+		Amount:            coincount.Cents(1200),
+		Applications:      []coincount.ReceiptApplication{{InvoiceID: invoice.ID, Amount: coincount.Cents(1000)}},
+	}
+	if _, gl, err = coincount.ReceivePayment(ctx, store, receipt); err != nil {
+		t.Fatal(err)
+	}
+	if len(gl) != 2 || gl[0].Account.ID != coincount.GeminiUSD.ID || gl[0].Debit.Cmp(coincount.Cents(1200)) != 0 {
+		t.Errorf("ReceivePayment() entry = %+v", gl)
+	}
+	if _, _, err = coincount.ReceivePayment(ctx, store, receipt); !errors.Is(err, coincount.ErrInvalidReceipt) {
+		t.Errorf("ReceivePayment() applying to a settled invoice error = %v", err)
+	}
+
+	euros := receipt
+	euros.Amount = coincount.NewMoney(big.NewInt(500), "EUR", coincount.CentPrecision)
+	euros.Applications = []coincount.ReceiptApplication{{InvoiceID: invoice.ID, Amount: euros.Amount}}
+	if _, _, err = coincount.ReceivePayment(ctx, store, euros); !errors.Is(err, coincount.ErrCurrencyMismatch) {
+		t.Errorf("ReceivePayment() in euros error = %v", err)
+	}
+
+	invoices, receipts, err := coincount.CustomerReceivables(ctx, store, coincount.OTCDesk.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := coincount.OpenInvoices(invoices, receipts)
+	if len(open) != 1 || open[0].Open().Cmp(coincount.Cents(800)) != 0 {
+		t.Errorf("OpenInvoices() = %+v", open)
+	}
+
+	agings := coincount.AgeReceivables(invoices, receipts, sold.AddDate(0, 0, 70))
+	if len(agings) != 1 || agings[0].Days30.Cmp(coincount.Cents(800)) != 0 || agings[0].Balance().Cmp(coincount.Cents(600)) != 0 {
+		t.Errorf("AgeReceivables() = %+v", agings)
+	}
+
+	if err = store.Customers().Archive(ctx, coincount.OTCDesk.ID); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Customers().Archive() of an invoiced customer error = %v", err)
+	}
+	if err = store.Items().Archive(ctx, coincount.Ether.ID); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Items().Archive() of a sold item error = %v", err)
+	}
+}
+
+func testRecurring(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	payout := coincount.MiningPayout(time.Time{}, ether(1), coincount.Cents(1000))
+	templates := []coincount.RecurringTemplate{
+		{
+			Name:     "Pool payout",
+			Schedule: coincount.Schedule{Start: time.Date(2017, 1, 31, 0, 0, 0, 0, time.UTC), Every: 1, Unit: coincount.Monthly},
+			Purchase: &payout,
+		},
+		{
+			Name:     "Electricity",
+			Schedule: coincount.Schedule{Start: time.Date(2017, 2, 15, 0, 0, 0, 0, time.UTC), Every: 1, Unit: coincount.Monthly},
+			Payment: &coincount.VendorPayment{
+				Vendor:         coincount.ElectricCompany,
+				PayableAccount: coincount.ElectricBill,
+				PaymentAccount: coincount.VisaCard,
+				Amount:         coincount.Cents(1000),
+			},
+		},
+		{
+			Name: "Hosting",
+			Schedule: coincount.Schedule{
+				Start: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+				Every: 1,
+				Unit:  coincount.Monthly,
+				End:   time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+			Entry: []coincount.GLTransaction{
+				{Account: coincount.CoinbaseFee, Debit: coincount.Cents(500), Credit: coincount.Cents(0)},
+				{Account: coincount.VisaCard, Debit: coincount.Cents(0), Credit: coincount.Cents(500)},
+			},
+		},
+	}
+	for i := range templates {
+		id, err := store.Recurring().Save(ctx, templates[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates[i].ID = id
+	}
+
+	got, err := store.Recurring().Get(ctx, templates[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Pool payout" || got.Kind() != coincount.RecurringPurchase || !got.Schedule.Start.Equal(templates[0].Schedule.Start) ||
+		len(got.Purchase.Items) != 1 || got.Purchase.Items[0].Qty.Cmp(ether(1)) != 0 || got.Purchase.Amount.Cmp(coincount.Cents(1000)) != 0 {
+		t.Errorf("Recurring().Get() = %+v", got)
+	}
+
+	if _, err = store.Recurring().Save(ctx, coincount.RecurringTemplate{Name: "Empty"}); !errors.Is(err, coincount.ErrInvalidTemplate) {
+		t.Errorf("Recurring().Save() without a body error = %v", err)
+	}
+
+	through := time.Date(2017, 3, 31, 0, 0, 0, 0, time.UTC)
+	generated, err := coincount.RunRecurring(ctx, store, through, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generated) != 7 {
+		t.Errorf("RunRecurring() generated %d instances, want 7: %+v", len(generated), generated)
+	}
+
+	purchases, payments, err := coincount.VendorPayables(ctx, store, coincount.ElectricCompany.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purchases) != 3 || !purchases[1].Date.Equal(time.Date(2017, 2, 28, 0, 0, 0, 0, time.UTC)) || len(payments) != 2 {
+		t.Errorf("RunRecurring() saved purchases %+v and payments %+v", purchases, payments)
+	}
+	if len(payments) > 0 && (len(payments[0].Applications) != 1 || payments[0].Applications[0].PurchaseID != purchases[0].ID) {
+		t.Errorf("RunRecurring() applied payment %+v", payments[0])
+	}
+
+	gl, _, err := store.GLTransactions().List(ctx, coincount.ListOptions{})
+	if err != nil || len(gl) != 0 {
+		t.Errorf("RunRecurring() without posting posted %+v, %v", gl, err)
+	}
+
+	if again, err := coincount.RunRecurring(ctx, store, through, false); err != nil || len(again) != 0 {
+		t.Errorf("RunRecurring() again = %+v, %v", again, err)
+	}
+
+	posted, err := coincount.RunRecurring(ctx, store, through, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posted) != 7 {
+		t.Errorf("RunRecurring() posted %d instances, want 7", len(posted))
+	}
+	for _, instance := range posted {
+		if instance.Entry == 0 {
+			t.Errorf("RunRecurring() left %+v unposted", instance)
+		}
+	}
+
+	if again, err := coincount.RunRecurring(ctx, store, through, true); err != nil || len(again) != 0 {
+		t.Errorf("RunRecurring() posting again = %+v, %v", again, err)
+	}
+
+	if purchases, _, err = coincount.VendorPayables(ctx, store, coincount.ElectricCompany.ID); err != nil || len(purchases) != 3 {
+		t.Errorf("RunRecurring() posting again saved %d purchases, %v", len(purchases), err)
+	}
+
+	instances, err := store.Recurring().Instances(ctx, templates[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || !instances[1].Date.Equal(templates[2].Schedule.End) || !instances[1].Document.IsZero() {
+		t.Fatalf("Recurring().Instances() = %+v", instances)
+	}
+
+	entry, err := store.GLTransactions().Get(ctx, instances[1].Entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = coincount.CheckBalanced(entry); err != nil || len(entry) != 2 ||
+		entry[0].Source != coincount.RecurringSource(templates[2].ID) || !entry[0].Date.Equal(templates[2].Schedule.End) {
+		t.Errorf("posted journal entry = %+v, %v", entry, err)
+	}
+
+	if err = store.Recurring().SaveInstance(ctx, instances[0]); !errors.Is(err, coincount.ErrConflict) {
+		t.Errorf("Recurring().SaveInstance() of a recorded date error = %v", err)
+	}
+
+	// A payout generated into a closed period cannot be posted. Once the
+	// period is reopened the next run posts it rather than generating it
+	// again.
+	may := coincount.Period{Start: time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)}
+	if err = store.Periods().Save(ctx, may); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = coincount.ClosePeriod(ctx, store, may.Start); err != nil {
+		t.Fatal(err)
+	}
+
+	through = time.Date(2017, 5, 31, 0, 0, 0, 0, time.UTC)
+	if _, err = coincount.RunRecurring(ctx, store, through, true); !errors.Is(err, coincount.ErrPeriodClosed) {
+		t.Fatalf("RunRecurring() into a closed period error = %v", err)
+	}
+	if _, err = coincount.ReopenPeriod(ctx, store, may.Start); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = coincount.RunRecurring(ctx, store, through, true); err != nil {
+		t.Fatal(err)
+	}
+
+	payouts, _, err := store.Purchases().List(ctx, coincount.ListOptions{From: through, To: may.End})
+	if err != nil || len(payouts) != 1 {
+		t.Errorf("RunRecurring() saved %d payouts on %s, want 1: %v", len(payouts), through.Format("2006-01-02"), err)
+	}
+	if instances, err = store.Recurring().Instances(ctx, templates[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if last := instances[len(instances)-1]; len(payouts) == 1 && (last.Document != coincount.PurchaseSource(payouts[0].ID) || last.Entry == 0) {
+		t.Errorf("Recurring().Instances() last = %+v", last)
+	}
+}
+
+func testBudgets(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	august := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	september := august.AddDate(0, 1, 0)
+
+	budgets, err := coincount.ImportBudgets(ctx, store, strings.NewReader(fmt.Sprintf(
+		"account,period,amount\n%[1]d,2017-08,200.00\n%[1]d,2017-09,100.00\n%[2]d,2017-08,50.00\n",
+		coincount.CoinbaseFee.ID, coincount.EthTXFee.ID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 3 {
+		t.Errorf("ImportBudgets() = %+v", budgets)
+	}
+
+	if _, err = coincount.ImportBudgets(ctx, store, strings.NewReader(fmt.Sprintf(
+		"account,period,amount\n%d,2017-08,250.00\n", coincount.CoinbaseFee.ID))); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Budgets().Get(ctx, coincount.CoinbaseFee.ID, august.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Account != coincount.CoinbaseFee || !got.Period.Equal(august) || got.Amount.Cmp(coincount.Cents(25000)) != 0 {
+		t.Errorf("Budgets().Get() after importing again = %+v", got)
+	}
+
+	listed, _, err := store.Budgets().List(ctx, coincount.ListOptions{From: august, To: september})
+	if err != nil || len(listed) != 2 {
+		t.Errorf("Budgets().List() for August = %+v, %v", listed, err)
+	}
+
+	mid := coincount.Budget{Account: coincount.CoinbaseFee, Period: august.AddDate(0, 0, 14), Amount: coincount.Cents(100)}
+	if err = store.Budgets().Save(ctx, mid); !errors.Is(err, coincount.ErrInvalidBudget) {
+		t.Errorf("Budgets().Save() mid-month error = %v", err)
+	}
+	missing := coincount.Budget{Account: coincount.Account{ID: 9999}, Period: august, Amount: coincount.Cents(100)}
+	if err = store.Budgets().Save(ctx, missing); !errors.Is(err, coincount.ErrMissingReference) {
+		t.Errorf("Budgets().Save() for a missing account error = %v", err)
+	}
+
+	// An import failing on a later row saves none of it.
+	if budgets, err = coincount.ImportBudgets(ctx, store, strings.NewReader(fmt.Sprintf(
+		"account,period,amount\n%d,2017-10,75.00\n9999,2017-10,100.00\n", coincount.CoinbaseFee.ID))); !errors.Is(err, coincount.ErrMissingReference) || budgets != nil {
+		t.Errorf("ImportBudgets() with a missing account = %+v, %v", budgets, err)
+	}
+	if _, err = store.Budgets().Get(ctx, coincount.CoinbaseFee.ID, september.AddDate(0, 1, 0)); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Budgets().Get() after a failed import error = %v", err)
+	}
+
+	entries := [][]coincount.GLTransaction{
+		{
+			{ID: 1, Date: august.AddDate(0, 0, 9), Account: coincount.CoinbaseFee, Debit: coincount.Cents(30000), Memo: "JE-1"},
+			{ID: 1, Date: august.AddDate(0, 0, 9), Account: coincount.VisaCard, Credit: coincount.Cents(30000), Memo: "JE-1"},
+		},
+		{
+			{ID: 2, Date: september.AddDate(0, 0, 4), Account: coincount.EthTXFee, Debit: coincount.Cents(1000), Memo: "JE-2"},
+			{ID: 2, Date: september.AddDate(0, 0, 4), Account: coincount.VisaCard, Credit: coincount.Cents(1000), Memo: "JE-2"},
+		},
+	}
+	for _, entry := range entries {
+		if err = store.GLTransactions().Save(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines, err := coincount.BudgetReport(ctx, store, 0, august, september.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("BudgetReport() = %+v", lines)
+	}
+	if percent, ok := lines[1].VariancePercent(); lines[1].Account.ID != coincount.CoinbaseFee.ID ||
+		lines[1].Actual.Cmp(coincount.Cents(30000)) != 0 || !ok || percent != 20 {
+		t.Errorf("BudgetReport() line %+v, variance %v%%", lines[1], percent)
+	}
+
+	lines, err = coincount.BudgetReport(ctx, store, coincount.EthTXFee.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || !lines[0].Actual.IsZero() || lines[0].Variance().Cmp(coincount.Cents(-5000)) != 0 {
+		t.Errorf("BudgetReport() for %s = %+v", coincount.EthTXFee.Name, lines)
+	}
+}
+
+func testReferences(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	missing := coincount.Account{ID: 9999, Name: "Missing"}
+
+	purchase := coincount.MiningPayout(date, ether(1), coincount.Cents(100))
+	purchase.Vendor = coincount.Vendor{ID: 9999, Name: "Missing"}
+	if _, err := store.Purchases().Save(ctx, purchase); !errors.Is(err, coincount.ErrMissingReference) {
+		t.Errorf("Purchases().Save() with a missing vendor error = %v", err)
+	}
+
+	purchase = coincount.MiningPayout(date, ether(1), coincount.Cents(100))
+	purchase.Items[0].InventoryAccount = missing
+	if _, err := store.Purchases().Save(ctx, purchase); !errors.Is(err, coincount.ErrMissingReference) {
+		t.Errorf("Purchases().Save() with a missing inventory account error = %v", err)
+	}
+
+	err := store.GLTransactions().Save(ctx, []coincount.GLTransaction{
+		{ID: 1, Date: date, Account: missing, Debit: coincount.Cents(100)},
+		{ID: 1, Date: date, Account: coincount.ElectricBill, Credit: coincount.Cents(100)},
+	})
+	if !errors.Is(err, coincount.ErrMissingReference) {
+		t.Errorf("GLTransactions().Save() with a missing account error = %v", err)
+	}
+
+	_, err = store.InventoryTransactions().Save(ctx, coincount.InventoryTransaction{
+		Date:    date,
+		Account: coincount.EthMain,
+		Item:    coincount.Item{ID: 9999},
+		QtyIn:   ether(1),
+		Cost:    coincount.UnitCostOf(coincount.Cents(100)),
+	})
+	if !errors.Is(err, coincount.ErrMissingReference) {
+		t.Errorf("InventoryTransactions().Save() with a missing item error = %v", err)
+	}
+}
+
+func testAtomic(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+	date := time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+	failed := errors.New("failed")
+
+	var purchaseID int
+	err := store.Atomic(ctx, func(tx coincount.Store) error {
+		var err error
+		if purchaseID, err = tx.Purchases().Save(ctx, coincount.MiningPayout(date, ether(1), coincount.Cents(1000))); err != nil {
+			return err
+		}
+		if _, err = tx.Purchases().Get(ctx, purchaseID); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Atomic() error = %v, want the error fn returned", err)
+	}
+	if _, err = store.Purchases().Get(ctx, purchaseID); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Purchases().Get() of a purchase saved by a failed Atomic() error = %v", err)
+	}
+
+	suspense := coincount.Account{ID: 9100, Name: "Suspense"}
+	err = store.Atomic(ctx, func(tx coincount.Store) error {
+		if err := tx.Accounts().Save(ctx, coincount.GLAccounts[0]); !errors.Is(err, coincount.ErrConflict) {
+			return fmt.Errorf("saving an account twice: %v", err)
+		}
+		return tx.Accounts().Save(ctx, suspense)
+	})
+	if err != nil {
+		t.Fatalf("Atomic() after a failed write error = %v", err)
+	}
+	if got, err := store.Accounts().Get(ctx, suspense.ID); err != nil || got != suspense {
+		t.Errorf("Accounts().Get() = %+v, %v, want %+v", got, err, suspense)
+	}
+}
+
+func testJournal(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	entry := []coincount.GLTransaction{
+		{ID: 1, Date: date, Account: coincount.EthMain, Debit: coincount.Cents(1000), Memo: "JE-1"},
+		{ID: 1, Date: date, Account: coincount.ElectricBill, Credit: coincount.Cents(999), Memo: "JE-1"},
+	}
+
+	if err := store.GLTransactions().Save(ctx, entry); !errors.Is(err, coincount.ErrUnbalanced) {
+		t.Errorf("GLTransactions().Save() of an unbalanced entry error = %v", err)
+	}
+	if _, err := store.GLTransactions().Get(ctx, 1); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("GLTransactions().Get() after a refused Save() error = %v", err)
+	}
+
+	entry[1].Credit = coincount.Cents(1000)
+	if err := store.GLTransactions().Save(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GLTransactions().Save(ctx, entry); !errors.Is(err, coincount.ErrConflict) {
+		t.Errorf("GLTransactions().Save() of a duplicate entry error = %v", err)
+	}
+
+	got, err := store.GLTransactions().Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entry) {
+		t.Errorf("GLTransactions().Get() = %d lines, want %d", len(got), len(entry))
+	}
+
+	if _, err = store.InventoryTransactions().Get(ctx, 1); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("InventoryTransactions().Get() of a missing row error = %v", err)
+	}
+}
+
+func testQuantities(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	// Quantities are stored in wei whatever decimals they were parsed with.
+	whole, err := coincount.ParseQuantity("1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	half, err := coincount.ParseQuantity("0.5", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	id, err := store.InventoryTransactions().Save(ctx, coincount.InventoryTransaction{
+		Date:    date,
+		Account: coincount.EthMain,
+		Item:    coincount.Ether,
+		QtyIn:   whole,
+		QtyOut:  half,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.InventoryTransactions().Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.QtyIn.Cmp(ether(1)) != 0 || got.QtyOut.Cmp(half) != 0 {
+		t.Errorf("InventoryTransactions().Get() = %v in and %v out, want 1 and 0.5", got.QtyIn, got.QtyOut)
+	}
+
+	purchase := coincount.MiningPayout(date, whole, coincount.Cents(30000))
+	if id, err = store.Purchases().Save(ctx, purchase); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.Purchases().Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Items) != 1 || saved.Items[0].Qty.Cmp(ether(1)) != 0 {
+		t.Errorf("Purchases().Get() items = %+v, want 1 ether", saved.Items)
+	}
+}
+
+func testBooks(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	books, err := store.Books().Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if books != coincount.DefaultBooks {
+		t.Errorf("Books().Get() = %v, want %v", books, coincount.DefaultBooks)
+	}
+
+	want := coincount.Books{FunctionalCurrency: "EUR", ReportingCurrency: "USD"}
+	for i := 0; i < 2; i++ {
+		if err = store.Books().Save(ctx, want); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if books, err = store.Books().Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if books != want {
+		t.Errorf("Books().Get() = %v, want %v", books, want)
+	}
+}
+
+func testFXRates(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i, rate := range []*big.Rat{big.NewRat(11, 10), big.NewRat(6, 5)} {
+		err := store.FXRates().Save(ctx, coincount.FXRate{
+			Date:  date.AddDate(0, 0, i),
+			Base:  "EUR",
+			Quote: "USD",
+			Rate:  rate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rate, err := store.FXRates().Get(ctx, "USD", "EUR", date.AddDate(0, 0, 1).Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Base != "USD" || rate.Quote != "EUR" || rate.Rate.Cmp(big.NewRat(5, 6)) != 0 || !rate.Date.Equal(date.AddDate(0, 0, 1)) {
+		t.Errorf("FXRates().Get() = %v", rate)
+	}
+
+	if _, err = store.FXRates().Get(ctx, "EUR", "USD", date.Add(-time.Second)); !errors.Is(err, coincount.ErrNoRate) {
+		t.Errorf("FXRates().Get() before the first rate error = %v", err)
+	}
+
+	// A bill of 8 euros is carried at 8.80 dollars, then revalued at 9.60.
+	euros := coincount.NewMoney(big.NewInt(800), "EUR", coincount.CentPrecision)
+	if _, _, err = coincount.RecordPurchase(ctx, store, coincount.MiningPayout(date, ether(1), euros)); err != nil {
+		t.Fatal(err)
+	}
+
+	next := date.AddDate(0, 0, 1)
+	entry, err := coincount.RevalueAccount(ctx, store, next, coincount.ElectricBill, coincount.UnrealizedFX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry) != 2 || entry[0].Account.ID != coincount.ElectricBill.ID || entry[0].Credit.Cmp(coincount.Cents(80)) != 0 ||
+		entry[1].Account.ID != coincount.UnrealizedFX.ID || entry[1].Debit.Cmp(coincount.Cents(80)) != 0 {
+		t.Errorf("RevalueAccount() = %+v", entry)
+	}
+	if entry, err = coincount.RevalueAccount(ctx, store, next, coincount.ElectricBill, coincount.UnrealizedFX); err != nil || len(entry) != 0 {
+		t.Errorf("RevalueAccount() again at the same rate = %+v, %v", entry, err)
+	}
+
+	books := coincount.DefaultBooks
+	books.FunctionalCurrency = "EUR"
+	if err = store.Books().Save(ctx, books); !errors.Is(err, coincount.ErrInUse) {
+		t.Errorf("Books().Save() changing the functional currency of a used ledger error = %v", err)
+	}
+}
+
+func testPeriods(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	var (
+		start  = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		end    = start.AddDate(1, 0, 0)
+		date   = time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+		period = coincount.Period{Start: start, End: end}
+		sale   = []coincount.GLTransaction{
+			{ID: 1, Date: date, Account: coincount.EthMain, Debit: coincount.Cents(500), Memo: "JE-1"},
+			{ID: 1, Date: date, Account: coincount.RevenueEth, Credit: coincount.Cents(500), Memo: "JE-1"},
+		}
+	)
+
+	if err := store.Periods().Save(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	overlap := coincount.Period{Start: date, End: end.AddDate(0, 6, 0)}
+	if err := store.Periods().Save(ctx, overlap); !errors.Is(err, coincount.ErrConflict) {
+		t.Errorf("Periods().Save() of an overlapping period error = %v", err)
+	}
+	if _, err := store.Periods().Get(ctx, end); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("Periods().Get() after the last period error = %v", err)
+	}
+
+	if err := store.GLTransactions().Save(ctx, sale); err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := coincount.ClosePeriod(ctx, store, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closed.Closed() || closed.ClosingEntry == 0 {
+		t.Fatalf("ClosePeriod() = %+v", closed)
+	}
+
+	lines, err := store.GLTransactions().Get(ctx, closed.ClosingEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances := coincount.TrialBalance(lines)
+	if len(balances) != 2 ||
+		balances[0].Account.ID != coincount.RetainedEarnings.ID || balances[0].Balance().Cmp(coincount.Cents(-500)) != 0 ||
+		balances[1].Account.ID != coincount.RevenueEth.ID || balances[1].Balance().Cmp(coincount.Cents(500)) != 0 {
+		t.Errorf("closing entry = %v", lines)
+	}
+
+	if balances, err = store.Periods().Balances(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 2 || balances[0].Account != coincount.EthMain || balances[1].Account != coincount.RevenueEth {
+		t.Errorf("Periods().Balances() = %v", balances)
+	}
+
+	sale[0].ID, sale[1].ID = 100, 100
+	if err = store.GLTransactions().Save(ctx, sale); !errors.Is(err, coincount.ErrPeriodClosed) {
+		t.Errorf("GLTransactions().Save() in a closed period error = %v", err)
+	}
+	_, err = store.InventoryTransactions().Save(ctx, coincount.InventoryTransaction{
+		Date:    date,
+		Account: coincount.EthMain,
+		Item:    coincount.Ether,
+		QtyIn:   ether(1),
+		QtyOut:  ether(0),
+	})
+	if !errors.Is(err, coincount.ErrPeriodClosed) {
+		t.Errorf("InventoryTransactions().Save() in a closed period error = %v", err)
+	}
+	if _, err = coincount.ClosePeriod(ctx, store, date); !errors.Is(err, coincount.ErrPeriodClosed) {
+		t.Errorf("ClosePeriod() of a closed period error = %v", err)
+	}
+
+	if _, err = coincount.ReopenPeriod(ctx, store, date); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.GLTransactions().Save(ctx, sale); err != nil {
+		t.Errorf("GLTransactions().Save() in a reopened period error = %v", err)
+	}
+
+	periods, err := store.Periods().List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(periods) != 1 || periods[0].Closed() || !periods[0].Start.Equal(start) || !periods[0].End.Equal(end) {
+		t.Errorf("Periods().List() = %v", periods)
+	}
+}
+
+func testReversals(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	id, err := store.Purchases().Save(ctx, coincount.MiningPayout(date, ether(1), coincount.Cents(30000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	purchase, err := store.Purchases().Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, posted, err := coincount.RecordPurchase(ctx, store, purchase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, gl, err := coincount.ReverseEntry(ctx, store, posted[0].ID, date.AddDate(0, 0, 1), "wrong payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv) != 1 || inv[0].Reverses == 0 || inv[0].QtyOut.Cmp(ether(1)) != 0 {
+		t.Errorf("ReverseEntry() inventory = %+v", inv)
+	}
+
+	lines, err := store.GLTransactions().Get(ctx, gl[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		if line.Reverses != posted[0].ID || line.Memo != coincount.ReversalMemo(posted[0].ID, "wrong payout") {
+			t.Errorf("reversing line = %+v", line)
+		}
+	}
+
+	reversing, _, err := store.GLTransactions().List(ctx, coincount.ListOptions{Reverses: posted[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reversing) != len(posted) {
+		t.Errorf("GLTransactions().List() reversing %d = %d lines, want %d", posted[0].ID, len(reversing), len(posted))
+	}
+
+	all, _, err := store.GLTransactions().List(ctx, coincount.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, balance := range coincount.TrialBalance(all) {
+		if !balance.Balance().IsZero() {
+			t.Errorf("%s balance after reversal = %v", balance.Account.Name, balance.Balance())
+		}
+	}
+	if net := coincount.NetOfReversals(all); len(net) != 0 {
+		t.Errorf("NetOfReversals() = %v", net)
+	}
+
+	stock, _, err := store.InventoryTransactions().List(ctx, coincount.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stock) != 2 || len(coincount.NetInventoryOfReversals(stock)) != 0 {
+		t.Errorf("inventory after reversal = %v", stock)
+	}
+
+	if _, _, err = coincount.ReverseEntry(ctx, store, posted[0].ID, date, ""); !errors.Is(err, coincount.ErrConflict) {
+		t.Errorf("ReverseEntry() of a reversed entry error = %v", err)
+	}
+	if _, _, err = coincount.ReverseEntry(ctx, store, gl[0].ID, date, ""); !errors.Is(err, coincount.ErrConflict) {
+		t.Errorf("ReverseEntry() of a reversal error = %v", err)
+	}
+	if _, _, err = coincount.ReverseEntry(ctx, store, 100, date, ""); !errors.Is(err, coincount.ErrNotFound) {
+		t.Errorf("ReverseEntry() of a missing entry error = %v", err)
+	}
+
+	// The reposted purchase shares the first entry's memo but not its
+	// inventory.
+	again, reposted, err := coincount.RecordPurchase(ctx, store, purchase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].Entry != reposted[0].ID {
+		t.Fatalf("RecordPurchase() inventory = %+v, want it recorded with entry %d", again, reposted[0].ID)
+	}
+	if inv, _, err = coincount.ReverseEntry(ctx, store, reposted[0].ID, date.AddDate(0, 0, 1), ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(inv) != 1 || inv[0].Reverses != again[0].ID {
+		t.Errorf("ReverseEntry() of the reposted purchase inventory = %+v, want %d reversed", inv, again[0].ID)
+	}
+}
+
+func testAudit(t *testing.T, store coincount.Store) {
+	ctx := coincount.WithUser(context.Background(), "alice")
+
+	renamed := coincount.VisaCard
+	renamed.Name = "Visa"
+	if err := store.Accounts().Update(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Accounts().Archive(ctx, renamed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _, err := store.Audit().List(ctx, coincount.ListOptions{Search: "account"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seed saved every account before the update and archive.
+	if len(entries) != len(coincount.GLAccounts)+2 {
+		t.Fatalf("Audit().List() = %d entries, want %d", len(entries), len(coincount.GLAccounts)+2)
+	}
+
+	saved := entries[0]
+	if saved.Operation != "save" || saved.Entity != "account" || string(saved.Before) != "null" || saved.User != "" {
+		t.Errorf("save entry = %+v", saved)
+	}
+
+	updated, archived := entries[len(entries)-2], entries[len(entries)-1]
+	if updated.Operation != "update" || updated.User != "alice" || updated.EntityID != "1020" {
+		t.Errorf("update entry = %+v", updated)
+	}
+
+	var before, after coincount.Account
+	if err = json.Unmarshal(updated.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(updated.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Name != coincount.VisaCard.Name || after.Name != "Visa" {
+		t.Errorf("update entry before = %+v, after = %+v", before, after)
+	}
+
+	if err = json.Unmarshal(archived.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if archived.Operation != "archive" || !after.Archived {
+		t.Errorf("archive entry = %+v", archived)
+	}
+	if archived.Time.IsZero() || archived.ID <= updated.ID {
+		t.Errorf("archive entry = %+v recorded before %+v", archived, updated)
+	}
+
+	page, cursor, err := store.Audit().List(ctx, coincount.ListOptions{Descending: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != archived.ID || cursor == "" {
+		t.Errorf("Audit().List() newest = %+v, cursor %q", page, cursor)
+	}
+}
+
+func testChain(t *testing.T, store coincount.Store) {
+	ctx := context.Background()
+
+	date := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(id int, cents int64) []coincount.GLTransaction {
+		memo := fmt.Sprintf("JE-%d", id)
+		return []coincount.GLTransaction{
+			{ID: id, Date: date, Account: coincount.EthMain, Debit: coincount.Cents(cents), Memo: memo},
+			{ID: id, Date: date, Account: coincount.ElectricBill, Credit: coincount.Cents(cents), Memo: memo},
+		}
+	}
+
+	// Entries saved before the chain is enabled stay outside it.
+	if err := store.GLTransactions().Save(ctx, entry(1, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	books := coincount.DefaultBooks
+	books.HashChain = true
+	if err := store.Books().Save(ctx, books); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.GLTransactions().Save(ctx, entry(2, 200)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GLTransactions().Save(ctx, append(entry(3, 300), entry(4, 400)...)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entry IDs handed out concurrently may be saved out of order.
+	if err := store.GLTransactions().Save(ctx, entry(6, 600)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GLTransactions().Save(ctx, entry(5, 500)); err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := store.GLTransactions().Chain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 5 || links[0].Entry != 2 || links[0].Previous != "" || links[2].Previous != links[1].Hash ||
+		links[3].Entry != 6 || links[4].Entry != 5 || links[4].Previous != links[3].Hash {
+		t.Errorf("GLTransactions().Chain() = %+v", links)
+	}
+
+	if err = coincount.VerifyLedger(ctx, store); err != nil {
+		t.Errorf("VerifyLedger() error = %v", err)
+	}
+}
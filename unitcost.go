@@ -0,0 +1,148 @@
+package coincount
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrInvalidUnitCost = errors.New("Invalid Unit Cost")
+
+// UnitCost is the exact price of one whole unit of an item, such as dollars
+// per ether. It is held as a rational number so that a lot of any size, down
+// to a single wei, extends back to exactly the amount that was paid for it.
+type UnitCost struct {
+	rat      *big.Rat
+	currency string
+}
+
+// NewUnitCost returns the cost per whole unit of paying amount for qty.
+func NewUnitCost(amount Money, qty Quantity) UnitCost {
+	if qty.IsZero() {
+		return UnitCost{rat: new(big.Rat), currency: amount.currency}
+	}
+
+	rat := new(big.Rat).SetFrac(amount.bigInt(), pow10(amount.precision))
+	rat.Mul(rat, new(big.Rat).SetFrac(pow10(qty.Decimals()), qty.bigInt()))
+	return UnitCost{rat: rat, currency: amount.currency}
+}
+
+// UnitCostOf converts a per unit price to a UnitCost.
+func UnitCostOf(price Money) UnitCost {
+	return UnitCost{
+		rat:      new(big.Rat).SetFrac(price.bigInt(), pow10(price.precision)),
+		currency: price.currency,
+	}
+}
+
+func (c UnitCost) bigRat() *big.Rat {
+	if c.rat == nil {
+		return new(big.Rat)
+	}
+	return c.rat
+}
+
+func (c UnitCost) Currency() string {
+	return c.currency
+}
+
+// Rat returns a copy of the cost in major currency units per whole unit.
+func (c UnitCost) Rat() *big.Rat {
+	return new(big.Rat).Set(c.bigRat())
+}
+
+func (c UnitCost) Sign() int {
+	return c.bigRat().Sign()
+}
+
+func (c UnitCost) IsZero() bool {
+	return c.Sign() == 0
+}
+
+func (c UnitCost) Cmp(o UnitCost) int {
+	return c.bigRat().Cmp(o.bigRat())
+}
+
+// extend returns the exact cost of qty in major currency units.
+func (c UnitCost) extend(qty Quantity) *big.Rat {
+	rat := new(big.Rat).SetFrac(qty.bigInt(), pow10(qty.Decimals()))
+	return rat.Mul(rat, c.bigRat())
+}
+
+// Extend returns the cost of qty rounded to precision with mode.
+func (c UnitCost) Extend(qty Quantity, precision int, mode RoundingMode) Money {
+	return ratToMoney(c.extend(qty), c.currency, precision, mode)
+}
+
+// Money returns the cost of one whole unit rounded to precision with mode.
+func (c UnitCost) Money(precision int, mode RoundingMode) Money {
+	return ratToMoney(c.bigRat(), c.currency, precision, mode)
+}
+
+func ratToMoney(rat *big.Rat, currency string, precision int, mode RoundingMode) Money {
+	num := new(big.Int).Mul(rat.Num(), pow10(precision))
+	return Money{
+		amount:    divRound(num, rat.Denom(), mode),
+		currency:  currency,
+		precision: precision,
+	}
+}
+
+func (c UnitCost) String() string {
+	return c.bigRat().FloatString(8) + " " + c.currency
+}
+
+type unitCostJSON struct {
+	Cost     string `json:"cost"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes c as {"cost": "4387/2100", "currency": "USD"}.
+func (c UnitCost) MarshalJSON() ([]byte, error) {
+	return json.Marshal(unitCostJSON{Cost: c.bigRat().String(), Currency: c.currency})
+}
+
+func (c *UnitCost) UnmarshalJSON(data []byte) error {
+	var raw unitCostJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	rat, ok := new(big.Rat).SetString(raw.Cost)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidUnitCost, raw.Cost)
+	}
+
+	c.rat, c.currency = rat, raw.Currency
+	return nil
+}
+
+// Value stores the cost as an exact "numerator/denominator" string.
+func (c UnitCost) Value() (driver.Value, error) {
+	return c.bigRat().String(), nil
+}
+
+// Scan reads a cost written by Value. Integers are costs stored before unit
+// costs were exact and are read as cents per whole unit. The currency
+// already set on c is kept since the schema does not store it.
+func (c *UnitCost) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		c.rat = new(big.Rat)
+	case int64:
+		c.rat = big.NewRat(v, 1)
+		c.rat.Quo(c.rat, new(big.Rat).SetInt(pow10(CentPrecision)))
+	case []byte, string:
+		str := fmt.Sprintf("%s", v)
+		rat, ok := new(big.Rat).SetString(str)
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrInvalidUnitCost, str)
+		}
+		c.rat = rat
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidUnitCost, src)
+	}
+	return nil
+}
@@ -1,13 +1,117 @@
 package coincount
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"math/big"
+	"strconv"
 	"strings"
 )
 
 var weiPerEth = int64(math.Pow(10, 18))
 
+var ErrInvalidEther = errors.New("Invalid Ether Amount")
+
+// maxEtherExponent bounds scientific notation so a hostile exponent cannot
+// allocate an enormous integer.
+const maxEtherExponent = 256
+
+var etherUnits = []struct {
+	suffix   string
+	decimals int
+}{
+	{suffix: "gwei", decimals: 9},
+	{suffix: "wei", decimals: 0},
+	{suffix: "ether", decimals: EtherDecimals},
+}
+
+// ParseEther parses an amount such as "1.5", "-2e-3 ether", "21 gwei" or
+// "1000wei" into wei. Amounts without a unit are ether. Anything that is not
+// a well formed number, or that does not come to a whole number of wei, is
+// an error.
+func ParseEther(amount string) (*big.Int, error) {
+	str := strings.ToLower(strings.TrimSpace(amount))
+
+	decimals := EtherDecimals
+	for _, unit := range etherUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit.suffix))
+			decimals = unit.decimals
+			break
+		}
+	}
+
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %q %s", ErrInvalidEther, amount, reason)
+	}
+
+	neg := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	exp := 0
+	if i := strings.IndexByte(str, 'e'); i >= 0 {
+		var err error
+		exp, err = strconv.Atoi(str[i+1:])
+		if err != nil || str[i+1:] == "" || exp > maxEtherExponent || exp < -maxEtherExponent {
+			return nil, invalid("has a bad exponent")
+		}
+		str = str[:i]
+	}
+
+	whole, frac := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		whole, frac = str[:i], str[i+1:]
+	}
+
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, invalid("is not a number")
+	}
+
+	wei, _ := new(big.Int).SetString("0"+whole+frac, 10)
+	scale := decimals + exp - len(frac)
+	if scale >= 0 {
+		wei.Mul(wei, pow10(scale))
+	} else {
+		var rem big.Int
+		wei.QuoRem(wei, pow10(-scale), &rem)
+		if rem.Sign() != 0 {
+			return nil, invalid("is smaller than one wei")
+		}
+	}
+
+	if neg {
+		wei.Neg(wei)
+	}
+	return wei, nil
+}
+
+// FormatWei formats wei as ether with exactly precision decimal places,
+// rounding half to even when precision is less than 18.
+func FormatWei(wei *big.Int, precision int) string {
+	if precision < 0 {
+		precision = 0
+	}
+
+	value := new(big.Int).Set(wei)
+	switch {
+	case precision < EtherDecimals:
+		value = divRound(value, pow10(EtherDecimals-precision), RoundHalfEven)
+	case precision > EtherDecimals:
+		value.Mul(value, pow10(precision-EtherDecimals))
+	}
+
+	return formatDecimal(value, precision)
+}
+
+// Deprecated: ParseEtherFloatToWei silently truncates and ignores invalid
+// input. Use ParseEther.
 func ParseEtherFloatToWei(amount string) *big.Int {
 	parts := strings.Split(amount, ".")
 	weiStr := "0"
@@ -39,55 +143,3 @@ func padRight(str, pad string, length int) string {
 		}
 	}
 }
-
-func multiplyRoundUp(wei *big.Int, costInCents int64) int64 {
-	var remainder big.Int
-	centPrecision := big.NewInt(1000)
-
-	amount := big.NewInt(costInCents)
-	amount.Mul(amount, centPrecision).
-		Mul(amount, wei).
-		Div(amount, big.NewInt(weiPerEth))
-	remainder.Mod(amount, centPrecision)
-
-	amt := amount.Div(amount, centPrecision).Int64()
-	if remainder.Int64() > 1 {
-		amt++
-	}
-
-	return amt
-}
-
-func multiplyTruncate(wei *big.Int, costInCents int64) int64 {
-	amount := big.NewInt(costInCents)
-	amount.Mul(amount, wei).
-		Div(amount, big.NewInt(weiPerEth))
-
-	return amount.Int64()
-}
-
-func divideRound(costInCents int64, wei *big.Int) int64 {
-	var remainder big.Int
-	centPrecision := big.NewInt(1000)
-
-	amount := big.NewInt(costInCents)
-	amount.Mul(amount, centPrecision).
-		Mul(amount, big.NewInt(weiPerEth)).
-		Div(amount, wei)
-	remainder.Mod(amount, centPrecision)
-
-	amt := amount.Div(amount, centPrecision).Int64()
-	if remainder.Int64() > 1 {
-		amt++
-	}
-
-	return amt
-}
-
-func divideTruncate(costInCents int64, wei *big.Int) int64 {
-	amount := big.NewInt(costInCents)
-	amount.Mul(amount, big.NewInt(weiPerEth)).
-		Div(amount, wei)
-
-	return amount.Int64()
-}
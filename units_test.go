@@ -84,3 +84,77 @@ func Test_ParseEtherFloatToWei(t *testing.T) {
 		})
 	}
 }
+
+func TestParseEther(t *testing.T) {
+	bigInt := func(str string) *big.Int {
+		i, _ := new(big.Int).SetString(str, 10)
+		return i
+	}
+	tests := []struct {
+		name    string
+		amount  string
+		want    *big.Int
+		wantErr bool
+	}{
+		{name: "ether", amount: "1.5", want: bigInt("1500000000000000000")},
+		{name: "ether suffix", amount: "2 ether", want: bigInt("2000000000000000000")},
+		{name: "gwei", amount: "21 gwei", want: bigInt("21000000000")},
+		{name: "fractional gwei", amount: "0.5gwei", want: bigInt("500000000")},
+		{name: "wei", amount: "1000wei", want: bigInt("1000")},
+		{name: "upper case unit", amount: "3 GWEI", want: bigInt("3000000000")},
+		{name: "negative", amount: "-0.25", want: bigInt("-250000000000000000")},
+		{name: "explicit plus", amount: "+1", want: bigInt("1000000000000000000")},
+		{name: "scientific", amount: "1.5e-3", want: bigInt("1500000000000000")},
+		{name: "scientific positive exponent", amount: "2E+2 wei", want: bigInt("200")},
+		{name: "smallest", amount: "1e-18", want: bigInt("1")},
+		{name: "fraction only", amount: ".999999999999999999", want: bigInt("999999999999999999")},
+		{name: "below one wei", amount: "0.0000000000000000001", wantErr: true},
+		{name: "fractional wei", amount: "1.5 wei", wantErr: true},
+		{name: "empty", amount: "", wantErr: true},
+		{name: "unit only", amount: "gwei", wantErr: true},
+		{name: "letters", amount: "abc", wantErr: true},
+		{name: "double sign", amount: "--1", wantErr: true},
+		{name: "two points", amount: "1.2.3", wantErr: true},
+		{name: "missing exponent", amount: "1e", wantErr: true},
+		{name: "huge exponent", amount: "1e100000", wantErr: true},
+		{name: "unknown unit", amount: "1 finney", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEther(tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEther() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Cmp(tt.want) != 0 {
+				t.Errorf("ParseEther() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatWei(t *testing.T) {
+	type args struct {
+		wei       *big.Int
+		precision int
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{name: "full precision", args: args{wei: big.NewInt(1), precision: 18}, want: "0.000000000000000001"},
+		{name: "report precision", args: args{wei: big.NewInt(1234567890000000000), precision: 4}, want: "1.2346"},
+		{name: "half even", args: args{wei: big.NewInt(125000000000000000), precision: 2}, want: "0.12"},
+		{name: "whole ether", args: args{wei: big.NewInt(2500000000000000000), precision: 0}, want: "2"},
+		{name: "negative", args: args{wei: big.NewInt(-1500000000000000000), precision: 2}, want: "-1.50"},
+		{name: "extra precision", args: args{wei: big.NewInt(1), precision: 20}, want: "0.00000000000000000100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatWei(tt.args.wei, tt.args.precision); got != tt.want {
+				t.Errorf("FormatWei() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package coincount
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidAccount  = errors.New("Invalid Account")
+	ErrInvalidPurchase = errors.New("Invalid Purchase")
+)
+
+// The chart of accounts numbers accounts with four digits. Assets,
+// liabilities and equity come first; revenue and expense accounts, which
+// close to retained earnings, are numbered from FirstTemporaryAccount up.
+const (
+	FirstAccount          = 1000
+	FirstTemporaryAccount = 4000
+	LastAccount           = 9999
+)
+
+// FieldError describes what is wrong with one field.
+type FieldError struct {
+	// Field is the path to the field, such as "items[1].qty".
+	Field   string
+	Problem string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Problem
+}
+
+// ValidationError collects every field error found in a record. It wraps
+// Err, such as ErrInvalidPurchase, for errors.Is.
+type ValidationError struct {
+	Err    error
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		problems[i] = field.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Problem: fmt.Sprintf(format, args...)})
+}
+
+// err returns e, or nil when no field errors were added.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidAccount listing
+// every field of a that cannot be saved. IDs outside the chart's numbering
+// would be closed, or not, to retained earnings by accident.
+func (a Account) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidAccount}
+
+	if a.ID < FirstAccount || a.ID > LastAccount {
+		invalid.add("id", "%d is not between %d and %d", a.ID, FirstAccount, LastAccount)
+	}
+	if strings.TrimSpace(a.Name) == "" {
+		invalid.add("name", "is missing")
+	}
+
+	return invalid.err()
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidPurchase listing
+// every field of p that cannot be saved or posted. Whether the vendor and
+// accounts exist is left to the store.
+func (p Purchase) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidPurchase}
+
+	if p.Date.IsZero() {
+		invalid.add("date", "is missing")
+	}
+	if p.Vendor.ID <= 0 {
+		invalid.add("vendor", "is missing")
+	}
+	if p.PayableAccount.ID <= 0 {
+		invalid.add("payable_account", "is missing")
+	}
+	if len(p.Items) == 0 {
+		invalid.add("items", "are missing")
+	}
+
+	currency := p.Amount.Currency()
+	total, matched := p.Amount.zero(), true
+	for i, item := range p.Items {
+		var itemInvalid *ValidationError
+		if errors.As(item.Validate(), &itemInvalid) {
+			for _, field := range itemInvalid.Fields {
+				invalid.add(fmt.Sprintf("items[%d].%s", i, field.Field), "%s", field.Problem)
+			}
+		}
+
+		if itemCurrency := item.Amount.Currency(); itemCurrency != "" && currency != "" && itemCurrency != currency {
+			invalid.add(fmt.Sprintf("items[%d].amount", i), "is in %s, not %s", itemCurrency, currency)
+			matched = false
+			continue
+		}
+		total = total.Add(ledgerAmount(item.signedAmount()))
+	}
+
+	if matched && len(p.Items) > 0 && total.Cmp(ledgerAmount(p.Amount)) != 0 {
+		invalid.add("amount", "%v does not match the items' total of %v", ledgerAmount(p.Amount), total)
+	}
+
+	return invalid.err()
+}
+
+// Validate returns a *ValidationError wrapping ErrInvalidPurchase listing
+// every field of i that cannot be posted. Only inventory lines need an item
+// and quantity.
+func (i PurchaseItem) Validate() error {
+	invalid := &ValidationError{Err: ErrInvalidPurchase}
+
+	kind := i.LineKind()
+	switch kind {
+	case LineInventory, LineExpense, LineTax:
+	case LineDiscount:
+		if i.Amount.Sign() < 0 {
+			invalid.add("amount", "is negative")
+		}
+	default:
+		invalid.add("kind", "%q is unknown", i.Kind)
+	}
+
+	if kind == LineInventory && i.Item.ID <= 0 {
+		invalid.add("item", "is missing")
+	}
+	if i.InventoryAccount.ID <= 0 {
+		invalid.add("inventory_account", "is missing")
+	}
+	if kind == LineInventory && i.Qty.IsZero() {
+		invalid.add("qty", "is missing")
+	}
+
+	return invalid.err()
+}
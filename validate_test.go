@@ -0,0 +1,115 @@
+package coincount
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPurchaseValidate(t *testing.T) {
+	valid := MiningPayout(time.Unix(0, 0), ether("1"), Cents(100))
+
+	tests := []struct {
+		name   string
+		modify func(p *Purchase)
+		want   []string
+	}{
+		{name: "valid", modify: func(p *Purchase) {}},
+		{
+			name:   "empty",
+			modify: func(p *Purchase) { *p = Purchase{} },
+			want:   []string{"date", "vendor", "payable_account", "items"},
+		},
+		{
+			name: "two lines on one account",
+			modify: func(p *Purchase) {
+				p.Items = append(p.Items, p.Items[0])
+				p.Amount = Cents(200)
+			},
+		},
+		{
+			name:   "amount off",
+			modify: func(p *Purchase) { p.Amount = Cents(101) },
+			want:   []string{"amount"},
+		},
+		{
+			name: "bad item",
+			modify: func(p *Purchase) {
+				p.Items = append(p.Items, PurchaseItem{Amount: Cents(0)})
+			},
+			want: []string{"items[1].item", "items[1].inventory_account", "items[1].qty"},
+		},
+		{
+			name: "item currency",
+			modify: func(p *Purchase) {
+				p.Items[0].Amount = euros(100)
+			},
+			want: []string{"items[0].amount"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purchase := valid
+			purchase.Items = append([]PurchaseItem(nil), valid.Items...)
+			tt.modify(&purchase)
+
+			err := purchase.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidPurchase) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			var fields []string
+			for _, field := range invalid.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccountValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		acct Account
+		want []string
+	}{
+		{name: "valid", acct: ElectricBill},
+		{name: "last", acct: Account{ID: LastAccount, Name: "Suspense"}},
+		{name: "below the chart", acct: Account{ID: 999, Name: "Cash"}, want: []string{"id"}},
+		{name: "above the chart", acct: Account{ID: 10000, Name: "Fees"}, want: []string{"id"}},
+		{name: "empty", want: []string{"id", "name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.acct.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidAccount) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			var fields []string
+			for _, field := range invalid.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}